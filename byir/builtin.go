@@ -10,15 +10,28 @@ import (
 
 type builtins struct {
 	append,
+	dbgDeclare,
+	dbgValue,
 	exit,
+	longjmp,
 	malloc,
 	memcpy,
+	panic,
 	printf,
+	runDefers,
+	setjmp,
 	strncmp,
 	trap,
 	write *ir.Func
+
+	panicArg,
+	panicJmpBuf,
+	panicMsg,
+	panicking *ir.Global
 }
 
+var irStringType = irtypes.NewStruct(irtypes.I8Ptr, irtypes.I64)
+
 func (b *builtins) Exit(t *translator) *ir.Func {
 	if b.exit == nil {
 		b.exit = t.m.NewFunc("_exit",
@@ -181,6 +194,167 @@ func (b *builtins) Append(t *translator) *ir.Func {
 	return b.append
 }
 
+func (b *builtins) DbgDeclare(t *translator) *ir.Func {
+	if b.dbgDeclare == nil {
+		b.dbgDeclare = t.m.NewFunc("llvm.dbg.declare",
+			irtypes.Void,
+			ir.NewParam("addr", irtypes.Metadata),
+			ir.NewParam("var", irtypes.Metadata),
+			ir.NewParam("expr", irtypes.Metadata),
+		)
+	}
+	return b.dbgDeclare
+}
+
+func (b *builtins) DbgValue(t *translator) *ir.Func {
+	if b.dbgValue == nil {
+		b.dbgValue = t.m.NewFunc("llvm.dbg.value",
+			irtypes.Void,
+			ir.NewParam("value", irtypes.Metadata),
+			ir.NewParam("var", irtypes.Metadata),
+			ir.NewParam("expr", irtypes.Metadata),
+		)
+	}
+	return b.dbgValue
+}
+
+func (b *builtins) Setjmp(t *translator) *ir.Func {
+	if b.setjmp == nil {
+		b.setjmp = t.m.NewFunc("_setjmp",
+			irtypes.I32,
+			ir.NewParam("env", irtypes.I8Ptr),
+		)
+		b.setjmp.FuncAttrs = append(b.setjmp.FuncAttrs, irenum.FuncAttrReturnsTwice)
+	}
+	return b.setjmp
+}
+
+func (b *builtins) Longjmp(t *translator) *ir.Func {
+	if b.longjmp == nil {
+		b.longjmp = t.m.NewFunc("_longjmp",
+			irtypes.Void,
+			ir.NewParam("env", irtypes.I8Ptr),
+			ir.NewParam("val", irtypes.I32),
+		)
+		b.longjmp.FuncAttrs = append(b.longjmp.FuncAttrs, irenum.FuncAttrNoReturn)
+	}
+	return b.longjmp
+}
+
+// PanicJmpBuf is the jmp_buf of the innermost frame with defers, or null.
+func (b *builtins) PanicJmpBuf(t *translator) *ir.Global {
+	if b.panicJmpBuf == nil {
+		b.panicJmpBuf = t.m.NewGlobalDef("$panic_jmpbuf", irconstant.NewNull(irtypes.I8Ptr))
+		b.panicJmpBuf.Linkage = irenum.LinkagePrivate
+	}
+	return b.panicJmpBuf
+}
+
+// Panicking is set by panic() and cleared by recover().
+func (b *builtins) Panicking(t *translator) *ir.Global {
+	if b.panicking == nil {
+		b.panicking = t.m.NewGlobalDef("$panicking", irconstant.False)
+		b.panicking.Linkage = irenum.LinkagePrivate
+	}
+	return b.panicking
+}
+
+// PanicArg is the interface{} value given to panic().
+func (b *builtins) PanicArg(t *translator) *ir.Global {
+	if b.panicArg == nil {
+		irIfaceType := irtypes.NewStruct(irtypes.I8Ptr, irtypes.I8Ptr)
+		b.panicArg = t.m.NewGlobalDef("$panic_arg", irconstant.NewZeroInitializer(irIfaceType))
+		b.panicArg.Linkage = irenum.LinkagePrivate
+	}
+	return b.panicArg
+}
+
+// PanicMsg is the message printed if the panic is not recovered. It is only
+// known when panic() is given a string.
+func (b *builtins) PanicMsg(t *translator) *ir.Global {
+	if b.panicMsg == nil {
+		b.panicMsg = t.m.NewGlobalDef("$panic_msg", irconstant.NewZeroInitializer(irStringType))
+		b.panicMsg.Linkage = irenum.LinkagePrivate
+	}
+	return b.panicMsg
+}
+
+// Panic unwinds to the innermost frame with defers, or if there are none,
+// prints the panic message and exits.
+func (b *builtins) Panic(t *translator) *ir.Func {
+	if b.panic == nil {
+		b.panic = t.m.NewFunc("$panic", irtypes.Void)
+		b.panic.Linkage = irenum.LinkagePrivate
+		b.panic.FuncAttrs = append(b.panic.FuncAttrs, irenum.FuncAttrNoReturn)
+
+		entry := b.panic.NewBlock("entry")
+		doUnwind := b.panic.NewBlock("doUnwind")
+		doExit := b.panic.NewBlock("doExit")
+
+		entry.NewStore(irconstant.True, b.Panicking(t))
+		irJmpBuf := entry.NewLoad(b.PanicJmpBuf(t))
+		irNoFrames := entry.NewICmp(
+			irenum.IPredEQ,
+			entry.NewPtrToInt(irJmpBuf, irtypes.I64),
+			irconstant.NewInt(irtypes.I64, 0),
+		)
+		entry.NewCondBr(irNoFrames, doExit, doUnwind)
+
+		doUnwind.NewCall(b.Longjmp(t), irJmpBuf, irconstant.NewInt(irtypes.I32, 1))
+		doUnwind.NewUnreachable()
+
+		irMsg := doExit.NewLoad(b.PanicMsg(t))
+		irMsgPtr := doExit.NewExtractValue(irMsg, 0)
+		irMsgLen := doExit.NewTrunc(doExit.NewExtractValue(irMsg, 1), irtypes.I32)
+		doExit.NewCall(
+			b.Printf(t),
+			irconstant.NewInt(irtypes.I32, 2),
+			t.constantString(doExit, "panic: %.*s\n"),
+			irMsgLen, irMsgPtr,
+		)
+		doExit.NewCall(b.Exit(t), irconstant.NewInt(irtypes.I32, 2))
+		doExit.NewUnreachable()
+	}
+	return b.panic
+}
+
+// RunDefers pops and calls each record of a defer list in turn. Records are
+// popped before being called, so that if a call panics the unwinding frame
+// carries on from the next one.
+func (b *builtins) RunDefers(t *translator) *ir.Func {
+	if b.runDefers == nil {
+		irHead := ir.NewParam("head", irtypes.NewPointer(irtypes.I8Ptr))
+		b.runDefers = t.m.NewFunc("$rundefers", irtypes.Void, irHead)
+		b.runDefers.Linkage = irenum.LinkagePrivate
+
+		entry := b.runDefers.NewBlock("entry")
+		loop := b.runDefers.NewBlock("loop")
+		doCall := b.runDefers.NewBlock("doCall")
+		done := b.runDefers.NewBlock("done")
+
+		entry.NewBr(loop)
+
+		irRecord := irLoadVolatile(loop, irHead)
+		irIsEnd := loop.NewICmp(
+			irenum.IPredEQ,
+			loop.NewPtrToInt(irRecord, irtypes.I64),
+			irconstant.NewInt(irtypes.I64, 0),
+		)
+		loop.NewCondBr(irIsEnd, done, doCall)
+
+		irRecordPtr := doCall.NewBitCast(irRecord, irtypes.NewPointer(irDeferRecordType))
+		irRecordValue := doCall.NewLoad(irRecordPtr)
+		irStoreVolatile(doCall, doCall.NewExtractValue(irRecordValue, 0), irHead)
+		irThunk := doCall.NewExtractValue(irRecordValue, 1)
+		irEnv := doCall.NewExtractValue(irRecordValue, 2)
+		doCall.NewCall(irThunk, irEnv)
+		doCall.NewBr(loop)
+
+		done.NewRet(nil)
+	}
+	return b.runDefers
+}
+
 func makeStruct(irBlock *ir.Block, values ...irvalue.Value) (ret irvalue.Value) {
 	var types []irtypes.Type
 	for _, v := range values {
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"go/token"
+	gotypes "go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"golang.org/x/tools/go/ssa"
+
+	ir "github.com/llir/llvm/ir"
+	irconstant "github.com/llir/llvm/ir/constant"
+	irenum "github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/metadata"
+	irtypes "github.com/llir/llvm/ir/types"
+	irvalue "github.com/llir/llvm/ir/value"
+)
+
+// debugInfo holds the DWARF metadata emitted when translating with debug
+// info enabled (see the debug subcommand). Functions get a DISubprogram,
+// instructions a DILocation taken from the ssa position they were lowered
+// from, and ssa.DebugRef instructions become llvm.dbg.value/declare calls.
+type debugInfo struct {
+	fset *token.FileSet
+	m    *ir.Module
+
+	cu          *metadata.DICompileUnit
+	files       map[string]*metadata.DIFile
+	subprograms map[*ir.Func]*metadata.DISubprogram
+	variables   map[debugVarKey]*metadata.DILocalVariable
+	declared    map[debugVarKey]bool
+	types       map[gotypes.Type]metadata.Field
+	expr        *metadata.DIExpression
+}
+
+func newDebugInfo(fset *token.FileSet, m *ir.Module) *debugInfo {
+	d := &debugInfo{
+		fset:        fset,
+		m:           m,
+		files:       map[string]*metadata.DIFile{},
+		subprograms: map[*ir.Func]*metadata.DISubprogram{},
+		variables:   map[debugVarKey]*metadata.DILocalVariable{},
+		declared:    map[debugVarKey]bool{},
+		types:       map[gotypes.Type]metadata.Field{},
+	}
+
+	cwd, _ := os.Getwd()
+	d.cu = &metadata.DICompileUnit{
+		Distinct:     true,
+		Language:     irenum.DwarfLangGo,
+		File:         d.def(&metadata.DIFile{Filename: "<go2ll>", Directory: cwd}).(*metadata.DIFile),
+		Producer:     "go2ll",
+		EmissionKind: irenum.EmissionKindFullDebug,
+	}
+	d.def(d.cu)
+	d.expr = d.def(&metadata.DIExpression{}).(*metadata.DIExpression)
+
+	if m.NamedMetadataDefs == nil {
+		m.NamedMetadataDefs = map[string]*metadata.NamedDef{}
+	}
+	m.NamedMetadataDefs["llvm.dbg.cu"] = &metadata.NamedDef{
+		Name:  "llvm.dbg.cu",
+		Nodes: []metadata.Node{d.cu},
+	}
+	m.NamedMetadataDefs["llvm.module.flags"] = &metadata.NamedDef{
+		Name: "llvm.module.flags",
+		Nodes: []metadata.Node{
+			d.moduleFlag("Dwarf Version", 4),
+			d.moduleFlag("Debug Info Version", 3),
+		},
+	}
+	return d
+}
+
+// def assigns the next metadata ID to md and adds it to the module.
+func (d *debugInfo) def(md metadata.Definition) metadata.Definition {
+	md.SetID(int64(len(d.m.MetadataDefs)))
+	d.m.MetadataDefs = append(d.m.MetadataDefs, md)
+	return md
+}
+
+func (d *debugInfo) moduleFlag(name string, value int64) metadata.Node {
+	const behaviorWarning = 2
+	return d.def(&metadata.Tuple{
+		Fields: []metadata.Field{
+			&metadata.Value{Value: irconstant.NewInt(irtypes.I32, behaviorWarning)},
+			&metadata.String{Value: name},
+			&metadata.Value{Value: irconstant.NewInt(irtypes.I32, value)},
+		},
+	})
+}
+
+func (d *debugInfo) file(filename string) *metadata.DIFile {
+	diFile, ok := d.files[filename]
+	if !ok {
+		dir, base := filepath.Split(filename)
+		diFile = d.def(&metadata.DIFile{
+			Filename:  base,
+			Directory: filepath.Clean(dir),
+		}).(*metadata.DIFile)
+		d.files[filename] = diFile
+	}
+	return diFile
+}
+
+// emitSubprogram describes f, which has been lowered to irFunc.
+func (d *debugInfo) emitSubprogram(irFunc *ir.Func, f *ssa.Function) {
+	p := d.fset.Position(f.Pos())
+	if !p.IsValid() {
+		return // Synthetic; wrappers, init, etc.
+	}
+
+	var diTypes []metadata.Field
+	goResults := f.Signature.Results()
+	if goResults.Len() == 1 {
+		diTypes = append(diTypes, d.typ(goResults.At(0).Type()))
+	} else {
+		diTypes = append(diTypes, nil) // void, or a tuple.
+	}
+	for _, goParam := range f.Params {
+		diTypes = append(diTypes, d.typ(goParam.Type()))
+	}
+
+	diFile := d.file(p.Filename)
+	sp := d.def(&metadata.DISubprogram{
+		Distinct:    true,
+		Name:        f.Name(),
+		LinkageName: f.String(),
+		Scope:       diFile,
+		File:        diFile,
+		Line:        int64(p.Line),
+		Type: d.def(&metadata.DISubroutineType{
+			Types: d.def(&metadata.Tuple{Fields: diTypes}).(*metadata.Tuple),
+		}).(*metadata.DISubroutineType),
+		IsDefinition: true,
+		ScopeLine:    int64(p.Line),
+		Unit:         d.cu,
+	}).(*metadata.DISubprogram)
+
+	irFunc.Metadata = append(irFunc.Metadata, &metadata.Attachment{Name: "dbg", Node: sp})
+	d.subprograms[irFunc] = sp
+}
+
+func (d *debugInfo) location(irFunc *ir.Func, pos token.Pos) *metadata.DILocation {
+	sp := d.subprograms[irFunc]
+	if sp == nil {
+		return nil
+	}
+
+	line, col := sp.ScopeLine, int64(0)
+	if p := d.fset.Position(pos); p.IsValid() {
+		line, col = int64(p.Line), int64(p.Column)
+	}
+	return d.def(&metadata.DILocation{
+		Line:   line,
+		Column: col,
+		Scope:  sp,
+	}).(*metadata.DILocation)
+}
+
+// attachLocations gives each of irInsts which has no location yet the
+// location of pos.
+func (d *debugInfo) attachLocations(irFunc *ir.Func, pos token.Pos, irInsts ...interface{}) {
+	var loc *metadata.DILocation
+	for _, irInst := range irInsts {
+		if irInst == nil || hasDebugLoc(irInst) {
+			continue
+		}
+		if loc == nil {
+			loc = d.location(irFunc, pos)
+			if loc == nil {
+				return
+			}
+		}
+		setDebugLoc(irInst, loc)
+	}
+}
+
+// finishFunction gives the instructions of irFunc which were not lowered
+// from an ssa instruction (e.g. the defer frame setup) the location of the
+// start of the function. LLVM insists on a location for calls within a
+// function which has debug info.
+func (d *debugInfo) finishFunction(irFunc *ir.Func) {
+	if d.subprograms[irFunc] == nil {
+		return
+	}
+	for _, irBlock := range irFunc.Blocks {
+		for _, irInst := range irBlock.Insts {
+			d.attachLocations(irFunc, token.NoPos, irInst)
+		}
+		d.attachLocations(irFunc, token.NoPos, irBlock.Term)
+	}
+}
+
+// debugVarKey identifies a local variable within one function. A
+// variable captured by a closure is seen from the closure too, which
+// needs its own DILocalVariable scoped to its own DISubprogram.
+type debugVarKey struct {
+	irFunc *ir.Func
+	goVar  gotypes.Object
+}
+
+// variable describes the local variable goVar, declared in irFunc.
+func (d *debugInfo) variable(irFunc *ir.Func, goVar *gotypes.Var, f *ssa.Function) *metadata.DILocalVariable {
+	key := debugVarKey{irFunc, goVar}
+	diVar, ok := d.variables[key]
+	if ok {
+		return diVar
+	}
+
+	sp := d.subprograms[irFunc]
+	p := d.fset.Position(goVar.Pos())
+	diVar = &metadata.DILocalVariable{
+		Name:  goVar.Name(),
+		Scope: sp,
+		File:  d.file(p.Filename),
+		Line:  int64(p.Line),
+		Type:  d.typ(goVar.Type()),
+	}
+	for i, goParam := range f.Params {
+		if goParam.Object() == goVar {
+			diVar.Arg = int64(i + 1)
+		}
+	}
+	d.def(diVar)
+	d.variables[key] = diVar
+	return diVar
+}
+
+// typ describes goType. Only the shapes gdb needs to print values are
+// modelled: basic types, pointers and structs (which covers strings,
+// slices and interfaces, given their lowering in goToIRType).
+func (d *debugInfo) typ(goType gotypes.Type) metadata.Field {
+	diType, ok := d.types[goType]
+	if ok {
+		return diType
+	}
+
+	name := goType.String()
+	size := uint64(sizeof(goType) * 8)
+
+	switch u := goType.Underlying().(type) {
+	case *gotypes.Basic:
+		switch {
+		case isString(u):
+			diType = d.structType(name, size,
+				d.member("ptr", d.pointerType("*uint8", d.typ(gotypes.Typ[gotypes.Uint8])), 0),
+				d.member("len", d.typ(gotypes.Typ[gotypes.Int]), 64),
+			)
+		default:
+			diType = d.def(&metadata.DIBasicType{
+				Tag:      irenum.DwarfTagBaseType,
+				Name:     name,
+				Size:     size,
+				Encoding: basicEncoding(u),
+			})
+		}
+
+	case *gotypes.Pointer:
+		// Placeholder first; pointers are how types refer to themselves.
+		diPtr := &metadata.DIDerivedType{
+			Tag:  irenum.DwarfTagPointerType,
+			Name: name,
+			Size: 64,
+		}
+		d.def(diPtr)
+		d.types[goType] = diPtr
+		diPtr.BaseType = d.typ(u.Elem())
+		return diPtr
+
+	case *gotypes.Slice:
+		// Registered before the element, which may be goType again.
+		diStruct := d.structPlaceholder(goType, name, size)
+		diElemPtr := d.pointerType("*"+u.Elem().String(), d.typ(u.Elem()))
+		diInt := d.typ(gotypes.Typ[gotypes.Int])
+		d.setMembers(diStruct,
+			d.member("array", diElemPtr, 0),
+			d.member("len", diInt, 64),
+			d.member("cap", diInt, 128),
+		)
+		return diStruct
+
+	case *gotypes.Struct:
+		// Registered before the fields, type T struct{ kids []T }.
+		diStruct := d.structPlaceholder(goType, name, size)
+		goFields := make([]*gotypes.Var, u.NumFields())
+		for i := range goFields {
+			goFields[i] = u.Field(i)
+		}
+		offsets := gotypes.SizesFor("gc", "amd64").Offsetsof(goFields)
+
+		var diMembers []metadata.Field
+		for i, goField := range goFields {
+			diMembers = append(diMembers,
+				d.member(goField.Name(), d.typ(goField.Type()), uint64(offsets[i]*8)))
+		}
+		d.setMembers(diStruct, diMembers...)
+		return diStruct
+
+	default:
+		// Opaque, but at least the right size.
+		diType = d.def(&metadata.DIBasicType{
+			Tag:      irenum.DwarfTagBaseType,
+			Name:     name,
+			Size:     size,
+			Encoding: irenum.DwarfAttEncodingUnsigned,
+		})
+	}
+
+	d.types[goType] = diType
+	return diType
+}
+
+func (d *debugInfo) pointerType(name string, diElem metadata.Field) metadata.Field {
+	return d.def(&metadata.DIDerivedType{
+		Tag:      irenum.DwarfTagPointerType,
+		Name:     name,
+		BaseType: diElem,
+		Size:     64,
+	})
+}
+
+func (d *debugInfo) member(name string, diType metadata.Field, offset uint64) metadata.Field {
+	return d.def(&metadata.DIDerivedType{
+		Tag:      irenum.DwarfTagMember,
+		Name:     name,
+		BaseType: diType,
+		Offset:   offset,
+	})
+}
+
+func (d *debugInfo) structType(name string, size uint64, diMembers ...metadata.Field) metadata.Field {
+	return d.def(&metadata.DICompositeType{
+		Tag:      irenum.DwarfTagStructureType,
+		Name:     name,
+		Size:     size,
+		Elements: d.def(&metadata.Tuple{Fields: diMembers}).(*metadata.Tuple),
+	})
+}
+
+// structPlaceholder is the struct type of goType without its members yet,
+// already found by typ, so members can refer back to it.
+func (d *debugInfo) structPlaceholder(goType gotypes.Type, name string, size uint64) *metadata.DICompositeType {
+	diStruct := &metadata.DICompositeType{
+		Tag:  irenum.DwarfTagStructureType,
+		Name: name,
+		Size: size,
+	}
+	d.def(diStruct)
+	d.types[goType] = diStruct
+	return diStruct
+}
+
+func (d *debugInfo) setMembers(diStruct *metadata.DICompositeType, diMembers ...metadata.Field) {
+	diStruct.Elements = d.def(&metadata.Tuple{Fields: diMembers}).(*metadata.Tuple)
+}
+
+func basicEncoding(goType *gotypes.Basic) irenum.DwarfAttEncoding {
+	switch {
+	case isBool(goType):
+		return irenum.DwarfAttEncodingBoolean
+	case isFloat(goType):
+		return irenum.DwarfAttEncodingFloat
+	case isInteger(goType) && isSigned(goType):
+		return irenum.DwarfAttEncodingSigned
+	default:
+		return irenum.DwarfAttEncodingUnsigned
+	}
+}
+
+func (t *translator) emitDebugRef(irBlock *ir.Block, d *ssa.DebugRef) {
+	if t.debug == nil {
+		return
+	}
+	goVar, ok := d.Object().(*gotypes.Var)
+	if !ok || goVar.Name() == "_" {
+		return
+	}
+	if _, isFunc := d.X.(*ssa.Function); isFunc {
+		return // No real value to describe, see translateValue.
+	}
+
+	irFunc := irBlock.Parent
+	if t.debug.subprograms[irFunc] == nil {
+		return
+	}
+	diVar := t.debug.variable(irFunc, goVar, d.Parent())
+	irX := t.translateValue(irBlock, d.X)
+
+	if d.IsAddr {
+		// The address of a variable doesn't change; declare it once.
+		key := debugVarKey{irFunc, goVar}
+		if t.debug.declared[key] {
+			return
+		}
+		t.debug.declared[key] = true
+		irBlock.NewCall(t.builtins.DbgDeclare(t),
+			&irMetadataArg{irX}, &irMetadataArg{diVar}, &irMetadataArg{t.debug.expr})
+		return
+	}
+	irBlock.NewCall(t.builtins.DbgValue(t),
+		&irMetadataArg{irX}, &irMetadataArg{diVar}, &irMetadataArg{t.debug.expr})
+}
+
+// irMetadataArg passes a value or a metadata node to the llvm.dbg.*
+// intrinsics, as "metadata <value>" or "metadata !N".
+type irMetadataArg struct {
+	x interface{ Ident() string }
+}
+
+func (a *irMetadataArg) Type() irtypes.Type { return irtypes.Metadata }
+func (a *irMetadataArg) Ident() string {
+	if v, ok := a.x.(irvalue.Value); ok {
+		return v.String() // "<type> <ident>"
+	}
+	return a.x.Ident()
+}
+func (a *irMetadataArg) String() string { return a.Type().String() + " " + a.Ident() }
+
+// llir has no common interface for setting the metadata attachments of an
+// instruction; each has a Metadata field of attachments, so use that.
+func metadataField(irInst interface{}) reflect.Value {
+	v := reflect.ValueOf(irInst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reflect.Value{}
+	}
+	return v.Elem().FieldByName("Metadata")
+}
+
+func hasDebugLoc(irInst interface{}) bool {
+	f := metadataField(irInst)
+	if !f.IsValid() {
+		return true // Can't have one.
+	}
+	for i := 0; i < f.Len(); i++ {
+		if f.Index(i).Interface().(*metadata.Attachment).Name == "dbg" {
+			return true
+		}
+	}
+	return false
+}
+
+func setDebugLoc(irInst interface{}, loc *metadata.DILocation) {
+	f := metadataField(irInst)
+	if !f.IsValid() {
+		return
+	}
+	att := reflect.ValueOf(&metadata.Attachment{Name: "dbg", Node: loc})
+	f.Set(reflect.Append(f, att))
+}
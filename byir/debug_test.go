@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"testing"
+)
+
+// TestDebugClosureVars lowers a closure with debug info. x of makeFunc is
+// seen from makeFunc and from its closure, each needs a DILocalVariable in
+// its own scope, or opt -verify rejects the module.
+func TestDebugClosureVars(t *testing.T) {
+	var buf bytes.Buffer
+	err := lower(&buf, []string{"./testdata/closure"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reVar := regexp.MustCompile(`!DILocalVariable\([^)]*\)`)
+	reName := regexp.MustCompile(`name: "x"`)
+	reScope := regexp.MustCompile(`scope: (![0-9]+)`)
+	scopes := map[string]bool{}
+	for _, diVar := range reVar.FindAllString(buf.String(), -1) {
+		if !reName.MatchString(diVar) {
+			continue
+		}
+		if m := reScope.FindStringSubmatch(diVar); m != nil {
+			scopes[m[1]] = true
+		}
+	}
+	if len(scopes) < 2 {
+		t.Errorf("x described in %d scopes, want one for makeFunc and one for its closure", len(scopes))
+	}
+
+	if _, err := exec.LookPath("opt"); err != nil {
+		return
+	}
+	fd, err := ioutil.TempFile("", "x_*.ll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	fd.Write(buf.Bytes())
+	fd.Close()
+	out, err := exec.Command("opt", "-verify", "-o", "/dev/null", fd.Name()).CombinedOutput()
+	if err != nil {
+		t.Errorf("opt -verify: %v\n%s", err, out)
+	}
+}
+
+// TestDebugRecursiveSlice describes T, whose fields reach T again through a
+// slice rather than a pointer.
+func TestDebugRecursiveSlice(t *testing.T) {
+	var buf bytes.Buffer
+	err := lower(&buf, []string{"./testdata/recursiveslice"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`!DICompositeType\([^)]*name: "main.T"`).Match(buf.Bytes()) {
+		t.Errorf("no DICompositeType for main.T")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"golang.org/x/tools/go/ssa"
+
+	ir "github.com/llir/llvm/ir"
+	irconstant "github.com/llir/llvm/ir/constant"
+	irenum "github.com/llir/llvm/ir/enum"
+	irtypes "github.com/llir/llvm/ir/types"
+	irvalue "github.com/llir/llvm/ir/value"
+)
+
+// Defer and panic are implemented with setjmp/longjmp.
+//
+// Every function containing a defer statement owns a deferFrame. On entry it
+// pushes its jmp_buf as the current panic target (remembering the previous
+// one) and calls setjmp. Deferred calls are pushed onto a per-frame linked
+// list of records { next, thunk, env }, where env holds the call's evaluated
+// arguments and thunk is a generated function which unpacks env and makes the
+// call.
+//
+// A panic longjmps to the innermost frame, which runs its defer list, pops
+// its jmp_buf and then either continues at the ssa Recover block (if one of
+// the deferred calls recovered) or re-panics into the next frame out. Once
+// no frames remain the panic message is printed and the process exits.
+
+// Glibc's jmp_buf is 200 bytes; leave some room.
+var irJmpBufType = irtypes.NewArray(32, irtypes.I64)
+
+// { i8* next, void (i8*)* thunk, i8* env }
+var irDeferRecordType = irtypes.NewStruct(
+	irtypes.I8Ptr,
+	irtypes.NewPointer(irtypes.NewFunc(irtypes.Void, irtypes.I8Ptr)),
+	irtypes.I8Ptr,
+)
+
+type deferFrame struct {
+	name   string
+	head   irvalue.Value // i8**, the most recently deferred record.
+	jmpBuf irvalue.Value // i8*, this frame's jmp_buf.
+	prev   irvalue.Value // i8**, the panic target to restore on exit.
+
+	nthunks int
+}
+
+func hasDefers(f *ssa.Function) bool {
+	if f.Recover != nil {
+		return true
+	}
+	for _, goBB := range f.Blocks {
+		for _, goInst := range goBB.Instrs {
+			if _, ok := goInst.(*ssa.Defer); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emitDeferFrame appends the blocks which set up the defer frame of f to
+// irFunc. It returns the block which should branch to the function body, and
+// the block which should branch to the ssa Recover block; both are left
+// without a terminator.
+func (t *translator) emitDeferFrame(
+	irFunc *ir.Func,
+	f *ssa.Function,
+) (
+	irBody, irRecover *ir.Block,
+) {
+	irSetup := irFunc.NewBlock("deferSetup")
+	irUnwind := irFunc.NewBlock("deferUnwind")
+	irRepanic := irFunc.NewBlock("deferRepanic")
+	irBody = irFunc.NewBlock("deferBody")
+	irRecover = irFunc.NewBlock("deferRecover")
+
+	// The closure env loading block, if any, falls through to us.
+	if irFunc.Blocks[0] != irSetup && irFunc.Blocks[0].Term == nil {
+		irFunc.Blocks[0].NewBr(irSetup)
+	}
+
+	frame := &deferFrame{name: f.String()}
+
+	irHead := irSetup.NewAlloca(irtypes.I8Ptr)
+	irStoreVolatile(irSetup, irconstant.NewNull(irtypes.I8Ptr), irHead)
+	frame.head = irHead
+
+	irJmpBuf := irSetup.NewAlloca(irJmpBufType)
+	frame.jmpBuf = irSetup.NewBitCast(irJmpBuf, irtypes.I8Ptr)
+
+	irPrev := irSetup.NewAlloca(irtypes.I8Ptr)
+	irStoreVolatile(irSetup, irSetup.NewLoad(t.builtins.PanicJmpBuf(t)), irPrev)
+	frame.prev = irPrev
+
+	irSetup.NewStore(frame.jmpBuf, t.builtins.PanicJmpBuf(t))
+	irSetjmp := irSetup.NewCall(t.builtins.Setjmp(t), frame.jmpBuf)
+	irIsFirst := irSetup.NewICmp(irenum.IPredEQ, irSetjmp, irconstant.NewInt(irtypes.I32, 0))
+	irSetup.NewCondBr(irIsFirst, irBody, irUnwind)
+
+	// Reached by longjmp: run whatever is left of the defer list. Our jmp_buf
+	// stays in place while doing so, so that a panic inside a deferred call
+	// comes back here to run the rest.
+	irUnwind.NewCall(t.builtins.RunDefers(t), frame.head)
+	irUnwind.NewStore(irLoadVolatile(irUnwind, frame.prev), t.builtins.PanicJmpBuf(t))
+	irPanicking := irUnwind.NewLoad(t.builtins.Panicking(t))
+	irUnwind.NewCondBr(irPanicking, irRepanic, irRecover)
+
+	irRepanic.NewCall(t.builtins.Panic(t))
+	irRepanic.NewUnreachable()
+
+	t.deferFrames[irFunc] = frame
+	return irBody, irRecover
+}
+
+func (t *translator) emitDefer(irBlock *ir.Block, d *ssa.Defer) {
+	frame := t.deferFrames[irBlock.Parent]
+	if frame == nil {
+		panic(fmt.Errorf("emitDefer: no defer frame in %v", d.Parent()))
+	}
+
+	// Values which must be evaluated now and carried to the thunk.
+	// Constants, globals and functions are the same everywhere.
+	var goCaptured []ssa.Value
+	capture := func(goValue ssa.Value) {
+		switch goValue.(type) {
+		case *ssa.Const, *ssa.Global, *ssa.Function, *ssa.Builtin:
+			return
+		}
+		goCaptured = append(goCaptured, goValue)
+	}
+	capture(d.Call.Value)
+	for _, goArg := range d.Call.Args {
+		capture(goArg)
+	}
+
+	var irEnvFieldTypes []irtypes.Type
+	var irEnvFields []irvalue.Value
+	for _, goValue := range goCaptured {
+		irValue := t.translateValue(irBlock, goValue)
+		irEnvFieldTypes = append(irEnvFieldTypes, irValue.Type())
+		irEnvFields = append(irEnvFields, irValue)
+	}
+	irEnvType := irtypes.NewStruct(irEnvFieldTypes...)
+
+	irThunk := t.emitDeferThunk(frame, d, goCaptured, irEnvType)
+
+	var irEnv irvalue.Value = irconstant.NewNull(irtypes.I8Ptr)
+	if len(irEnvFields) != 0 {
+		irEnv = irBlock.NewCall(t.builtins.Malloc(t), irSizeof(irEnvType))
+		irEnvValue := makeStruct(irBlock, irEnvFields...)
+		irBlock.NewStore(irEnvValue, irBlock.NewBitCast(irEnv, irtypes.NewPointer(irEnvType)))
+	}
+
+	irRecord := irBlock.NewCall(t.builtins.Malloc(t), irSizeof(irDeferRecordType))
+	irRecordValue := makeStruct(irBlock, irLoadVolatile(irBlock, frame.head), irThunk, irEnv)
+	irBlock.NewStore(irRecordValue, irBlock.NewBitCast(irRecord, irtypes.NewPointer(irDeferRecordType)))
+	irStoreVolatile(irBlock, irRecord, frame.head)
+}
+
+// emitDeferThunk makes a void(i8* env) function which performs the deferred
+// call d, taking the values of goCaptured from env.
+func (t *translator) emitDeferThunk(
+	frame *deferFrame,
+	d *ssa.Defer,
+	goCaptured []ssa.Value,
+	irEnvType *irtypes.StructType,
+) *ir.Func {
+	irEnvParam := ir.NewParam("env", irtypes.I8Ptr)
+	irThunkName := fmt.Sprintf("%s$defer%d", frame.name, frame.nthunks)
+	frame.nthunks++
+	irThunk := t.m.NewFunc(irThunkName, irtypes.Void, irEnvParam)
+	irThunk.Linkage = irenum.LinkagePrivate
+	irBlock := irThunk.NewBlock("entry")
+
+	// Point the captured ssa values at their copies in env while emitting
+	// the call, then put the originals back.
+	saved := map[ssa.Value]irvalue.Value{}
+	if len(goCaptured) != 0 {
+		irEnv := irBlock.NewBitCast(irEnvParam, irtypes.NewPointer(irEnvType))
+		for i, goValue := range goCaptured {
+			irZero := irconstant.NewInt(irtypes.I32, 0)
+			irIdx := irconstant.NewInt(irtypes.I32, int64(i))
+			irFieldPtr := irBlock.NewGetElementPtr(irEnv, irZero, irIdx)
+			saved[goValue] = t.goToIRValue[goValue]
+			t.goToIRValue[goValue] = irBlock.NewLoad(irFieldPtr)
+		}
+	}
+	defer func() {
+		for goValue, irValue := range saved {
+			if irValue == nil {
+				delete(t.goToIRValue, goValue)
+			} else {
+				t.goToIRValue[goValue] = irValue
+			}
+		}
+	}()
+
+	// The result of a deferred call is discarded, so goCall is never given a
+	// type; only the kinds of call which don't need one are handled.
+	goCall := &ssa.Call{Call: d.Call}
+	switch goCallee := d.Call.Value.(type) {
+	case *ssa.Function:
+		t.emitCall(irBlock, goCall)
+
+	case *ssa.Builtin:
+		switch goCallee.Name() {
+		case "print", "println", "copy", "recover":
+			t.emitCall(irBlock, goCall)
+		default:
+			log.Printf("unimplemented: emitDefer of builtin %v", goCallee.Name())
+			t.doTrap(irBlock)
+		}
+
+	case *ssa.MakeClosure:
+		var irArgs []irvalue.Value
+		for _, goArg := range d.Call.Args {
+			irArgs = append(irArgs, t.translateValue(irBlock, goArg))
+		}
+		t.emitCallClosure(irBlock, goCall, irArgs)
+
+	default:
+		log.Printf("unimplemented: emitDefer of %T: %v", goCallee, d)
+		t.doTrap(irBlock)
+	}
+	delete(t.goToIRValue, goCall)
+
+	irBlock.NewRet(nil)
+	return irThunk
+}
+
+func (t *translator) emitRunDefers(irBlock *ir.Block, r *ssa.RunDefers) {
+	frame := t.deferFrames[irBlock.Parent]
+	if frame == nil {
+		panic(fmt.Errorf("emitRunDefers: no defer frame in %v", r.Parent()))
+	}
+
+	irBlock.NewCall(t.builtins.RunDefers(t), frame.head)
+	irBlock.NewStore(irLoadVolatile(irBlock, frame.prev), t.builtins.PanicJmpBuf(t))
+}
+
+func (t *translator) emitPanic(irBlock *ir.Block, p *ssa.Panic) {
+	irArg := t.translateValue(irBlock, p.X)
+	irBlock.NewStore(irArg, t.builtins.PanicArg(t))
+
+	var irMsg irvalue.Value = irconstant.NewZeroInitializer(irStringType)
+	if goIface, ok := p.X.(*ssa.MakeInterface); ok && isString(goIface.X.Type()) {
+		irMsg = t.translateValue(irBlock, goIface.X)
+	}
+	irBlock.NewStore(irMsg, t.builtins.PanicMsg(t))
+
+	irBlock.NewCall(t.builtins.Panic(t))
+	irBlock.NewUnreachable()
+}
+
+// emitCallBuiltinRecover stops the current panic, if any, and gives its
+// value. Outside of a panic it gives nil.
+func (t *translator) emitCallBuiltinRecover(irBlock *ir.Block, c *ssa.Call) {
+	irPanicking := irBlock.NewLoad(t.builtins.Panicking(t))
+	irArg := irBlock.NewLoad(t.builtins.PanicArg(t))
+	irNil := irconstant.NewZeroInitializer(irArg.Type())
+
+	irBlock.NewStore(irconstant.False, t.builtins.Panicking(t))
+	irBlock.NewStore(irNil, t.builtins.PanicArg(t))
+
+	t.goToIRValue[c] = irBlock.NewSelect(irPanicking, irArg, irNil)
+}
+
+func irLoadVolatile(irBlock *ir.Block, src irvalue.Value) *ir.InstLoad {
+	irLoad := irBlock.NewLoad(src)
+	irLoad.Volatile = true
+	return irLoad
+}
+
+func irStoreVolatile(irBlock *ir.Block, src, dst irvalue.Value) *ir.InstStore {
+	irStore := irBlock.NewStore(src, dst)
+	irStore.Volatile = true
+	return irStore
+}
+
+// irSizeof computes the size of typ as the address of element 1 of a null
+// typ array.
+func irSizeof(typ irtypes.Type) irconstant.Constant {
+	irNull := irconstant.NewNull(irtypes.NewPointer(typ))
+	irOne := irconstant.NewInt(irtypes.I32, 1)
+	irEnd := irconstant.NewGetElementPtr(irNull, irOne)
+	return irconstant.NewPtrToInt(irEnd, irtypes.I64)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"cygo/golden"
+)
+
+// TestGolden builds each program in testdata, runs it and compares its
+// output and exit status with the expected.out beside it, see package
+// golden. Known gaps are listed in testdata/golden.skip.
+func TestGolden(t *testing.T) {
+	for _, tool := range []string{"opt", "clang"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found: %v", tool, err)
+		}
+	}
+
+	golden.Run(t, "testdata", "testdata/golden.skip", buildGolden)
+}
+
+// buildGolden is build, but a panic while translating fails the sample
+// rather than the whole test binary.
+func buildGolden(name, dir, exePath string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return build(exePath, []string{"./" + dir}, false)
+}
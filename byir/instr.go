@@ -591,6 +591,9 @@ func (t *translator) emitCallBuiltin(
 	case "copy":
 		t.emitCallBuiltinCopy(irBlock, c)
 
+	case "recover":
+		t.emitCallBuiltinRecover(irBlock, c)
+
 	default:
 		// TODO(pwaller): A number of missing builtins.
 		log.Printf("unimplemented: emitCallBuiltin: %v", goBuiltin.Name())
@@ -869,14 +872,6 @@ func (t *translator) emitConvert(irBlock *ir.Block, c *ssa.Convert) {
 	}
 }
 
-func (t *translator) emitDebugRef(irBlock *ir.Block, d *ssa.DebugRef) {
-	log.Printf("unimplemented: emitDebugRef")
-}
-
-func (t *translator) emitDefer(irBlock *ir.Block, d *ssa.Defer) {
-	log.Printf("unimplemented: emitDefer")
-}
-
 func (t *translator) emitExtract(irBlock *ir.Block, e *ssa.Extract) {
 	irElem := irBlock.NewExtractValue(t.translateValue(irBlock, e.Tuple), uint64(e.Index))
 	t.goToIRValue[e] = irElem
@@ -1030,6 +1025,11 @@ func (t *translator) emitMakeClosure(irBlock *ir.Block, m *ssa.MakeClosure) {
 }
 
 func (t *translator) emitMakeInterface(irBlock *ir.Block, m *ssa.MakeInterface) {
+	if onlyPanicked(m) {
+		t.emitMakeInterfaceForPanic(irBlock, m)
+		return
+	}
+
 	log.Printf("unimplemented: emitMakeInterface")
 	t.goToIRValue[m] = irconstant.NewUndef(t.goToIRType(m.Type()))
 	t.doTrap(irBlock)
@@ -1056,6 +1056,34 @@ func (t *translator) emitMakeInterface(irBlock *ir.Block, m *ssa.MakeInterface)
 
 }
 
+// onlyPanicked reports whether m is only used as an argument to panic().
+func onlyPanicked(m *ssa.MakeInterface) bool {
+	goRefs := m.Referrers()
+	if goRefs == nil || len(*goRefs) == 0 {
+		return false
+	}
+	for _, goRef := range *goRefs {
+		if _, ok := goRef.(*ssa.Panic); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// emitMakeInterfaceForPanic boxes the value of m so that recover() can give
+// back a non-nil interface. There is no type information yet, so the value
+// can only be compared against nil.
+func (t *translator) emitMakeInterfaceForPanic(irBlock *ir.Block, m *ssa.MakeInterface) {
+	irX := t.translateValue(irBlock, m.X)
+	irXType := t.goToIRType(m.X.Type())
+	irBox := irBlock.NewCall(t.builtins.Malloc(t), irSizeof(irXType))
+	irBlock.NewStore(irX, irBlock.NewBitCast(irBox, irtypes.NewPointer(irXType)))
+
+	var irValue irvalue.Value = irconstant.NewZeroInitializer(t.goToIRType(m.Type()))
+	irValue = irBlock.NewInsertValue(irValue, irBox, 1)
+	t.goToIRValue[m] = irValue
+}
+
 func (t *translator) emitMakeMap(irBlock *ir.Block, m *ssa.MakeMap) {
 	log.Printf("unimplemented: emitMakeMap")
 	t.doTrap(irBlock)
@@ -1098,19 +1126,6 @@ func (t *translator) emitNext(irBlock *ir.Block, n *ssa.Next) {
 	log.Printf("unimplemented: emitNext")
 }
 
-func (t *translator) emitPanic(irBlock *ir.Block, p *ssa.Panic) {
-	irBlock.NewCall(
-		t.builtins.Printf(t),
-		irconstant.NewInt(irtypes.I32, 2),
-		t.constantString(irBlock, "panic(TODO(pwaller): better message)\n"),
-	)
-	irBlock.NewCall(
-		t.builtins.Exit(t),
-		irconstant.NewInt(irtypes.I32, 42),
-	)
-	irBlock.NewUnreachable()
-}
-
 func (t *translator) emitPhi(irBlock *ir.Block, p *ssa.Phi) {
 	irPhi, ok := t.goToIRValue[p]
 	if ok {
@@ -1151,11 +1166,6 @@ func (t *translator) emitReturn(irBlock *ir.Block, r *ssa.Return) {
 	irBlock.Term = ir.NewRet(retVal)
 }
 
-func (t *translator) emitRunDefers(irBlock *ir.Block, r *ssa.RunDefers) {
-	// TODO(pwaller): A no-op for now.
-	log.Printf("unimplemented: emitRunDefers")
-}
-
 func (t *translator) emitSelect(irBlock *ir.Block, s *ssa.Select) {
 	t.doTrap(irBlock)
 	t.goToIRValue[s] = irconstant.NewUndef(t.goToIRType(s.Type()))
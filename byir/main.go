@@ -32,6 +32,10 @@ type translator struct {
 
 	constantStrings map[string]irconstant.Constant
 	goToIRTypeCache map[gotypes.Type]irtypes.Type
+
+	deferFrames map[*ir.Func]*deferFrame
+
+	debug *debugInfo // nil unless emitting debug info.
 }
 
 func main() {
@@ -52,7 +56,7 @@ func main() {
 			}
 			return
 		case "build":
-			err := build("./a.out", args[1:])
+			err := build("./a.out", args[1:], false)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -66,7 +70,7 @@ func main() {
 		}
 	}
 
-	err := lower(os.Stdout, args)
+	err := lower(os.Stdout, args, false)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -81,7 +85,7 @@ func run(args []string) error {
 	_ = fdAOut.Close()
 	defer os.Remove(exePath)
 
-	err = build(exePath, args)
+	err = build(exePath, args, false)
 	if err != nil {
 		return err
 	}
@@ -94,7 +98,7 @@ func run(args []string) error {
 
 func debug(args []string) error {
 	const exePath = "a.out"
-	err := build(exePath, args)
+	err := build(exePath, args, true)
 	if err != nil {
 		return err
 	}
@@ -106,7 +110,9 @@ func debug(args []string) error {
 	return exe.Run()
 }
 
-func build(exePath string, args []string) error {
+// build compiles the packages in args to an executable at exePath. If
+// withDebug is set, the executable is unoptimized and has DWARF debug info.
+func build(exePath string, args []string, withDebug bool) error {
 	fd, err := ioutil.TempFile("", "x_*.ll")
 	if err != nil {
 		return fmt.Errorf("ioutil.TempFile: %v", err)
@@ -114,7 +120,7 @@ func build(exePath string, args []string) error {
 	defer os.Remove(fd.Name())
 	defer fd.Close()
 
-	err = lower(fd, args)
+	err = lower(fd, args, withDebug)
 	if err != nil {
 		return fmt.Errorf("lower: %v", err)
 	}
@@ -132,10 +138,15 @@ func build(exePath string, args []string) error {
 		return fmt.Errorf("opt -verify: %v", err)
 	}
 
+	optLevel := "-O3"
+	if withDebug {
+		optLevel = "-O0"
+	}
+
 	clang := exec.Command(
 		"clang",
 		"-Wno-override-module",
-		"-O3",
+		optLevel,
 		"-o", exePath,
 		fd.Name(),
 	)
@@ -148,7 +159,7 @@ func build(exePath string, args []string) error {
 	return nil
 }
 
-func lower(out io.Writer, args []string) error {
+func lower(out io.Writer, args []string, withDebug bool) error {
 	cfg := &packages.Config{Mode: packages.LoadAllSyntax}
 	initial, err := packages.Load(cfg, args...)
 	if err != nil {
@@ -158,7 +169,11 @@ func lower(out io.Writer, args []string) error {
 		return fmt.Errorf("packages contain errors")
 	}
 
-	prog, _ := ssautil.AllPackages(initial, 0)
+	var mode ssa.BuilderMode
+	if withDebug {
+		mode |= ssa.GlobalDebug // For DebugRef instructions.
+	}
+	prog, _ := ssautil.AllPackages(initial, mode)
 	prog.Build()
 
 	t := translator{
@@ -169,6 +184,10 @@ func lower(out io.Writer, args []string) error {
 		constantStrings: map[string]irconstant.Constant{},
 		goToIRValue:     map[ssa.Value]irvalue.Value{},
 		goToIRTypeCache: map[gotypes.Type]irtypes.Type{},
+		deferFrames:     map[*ir.Func]*deferFrame{},
+	}
+	if withDebug {
+		t.debug = newDebugInfo(prog.Fset, &t.m)
 	}
 
 	var toTranslate []*ssa.Package
@@ -336,6 +355,10 @@ func (t *translator) emitFunctionDecl(f *ssa.Function) *ir.Func {
 		irFunc.Linkage = irenum.LinkagePrivate
 	}
 
+	if t.debug != nil {
+		t.debug.emitSubprogram(irFunc, f)
+	}
+
 	t.goToIRValue[f] = irFunc
 	return irFunc
 }
@@ -352,6 +375,11 @@ func (t *translator) emitFunctionBody(f *ssa.Function) {
 		return
 	}
 
+	var irDeferBody, irDeferRecover *ir.Block
+	if hasDefers(f) {
+		irDeferBody, irDeferRecover = t.emitDeferFrame(irFunc, f)
+	}
+
 	// Bulk of translation happens here, except for terminators and phis which
 	// can't be hooked up until their targets are constructed. So that happens
 	// below.
@@ -401,9 +429,22 @@ func (t *translator) emitFunctionBody(f *ssa.Function) {
 		}
 	}
 
+	if irDeferBody != nil {
+		irDeferBody.NewBr(goBlockToIR[f.Blocks[0]])
+		if f.Recover != nil {
+			irDeferRecover.NewBr(goBlockToIR[f.Recover])
+		} else {
+			irDeferRecover.NewUnreachable()
+		}
+	}
+
 	if irFunc.Blocks[0].Term == nil {
 		irFunc.Blocks[0].NewBr(goBlockToIR[f.Blocks[0]])
 	}
+
+	if t.debug != nil {
+		t.debug.finishFunction(irFunc)
+	}
 }
 
 func (t *translator) emitEmptyFunc(irFunc *ir.Func, f *ssa.Function) {
@@ -439,7 +480,15 @@ func (t *translator) emitEmptyFunc(irFunc *ir.Func, f *ssa.Function) {
 func (t *translator) emitBlock(irFunc *ir.Func, goBB *ssa.BasicBlock) *ir.Block {
 	irBlock := irFunc.NewBlock(fmt.Sprintf("bb_%03d", goBB.Index))
 	for _, goInst := range goBB.Instrs {
+		nInsts := len(irBlock.Insts)
 		t.emitInstr(irBlock, goInst)
+
+		if t.debug != nil {
+			for _, irInst := range irBlock.Insts[nInsts:] {
+				t.debug.attachLocations(irFunc, goInst.Pos(), irInst)
+			}
+			t.debug.attachLocations(irFunc, goInst.Pos(), irBlock.Term)
+		}
 	}
 
 	if irBlock.Term == nil {
@@ -0,0 +1,46 @@
+package main
+
+func main() {
+	println("main(): start")
+	order()
+	println("mayPanic(false):", mayPanic(false))
+	println("mayPanic(true):", mayPanic(true))
+	nested()
+	defer println("main(): deferred")
+	println("main(): end")
+}
+
+func order() {
+	for i := 0; i < 3; i++ {
+		defer println("order(): deferred", i)
+	}
+	println("order(): body")
+}
+
+func mayPanic(doPanic bool) (ret int) {
+	defer func() {
+		if recover() != nil {
+			println("mayPanic(): recovered")
+			ret = -1
+		}
+	}()
+	if doPanic {
+		panic("boom")
+	}
+	return 1
+}
+
+func nested() {
+	defer func() {
+		if recover() != nil {
+			println("nested(): recovered")
+		}
+	}()
+	inner()
+	println("nested(): not reached")
+}
+
+func inner() {
+	defer println("inner(): deferred")
+	panic("inner")
+}
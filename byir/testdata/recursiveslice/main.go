@@ -0,0 +1,11 @@
+package main
+
+type T struct {
+	kids []T
+}
+
+func main() {
+	var t T
+	t.kids = make([]T, 2)
+	println(len(t.kids), len(t.kids[0].kids))
+}
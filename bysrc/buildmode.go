@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"gopp"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// -buildmode=c-archive/c-shared, the main package is a library,
+// its //export functions get C typed wrappers and a public header.
+
+const (
+	bmexe     = "exe"
+	bmarchive = "c-archive"
+	bmshared  = "c-shared"
+)
+
+func islibmode() bool { return *buildmode == bmarchive || *buildmode == bmshared }
+
+// go type => C type for the public header, "" if not supported.
+// strings are const char* in, malloc'ed char* out.
+func libctype(ty types.Type, isret bool) string {
+	switch ty := ty.Underlying().(type) {
+	case *types.Basic:
+		switch ty.Kind() {
+		case types.Bool:
+			return "bool"
+		case types.Int:
+			return "int"
+		case types.Int8:
+			return "int8_t"
+		case types.Int16:
+			return "int16_t"
+		case types.Int32:
+			return "int32_t"
+		case types.Int64:
+			return "int64_t"
+		case types.Uint:
+			return "unsigned int"
+		case types.Uint8:
+			return "uint8_t"
+		case types.Uint16:
+			return "uint16_t"
+		case types.Uint32:
+			return "uint32_t"
+		case types.Uint64:
+			return "uint64_t"
+		case types.Uintptr:
+			return "uintptr_t"
+		case types.Float32:
+			return "float"
+		case types.Float64:
+			return "double"
+		case types.String:
+			return gopp.IfElseStr(isret, "char*", "const char*")
+		case types.Byteptr, types.Charptr:
+			return "char*"
+		case types.Voidptr, types.UnsafePointer:
+			return "void*"
+		}
+	case *types.Pointer:
+		return "void*" // opaque handle
+	}
+	return ""
+}
+
+//	void* Parse(const char* src) {
+//	    cygo_init();
+//	    return (void*)main__Parse(cxrt_lib_gostring(src));
+//	}
+func (c *g2nc) genFuncDeclLibExported(scope *ast.Scope, fd *ast.FuncDecl, ant *Annotation) {
+	if fd.Recv != nil {
+		c.errorf(fd, "//export of method %v not supported in %s", fd.Name, *buildmode)
+		return
+	}
+	sig := c.info.TypeOf(fd.Name).(*types.Signature)
+	if sig.Results().Len() > 1 {
+		c.errorf(fd, "//export of %v with multiple results not supported in %s", fd.Name, *buildmode)
+		return
+	}
+	if sig.Variadic() {
+		c.errorf(fd, "//export of variadic %v not supported in %s", fd.Name, *buildmode)
+		return
+	}
+
+	retcty := "void"
+	var retty types.Type
+	if sig.Results().Len() == 1 {
+		retty = sig.Results().At(0).Type()
+		retcty = libctype(retty, true)
+		if retcty == "" {
+			c.errorf(fd, "//export %v result type %v has no C type", fd.Name, retty)
+			return
+		}
+	}
+	prmdecls := []string{}
+	prmargs := []string{}
+	for i := 0; i < sig.Params().Len(); i++ {
+		prm := sig.Params().At(i)
+		prmcty := libctype(prm.Type(), false)
+		if prmcty == "" {
+			c.errorf(fd, "//export %v parameter %v type %v has no C type",
+				fd.Name, prm.Name(), prm.Type())
+			return
+		}
+		prmname := prm.Name()
+		if prmname == "" || prmname == "_" {
+			prmname = fmt.Sprintf("a%d", i)
+		}
+		prmdecls = append(prmdecls, prmcty+" "+prmname)
+		switch {
+		case isstrty2(prm.Type()):
+			prmargs = append(prmargs, fmt.Sprintf("cxrt_lib_gostring((byteptr)%s)", prmname))
+		case prmcty == "void*" || prmcty == "char*":
+			gotystr := c.exprTypeNameImpl2(scope, prm.Type(), fd.Name)
+			prmargs = append(prmargs, fmt.Sprintf("(%s)%s", gotystr, prmname))
+		default:
+			prmargs = append(prmargs, prmname)
+		}
+	}
+
+	proto := fmt.Sprintf("%s %s(%s)", retcty, ant.exportname,
+		gopp.IfElseStr(len(prmdecls) == 0, "void", strings.Join(prmdecls, ", ")))
+	c.libexports = append(c.libexports, proto)
+
+	c.out(proto, " {").outnl()
+	c.out("cygo_init()").outfh().outnl()
+	call := fmt.Sprintf("%s%s(%s)", c.pkgpfx(), fd.Name.Name, strings.Join(prmargs, ", "))
+	switch {
+	case retty == nil:
+		c.out(call).outfh().outnl()
+	case isstrty2(retty):
+		c.outf("return cxrt_lib_cstring(%s)", call).outfh().outnl()
+	default:
+		c.outf("return (%s)%s", retcty, call).outfh().outnl()
+	}
+	c.out("}").outnl().outnl()
+}
+
+// replaces main() in library mode, every exported wrapper calls it,
+// so the host needs not to, though it may to boot early.
+func (c *g2nc) genLibInitFunc(scope *ast.Scope) {
+	c.out("#include <pthread.h>").outnl()
+	c.out("static pthread_once_t cxlib_once = PTHREAD_ONCE_INIT").outfh().outnl()
+	c.out("static void cxlib_init_once() {").outnl()
+	c.out("cxrt_init_env(0, 0)").outfh().outnl()
+	c.out("extern void cxall_globvars_init()").outfh().outnl()
+	c.out("cxall_globvars_init()").outfh().outnl()
+	c.outf("%sglobvars_init()", c.pkgpfx()).outfh().outnl()
+	c.out("extern void cxall_pkginit()").outfh().outnl()
+	c.out("cxall_pkginit()").outfh().outnl()
+	c.outf("%spkginit()", c.pkgpfx()).outfh().outnl()
+	c.out("}").outnl()
+	c.out("// boots bdwgc and corona once, registers the calling thread with the gc").outnl()
+	c.out("void cygo_init() {").outnl()
+	c.out("pthread_once(&cxlib_once, cxlib_init_once)").outfh().outnl()
+	c.out("extern void cxrt_lib_thread_enter()").outfh().outnl()
+	c.out("cxrt_lib_thread_enter()").outfh().outnl()
+	c.out("}").outnl()
+}
+
+const libhdrtmpl = `/* Code generated by cygo -buildmode=%s, DO NOT EDIT. */
+
+#ifndef %s
+#define %s
+
+#include <stdbool.h>
+#include <stdint.h>
+
+/*
+ * Exported functions can be called from any thread, the runtime (bdwgc
+ * and corona) is booted by the first call. They run on the calling
+ * thread, outside corona's fibers, so blocking calls block it. A thread
+ * is registered with the gc on its first call and unregistered when it
+ * exits. Strings are passed as const
+ * char* and returned as char* to free() by the caller, pointers are
+ * opaque handles.
+ *
+ * link: %s
+ */
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+extern void cygo_init(void);
+
+%s
+#ifdef __cplusplus
+}
+#endif
+
+#endif
+`
+
+// compiles cfile to opkgs/lib<name>.a or .so and writes opkgs/lib<name>.h
+// flags are the #cgo ones of all packages.
+func buildlib(cfile string, name string, comps []*g2nc, flags *cgoflags) error {
+	outdir := filepath.Dir(cfile)
+	hdrfile := filepath.Join(outdir, "lib"+name+".h")
+	protos := ""
+	for _, comp := range comps {
+		for _, proto := range comp.libexports {
+			protos += "extern " + proto + ";\n"
+		}
+	}
+	guard := "CYGO_LIB" + strings.ToUpper(name) + "_H"
+	hdr := fmt.Sprintf(libhdrtmpl, *buildmode, guard, guard,
+		strings.Join(flags.ldflags, " "), protos)
+	err := ioutil.WriteFile(hdrfile, []byte(hdr), 0644)
+	if err != nil {
+		return err
+	}
+
+	cc := os.Getenv("CC")
+	if cc == "" {
+		cc = "cc"
+	}
+	rootdir := filepath.Dir(filepath.Dir(find_builtin_path("xgo/builtin")))
+	args := []string{"-std=c11", "-D_GNU_SOURCE", "-DGC_THREADS", "-g", "-fPIC",
+		"-I" + filepath.Join(rootdir, "src"),
+		"-I" + filepath.Join(rootdir, "include"),
+		"-I" + filepath.Join(rootdir, "corona-c"),
+		"-I" + filepath.Join(rootdir, "3rdparty/cltc/src/include"),
+		"-I" + filepath.Join(rootdir, "3rdparty/cltc/src"),
+	}
+	args = append(args, flags.cflags...)
+	args = append(args, strings.Fields(os.Getenv("CYGO_CFLAGS"))...)
+
+	var outfile string
+	switch *buildmode {
+	case bmarchive:
+		objfile := strings.TrimSuffix(cfile, filepath.Ext(cfile)) + ".o"
+		outfile = filepath.Join(outdir, "lib"+name+".a")
+		args = append(args, "-c", "-o", objfile, cfile)
+		err = runcmd(cc, args...)
+		if err == nil {
+			os.Remove(outfile)
+			err = runcmd("ar", "rcs", outfile, objfile)
+		}
+	case bmshared:
+		outfile = filepath.Join(outdir, "lib"+name+".so")
+		libdir := os.Getenv("CXRT_LIBDIR")
+		if libdir != "" {
+			args = append(args, "-L"+libdir)
+		}
+		args = append(args, "-shared", "-o", outfile, cfile)
+		args = append(args, flags.ldflags...)
+		args = append(args, strings.Fields(os.Getenv("CYGO_LDFLAGS"))...)
+		err = runcmd(cc, args...)
+	}
+	if err == nil {
+		log.Println("built", outfile, hdrfile)
+	}
+	return err
+}
+
+func runcmd(exe string, args ...string) error {
+	cmdo := exec.Command(exe, args...)
+	out, err := cmdo.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v\n%s", exe, err, out)
+	}
+	return nil
+}
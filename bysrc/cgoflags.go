@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// #cgo [constraints] CFLAGS|CPPFLAGS|LDFLAGS|pkg-config: args
+// of a package's C preamble, like the go tool, ${SRCDIR} (or ${PKGDIR})
+// is the package directory.
+type cgoflags struct {
+	cflags  []string
+	ldflags []string
+}
+
+func parsecgoflags(pkgdir string, ccode string) (*cgoflags, error) {
+	flags := &cgoflags{}
+	srcdir, _ := filepath.Abs(pkgdir)
+	for _, line := range strings.Split(ccode, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#cgo ") {
+			continue
+		}
+		colpos := strings.Index(line, ":")
+		if colpos < 0 {
+			return nil, fmt.Errorf("invalid #cgo line: %s", line)
+		}
+		fields := strings.Fields(line[4:colpos])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid #cgo line: %s", line)
+		}
+		verb := fields[len(fields)-1]
+		if !cgomatchcons(fields[:len(fields)-1]) {
+			continue
+		}
+		args, err := splitquoted(line[colpos+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %s", err, line)
+		}
+		for i, arg := range args {
+			arg = strings.ReplaceAll(arg, "${SRCDIR}", srcdir)
+			args[i] = strings.ReplaceAll(arg, "${PKGDIR}", srcdir)
+		}
+
+		switch verb {
+		case "CFLAGS", "CPPFLAGS":
+			flags.cflags = append(flags.cflags, args...)
+		case "LDFLAGS":
+			flags.ldflags = append(flags.ldflags, args...)
+		case "pkg-config":
+			cflags, ldflags, err := pkgconfig(args)
+			if err != nil {
+				return nil, err
+			}
+			flags.cflags = append(flags.cflags, cflags...)
+			flags.ldflags = append(flags.ldflags, ldflags...)
+		default:
+			return nil, fmt.Errorf("unsupported #cgo verb %s: %s", verb, line)
+		}
+	}
+	return flags, nil
+}
+
+// linux,amd64 !windows, space is or, comma is and
+func cgomatchcons(conds []string) bool {
+	if len(conds) == 0 {
+		return true
+	}
+	for _, cond := range conds {
+		ok := true
+		for _, term := range strings.Split(cond, ",") {
+			not := strings.HasPrefix(term, "!")
+			term = strings.TrimPrefix(term, "!")
+			mat := term == runtime.GOOS || term == runtime.GOARCH || term == "cgo" ||
+				(term == "unix" && runtime.GOOS != "windows")
+			if mat == not {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// -I"/a b" 'c' => [-I/a b, c]
+func splitquoted(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inarg := false
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteByte(ch)
+		case ch == '"' || ch == '\'':
+			quote = ch
+			inarg = true
+		case ch == ' ' || ch == '\t':
+			if inarg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inarg = false
+			}
+		default:
+			arg.WriteByte(ch)
+			inarg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote")
+	}
+	if inarg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+var pkgconfigmu sync.Mutex
+var pkgconfigcache = map[string][2][]string{}
+
+func pkgconfig(pkgs []string) (cflags []string, ldflags []string, err error) {
+	pkgconfigmu.Lock()
+	defer pkgconfigmu.Unlock()
+	key := strings.Join(pkgs, " ")
+	if res, ok := pkgconfigcache[key]; ok {
+		return res[0], res[1], nil
+	}
+	for _, kind := range []string{"--cflags", "--libs"} {
+		out, err := exec.Command("pkg-config", append([]string{kind}, pkgs...)...).CombinedOutput()
+		if err != nil {
+			return nil, nil, fmt.Errorf("pkg-config %s %s: %v\n%s", kind, key, err, out)
+		}
+		args, err := splitquoted(strings.TrimSpace(string(out)))
+		if err != nil {
+			return nil, nil, err
+		}
+		if kind == "--cflags" {
+			cflags = args
+		} else {
+			ldflags = args
+		}
+	}
+	pkgconfigcache[key] = [2][]string{cflags, ldflags}
+	return
+}
+
+// flags that matter to tcc -E/gcc -E
+func cppflags(cflags []string) []string {
+	var res []string
+	for i := 0; i < len(cflags); i++ {
+		arg := cflags[i]
+		switch {
+		case arg == "-I" || arg == "-D" || arg == "-U" || arg == "-isystem" || arg == "-include":
+			if i+1 < len(cflags) {
+				res = append(res, arg, cflags[i+1])
+				i++
+			}
+		case strings.HasPrefix(arg, "-I") || strings.HasPrefix(arg, "-D") ||
+			strings.HasPrefix(arg, "-U"):
+			res = append(res, arg)
+		}
+	}
+	return res
+}
+
+// of all packages, in package order, duplicates dropped.
+// ldflags keep the last duplicate, so libraries come after their users.
+func mergecgoflags(all []*cgoflags) *cgoflags {
+	res := &cgoflags{}
+	seen := map[string]bool{}
+	for _, flags := range all {
+		for _, arg := range flags.cflags {
+			// only -Ifoo -Dbar=1, the split -I foo forms stay as they are
+			if len(arg) > 2 && (strings.HasPrefix(arg, "-I") || strings.HasPrefix(arg, "-D")) {
+				if seen[arg] {
+					continue
+				}
+				seen[arg] = true
+			}
+			res.cflags = append(res.cflags, arg)
+		}
+	}
+	var ldflags []string
+	for _, flags := range all {
+		ldflags = append(ldflags, flags.ldflags...)
+	}
+	seen = map[string]bool{}
+	for i := len(ldflags) - 1; i >= 0; i-- {
+		arg := ldflags[i]
+		if seen[arg] && strings.HasPrefix(arg, "-l") {
+			continue
+		}
+		seen[arg] = true
+		res.ldflags = append([]string{arg}, res.ldflags...)
+	}
+	return res
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"go/types"
 	"gopp"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"github.com/thoas/go-funk"
@@ -31,12 +33,27 @@ type g2nc struct {
 	info *types.Info
 
 	fnexcepts map[*ast.FuncDecl]*FuncExceptions
+	cfuncs    map[string]string // C func name => Go func name, for linemap
+	nochecks  bool              // current function has //cygo:nochecks
+
+	libexports []string // C prototypes of //export in library build modes
+	thunks     []*mththunk
+}
+
+// a promoted method as a function of the outer type, named like its own
+// methods, so method tables and iface boxing take it the same way
+type mththunk struct {
+	name  string
+	proto string
+	body  string
 }
 
+var genedthunks = map[string]bool{} // of all packages, by name
+
 func (this *g2nc) initfields() {
 	this.info = &this.psctx.info
 	this.fnexcepts = this.psctx.fnexcepts
-
+	this.cfuncs = map[string]string{}
 }
 func (this *g2nc) genpkgs() {
 	this.initfields()
@@ -263,21 +280,42 @@ func (this *g2nc) genFuncs(pkg *ast.Package) {
 	this.genInitGlobvars(pkg.Scope, pkg)
 
 	this.genInitFuncs(scope, pkg)
-	if pkg.Name == "main" {
+	if pkg.Name == "main" && islibmode() {
+		this.genLibInitFunc(scope)
+	} else if pkg.Name == "main" {
 		this.genMainFunc(scope)
 	}
+	this.genThunks()
+}
+
+// the thunks genMethodTable declared, once, the embedded types' methods
+// are all defined before here
+func (c *g2nc) genThunks() {
+	for _, th := range c.thunks {
+		if genedthunks[th.name] {
+			continue
+		}
+		genedthunks[th.name] = true
+		c.outf("%s {", th.proto).outnl()
+		c.out(th.body).outfh().outnl()
+		c.out("}").outnl().outnl()
+	}
 }
 
 func (this *g2nc) genDecl(scope *ast.Scope, d ast.Decl) {
 	switch td := d.(type) {
 	case *ast.FuncDecl:
+		this.nochecks = newAnnotation(td.Doc).nochecks
 		this.genPreFuncDecl(scope, td)
 		this.genFuncDecl(scope, td)
+		this.clinereset()
 		this.genPostFuncDecl(scope, td)
+		this.nochecks = false
 	case *ast.GenDecl:
 		this.genGenDecl(scope, td)
+		this.clinereset()
 	default:
-		log.Println("unimplemented", reflect.TypeOf(d))
+		this.errorf(d, "unsupported declaration %T", d)
 	}
 }
 func (c *g2nc) genPreFuncDecl(scope *ast.Scope, d *ast.FuncDecl) {
@@ -320,10 +358,13 @@ func (c *g2nc) genPreFuncDecl(scope *ast.Scope, d *ast.FuncDecl) {
 			pkgpfx, d.Name.Name, cnter, pkgpfx, d.Name.Name, cnter).outfh().outnl()
 		c.out("}").outnl()
 
+		c.clinema(fnlit)
 		c.out("static").outsp()
 		c.genFieldList(scope, fnlit.Type.Results, true, false, "", true)
 		c.outsp()
 		c.outf("%s%s_closure_%d(", pkgpfx, d.Name.Name, cnter)
+		c.cfuncs[fmt.Sprintf("%s%s_closure_%d", pkgpfx, d.Name.Name, cnter)] =
+			fmt.Sprintf("%s.%s.func%d", c.curpkg, d.Name.Name, cnter+1)
 		c.outf("%s%s_closure_arg_%d*", pkgpfx, d.Name.Name, cnter).outsp()
 		c.out("clos", gopp.IfElseStr(fnlit.Type.Params.NumFields() > 0, ",", ""))
 		c.genFieldList(scope, fnlit.Type.Params, false, true, ",", true)
@@ -344,6 +385,7 @@ func (c *g2nc) genPreFuncDecl(scope *ast.Scope, d *ast.FuncDecl) {
 			c.outfh().outnl()
 		}
 		c.out("}").outnl()
+		c.clinereset()
 		c.outnl()
 	}
 }
@@ -356,15 +398,18 @@ func (c *g2nc) genPostFuncDecl(scope *ast.Scope, fd *ast.FuncDecl) {
 		switch te := fe.(type) {
 		case *ast.Ident:
 			mat = te.Name == fd.Name.Name
+		case *ast.FuncLit: // wrapped where it is, see genFiberStargs
 		default:
-			log.Println("todo", fe, reflect.TypeOf(fe))
+			c.errorf(fe, "unsupported go statement of %v", exprstr(fe))
 		}
 		if mat {
 			c.genFiberStwrap(scope, gostmt.Call)
 		}
 	}
 	ant := newAnnotation(fd.Doc)
-	if ant.exported {
+	if ant.exported && islibmode() && c.curpkg == "main" {
+		c.genFuncDeclLibExported(scope, fd, ant)
+	} else if ant.exported {
 		c.genFuncDeclExported(scope, fd, ant)
 	}
 	if fd.Recv == nil && fd.Body != nil {
@@ -507,8 +552,11 @@ func (this *g2nc) genFuncDecl(scope *ast.Scope, fd *ast.FuncDecl) {
 		recvtystr := this.exprTypeName(scope, fd.Recv.List[0].Type)
 		recvtystr = strings.TrimRight(recvtystr, "*")
 		this.out(recvtystr + mthsep + fd.Name.String())
+		this.cfuncs[recvtystr+mthsep+fd.Name.String()] = fmt.Sprintf("%s.(%s).%s",
+			this.curpkg, types.ExprString(fd.Recv.List[0].Type), fd.Name.Name)
 	} else {
 		this.out(pkgpfx + fdname)
+		this.cfuncs[pkgpfx+fdname] = this.curpkg + "." + fdname
 	}
 	this.out("(")
 	if fd.Recv != nil {
@@ -624,7 +672,12 @@ func (c *g2nc) genInitFuncs(scope *ast.Scope, pkg *ast.Package) {
 		c.outf("// %s", c.exprpos(fd).String()).outnl()
 		c.out("static").outsp()
 		c.outf("void %spkginit_%d()", c.pkgpfx(), idx)
+		c.cfuncs[fmt.Sprintf("%spkginit_%d", c.pkgpfx(), idx)] =
+			fmt.Sprintf("%s.init.%d", c.curpkg, idx)
+		c.nochecks = newAnnotation(fd.Doc).nochecks
 		c.genBlockStmt(scope, fd.Body)
+		c.nochecks = false
+		c.clinereset()
 	}
 	c.outf("void %spkginit(){", c.pkgpfx()).outnl()
 	for idx, _ := range c.psctx.initFuncs {
@@ -689,17 +742,12 @@ func (this *g2nc) genStmt(scope *ast.Scope, stmt ast.Stmt, idx int) {
 	// log.Println(stmt, reflect.TypeOf(stmt))
 	if stmt != nil {
 		posinfo := this.exprpos(stmt).String()
-		fields := strings.Split(posinfo, ":")
-		if len(fields) > 1 {
-			// this.outf("#line %s \"%s\"", fields[1], fields[0]).outnl()
-			this.out("// ", posinfo).outnl()
-		} else {
-			this.out("// ", posinfo).outnl()
-		}
+		this.out("// ", posinfo).outnl()
 		stmtstr := this.prtnode(stmt)
 		if !strings.ContainsAny(strings.TrimSpace(stmtstr), "\n") {
 			this.outf("// %s", stmtstr).outnl()
 		}
+		this.clinema(stmt)
 		this.genStmtTmps(scope, stmt)
 	}
 	defer this.outnl()
@@ -746,6 +794,8 @@ func (this *g2nc) genStmt(scope *ast.Scope, stmt ast.Stmt, idx int) {
 		this.genCaseClause(scope, t, idx)
 	case *ast.SendStmt:
 		this.genSendStmt(scope, t)
+	case *ast.SelectStmt:
+		this.genSelectStmt(scope, t)
 	case *ast.ReturnStmt:
 		this.genReturnStmt(scope, t)
 	case *ast.DeferStmt:
@@ -753,7 +803,7 @@ func (this *g2nc) genStmt(scope *ast.Scope, stmt ast.Stmt, idx int) {
 	default:
 		if stmt == nil { // empty block {}
 		} else {
-			log.Println("unknown", reflect.TypeOf(stmt), t)
+			this.errorf(stmt, "unsupported statement %T", stmt)
 		}
 	}
 	if addfh {
@@ -868,6 +918,10 @@ func (c *g2nc) genAssignStmt(scope *ast.Scope, s *ast.AssignStmt) {
 			} else {
 				// log.Println(retyx, mytyx, retyx == mytyx, isiface2(retyx), isiface2(mytyx))
 				// iface assign
+				mthtab := ""
+				if !isiface2(retyx) {
+					mthtab = c.genMethodTable(scope, retyx)
+				}
 				c.genExpr(scope, s.Lhs[i])
 				c.outeq()
 				tystr := c.exprTypeName(scope, s.Lhs[i])
@@ -880,6 +934,15 @@ func (c *g2nc) genAssignStmt(scope *ast.Scope, s *ast.AssignStmt) {
 					c.out("->thisptr")
 				}
 				c.outfh().outnl()
+				c.genExpr(scope, s.Lhs[i])
+				c.out("->thismths").outeq()
+				if isiface2(retyx) {
+					c.genExpr(scope, s.Rhs[i])
+					c.out("->thismths")
+				} else {
+					c.out(mthtab)
+				}
+				c.outfh().outnl()
 				unty := mytyx.Underlying().(*types.Interface)
 				for j := 0; j < unty.NumMethods(); j++ {
 					mtho := unty.Method(j)
@@ -887,7 +950,7 @@ func (c *g2nc) genAssignStmt(scope *ast.Scope, s *ast.AssignStmt) {
 					c.outf("->%v /*ifaceas*/ = ", mtho.Name())
 					if isiface2(retyx) {
 						c.genExpr(scope, s.Rhs[i])
-						c.out("->%s", mtho.Name())
+						c.outf("->%s", mtho.Name())
 					} else {
 						retystr := c.exprTypeName(scope, s.Rhs[i])
 						retystr = strings.TrimRight(retystr, "*")
@@ -992,7 +1055,13 @@ func (c *g2nc) genAssignStmt(scope *ast.Scope, s *ast.AssignStmt) {
 				c.genExpr(scope, s.Lhs[i])
 				c.out(",")
 			}
-			c.genExpr(ns, s.Rhs[i])
+			divchk := (s.Tok == token.QUO_ASSIGN || s.Tok == token.REM_ASSIGN) &&
+				c.isdivchk(s.Rhs[i])
+			if divchk {
+				c.genDivisorChecked(ns, s.Rhs[i], s.Rhs[i])
+			} else {
+				c.genExpr(ns, s.Rhs[i])
+			}
 			if isstrty2(goty) && s.Tok == token.ADD_ASSIGN {
 				c.out(")")
 			}
@@ -1007,6 +1076,118 @@ func (c *g2nc) genAssignStmt(scope *ast.Scope, s *ast.AssignStmt) {
 
 }
 
+// the methods of concrete type tyx, for the thismths of the iface box it
+// goes in, so a method that iface doesn't declare is still found by
+// name and signature, see cxrt_ifacemethod. like
+//
+//	static cxmethod gxtv3[] = {{"Error", "func() string", main__foo_Error}};
+//	static cxmethods gxtv4 = {"main__foo*", 1, gxtv3};
+//
+// returns the C expr to store, &gxtv4 or nilptr when tyx has no methods
+func (c *g2nc) genMethodTable(scope *ast.Scope, tyx types.Type) string {
+	mset := types.NewMethodSet(tyx)
+	tystr := c.exprTypeNameImpl2(scope, tyx, nil)
+	rcvname := strings.TrimRight(tystr, "*")
+	rows := []string{}
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		if len(sel.Index()) > 1 {
+			c.genThunkDecl(scope, rcvname, sel) // promoted from an embedded field
+		}
+		mtho := sel.Obj()
+		rows = append(rows, fmt.Sprintf("{%q, %q, (voidptr)%s_%s}",
+			mtho.Name(), methodsig(mtho.Type().(*types.Signature)), rcvname, mtho.Name()))
+	}
+	if len(rows) == 0 {
+		return "nilptr"
+	}
+	rowsname := tmpvarname()
+	c.outf("static cxmethod %s[] = {%s}", rowsname, strings.Join(rows, ", ")).outfh().outnl()
+	tabname := tmpvarname()
+	c.outf("static cxmethods %s = {%q, %d, %s}", tabname, tystr, len(rows), rowsname).outfh().outnl()
+	return "&" + tabname
+}
+
+// declares rcvname_method calling the promoted method through the
+// embedded fields, defined later by genThunks
+func (c *g2nc) genThunkDecl(scope *ast.Scope, rcvname string, sel *types.Selection) {
+	mtho := sel.Obj()
+	sig := mtho.Type().(*types.Signature)
+	retstr := "void"
+	switch sig.Results().Len() {
+	case 0:
+	case 1:
+		retstr = c.exprTypeNameImpl2(scope, sig.Results().At(0).Type(), nil)
+	default:
+		retstr = "voidptr" // the tuple, whose type is of the method's package
+	}
+	prms := []string{rcvname + "* this"}
+	args := []string{}
+	for i := 0; i < sig.Params().Len(); i++ {
+		prmty := c.exprTypeNameImpl2(scope, sig.Params().At(i).Type(), nil)
+		prms = append(prms, prmty+" "+tmpvarname2(i))
+		args = append(args, tmpvarname2(i))
+	}
+	name := rcvname + mthsep + mtho.Name()
+	proto := fmt.Sprintf("%s %s(%s)", retstr, name, strings.Join(prms, ", "))
+	c.out(proto).outfh().outnl()
+
+	// this->Inner->..., the last index is the method's
+	rcvx := "this"
+	ty := sel.Recv()
+	idxs := sel.Index()
+	for _, idx := range idxs[:len(idxs)-1] {
+		if ptrty, ok := ty.(*types.Pointer); ok {
+			ty = ptrty.Elem()
+		}
+		fld := ty.Underlying().(*types.Struct).Field(idx)
+		rcvx += "->" + fld.Name()
+		ty = fld.Type()
+	}
+	callstr := ""
+	if isiface2(ty) {
+		callstr = fmt.Sprintf("%s->%s(%s)", rcvx, mtho.Name(),
+			strings.Join(append([]string{rcvx + "->thisptr"}, args...), ", "))
+	} else {
+		mthrcv := c.exprTypeNameImpl2(scope, sig.Recv().Type(), nil)
+		callstr = fmt.Sprintf("%s%s%s(%s)", strings.TrimRight(mthrcv, "*"), mthsep, mtho.Name(),
+			strings.Join(append([]string{rcvx}, args...), ", "))
+	}
+	for _, th := range c.thunks {
+		if th.name == name {
+			return
+		}
+	}
+	th := &mththunk{name, proto, gopp.IfElseStr(retstr == "void", "", "return ") + callstr}
+	c.thunks = append(c.thunks, th)
+}
+
+// method type without receiver and param names, func(error) bool
+func methodsig(sig *types.Signature) string {
+	qf := func(pkg *types.Package) string { return pkg.Name() }
+	tystrs := func(tup *types.Tuple) []string {
+		res := []string{}
+		for i := 0; i < tup.Len(); i++ {
+			res = append(res, types.TypeString(tup.At(i).Type(), qf))
+		}
+		return res
+	}
+	prms := tystrs(sig.Params())
+	if sig.Variadic() {
+		prms[len(prms)-1] = "..." + strings.TrimPrefix(prms[len(prms)-1], "[]")
+	}
+	s := "func(" + strings.Join(prms, ", ") + ")"
+	rets := tystrs(sig.Results())
+	switch len(rets) {
+	case 0:
+	case 1:
+		s += " " + rets[0]
+	default:
+		s += " (" + strings.Join(rets, ", ") + ")"
+	}
+	return s
+}
+
 func (this *g2nc) genGoStmt(scope *ast.Scope, stmt *ast.GoStmt) {
 	// calleename := stmt.Call.Fun.(*ast.Ident).Name
 	// this.genCallExpr(scope, stmt.Call)
@@ -1027,7 +1208,8 @@ func (c *g2nc) genFiberStargs(scope *ast.Scope, e *ast.CallExpr) {
 		closi := c.getclosinfo(te)
 		funame = closi.fnname
 	default:
-		log.Println("todo", e, reflect.TypeOf(e.Fun))
+		c.errorf(e.Fun, "unsupported go statement of %v", exprstr(e.Fun))
+		return
 	}
 
 	c.out("typedef struct {")
@@ -1121,7 +1303,7 @@ func (c *g2nc) genForStmt(scope *ast.Scope, s *ast.ForStmt) {
 func (c *g2nc) genRangeStmt(scope *ast.Scope, s *ast.RangeStmt) {
 	varty := c.info.TypeOf(s.X)
 	// log.Println(varty, reflect.TypeOf(varty))
-	switch be := varty.(type) {
+	switch be := varty.Underlying().(type) {
 	case *types.Map:
 		idxidstr := fmt.Sprintf("%v", s.Key)
 		idxidstr = gopp.IfElseStr(s.Index == nil, tmpvarname(), idxidstr)
@@ -1150,59 +1332,128 @@ func (c *g2nc) genRangeStmt(scope *ast.Scope, s *ast.RangeStmt) {
 		c.out("}").outnl()
 		c.out("// TODO gc safepoint code").outnl()
 		c.out("}").outnl()
-	case *types.Slice:
-		if s.Key != nil && s.Value == nil {
-			// fix form like: for x in arr
-			s.Value = s.Key
-			s.Key = nil
-		}
-		keyidstr := fmt.Sprintf("%v", s.Key)
-		keyidstr = gopp.IfElseStr(s.Key == nil, tmpvarname(), keyidstr)
-		keyidstr = gopp.IfElseStr(keyidstr == "_", tmpvarname(), keyidstr)
-
-		c.out("{").outnl()
-		tmparrsz := tmpvarname()
-		c.outf("int %v = cxarray3_size(", tmparrsz)
-		c.genExpr(scope, s.X)
-		c.out(")").outfh().outnl()
-		c.outf("  for (int %s = 0; %s < %v; %s++) {",
-			keyidstr, keyidstr, tmparrsz, keyidstr).outnl()
-		if s.Value != nil {
-			valtystr := c.exprTypeName(scope, s.Value)
-			c.outf("     %s %v = %v", valtystr, s.Value, cuzero).outfh().outnl()
-			var tmpvar = tmpvarname()
-			c.outf("    voidptr %s = %v", tmpvar, cuzero).outfh().outnl()
-			c.outf("    %v = *(%v*)cxarray3_get_at(", tmpvar, valtystr)
-			c.genExpr(scope, s.X)
-			c.outf(", %s)", keyidstr).outfh().outnl()
-			c.outf("%v = %v", s.Value, tmpvar).outfh().outnl()
-		}
-		c.genBlockStmt(scope, s.Body)
-		c.out("  }").outnl()
-		c.out("// TODO gc safepoint code").outnl()
-		c.out("}").outnl()
-		if be == nil {
-		}
-	// TODO Array/String
-	default:
-		if isstrty2(varty) {
-			keyidstr := fmt.Sprintf("%v", s.Key)
-			keyidstr = gopp.IfElseStr(keyidstr == "_", "idx", keyidstr)
-			valtystr := c.exprTypeName(scope, s.Value)
-
-			c.out("{").outnl()
-			c.outf("  for (int %s = 0; %s < (%v)->len; %s++) {",
-				keyidstr, keyidstr, s.X, keyidstr).outnl()
-			c.outf("     %s %v = %v", valtystr, s.Value, cuzero).outfh().outnl()
-			c.outf("    %v = (%v->ptr)[%s]", s.Value, s.X, keyidstr).outfh().outnl()
-			c.genBlockStmt(scope, s.Body)
-			c.out("  }").outnl()
-			c.out("// TODO gc safepoint code").outnl()
-			c.out("}").outnl()
+	case *types.Slice, *types.Array:
+		c.genRangeArray(scope, s, false)
+	case *types.Pointer:
+		// to array, checked by types
+		c.genRangeArray(scope, s, true)
+	case *types.Chan:
+		c.genRangeChan(scope, s)
+	case *types.Basic:
+		if be.Info()&types.IsString != 0 {
+			c.genRangeString(scope, s)
+		} else if be.Info()&types.IsInteger != 0 {
+			c.genRangeInt(scope, s)
 		} else {
-			log.Println("todo", s.Key, s.Value, s.X, varty)
+			c.errorf(s.X, "unsupported range over %v", varty)
 		}
+	default:
+		c.errorf(s.X, "unsupported range over %v", varty)
+	}
+}
+
+// name of a range iteration variable, nil and _ get a temporary
+func (c *g2nc) rangevarname(e ast.Expr) string {
+	if e == nil {
+		return tmpvarname()
 	}
+	name := fmt.Sprintf("%v", e)
+	return gopp.IfElseStr(name == "_", tmpvarname(), name)
+}
+
+// slice, array, or pointer to array if deref
+func (c *g2nc) genRangeArray(scope *ast.Scope, s *ast.RangeStmt, deref bool) {
+	if s.Key != nil && s.Value == nil {
+		// fix form like: for x in arr
+		s.Value = s.Key
+		s.Key = nil
+	}
+	keyidstr := c.rangevarname(s.Key)
+
+	c.out("{").outnl()
+	tmparr := tmpvarname()
+	c.outf("builtin__cxarray3* %v = %s", tmparr, gopp.IfElseStr(deref, "*", ""))
+	c.genExpr(scope, s.X)
+	c.outfh().outnl()
+	tmparrsz := tmpvarname()
+	c.outf("int %v = cxarray3_size(%v)", tmparrsz, tmparr).outfh().outnl()
+	c.outf("  for (int %s = 0; %s < %v; %s++) {",
+		keyidstr, keyidstr, tmparrsz, keyidstr).outnl()
+	if s.Value != nil {
+		valtystr := c.exprTypeName(scope, s.Value)
+		c.outf("     %s %v = %v", valtystr, s.Value, cuzero).outfh().outnl()
+		var tmpvar = tmpvarname()
+		c.outf("    voidptr %s = %v", tmpvar, cuzero).outfh().outnl()
+		c.outf("    %v = *(%v*)cxarray3_get_at(%v, %s)",
+			tmpvar, valtystr, tmparr, keyidstr).outfh().outnl()
+		c.outf("%v = %v", s.Value, tmpvar).outfh().outnl()
+	}
+	c.genBlockStmt(scope, s.Body)
+	c.out("  }").outnl()
+	c.out("// TODO gc safepoint code").outnl()
+	c.out("}").outnl()
+}
+
+// by rune, key is the byte index of it
+func (c *g2nc) genRangeString(scope *ast.Scope, s *ast.RangeStmt) {
+	keyidstr := c.rangevarname(s.Key)
+
+	c.out("{").outnl()
+	tmpstr := tmpvarname()
+	c.outf("builtin__cxstring3* %v = ", tmpstr)
+	c.genExpr(scope, s.X)
+	c.outfh().outnl()
+	tmpstrsz := tmpvarname()
+	c.outf("int %v = cxstring3_len(%v)", tmpstrsz, tmpstr).outfh().outnl()
+	tmpwidth := tmpvarname()
+	c.outf("int %v = 0", tmpwidth).outfh().outnl()
+	c.outf("  for (int %s = 0; %s < %v; %s += %v) {",
+		keyidstr, keyidstr, tmpstrsz, keyidstr, tmpwidth).outnl()
+	valvname := c.rangevarname(s.Value)
+	c.outf("    rune %v = cxstring3_decoderune(%v, %s, &%v)",
+		valvname, tmpstr, keyidstr, tmpwidth).outfh().outnl()
+	c.genBlockStmt(scope, s.Body)
+	c.out("  }").outnl()
+	c.out("}").outnl()
+}
+
+// until closed and drained, values are boxed like genSendStmt does
+func (c *g2nc) genRangeChan(scope *ast.Scope, s *ast.RangeStmt) {
+	var elemtyname = c.chanElemTypeName(s.X, false)
+	var elemtyname2 = c.chanElemTypeName(s.X, true)
+	var chanargname = "chan_arg_" + elemtyname2
+
+	c.out("{").outnl()
+	tmpch := tmpvarname()
+	c.outf("voidptr %v = ", tmpch)
+	c.genExpr(scope, s.X)
+	c.outfh().outnl()
+	c.out("  for (;;) {").outnl()
+	tmprvx := tmpvarname()
+	c.outf("    voidptr %v = cxrt_chan_recv_open(%v)", tmprvx, tmpch).outfh().outnl()
+	c.outf("    if (%v == nilptr) { break; }", tmprvx).outnl()
+	c.outf("    %s %v = ((%s*)%v)->elem",
+		elemtyname, c.rangevarname(s.Key), chanargname, tmprvx).outfh().outnl()
+	c.genBlockStmt(scope, s.Body)
+	c.out("  }").outnl()
+	c.out("}").outnl()
+}
+
+// go1.22 for i := range n
+func (c *g2nc) genRangeInt(scope *ast.Scope, s *ast.RangeStmt) {
+	keyidstr := c.rangevarname(s.Key)
+	keytystr := c.exprTypeNameImpl2(scope, c.info.TypeOf(s.X), s.X)
+
+	c.out("{").outnl()
+	tmpn := tmpvarname()
+	c.outf("%s %v = ", keytystr, tmpn)
+	c.genExpr(scope, s.X)
+	c.outfh().outnl()
+	c.outf("  for (%s %s = 0; %s < %v; %s++) {",
+		keytystr, keyidstr, keyidstr, tmpn, keyidstr).outnl()
+	c.genBlockStmt(scope, s.Body)
+	c.out("  }").outnl()
+	c.out("}").outnl()
 }
 func (c *g2nc) genIncDecStmt(scope *ast.Scope, s *ast.IncDecStmt) {
 	c.genExpr(scope, s.X)
@@ -1253,17 +1504,19 @@ func (c *g2nc) genSwitchStmt(scope *ast.Scope, s *ast.SwitchStmt) {
 	case *types.Basic:
 		if tty.Kind() == types.String {
 			c.genSwitchStmtStr(scope, s)
-		} else if tty.Info()&types.IsOrdered > 0 {
+		} else if tty.Info()&(types.IsOrdered|types.IsBoolean) > 0 {
 			// c.genSwitchStmtNum(scope, s)
 			c.genSwitchStmtAsIf(scope, s)
 		} else {
-			log.Println("unknown", tagty, reflect.TypeOf(tagty))
+			c.errorf(s.Tag, "unsupported switch on %v", tagty)
 		}
+	case *types.Pointer, *types.Chan:
+		c.genSwitchStmtAsIf(scope, s)
 	default:
 		if tagty == nil {
 			c.genSwitchStmtIf(scope, s)
 		} else {
-			log.Println("unknown", tagty, reflect.TypeOf(tagty))
+			c.errorf(s.Tag, "unsupported switch on %v", tagty)
 		}
 	}
 
@@ -1439,6 +1692,8 @@ func (c *g2nc) genCatchStmtAsIf(scope *ast.Scope, s *ast.CatchStmt) {
 	if s.Init != nil {
 		c.genStmt(scope, s.Init, 0)
 	}
+	tagty := c.info.TypeOf(s.Tag)
+	iserrtag := tagty != nil && isiface2(tagty)
 	lst := s.Body.List
 	tmplabs := []string{}
 	for range lst {
@@ -1451,9 +1706,18 @@ func (c *g2nc) genCatchStmtAsIf(scope *ast.Scope, s *ast.CatchStmt) {
 		c.outf("// %v", exprpos(c.psctx, stmt)).outnl()
 		c.outf("if (")
 		for idx2, exprx := range stmt.List {
-			c.genExpr(scope, s.Tag)
-			c.out(token.EQL.String())
-			c.genExpr(scope, exprx)
+			if iserrtag && !isnilident(exprx) {
+				// errors wrapping it match too, see xgo/builtin/errors.go
+				c.out("cxrt_errors_is(")
+				c.genExpr(scope, s.Tag)
+				c.out(",")
+				c.genExpr(scope, exprx)
+				c.out(")")
+			} else {
+				c.genExpr(scope, s.Tag)
+				c.out(token.EQL.String())
+				c.genExpr(scope, exprx)
+			}
 			c.out(gopp.IfElseStr(idx2 < len(stmt.List)-1, "||", ""))
 		}
 		if len(stmt.List) == 0 { //default
@@ -1531,8 +1795,14 @@ func (c *g2nc) genCallExpr(scope *ast.Scope, te *ast.CallExpr) {
 			c.genCallExprAppend(scope, te)
 		} else if funame == "delete" {
 			c.genCallExprDelete(scope, te)
+		} else if funame == "close" && ischanty2(c.info.TypeOf(te.Args[0])) {
+			c.out("cxrt_chan_close(")
+			c.genExpr(scope, te.Args[0])
+			c.out(")")
 		} else if funame == "println" {
 			c.genCallExprPrintln(scope, te)
+		} else if funame == "asm" && c.isbuiltinobj(be) {
+			c.genCallExprAsm(scope, te)
 		} else if c.funcistype(be) {
 			c.genTypeCtor(scope, te)
 		} else {
@@ -1616,7 +1886,7 @@ func (c *g2nc) genCallExpr(scope *ast.Scope, te *ast.CallExpr) {
 	case *ast.FuncLit:
 		c.genCallExprClosure(scope, te, be)
 	default:
-		log.Println("todo", be, reflect.TypeOf(be))
+		c.errorf(te.Fun, "unsupported call of %v", exprstr(te.Fun))
 	}
 }
 func (c *g2nc) genCallExprMake(scope *ast.Scope, te *ast.CallExpr) {
@@ -1631,19 +1901,7 @@ func (c *g2nc) genCallExprMake(scope *ast.Scope, te *ast.CallExpr) {
 	switch ity := itep.(type) {
 	case *ast.ChanType:
 		log.Println("elemty", reflect.TypeOf(ity.Value), c.info.TypeOf(ity.Value))
-		elemtyx := c.info.TypeOf(ity.Value)
-		log.Println(elemtyx, reflect.TypeOf(elemtyx))
-		switch elemty := elemtyx.(type) {
-		case *types.Basic:
-			switch elemty.Kind() {
-			case types.Int:
-				log.Println("it's chan, and elem int", lenep)
-			default:
-				log.Println("unknown", elemtyx, elemty)
-			}
-		default:
-			log.Println("unknown", elemtyx, elemty)
-		}
+		// elems are passed as pointers, see chanElemTypeName
 		c.out("cxrt_chan_new(")
 		if lenep == nil {
 			c.out("0")
@@ -1665,7 +1923,7 @@ func (c *g2nc) genCallExprMake(scope *ast.Scope, te *ast.CallExpr) {
 		etystr := c.exprTypeNameImpl2(scope, elemtyt, elemtya)
 		c.outf(", sizeof(%v))", etystr)
 	default:
-		log.Println("unknown", itep, ity, lenep)
+		c.errorf(itep, "unsupported make of %v", exprstr(itep))
 	}
 }
 func (c *g2nc) genCallExprLen(scope *ast.Scope, te *ast.CallExpr) {
@@ -1682,8 +1940,15 @@ func (c *g2nc) genCallExprLen(scope *ast.Scope, te *ast.CallExpr) {
 			c.genExpr(scope, be.Sel)
 			c.out(")")
 		default:
-			log.Println("todo", reflect.TypeOf(arg0))
+			c.out("cxhashtable3_size(")
+			c.genExpr(scope, arg0)
+			c.out(")")
 		}
+	} else if ischanty2(argty) {
+		funame := te.Fun.(*ast.Ident).Name
+		c.outf("cxrt_chan_%s(", funame)
+		c.genExpr(scope, arg0)
+		c.out(")")
 	} else if isstrty(argty.String()) {
 		c.out("cxstring3_len(")
 		c.genExpr(scope, arg0)
@@ -1702,7 +1967,7 @@ func (c *g2nc) genCallExprLen(scope *ast.Scope, te *ast.CallExpr) {
 			panic(funame)
 		}
 	} else {
-		log.Println("todo", te.Args, argty)
+		c.errorf(arg0, "unsupported %v of %v", exprstr(te.Fun), argty)
 	}
 }
 func (c *g2nc) genCallExprAppend(scope *ast.Scope, te *ast.CallExpr) {
@@ -1743,7 +2008,7 @@ func (c *g2nc) genCallExprAppend(scope *ast.Scope, te *ast.CallExpr) {
 		}
 
 	} else {
-		log.Println("todo", te.Args, argty)
+		c.errorf(arg0, "unsupported append to %v", argty)
 	}
 }
 func (c *g2nc) genCallExprDelete(scope *ast.Scope, te *ast.CallExpr) {
@@ -1758,18 +2023,18 @@ func (c *g2nc) genCallExprDelete(scope *ast.Scope, te *ast.CallExpr) {
 			case token.STRING:
 				keystr = fmt.Sprintf("cxhashtable3_hash_str(%s)", te.Value)
 			default:
-				log.Println("todo", te.Kind)
+				c.errorf(arg1, "unsupported map key %v, use a variable", te.Value)
 			}
 		case *ast.Ident:
 			keystr = c.exprstr(arg1)
 		default:
-			log.Println("todo", reflect.TypeOf(arg1), arg1, c.exprstr(arg1), c.exprpos(arg0))
+			c.errorf(arg1, "unsupported map key %v, use a variable", exprstr(arg1))
 		}
 		c.outf("cxhashtable3_remove(")
 		c.genExpr(scope, arg0)
 		c.outf(", (voidptr)&%s, 0)", keystr).outfh().outnl()
 	} else {
-		log.Println("todo", te.Args, argty)
+		c.errorf(arg0, "unsupported delete from %v", argty)
 	}
 }
 func (c *g2nc) genCallExprPrintln(scope *ast.Scope, te *ast.CallExpr) {
@@ -1789,7 +2054,12 @@ func (c *g2nc) genCallExprPrintln(scope *ast.Scope, te *ast.CallExpr) {
 	}
 	// c.genExpr(scope, te.Fun)
 	c.out("println2")
-	c.out("(__FILE__, __LINE__, __func__")
+	// the go line, __LINE__ is off by the temporaries generated before
+	if poso := c.psctx.fset.Position(te.Pos()); poso.IsValid() {
+		c.outf("(%q, %d, __func__", poso.Filename, poso.Line)
+	} else {
+		c.out("(__FILE__, __LINE__, __func__")
+	}
 	c.out(gopp.IfElseStr(len(te.Args) > 0, ",", "")).outnl()
 	if len(te.Args) > 0 {
 		var tyfmts []string
@@ -1946,9 +2216,15 @@ func (c *g2nc) genCallExprNorm(scope *ast.Scope, te *ast.CallExpr) {
 					tyname = strings.TrimRight(tyname, "*")
 				}
 				tvar := tmpvarname()
-				c.outf("voidptr %s= cxrt_type2eface((voidptr)&%s_metatype, (voidptr)&", tvar, tyname)
-				c.genExpr(scope, e1)
-				c.out(")").outfh().outnl()
+				if _, isptr := e1tyx.(*types.Pointer); isptr {
+					c.outf("voidptr %s= cxrt_ptr2eface((voidptr)&%s_metatype, (voidptr)", tvar, ptrelemmeta(tyname))
+					c.genExpr(scope, e1)
+					c.outf(", %d)", ptrdepth(e1tyx)).outfh().outnl()
+				} else {
+					c.outf("voidptr %s= cxrt_type2eface((voidptr)&%s_metatype, (voidptr)&", tvar, tyname)
+					c.genExpr(scope, e1)
+					c.out(")").outfh().outnl()
+				}
 				c.outf("cxarray3_append(%s, &%s)", idt.Name, tvar)
 			default:
 				_ = elty
@@ -2035,16 +2311,22 @@ func (c *g2nc) genCallExprNorm(scope *ast.Scope, te *ast.CallExpr) {
 			if _, ok := prmn.(*types.Interface); ok && e1ifc {
 				c.genExpr(scope, e1)
 			} else if _, ok := prmn.(*types.Interface); ok {
-				c.out("cxrt_type2eface((voidptr)&")
 				tyname := c.exprTypeName(scope, e1)
-				if strings.Contains(tyname, "cxstring3") {
-					c.out("string")
+				if _, isptr := e1ty.(*types.Pointer); isptr {
+					c.outf("cxrt_ptr2eface((voidptr)&%s_metatype, (voidptr)", ptrelemmeta(tyname))
+					c.genExpr(scope, e1)
+					c.outf(", %d)", ptrdepth(e1ty))
 				} else {
-					c.out(tyname)
+					c.out("cxrt_type2eface((voidptr)&")
+					if strings.Contains(tyname, "cxstring3") {
+						c.out("string")
+					} else {
+						c.out(tyname)
+					}
+					c.out("_metatype, (voidptr)&")
+					c.genExpr(scope, e1)
+					c.out(")")
 				}
-				c.out("_metatype, (voidptr)&")
-				c.genExpr(scope, e1)
-				c.out(")")
 			} else {
 				c.genExpr(scope, e1)
 			}
@@ -2151,6 +2433,18 @@ func (c *g2nc) genTypeCtor(scope *ast.Scope, te *ast.CallExpr) {
 		switch be.Name {
 		case "string":
 			arg0 := te.Args[0]
+			argty := c.info.TypeOf(arg0)
+			if isruneslicety2(argty) {
+				c.out("cxstring3_from_runes(")
+				c.genExpr(scope, arg0)
+				c.out(")")
+				break
+			} else if isrunety2(argty) {
+				c.out("cxstring3_new_rune(")
+				c.genExpr(scope, arg0)
+				c.out(")")
+				break
+			}
 			switch ce := arg0.(type) {
 			case *ast.BasicLit:
 				c.outf("cxstring3_new_char(%v)", ce.Value)
@@ -2167,7 +2461,8 @@ func (c *g2nc) genTypeCtor(scope *ast.Scope, te *ast.CallExpr) {
 					c.outf("cxstring3_new_char(%v)", ce.Name)
 				}
 			default:
-				log.Println("todo", te.Fun, ce)
+				c.errorf(ce, "unsupported string conversion of %v, use a variable",
+					exprstr(ce))
 			}
 		default:
 			// log.Println(te.Fun, reftyof(te.Fun), c.exprstr(te.Fun))
@@ -2185,11 +2480,17 @@ func (c *g2nc) genTypeCtor(scope *ast.Scope, te *ast.CallExpr) {
 		c.genFuncArgs(scope, te.Args)
 		c.out(")")
 	case *ast.ArrayType:
+		if isruneslicety2(c.info.TypeOf(te)) {
+			c.out("cxstring3_to_runes(")
+			c.genExpr(scope, te.Args[0])
+			c.out(")")
+			break
+		}
 		c.out("cxstring3_dup(")
 		c.genExpr(scope, te.Args[0])
 		c.out(")")
 	default:
-		log.Println("todo", te.Fun, be)
+		c.errorf(te.Fun, "unsupported conversion to %v", exprstr(te.Fun))
 	}
 }
 func (c *g2nc) genFuncArgs(scope *ast.Scope, args []ast.Expr) {
@@ -2355,8 +2656,9 @@ func (c *g2nc) genRecvStmt(scope *ast.Scope, e ast.Expr) {
 	c.out("voidptr rvx = cxrt_chan_recv(")
 	c.genExpr(scope, e)
 	c.out(")").outfh().outnl()
-	c.out(" // c = rv->v").outfh().outnl()
-	c.outf("%s rvp = ((%s*)rvx)->elem", elemtyname, chanargname).outfh().outnl()
+	c.out(" // c = rv->v, zero value from a closed chan").outfh().outnl()
+	c.outf("%s rvp = rvx == nilptr ? (%s){0} : ((%s*)rvx)->elem",
+		elemtyname, elemtyname, chanargname).outfh().outnl()
 
 	if varobj != nil {
 		c.genExpr(scope, varobj.Data.(ast.Expr)) // left
@@ -2365,6 +2667,98 @@ func (c *g2nc) genRecvStmt(scope *ast.Scope, e ast.Expr) {
 
 	c.out("}").outnl()
 }
+
+// the <-ch of a select recv case, nil for send and default
+func selectRecvExpr(comm ast.Stmt) *ast.UnaryExpr {
+	var e ast.Expr
+	switch t := comm.(type) {
+	case *ast.ExprStmt:
+		e = t.X
+	case *ast.AssignStmt:
+		e = t.Rhs[0]
+	default:
+		return nil
+	}
+	for {
+		pe, ok := e.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		e = pe.X
+	}
+	ue, ok := e.(*ast.UnaryExpr)
+	if !ok || ue.Op != token.ARROW {
+		return nil
+	}
+	return ue
+}
+
+// cases go to corona's goselect, then a switch on the chosen index.
+// break leaves the C switch the same as it leaves a go select
+func (c *g2nc) genSelectStmt(scope *ast.Scope, s *ast.SelectStmt) {
+	lst := s.Body.List
+	tmpcases := tmpvarname()
+	c.out("{ // select").outnl()
+	c.outf("voidptr %s[%d]", tmpcases, len(lst)+1).outfh().outnl()
+	for idx, stmtx := range lst {
+		cc := stmtx.(*ast.CommClause)
+		if cc.Comm == nil { // default
+			c.outf("%s[%d] = cxrt_select_case(nilptr, 3, nilptr)", tmpcases, idx).outfh().outnl()
+		} else if ss, ok := cc.Comm.(*ast.SendStmt); ok {
+			var chanargname = "chan_arg_" + c.chanElemTypeName(ss.Chan, true)
+			tmparg := tmpvarname()
+			c.outf("%s* %s = (%s*)cxmalloc(sizeof(%s))",
+				chanargname, tmparg, chanargname, chanargname).outfh().outnl()
+			c.outf("%s->elem = ", tmparg)
+			c.genExpr(scope, ss.Value)
+			c.outfh().outnl()
+			c.outf("%s[%d] = cxrt_select_case(", tmpcases, idx)
+			c.genExpr(scope, ss.Chan)
+			c.outf(", 2, %s)", tmparg).outfh().outnl()
+		} else if ue := selectRecvExpr(cc.Comm); ue != nil {
+			c.outf("%s[%d] = cxrt_select_case(", tmpcases, idx)
+			c.genExpr(scope, ue.X)
+			c.out(", 1, nilptr)").outfh().outnl()
+		} else {
+			c.errorf(cc.Comm, "unsupported select case %T", cc.Comm)
+		}
+	}
+	tmpcasi := tmpvarname()
+	tmpok := tmpvarname()
+	c.outf("int %s = -1", tmpcasi).outfh().outnl()
+	c.outf("bool %s = cxrt_select(%s, %d, &%s)",
+		tmpok, tmpcases, len(lst), tmpcasi).outfh().outnl()
+	c.outf("switch (%s) {", tmpcasi).outnl()
+	for idx, stmtx := range lst {
+		cc := stmtx.(*ast.CommClause)
+		c.outf("case %d: {", idx).outnl()
+		if as, ok := cc.Comm.(*ast.AssignStmt); ok {
+			ue := selectRecvExpr(as)
+			var elemtyname = c.chanElemTypeName(ue.X, false)
+			var chanargname = "chan_arg_" + c.chanElemTypeName(ue.X, true)
+			tmprvx := tmpvarname()
+			c.outf("voidptr %s = cxrt_select_recved(%s[%d])", tmprvx, tmpcases, idx).outfh().outnl()
+			rvstr := fmt.Sprintf("(%s == nilptr ? (%s){0} : ((%s*)%s)->elem)",
+				tmprvx, elemtyname, chanargname, tmprvx)
+			for lidx, lhs := range as.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == "_" {
+					continue
+				}
+				if as.Tok == token.DEFINE {
+					c.out(gopp.IfElseStr(lidx == 0, elemtyname, "bool")).outsp()
+				}
+				c.genExpr(scope, lhs)
+				c.out(" = ", gopp.IfElseStr(lidx == 0, rvstr, tmpok)).outfh().outnl()
+			}
+		}
+		for idx2, s2 := range cc.Body {
+			c.genStmt(scope, s2, idx2)
+		}
+		c.out("} break").outfh().outnl()
+	}
+	c.out("}").outnl()
+	c.out("}").outnl()
+}
 func (c *g2nc) chanElemTypeName(e ast.Expr, trimstar bool) string {
 	var elemtyname = ""
 	chtyx := c.info.TypeOf(e)
@@ -2375,8 +2769,6 @@ func (c *g2nc) chanElemTypeName(e ast.Expr, trimstar bool) string {
 			switch te.Kind() {
 			case types.Int:
 				elemtyname = "int"
-			default:
-				log.Println("unknown", te, te.Kind())
 			}
 		case *types.Pointer:
 			tystr := c.exprTypeNameImpl2(nil, te, e)
@@ -2384,14 +2776,11 @@ func (c *g2nc) chanElemTypeName(e ast.Expr, trimstar bool) string {
 				tystr = strings.Replace(tystr, "*", "p", -1)
 			}
 			return tystr
-		default:
-			log.Println("unknown", t, reflect.TypeOf(t.Elem()))
 		}
-	default:
-		log.Println("unknown", chtyx)
 	}
 	if elemtyname == "" {
-		log.Println("cannot resolve chan element typename", e, reflect.TypeOf(e))
+		c.errorf(e, "unsupported chan element type of %v, use int or a pointer", chtyx)
+		elemtyname = "int"
 	}
 	return elemtyname
 }
@@ -2415,6 +2804,10 @@ func (c *g2nc) genReturnStmt(scope *ast.Scope, e *ast.ReturnStmt) {
 
 			if isiface2(mytyx) && retyx != mytyx && !isnilident(re) {
 				// iface assign
+				mthtab := ""
+				if !isiface2(retyx) {
+					mthtab = c.genMethodTable(scope, retyx)
+				}
 				tvname := tmpvarname()
 				tystr := c.exprTypeNameImpl2(scope, mytyx, nil)
 				tystr = strings.Trim(tystr, "*")
@@ -2426,13 +2819,21 @@ func (c *g2nc) genReturnStmt(scope *ast.Scope, e *ast.ReturnStmt) {
 					c.out("->thisptr")
 				}
 				c.outfh().outnl()
+				c.outf("%s->thismths", tvname).outeq()
+				if isiface2(retyx) {
+					c.genExpr(scope, re)
+					c.out("->thismths")
+				} else {
+					c.out(mthtab)
+				}
+				c.outfh().outnl()
 				unty := mytyx.Underlying().(*types.Interface)
 				for j := 0; j < unty.NumMethods(); j++ {
 					mtho := unty.Method(j)
 					c.outf("%s->%v /*ifaceas*/ = ", tvname, mtho.Name())
 					if isiface2(retyx) {
 						c.genExpr(scope, re)
-						c.out("->thisptr")
+						c.outf("->%s", mtho.Name())
 					} else {
 						retystr := c.exprTypeName(scope, re)
 						retystr = strings.TrimRight(retystr, "*")
@@ -2473,6 +2874,10 @@ func (c *g2nc) genReturnStmt(scope *ast.Scope, e *ast.ReturnStmt) {
 			case *types.Named:
 				if sigty != resty && isiface2(ne.Underlying()) {
 					reset = true
+					mthtab := ""
+					if !isnilident(ae) && !isiface2(resty) {
+						mthtab = c.genMethodTable(scope, resty)
+					}
 					idt := newIdent(tmpvarname())
 					reses = append(reses, idt)
 					tystr := c.exprTypeName(scope, fd.Type.Results.List[idx].Type)
@@ -2483,12 +2888,29 @@ func (c *g2nc) genReturnStmt(scope *ast.Scope, e *ast.ReturnStmt) {
 					undty := ne.Underlying().(*types.Interface)
 					c.outf("%s->thisptr =", idt.Name)
 					c.genExpr(scope, ae)
+					if isiface2(resty) {
+						c.out("->thisptr")
+					}
 					c.outfh().outnl()
 					if isnilident(ae) {
 						c.out(idt.Name).outeq().out("nilptr").outfh().outnl()
 						break
 					}
+					c.outf("%s->thismths =", idt.Name)
+					if isiface2(resty) {
+						c.genExpr(scope, ae)
+						c.out("->thismths")
+					} else {
+						c.out(mthtab)
+					}
+					c.outfh().outnl()
 					for i := 0; i < undty.NumMethods(); i++ {
+						if isiface2(resty) {
+							c.outf("%s->%s = ", idt.Name, undty.Method(i).Name())
+							c.genExpr(scope, ae)
+							c.outf("->%s", undty.Method(i).Name()).outfh().outnl()
+							continue
+						}
 						c.outf("%s->%s = (__typeof__(%s->%s))%s_%s", idt.Name, undty.Method(i).Name(),
 							idt.Name, undty.Method(i).Name(),
 							strings.Trim(c.exprTypeName(scope, ae), "*"), undty.Method(i).Name())
@@ -2496,7 +2918,9 @@ func (c *g2nc) genReturnStmt(scope *ast.Scope, e *ast.ReturnStmt) {
 					}
 				}
 			default:
-				log.Println("todo", reflect.TypeOf(sigty))
+				if isiface2(sigty) && !isiface2(resty) && !isnilident(ae) {
+					c.errorf(ae, "unsupported return of %v as %v", resty, sigty)
+				}
 			}
 			if reset {
 				// reses = append(reses, ae)
@@ -2624,12 +3048,33 @@ func (this *g2nc) genFieldList(scope *ast.Scope, flds *ast.FieldList,
 		if withname && len(fld.Names) > 0 {
 			this.genExpr(scope, fld.Names[0])
 			this.out(gopp.IfElseStr(iscbrackarr, "[]", ""))
+		} else if name := this.embeddedname(fld); withname && name != "" {
+			this.out(name)
 		}
 		outskip := skiplast && (idx == len(flds.List)-1)
 		this.out(gopp.IfElseStr(outskip, "", linebrk))
 	}
 }
 
+// T of an embedded *pkg.T struct field, "" if fld isn't one
+func (c *g2nc) embeddedname(fld *ast.Field) string {
+	e := fld.Type
+	if se, ok := e.(*ast.StarExpr); ok {
+		e = se.X
+	}
+	if se, ok := e.(*ast.SelectorExpr); ok {
+		e = se.Sel
+	}
+	idt, ok := e.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if v, ok := c.info.Defs[idt].(*types.Var); ok && v.Embedded() {
+		return idt.Name
+	}
+	return ""
+}
+
 func (c *g2nc) genStructZeroFields(scope *ast.Scope) {
 	log.Println("zero struct fields")
 }
@@ -2701,7 +3146,7 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 			this.out("void")
 			break
 		}
-		log.Println("todo", te, reflect.TypeOf(e), e.Pos())
+		this.errorf(te, "unsupported array type %v", tystr)
 		this.out(tystr)
 	case *ast.StructType:
 		this.genFieldList(scope, te.Fields, false, true, ";\n", false)
@@ -2771,7 +3216,7 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 					this.genCxmapAddkv(scope, vo.Data, be.Key, be.Value)
 					this.outfh().outnl()
 				default:
-					log.Println("unknown", idx, reflect.TypeOf(ex))
+					this.errorf(ex, "unsupported map literal element %v", idx)
 				}
 			}
 		case *ast.ArrayType:
@@ -2791,14 +3236,12 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 			if be == nil {
 			}
 		case *ast.Ident: // TODO
-			var vo = scope.Lookup("varname")
 			this.outf("%v_new_zero()", this.exprTypeName(scope, be)).outfh().outnl()
-			for _, ex := range te.Elts {
-				this.outf("%v->%v = %v", vo, "todoaaa", ex)
-				this.outfh().outnl()
+			if len(te.Elts) > 0 {
+				this.errorf(te, "unsupported %v literal with fields here", exprstr(be))
 			}
 		default:
-			log.Println("todo", te.Type, reflect.TypeOf(te.Type))
+			this.errorf(te, "unsupported composite literal of %v", exprstr(te.Type))
 		}
 
 	case *ast.CallExpr:
@@ -2835,12 +3278,12 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 					this.out(te.Value)
 				} else {
 					this.outf("unknown %v", e)
-					log.Println("unknown", t.String())
+					this.errorf(te, "unsupported literal %v of %v", te.Value, t)
 				}
 			}
 		default:
 			this.outf("unknown %v", e)
-			log.Println("unknown", e, t, reflect.TypeOf(t))
+			this.errorf(te, "unsupported literal %v of %v", te.Value, t)
 		}
 	case *ast.BinaryExpr:
 		opty := this.info.TypeOf(te.X)
@@ -2852,13 +3295,25 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 				this.out("cxstring3_ne(")
 			case token.ADD:
 				this.out("cxstring3_add(")
+			case token.LSS:
+				this.out("cxstring3_lt(")
+			case token.GTR:
+				this.out("cxstring3_gt(")
+			case token.LEQ:
+				this.out("cxstring3_le(")
+			case token.GEQ:
+				this.out("cxstring3_ge(")
 			default:
-				log.Println("todo", te.Op)
+				this.errorf(te, "unsupported string operator %v", te.Op)
 			}
 			this.genExpr(scope, te.X)
 			this.out(",")
 			this.genExpr(scope, te.Y)
 			this.out(")")
+		} else if (te.Op == token.QUO || te.Op == token.REM) && this.isdivchk(te.Y) {
+			this.genExpr(scope, te.X)
+			this.out(te.Op.String())
+			this.genDivisorChecked(scope, te.Y, te)
 		} else {
 			this.genExpr(scope, te.X)
 			this.out(te.Op.String())
@@ -2897,22 +3352,14 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 			}
 		} else if isstrty(varty.String()) {
 			if vo == nil { // right value
-				this.out("((builtin__cxstring3*)")
-				this.genExpr(scope, te.X)
-				this.out(")->ptr[")
-				this.genExpr(scope, te.Index)
-				this.out("]")
+				this.genStrIndex(scope, te.X, te.Index)
 			} else { // left value
-				this.out("((builtin__cxstring3*)")
-				this.genExpr(scope.Outer, te.X) // temporarily left value
-				this.out(")->ptr[")
-				this.genExpr(scope, te.Index)
-				this.out("]")
+				this.genStrIndex(scope.Outer, te.X, te.Index) // temporarily left value
 				this.out("=")
 				this.genExpr(scope, vo.Data.(ast.Expr))
 			}
 		} else if isinvalidty2(varty) { // index of c type???
-			gopp.Assert(1 == 2, "waitdep", varty)
+			this.errorf(te.X, "unsupported index of %v, its C type is unknown", exprstr(te.X))
 			this.genExpr(scope, te.X)
 			this.out("[")
 			this.genExpr(scope, te.Index)
@@ -2943,8 +3390,14 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 			this.out("[")
 			this.genExpr(scope, te.Index)
 			this.out("] /*warn?*/")
-			log.Println("todo", te.X, te.Index, exprstr(te))
-			log.Println("todo", reftyof(te.X), varty, reftyof(varty), this.exprpos(te.X))
+			switch varty.Underlying().(type) {
+			case *types.Slice, *types.Map:
+				this.errorf(te.X, "unsupported index of %v", varty)
+			default:
+				if isstrty2(varty) {
+					this.errorf(te.X, "unsupported index of %v", varty)
+				}
+			}
 		}
 	case *ast.SliceExpr:
 		varty := this.info.TypeOf(te.X)
@@ -2953,43 +3406,34 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 		if lowe == nil {
 			lowe = newLitInt(0)
 		}
-		if isstrty2(varty) {
-			this.outf("cxstring3_sub(%v, ", te.X)
-			this.genExpr(scope, lowe)
-			this.out(",")
-
-			if highe == nil {
-				this.outf("(%v)->len", te.X)
-			} else {
-				this.genExpr(scope, te.High)
-			}
-			this.out(")")
-		} else if isslicety2(varty) {
-			this.outf("cxarray3_slice(")
+		chksfx := gopp.IfElseStr(this.checks(), "_chk", "")
+		// x[low:] to the _from ones, so x is evaluated once
+		fromsfx := gopp.IfElseStr(highe == nil, "_from", "")
+		if isstrty2(varty) || isslicety2(varty) {
+			fn := gopp.IfElseStr(isstrty2(varty), "cxstring3_sub", "cxarray3_slice")
+			this.outf("%s%s%s(", fn, fromsfx, chksfx)
 			this.genExpr(scope, te.X)
 			this.out(",")
 			this.genExpr(scope, lowe)
-			this.out(",")
-
-			if highe == nil {
-				this.outf("cxarray3_size(")
-				this.genExpr(scope, te.X)
-				this.out(")")
-			} else {
-				this.genExpr(scope, te.High)
+			if highe != nil {
+				this.out(",")
+				this.genExpr(scope, highe)
+			}
+			if this.checks() {
+				this.out(",", this.chkpos(te))
 			}
 			this.out(")")
 		} else {
-			log.Println("todo", varty, te)
+			this.errorf(te.X, "unsupported slice of %v", varty)
 		}
 	case *ast.SelectorExpr:
 		if iscsel(te) {
 		} else {
-			this.genExpr(scope, te.X)
+			this.genNilChecked(scope, te.X)
 			selxty := this.info.TypeOf(te.X)
 			log.Println(selxty, reflect.TypeOf(selxty), te.X, te.Sel)
 			if selxty == nil {
-				gopp.Assert(1 == 2, "waitdep", te)
+				this.errorf(te.X, "unknown type of %v", exprstr(te.X))
 				// c type?
 				this.out(". /* c struct selctorexpr */")
 			} else if isinvalidty2(selxty) && ispackage(this.psctx, te.X) { // package
@@ -3021,13 +3465,13 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 				this.out("*")
 			} else if isvarty(varobj.String()) {
 				this.out("*")
-				this.genExpr(scope, te.X)
+				this.genNilChecked(scope, te.X)
 			} else {
-				log.Println("todo", varobj.Type(), varobj.String())
+				this.errorf(te, "unsupported dereference of %v", varobj)
 			}
 		} else {
 			this.out("*")
-			this.genExpr(scope, te.X)
+			this.genNilChecked(scope, te.X)
 		}
 	case *ast.InterfaceType:
 		if te.Methods != nil && te.Methods.NumFields() > 0 {
@@ -3049,7 +3493,7 @@ func (this *g2nc) genExpr2(scope *ast.Scope, e ast.Expr) {
 		this.outf("%s%s", this.pkgpfx(), closi.fnname).outfh().outnl()
 	default:
 		this.outf("unknown %v", e)
-		log.Println("unknown", reflect.TypeOf(e), e, te)
+		this.errorf(e, "unsupported expression %T", e)
 	}
 }
 func (c *g2nc) genCxmapAddkv(scope *ast.Scope, vnamex interface{}, ke ast.Expr, vei interface{}) {
@@ -3083,10 +3527,10 @@ func (c *g2nc) genCxmapAddkv(scope *ast.Scope, vnamex interface{}, ke ast.Expr,
 			sym := fmt.Sprintf("%v->%v", be.X, be.Sel)
 			keystr = sym
 		default:
-			log.Println("unknown", varty, ke)
+			c.errorf(ke, "unsupported map key %v of %v, use a variable", exprstr(ke), varty)
 		}
 	default:
-		log.Println("unknown index key", ke, reflect.TypeOf(ke))
+		c.errorf(ke, "unsupported map key %v, use a variable", exprstr(ke))
 	}
 
 	valstr := ""
@@ -3095,8 +3539,6 @@ func (c *g2nc) genCxmapAddkv(scope *ast.Scope, vnamex interface{}, ke ast.Expr,
 		valstr = be.Value
 	case *ast.Ident:
 		valstr = be.Name
-	default:
-		log.Println("unknown", vei, reflect.TypeOf(ke), reflect.TypeOf(vei))
 	}
 
 	c.outf("cxhashtable3_add(")
@@ -3184,13 +3626,17 @@ func (c *g2nc) genCxarrSet(scope *ast.Scope, vname ast.Expr, vidx ast.Expr, elem
 	c.out(tname).outeq()
 	c.genExpr(scope, elem.(ast.Expr))
 	c.outfh().outnl()
-	c.outf("cxarray3_replace_at(")
+	c.outf("cxarray3_replace_at%s(", gopp.IfElseStr(c.checks(), "_chk", ""))
 	c.genExpr(scope, vname)
 	c.outf(", (voidptr)&")
 	c.out(tname)
 	c.out(",")
 	c.genExpr(scope, vidx)
-	c.outf(", nilptr)").outfh().outnl()
+	c.outf(", nilptr")
+	if c.checks() {
+		c.out(",", c.chkpos(vidx))
+	}
+	c.out(")").outfh().outnl()
 }
 func (c *g2nc) genCxarrGet(scope *ast.Scope, vname ast.Expr, vidx ast.Expr, varty types.Type) {
 	var elemty types.Type
@@ -3223,12 +3669,265 @@ func (c *g2nc) genCxarrGet(scope *ast.Scope, vname ast.Expr, vidx ast.Expr, vart
 	tystr := c.exprTypeName(scope, vname)
 	tystr = c.exprTypeNameImpl2(scope, elemty, nil)
 	c.outf("*(%v*)", tystr)
-	c.outf("cxarray3_get_at(")
+	c.outf("cxarray3_get_at%s(", gopp.IfElseStr(c.checks(), "_chk", ""))
 	c.genExpr(scope, vname)
 	c.out(",")
 	c.genExpr(scope, vidx)
+	if c.checks() {
+		c.out(",", c.chkpos(vidx))
+	}
 	c.out(")").outnl()
 }
+
+// runtime checks, see xgo/builtin/checks.go
+func (c *g2nc) checks() bool { return !*nochecks && !c.nochecks }
+
+func (c *g2nc) isbuiltinobj(idt *ast.Ident) bool {
+	obj := c.info.ObjectOf(idt)
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Name() == "builtin"
+}
+
+func (c *g2nc) conststr(e ast.Expr) (string, bool) {
+	tv, ok := c.info.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// asm(code, asmout("=r", x), asmin("r", y), asmclob("memory"))
+// => __asm__ volatile("code" : "=r"(x) : "r"(y) : "memory")
+// operands are numbered outputs first then inputs, like gcc.
+func (c *g2nc) genCallExprAsm(scope *ast.Scope, te *ast.CallExpr) {
+	code, ok := c.conststr(te.Args[0])
+	if !ok {
+		c.errorf(te.Args[0], "asm code must be a constant string")
+		return
+	}
+	var outs, ins, clobs []string
+	var outes, ines []ast.Expr
+	var outws []int
+	for _, arg := range te.Args[1:] {
+		ce, ok := arg.(*ast.CallExpr)
+		var fnidt *ast.Ident
+		if ok {
+			fnidt, ok = ce.Fun.(*ast.Ident)
+		}
+		if !ok || !c.isbuiltinobj(fnidt) {
+			c.errorf(arg, "asm operand must be asmout, asmin or asmclob")
+			continue
+		}
+		if fnidt.Name == "asmclob" {
+			for _, ae := range ce.Args {
+				reg, ok := c.conststr(ae)
+				if !ok {
+					c.errorf(ae, "asm clobber must be a constant string")
+					continue
+				}
+				clobs = append(clobs, fmt.Sprintf("%q", reg))
+			}
+			continue
+		}
+		cons, ok := c.conststr(ce.Args[0])
+		if !ok {
+			c.errorf(ce.Args[0], "asm constraint must be a constant string")
+			continue
+		}
+		opnd := ce.Args[1]
+		isout := strings.HasPrefix(cons, "=") || strings.HasPrefix(cons, "+")
+		switch fnidt.Name {
+		case "asmout":
+			if !isout {
+				c.errorf(ce.Args[0], "asm output constraint %q must start with = or +", cons)
+			}
+			switch opnd.(type) {
+			case *ast.Ident, *ast.SelectorExpr, *ast.StarExpr, *ast.IndexExpr:
+			default:
+				c.errorf(opnd, "asm output %v is not assignable", exprstr(opnd))
+			}
+			outs = append(outs, fmt.Sprintf("%q", cons))
+			outes = append(outes, opnd)
+			outws = append(outws, c.chkasmopnd(cons, opnd))
+		case "asmin":
+			if isout {
+				c.errorf(ce.Args[0], "asm input constraint %q can not be an output", cons)
+			}
+			ins = append(ins, fmt.Sprintf("%q", cons))
+			ines = append(ines, opnd)
+			width := c.chkasmopnd(cons, opnd)
+			// matching constraint, same register as output n
+			if n, err := strconv.Atoi(cons); err == nil {
+				if n >= len(outws) {
+					c.errorf(ce.Args[0], "asm input %q matches no output", cons)
+				} else if width != outws[n] {
+					c.errorf(opnd, "asm input %v is %d bytes, output %d is %d bytes",
+						exprstr(opnd), width, n, outws[n])
+				}
+			}
+		default:
+			c.errorf(arg, "asm operand must be asmout, asmin or asmclob")
+		}
+	}
+	nopnd := len(outes) + len(ines)
+	for i := 0; i+1 < len(code); i++ {
+		if code[i] != '%' {
+			continue
+		}
+		if code[i+1] == '%' {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(code) && code[j] >= 'a' && code[j] <= 'z' {
+			j++ // operand modifiers, %k0, %w1
+		}
+		n := 0
+		isnum := false
+		for ; j < len(code) && code[j] >= '0' && code[j] <= '9'; j++ {
+			n = n*10 + int(code[j]-'0')
+			isnum = true
+		}
+		if isnum && n >= nopnd {
+			c.errorf(te.Args[0], "asm code refers operand %%%d, only %d given", n, nopnd)
+		}
+	}
+
+	c.outf("__asm__ volatile(%q", code)
+	genopnds := func(conss []string, es []ast.Expr) {
+		c.out(":")
+		for idx, e := range es {
+			c.out(conss[idx], "(")
+			c.genExpr(scope, e)
+			c.out(")")
+			c.out(gopp.IfElseStr(idx+1 < len(es), ", ", ""))
+		}
+	}
+	if len(outes)+len(ines)+len(clobs) > 0 {
+		genopnds(outs, outes)
+	}
+	if len(ines)+len(clobs) > 0 {
+		genopnds(ins, ines)
+	}
+	if len(clobs) > 0 {
+		c.out(":", strings.Join(clobs, ", "))
+	}
+	c.out(")")
+}
+
+// operand type must fit the register class of the constraint,
+// gives its width in bytes, 0 if it is not a scalar
+func (c *g2nc) chkasmopnd(cons string, e ast.Expr) int {
+	ty := c.info.TypeOf(e)
+	if ty == nil {
+		return 0
+	}
+	width := 0
+	isflt := false
+	switch uty := ty.Underlying().(type) {
+	case *types.Basic:
+		switch uty.Kind() {
+		case types.Bool, types.Int8, types.Uint8:
+			width = 1
+		case types.Int16, types.Uint16:
+			width = 2
+		case types.Int32, types.Uint32:
+			width = 4
+		case types.Int, types.Uint, types.UntypedInt, types.UntypedRune:
+			width = 4 // a C int
+		case types.Float32:
+			width, isflt = 4, true
+		case types.Float64:
+			width, isflt = 8, true
+		case types.String:
+		default:
+			if uty.Info()&(types.IsInteger|types.IsPointer) != 0 {
+				width = 8 // int64, uint64, uintptr, unsafe.Pointer
+			}
+		}
+	case *types.Pointer, *types.Signature, *types.Chan, *types.Map, *types.Slice:
+		width = 8
+	}
+
+	cls := strings.TrimLeft(cons, "=+&")
+	for _, cc := range cls {
+		switch cc {
+		case 'm', 'o', 'V', 'g', 'X':
+			// memory or anything
+			return width
+		case 'i', 'n':
+			if tv := c.info.Types[e]; tv.Value == nil {
+				c.errorf(e, "asm operand %v is not a constant for %q", exprstr(e), cons)
+			}
+			return width
+		case 'x', 'f', 't', 'u':
+			if !isflt {
+				c.errorf(e, "asm operand %v of type %v needs a float for %q", exprstr(e), ty, cons)
+			}
+			return width
+		case 'r', 'q', 'Q', 'R', 'a', 'b', 'c', 'd', 'S', 'D':
+			if width == 0 || isflt {
+				c.errorf(e, "asm operand %v of type %v does not fit a register for %q",
+					exprstr(e), ty, cons)
+			}
+			return width
+		}
+	}
+	return width
+}
+
+// integer divisor y, unless it is a constant
+func (c *g2nc) isdivchk(y ast.Expr) bool {
+	if !c.checks() {
+		return false
+	}
+	tv, ok := c.info.Types[y]
+	if !ok || tv.Value != nil {
+		return false
+	}
+	ty, ok := tv.Type.Underlying().(*types.Basic)
+	return ok && ty.Info()&types.IsInteger != 0
+}
+
+// divisor y checked for zero, still of its own type, not int64
+func (c *g2nc) genDivisorChecked(scope *ast.Scope, y ast.Expr, posnode ast.Node) {
+	c.outf("((%s)cxrt_chkdiv(", c.exprTypeNameImpl2(scope, c.info.TypeOf(y), y))
+	c.genExpr(scope, y)
+	c.out(",", c.chkpos(posnode), "))")
+}
+
+// the byte vname[vidx] of string vname, vname evaluated once
+func (c *g2nc) genStrIndex(scope *ast.Scope, vname ast.Expr, vidx ast.Expr) {
+	if !c.checks() {
+		c.out("((builtin__cxstring3*)")
+		c.genExpr(scope, vname)
+		c.out(")->ptr[")
+		c.genExpr(scope, vidx)
+		c.out("]")
+		return
+	}
+	c.out("(*cxstring3_at_chk(")
+	c.genExpr(scope, vname)
+	c.out(",")
+	c.genExpr(scope, vidx)
+	c.out(",", c.chkpos(vidx), "))")
+}
+
+// pointer e, as a nil checked one
+func (c *g2nc) genNilChecked(scope *ast.Scope, e ast.Expr) {
+	ety := c.info.TypeOf(e)
+	if _, ok := ety.(*types.Pointer); !ok || !c.checks() {
+		c.genExpr(scope, e)
+		return
+	}
+	c.outf("((%s)cxrt_chknil(", c.exprTypeNameImpl2(scope, ety, e))
+	c.genExpr(scope, e)
+	c.out(",", c.chkpos(e), "))")
+}
+
+// go position of e for runtime check failures, C string literal
+func (c *g2nc) chkpos(e ast.Node) string {
+	return fmt.Sprintf("%q", c.exprpos(e).String())
+}
 func (this *g2nc) exprTypeName(scope *ast.Scope, e ast.Expr) string {
 	// log.Println(e, reflect.TypeOf(e))
 	tyname := this.exprTypeNameImpl(scope, e)
@@ -3288,7 +3987,6 @@ func (this *g2nc) exprTypeNameImpl2(scope *ast.Scope, ety types.Type, e ast.Expr
 	}
 
 	goty := ety
-	tyval, isudty := this.strtypes[goty.String()]
 	log.Println(goty, reftyof(goty), e, reftyof(e), exprstr(e))
 
 	switch te := goty.(type) {
@@ -3335,13 +4033,14 @@ func (this *g2nc) exprTypeNameImpl2(scope *ast.Scope, ety types.Type, e ast.Expr
 				return undty.String()
 			}
 			return fmt.Sprintf("%s%s%s", pkgo.Name(), pkgsep, teobj.Name())
-		case *types.Array:
-			// tyname := teobj.Name()
 		default:
+			// slices, maps, funcs etc are the same as unnamed in C
 			gopp.G_USED(ne)
 		}
-		log.Println("todo", teobj.Name(), reflect.TypeOf(undty), goty)
-		return "/*todo*/" + teobj.Name()
+		if _, ok := undty.(*types.Signature); ok {
+			e = nil // the func type of its TypeSpec, see genFunctypesDecl
+		}
+		return this.exprTypeNameImpl2(scope, undty, e)
 		// return sign2rety(te.String())
 	case *types.Pointer:
 		tystr := this.exprTypeNameImpl2(scope, te.Elem(), e)
@@ -3373,7 +4072,7 @@ func (this *g2nc) exprTypeNameImpl2(scope *ast.Scope, ety types.Type, e ast.Expr
 			if closi, ok := this.closidx[fe]; ok {
 				return this.pkgpfx() + closi.fntype
 			} else {
-				log.Println("todo", goty, reflect.TypeOf(goty), isudty, tyval, te)
+				this.errorf(fe, "unsupported func literal here")
 			}
 		case *ast.Ident:
 			return te.String()
@@ -3402,7 +4101,7 @@ func (this *g2nc) exprTypeNameImpl2(scope *ast.Scope, ety types.Type, e ast.Expr
 		}
 		gopp.Assert(1 == 2, "wtfff", te.String())
 	default:
-		log.Println("todo", goty, exprstr(e), reftyof(goty), isudty, tyval, te, this.exprpos(e))
+		this.errorf(e, "unsupported type %v", goty)
 		return te.String() + "/*todo*/"
 	}
 
@@ -3529,7 +4228,7 @@ func (this *g2nc) genGenDecl(scope *ast.Scope, d *ast.GenDecl) {
 			this.outf("// import %v by %s", tspec.Path, this.exprpos(tspec)).outnl().outnl()
 			// log.Println(tspec.Comment)
 		default:
-			log.Println("unknown", reflect.TypeOf(d), reflect.TypeOf(spec))
+			this.errorf(spec, "unsupported declaration")
 		}
 	}
 }
@@ -3666,6 +4365,7 @@ func (this *g2nc) genTypeSpec(scope *ast.Scope, spec *ast.TypeSpec) {
 			this.pkgpfx(), spec.Name).outfh().outnl()
 		this.outf("struct %s%s {", this.pkgpfx(), spec.Name).outnl()
 		this.out("voidptr thisptr").outfh().outnl()
+		this.out("cxmethods* thismths").outfh().outnl()
 		for _, fld := range te.Methods.List {
 			switch fldty := fld.Type.(type) {
 			case *ast.FuncType:
@@ -3685,7 +4385,7 @@ func (this *g2nc) genTypeSpec(scope *ast.Scope, spec *ast.TypeSpec) {
 					this.out(")").outfh().outnl()
 				}
 			default:
-				log.Println("todo", fld.Type, reflect.TypeOf(fld.Type))
+				this.errorf(fld.Type, "unsupported embedded interface %v", exprstr(fld.Type))
 			}
 		}
 		this.out("}").outfh().outnl()
@@ -3694,18 +4394,27 @@ func (this *g2nc) genTypeSpec(scope *ast.Scope, spec *ast.TypeSpec) {
 		this.outf("(%s%s*)cxmalloc(sizeof(%s%s))", this.pkgpfx(), spec.Name.Name, this.pkgpfx(), spec.Name.Name)
 		this.outfh().outnl()
 		this.out("}").outnl().outnl()
+		// for interface{} args, what is kept is the pointer to the box
+		this.outf("static const _metatype %s%s_metatype = {", this.pkgpfx(), spec.Name.Name)
+		this.outnl()
+		this.outf(".kind = %d, // interface", reflect.Interface).outnl()
+		this.out(".size = sizeof(voidptr),").outnl()
+		this.out(".align = alignof(voidptr),").outnl()
+		this.outf(".tystr = \"%s%s\",", this.pkgpfx(), spec.Name.Name).outnl()
+		this.out("}").outfh().outnl()
+		this.outnl()
+	case *ast.FuncType:
+		// a typedef of its own, see genFunctypesDecl
+		this.outf("// func type %s%s", this.pkgpfx(), spec.Name.Name).outnl()
 	case *ast.ArrayType:
-		log.Println("todo", spec.Name, spec.Type, reflect.TypeOf(spec.Type), te)
-		log.Println("todo", te.Elt, te.Len, this.exprstr(te))
 		tystr := this.exprstr(te)
 		if tystr == "[0]byte" {
-			log.Println("todo", "hehe")
 			// this.out("void...")
 			break
 		}
-		this.out("todo", tystr)
+		this.errorf(spec, "unsupported named type %v of %v", spec.Name, tystr)
 	default:
-		log.Println("todo", spec.Name, spec.Type, reflect.TypeOf(spec.Type), te)
+		this.errorf(spec, "unsupported named type %v of %v", spec.Name, exprstr(spec.Type))
 	}
 }
 
@@ -3765,7 +4474,7 @@ func (c *g2nc) genValueSpec(scope *ast.Scope, spec *ast.ValueSpec, validx int) {
 		}
 		if varty == nil {
 			varty = types.Typ[types.UntypedInt]
-			log.Println("todo", spec.Values[idx], types.ExprString(spec.Values[idx]))
+			c.errorf(spec.Values[idx], "unknown type of %v", exprstr(spec.Values[idx]))
 		}
 		if varty == nil {
 			panic("ddd")
@@ -3831,7 +4540,8 @@ func (c *g2nc) genValueSpec(scope *ast.Scope, spec *ast.ValueSpec, validx int) {
 			c.valnames[spec.Values[idx]] = varname
 			scope = putscope(scope, ast.Var, "varname", varname)
 			if isglobvar && (isstrty2(varty) || isslicety2(varty) ||
-				isarrayty2(varty) || isstructty2(varty) || ismapty2(varty)) {
+				isarrayty2(varty) || isstructty2(varty) || ismapty2(varty) ||
+				c.isglobcallinit(spec.Values[idx])) {
 				c.out(cuzero)
 			} else {
 				c.genExpr(scope, spec.Values[idx])
@@ -3878,6 +4588,22 @@ func (c *g2nc) genValueSpec(scope *ast.Scope, spec *ast.ValueSpec, validx int) {
 
 }
 
+// var ErrFoo = errors.New("foo"), a function call is no constant
+// initializer in C, assigned in globvars_init instead
+func (c *g2nc) isglobcallinit(vale ast.Expr) bool {
+	ce, ok := vale.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	if tv, ok := c.info.Types[ce]; ok && tv.Value != nil {
+		return false
+	}
+	if tv, ok := c.info.Types[ce.Fun]; ok && tv.IsType() {
+		return false // conversion
+	}
+	return true
+}
+
 func (c *g2nc) genInitGlobvars(scope *ast.Scope, pkg *ast.Package) {
 	c.outf("void %sglobvars_init() {", c.pkgpfx()).outnl()
 	for _, varx := range c.psctx.globvars {
@@ -3900,6 +4626,9 @@ func (c *g2nc) genInitGlobvars(scope *ast.Scope, pkg *ast.Package) {
 			default:
 				gopp.G_USED(goty)
 			}
+			if idx < len(varo.Values) && c.isglobcallinit(varo.Values[idx]) {
+				keepon = true
+			}
 			if !keepon {
 				c.out("// soon ", exprstr(name), " ", c.exprpos(name).String()).outnl()
 				continue
@@ -3916,6 +4645,7 @@ func (c *g2nc) genInitGlobvars(scope *ast.Scope, pkg *ast.Package) {
 		}
 	}
 	c.out("}").outnl()
+	c.clinereset()
 }
 
 func (this *g2nc) outsp() *g2nc   { return this.out(" ") }
@@ -3935,14 +4665,22 @@ func (this *g2nc) outf(format string, args ...interface{}) *g2nc {
 	this.out(s)
 	return this
 }
+
+// #line directive, so C compiler errors and debug info refer to go source.
+// use the full path, debuggers need to find the file
 func (this *g2nc) clinema(e ast.Node) *g2nc {
-	poso := this.exprpos(e) // file:row:col
-	fields := strings.Split(poso.String(), ":")
-	if len(fields) > 1 {
-		this.outf("// #line %s %s", fields[1], fields[0]).outnl()
-	} else {
-		this.outf("// #line %v", fields).outnl()
+	poso := this.psctx.fset.Position(e.Pos()) // file:row:col
+	if !poso.IsValid() {
+		return this
 	}
+	this.outnl().outf("#line %d %q", poso.Line, poso.Filename).outnl()
+	return this
+}
+
+// back to the C source after a #line span, resolved by fixclines
+// once the line numbers of foo.c are known (after clang-format)
+func (this *g2nc) clinereset() *g2nc {
+	this.outnl().out(clineresetmark).outnl()
 	return this
 }
 
@@ -4102,6 +4840,16 @@ typedef struct cxiface {
     ifacetab* itab; // itab
     voidptr data;
 } cxiface;
+typedef struct cxmethod {
+    charptr name;
+    charptr sig; // func(error) bool
+    voidptr fnptr;
+} cxmethod;
+typedef struct cxmethods {
+    charptr tystr; // the concrete type, main__foo*
+    int count;
+    cxmethod* mths;
+} cxmethods;
 
 `
 	return precgodefs
@@ -40,12 +40,57 @@ func isstrty2(typ types.Type) bool {
 	}
 	return isstrty(typ.String())
 }
+
+// prefix of the _metatype the elem of a pointer C type boxes to,
+// main__foo** => main__foo, builtin__cxstring3** => string
+func ptrelemmeta(tystr string) string {
+	tystr = strings.TrimRight(tystr, "*")
+	if tystr == "builtin__cxstring3" {
+		return "string"
+	}
+	return tystr
+}
+
+// levels of pointers, 2 for **T
+func ptrdepth(typ types.Type) int {
+	n := 0
+	for {
+		ptrty, ok := typ.(*types.Pointer)
+		if !ok {
+			return n
+		}
+		typ = ptrty.Elem()
+		n++
+	}
+}
 func iscstrty2(typ types.Type) bool {
 	tystr := typ.String()
 	return strings.HasPrefix(tystr, "*") && strings.HasSuffix(tystr, "_Ctype_char")
 }
 func isslicety(tystr string) bool    { return strings.HasPrefix(tystr, "[]") }
 func isslicety2(typ types.Type) bool { return isslicety(typ.String()) }
+
+// rune or any integer other than byte, string(x) of it encodes utf8
+func isrunety2(typ types.Type) bool {
+	if typ == nil {
+		return false
+	}
+	if ty, ok := typ.Underlying().(*types.Basic); ok {
+		return ty.Info()&types.IsInteger != 0 && ty.Kind() != types.Uint8 &&
+			ty.Kind() != types.UntypedInt
+	}
+	return false
+}
+func isruneslicety2(typ types.Type) bool {
+	if typ == nil {
+		return false
+	}
+	if ty, ok := typ.Underlying().(*types.Slice); ok {
+		elty, ok := ty.Elem().Underlying().(*types.Basic)
+		return ok && elty.Kind() == types.Int32
+	}
+	return false
+}
 func isarrayty(tystr string) bool {
 	s := ""
 	for _, c := range tystr {
@@ -581,6 +626,9 @@ type Annotation struct {
 	noinline       bool
 	nodefer        bool
 
+	// cygo:
+	nochecks bool // no runtime bounds/nil/div checks
+
 	exported   bool
 	exportname string
 }
@@ -610,6 +658,9 @@ func newAnnotation(cmts *ast.CommentGroup) *Annotation {
 			if strings.HasPrefix(line, "//go:noinline") {
 				ant.noinline = true
 			}
+			if strings.HasPrefix(line, "//cygo:nochecks") {
+				ant.nochecks = true
+			}
 			if strings.HasPrefix(line, "//go:linkname ") {
 				fields := strings.Split(line, " ")
 				ant.linkname = fields[1]
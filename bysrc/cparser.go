@@ -43,6 +43,7 @@ type cparser1 struct {
 	trn   *sitter.Tree
 
 	hdrfiles map[string]int // filepath => lineno, reorder
+	cflags   []string       // -I/-D of #cgo CFLAGS
 }
 type stfieldlist map[string]*stfield
 type stfield struct {
@@ -109,12 +110,14 @@ func newcsymdata(name string, kind int) *csymdata {
 }
 func (csym *csymdata) KindName() string { return csym_kind2str(csym.kind) }
 
-// 当前进程有效
+// 当前进程有效, persisted per preamble by cparsercache.go
 type cparser1cache struct {
 	// 当前进程生成的preprocessor文件表
 	ppfiles  map[string]int // filepath => 1
 	hdrfiles map[string]int // filepath => lineno
 	csyms    map[string]*csymdata
+	// the preamble being parsed, what it sees goes here too, see parsestr
+	delta *cparser1cache
 }
 
 func newcparser1cache() *cparser1cache {
@@ -127,20 +130,25 @@ func newcparser1cache() *cparser1cache {
 
 func (cp1c *cparser1cache) add(kind int, symname string, tyvalx interface{}) {
 	symname = strings.Replace(symname, " ", "_", -1)
-	if _, ok := cp1c.csyms[symname]; ok {
-		return
+	csi, ok := cp1c.csyms[symname]
+	if !ok {
+		csi = newcsymdata(symname, kind)
+		switch kind {
+		case csym_define:
+			csi.define = tyvalx.(ast.Expr)
+		case csym_struct:
+			csi.struc = stfieldlist{}
+		default:
+			csi.tyval = tyvalx.(string)
+		}
+		cp1c.csyms[symname] = csi
 	}
-
-	csi := newcsymdata(symname, kind)
-	switch kind {
-	case csym_define:
-		csi.define = tyvalx.(ast.Expr)
-	case csym_struct:
-		csi.struc = stfieldlist{}
-	default:
-		csi.tyval = tyvalx.(string)
+	// shared, so add_field on the table fills the delta's too
+	if cp1c.delta != nil {
+		if _, ok := cp1c.delta.csyms[symname]; !ok {
+			cp1c.delta.csyms[symname] = csi
+		}
 	}
-	cp1c.csyms[symname] = csi
 }
 func (cp1c *cparser1cache) add_field(stname string, fldname string, fldty string) *csymdata {
 	stname2 := strings.ReplaceAll(stname, " ", "_")
@@ -156,8 +164,10 @@ func (cp1c *cparser1cache) getsym(symname string) (*csymdata, bool) {
 
 var cp1cache = newcparser1cache()
 
+const tccppfilepfx = "/tmp/tcctrspp."
+
 func rmoldtccppfiles() {
-	files, err := filepath.Glob("/tmp/tcctrspp*.c")
+	files, err := filepath.Glob(tccppfilepfx + "*.c")
 	gopp.ErrPrint(err)
 	for _, filename := range files {
 		if _, ok := cp1cache.ppfiles[filename]; ok {
@@ -168,14 +178,37 @@ func rmoldtccppfiles() {
 	}
 }
 
+// symbols go to cp1cache, from the disk cache if the preamble and
+// its headers didn't change, see cparsercache.go
 func (cp *cparser1) parsestr(code string) error {
+	key := cp1cachekey(code, cp.cflags)
+	if cpc := loadcp1cache(key); cpc != nil {
+		cp1cache.merge(cpc)
+		cp.hdrfiles = cpc.hdrfiles
+		log.Println("cparser cache hit", cp.name, len(cpc.csyms))
+		return nil
+	}
+
+	// parse into the shared table, and collect what this preamble
+	// sees into a delta to save it on its own
+	cpc := newcparser1cache()
+	cp1cache.delta = cpc
+	err := cp.parsestr2(code)
+	cp1cache.delta = nil
+	if err == nil {
+		savecp1cache(key, cp.hdrfiles, cpc)
+	}
+	return err
+}
+
+func (cp *cparser1) parsestr2(code string) error {
 	rmoldtccppfiles()
-	filename := fmt.Sprintf("/tmp/tcctrspp.%s.%d.c", cp.name, rand.Intn(10000000)+50000)
+	filename := fmt.Sprintf(tccppfilepfx+"%s.%d.c", cp.name, rand.Intn(10000000)+50000)
 	cp1cache.ppfiles[filename] = 1
 
 	code = codepfx + code
 	btime := time.Now()
-	err := tccpp(code, filename, nil)
+	err := tccpp(code, filename, cp.cflags)
 	gopp.ErrPrint(err, cp.name, filename)
 	log.Println("tccpp", cp.name, err, time.Since(btime))
 	if err != nil {
@@ -191,14 +224,15 @@ func (cp *cparser1) parsestr(code string) error {
 	btime = time.Now()
 	cp.pplines = strings.Split(string(cp.ppsrc), "\n")
 	cp.cltfiles()
-	bcc = []byte(strings.Join(cp.clrlines, "\n"))
+	bcc = []byte(cleancppext(strings.Join(cp.clrlines, "\n")))
+	cp.clrlines = strings.Split(string(bcc), "\n")
 	cp.ppsrc = bcc
 	cp.pplines = cp.clrlines
 	cp.clrlines = nil
 	log.Println("clrpp", cp.name, time.Since(btime))
 
 	btime = time.Now()
-	// TODO 现在只能parse tcc -E 的结果，parse gcc -E的结果有问题
+	// tcc -E, or gcc/clang -E with the gnu extensions cleaned
 	trn := cp.prsit.Parse(nil, bcc)
 	cp.trn = trn
 	log.Println("trsit parse", cp.name, time.Since(btime))
@@ -218,6 +252,9 @@ func (cp *cparser1) fill_hotfixs() {
 	cp1cache.add(csym_var, "__func__", "char*")
 	cp1cache.add(csym_var, "errno", "int")
 	cp1cache.add(csym_var, "NULL", "void*")
+	// builtin types of gcc/clang
+	cp1cache.add(csym_type, "__builtin_va_list", "void*")
+	cp1cache.add(csym_type, "__gnuc_va_list", "void*")
 }
 func (cp *cparser1) collect() {
 	// cp.pplines = strings.Split(string(cp.ppsrc), "\n")
@@ -225,7 +262,7 @@ func (cp *cparser1) collect() {
 	cp.fill_hotfixs()
 	cp.cltdefines()
 	btime := time.Now()
-	cp.walk(cp.trn.RootNode(), 0) // TODO slow
+	cp.walk(cp.trn.RootNode(), 0) // slow, the result is cached on disk
 	results := map[string]interface{}{
 		"hdrfiles": len(cp.hdrfiles),
 		"csyms":    len(cp1cache.csyms),
@@ -829,11 +866,21 @@ func (cp *cparser1) cltfiles() {
 	for idx, line := range cp.pplines {
 		if strings.HasPrefix(line, "# ") {
 			// log.Println("header file?", idx, line)
-			fields := strings.Split(line, " ")
-			hdrfile := strings.Trim(fields[2], "\"<>")
+			// # 12 "/usr/include/stdio.h" 1 3 4, gcc/clang have the flags
+			hdrfile := ""
+			if bpos := strings.Index(line, "\""); bpos > 0 {
+				if epos := strings.LastIndex(line, "\""); epos > bpos {
+					hdrfile = line[bpos+1 : epos]
+				}
+			}
+			if hdrfile == "" {
+				continue
+			}
 			if _, ok := cp.hdrfiles[hdrfile]; !ok {
 				cp.hdrfiles[hdrfile] = idx
 			}
+		} else if strings.HasPrefix(line, "#") {
+			// #pragma, #ident of gcc
 		} else {
 			clrlines = append(clrlines, line)
 		}
@@ -844,10 +891,19 @@ func (cp *cparser1) cltfiles() {
 
 func (cp *cparser1) cltdefines() {
 	btime := time.Now()
+	// a header read for another preamble is read again for the delta
+	seen := cp1cache.ppfiles
+	if cp1cache.delta != nil {
+		seen = cp1cache.delta.ppfiles
+	}
 	for hdrfile, _ := range cp.hdrfiles {
-		if _, ok := cp1cache.ppfiles[hdrfile]; ok {
+		if _, ok := seen[hdrfile]; ok {
 			continue
 		}
+		if strings.HasPrefix(hdrfile, "<") {
+			continue // <built-in>, <command-line> of gcc
+		}
+		seen[hdrfile] = 1
 		cp1cache.ppfiles[hdrfile] = 1
 
 		bcc, err := ioutil.ReadFile(hdrfile)
@@ -1207,8 +1263,14 @@ func (cp *cparser1) ctype2go(sym, tystr string) (tystr2 string, tyobj types.Type
 		tyobj = (*types.Tuple)(nil)
 	case "int*", "int *":
 		tyobj = types.NewPointer(types.Typ[types.Int])
-	case "long long int":
+	case "long long int", "long long", "long long signed int":
 		tyobj = types.Typ[types.Int64]
+	case "signed char":
+		tyobj = types.Typ[types.Int8]
+	case "long unsigned int", "long long unsigned int":
+		tyobj = types.Typ[types.Uint64]
+	case "short unsigned int":
+		tyobj = types.Typ[types.Uint16]
 	case "long int", "long":
 		tyobj = types.Typ[types.Int64]
 	case "unsigned long", "unsigned long int", "ulong":
@@ -371,7 +371,7 @@ func (cp *cparser2) dumpdecls1() {
 
 func cprsavetmp(cpname string, code string) (string, error) {
 	rmoldtccppfiles()
-	filename := fmt.Sprintf("/tmp/tcctrspp.%s.%d.c", cpname, rand.Intn(10000000)+50000)
+	filename := fmt.Sprintf(tccppfilepfx+"%s.%d.c", cpname, rand.Intn(10000000)+50000)
 	cp1cache.ppfiles[filename] = 1
 	err := ioutil.WriteFile(filename, []byte(code), 0644)
 	return filename, err
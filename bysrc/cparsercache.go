@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"gopp"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cparser1cache persisted across runs, one file per C preamble, keyed by
+// the preamble, preprocessor, -I/-D flags and include dirs. Headers it was parsed from
+// are recorded with size and mtime, any change is a miss.
+// $CYGO_CACHE, by default ~/.cache/cygo, CYGO_CACHE=off to disable.
+
+const cp1cacheversion = "2" // bump when the symbol collecting changes
+
+type cp1diskcache struct {
+	Hdrs map[string]cp1hdrstamp
+	Syms []cp1disksym
+}
+type cp1hdrstamp struct {
+	Size  int64
+	Mtime int64
+}
+type cp1disksym struct {
+	Kind   int
+	Name   string
+	Tyval  string
+	Define string // go expr
+	Fields []cp1diskfield
+}
+type cp1diskfield struct {
+	Name  string
+	Tystr string
+	Idx   int
+}
+
+func cp1cachedir() string {
+	dir := os.Getenv("CYGO_CACHE")
+	if dir == "off" {
+		return ""
+	}
+	if dir == "" {
+		usrdir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(usrdir, "cygo")
+	}
+	return filepath.Join(dir, "cparser")
+}
+
+func cp1cachekey(code string, cflags []string) string {
+	hasher := sha256.New()
+	cpp := getcpp()
+	for _, str := range []string{cp1cacheversion, cpp.Name(), codepfx, code,
+		strings.Join(cflags, "\x00"), strings.Join(cpp.Incdirs(), "\x00")} {
+		hasher.Write([]byte(str))
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func hdrstamp(hdrfile string) (cp1hdrstamp, bool) {
+	fi, err := os.Stat(hdrfile)
+	if err != nil {
+		return cp1hdrstamp{}, false
+	}
+	return cp1hdrstamp{fi.Size(), fi.ModTime().UnixNano()}, true
+}
+
+// nil if not cached or any header changed
+func loadcp1cache(key string) *cparser1cache {
+	cachedir := cp1cachedir()
+	if cachedir == "" {
+		return nil
+	}
+	fo, err := os.Open(filepath.Join(cachedir, key+".gob"))
+	if err != nil {
+		return nil
+	}
+	defer fo.Close()
+	dc := &cp1diskcache{}
+	err = gob.NewDecoder(fo).Decode(dc)
+	if err != nil {
+		log.Println("bad cparser cache", key, err)
+		return nil
+	}
+	for hdrfile, stamp := range dc.Hdrs {
+		if stamp2, ok := hdrstamp(hdrfile); !ok || stamp2 != stamp {
+			log.Println("cparser cache stale", key, hdrfile)
+			return nil
+		}
+	}
+
+	cpc := newcparser1cache()
+	for _, sym := range dc.Syms {
+		switch sym.Kind {
+		case csym_define:
+			ve, err := parser.ParseExpr(sym.Define)
+			if err != nil {
+				log.Println("bad cparser cache", key, sym.Name, err)
+				return nil
+			}
+			cpc.add(sym.Kind, sym.Name, ve)
+		case csym_struct:
+			cpc.add(sym.Kind, sym.Name, stfieldlist{})
+			for _, fld := range sym.Fields {
+				cpc.csyms[sym.Name].struc[fld.Name] = &stfield{fld.Name, fld.Tystr, nil, fld.Idx}
+			}
+		default:
+			cpc.add(sym.Kind, sym.Name, sym.Tyval)
+		}
+	}
+	for hdrfile := range dc.Hdrs {
+		cpc.hdrfiles[hdrfile] = 0
+	}
+	return cpc
+}
+
+func savecp1cache(key string, hdrfiles map[string]int, cpc *cparser1cache) {
+	cachedir := cp1cachedir()
+	if cachedir == "" {
+		return
+	}
+	dc := &cp1diskcache{Hdrs: map[string]cp1hdrstamp{}}
+	for hdrfile := range hdrfiles {
+		if !filepath.IsAbs(hdrfile) || strings.HasPrefix(hdrfile, tccppfilepfx) {
+			continue // <built-in>, and the preamble itself which is in the key
+		}
+		stamp, ok := hdrstamp(hdrfile)
+		if !ok {
+			return // can not tell if changed
+		}
+		dc.Hdrs[hdrfile] = stamp
+	}
+	for _, csi := range cpc.csyms {
+		sym := cp1disksym{Kind: csi.kind, Name: csi.name, Tyval: csi.tyval}
+		if csi.define != nil {
+			str, ok := defineexprstr(csi.define)
+			if !ok {
+				// a warm build must see what a cold one does
+				log.Println("cparser cache skipped", key, csi.name, str)
+				return
+			}
+			sym.Define = str
+		}
+		for _, fld := range csi.struc {
+			sym.Fields = append(sym.Fields, cp1diskfield{fld.name, fld.tystr, fld.idx})
+		}
+		dc.Syms = append(dc.Syms, sym)
+	}
+
+	err := os.MkdirAll(cachedir, 0755)
+	gopp.ErrPrint(err, cachedir)
+	// write then rename, concurrent builds read whole files only
+	tmpfile := filepath.Join(cachedir, key+".gob.tmp"+strconv.Itoa(os.Getpid()))
+	fo, err := os.Create(tmpfile)
+	if err != nil {
+		gopp.ErrPrint(err, tmpfile)
+		return
+	}
+	err = gob.NewEncoder(fo).Encode(dc)
+	fo.Close()
+	if err == nil {
+		err = os.Rename(tmpfile, filepath.Join(cachedir, key+".gob"))
+	}
+	if err != nil {
+		gopp.ErrPrint(err, tmpfile)
+		os.Remove(tmpfile)
+	}
+}
+
+// source of a #define's go expr that parses back, false if it doesn't
+func defineexprstr(e ast.Expr) (string, bool) {
+	var buf bytes.Buffer
+	err := printer.Fprint(&buf, token.NewFileSet(), e)
+	if err != nil {
+		return err.Error(), false
+	}
+	str := buf.String()
+	if _, err := parser.ParseExpr(str); err != nil {
+		return str, false
+	}
+	return str, true
+}
+
+// symbols of other not in cp1c, first one wins like when parsed in order
+func (cp1c *cparser1cache) merge(other *cparser1cache) {
+	for name, csi := range other.csyms {
+		csi0, ok := cp1c.csyms[name]
+		if !ok {
+			cp1c.csyms[name] = csi
+			continue
+		}
+		if csi0.kind == csym_struct && csi.kind == csym_struct {
+			for fldname, fld := range csi.struc {
+				if _, ok := csi0.struc[fldname]; !ok {
+					csi0.struc[fldname] = fld
+				}
+			}
+		}
+	}
+	for filename := range other.ppfiles {
+		cp1c.ppfiles[filename] = 1
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+)
+
+// gcc/clang -E output has gnu extensions tree-sitter-c parses wrong,
+// they are dropped or replaced by standard C before parsing.
+// newlines are kept so rows stay the same.
+
+// keyword => replacement
+var cppextwords = map[string]string{
+	"__extension__": "",
+	"__restrict":    "restrict",
+	"__restrict__":  "restrict",
+	"__inline":      "inline",
+	"__inline__":    "inline",
+	"__const":       "const",
+	"__const__":     "const",
+	"__volatile":    "volatile",
+	"__volatile__":  "volatile",
+	"__signed":      "signed",
+	"__signed__":    "signed",
+	"_Noreturn":     "",
+	"__thread":      "",
+	"_Thread_local": "",
+	"_Float32":      "float",
+	"_Float64":      "double",
+	"_Float32x":     "double",
+	"_Float64x":     "long double",
+	"_Float128":     "long double",
+	"__float128":    "long double",
+}
+
+// keyword(...), dropped with the parens
+var cppextcalls = map[string]bool{
+	"__attribute__":  true,
+	"__attribute":    true,
+	"__asm__":        true, // int foo() __asm__("foo64"); and asm statements
+	"__asm":          true,
+	"__declspec":     true,
+	"_Alignas":       true,
+	"_Static_assert": true,
+}
+
+func isidentch(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// index after the ) matching src[pos] == '(', len(src) if unbalanced
+func skipparens(src string, pos int) int {
+	depth := 0
+	for i := pos; i < len(src); i++ {
+		switch src[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '"', '\'':
+			i = skipquoted(src, i) - 1
+		}
+	}
+	return len(src)
+}
+
+// index after the string or char literal starting at pos
+func skipquoted(src string, pos int) int {
+	quote := src[pos]
+	for i := pos + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote, '\n':
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+func skipspaces(src string, pos int) int {
+	for pos < len(src) && (src[pos] == ' ' || src[pos] == '\t' || src[pos] == '\n') {
+		pos++
+	}
+	return pos
+}
+
+// only the newlines of src[bpos:epos]
+func keepnewlines(src string, bpos, epos int) string {
+	return strings.Repeat("\n", strings.Count(src[bpos:epos], "\n"))
+}
+
+func cleancppext(src string) string {
+	var sb strings.Builder
+	sb.Grow(len(src))
+	for i := 0; i < len(src); {
+		ch := src[i]
+		if ch == '"' || ch == '\'' {
+			epos := skipquoted(src, i)
+			sb.WriteString(src[i:epos])
+			i = epos
+			continue
+		}
+		if !isidentch(ch) {
+			sb.WriteByte(ch)
+			i++
+			continue
+		}
+		epos := i
+		for epos < len(src) && isidentch(src[epos]) {
+			epos++
+		}
+		word := src[i:epos]
+
+		if repl, ok := cppextwords[word]; ok {
+			sb.WriteString(repl)
+			i = epos
+			continue
+		}
+		if cppextcalls[word] {
+			// __asm__ volatile goto (...)
+			pos := skipspaces(src, epos)
+			for _, qual := range []string{"volatile", "__volatile__", "goto", "inline"} {
+				if strings.HasPrefix(src[pos:], qual) &&
+					(pos+len(qual) == len(src) || !isidentch(src[pos+len(qual)])) {
+					pos = skipspaces(src, pos+len(qual))
+				}
+			}
+			if pos < len(src) && src[pos] == '(' {
+				pos = skipparens(src, pos)
+				sb.WriteString(keepnewlines(src, i, pos))
+				i = pos
+				continue
+			}
+		}
+		if word == "_Atomic" {
+			// _Atomic(int) => int, _Atomic int => int
+			pos := skipspaces(src, epos)
+			if pos < len(src) && src[pos] == '(' {
+				epos2 := skipparens(src, pos)
+				inner := src[pos+1 : epos2-1]
+				sb.WriteString(keepnewlines(src, i, pos+1))
+				sb.WriteString(cleancppext(inner))
+				i = epos2
+				continue
+			}
+			i = epos
+			continue
+		}
+		sb.WriteString(word)
+		i = epos
+	}
+	return sb.String()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// compiler diagnostics, with go source positions, reported as
+//
+//	file:line:col: error: message
+//
+// or with -json one object per line on stdout, for editors.
+// Any error stops the build before writing C code.
+
+const (
+	diagerror = "error"
+	diagwarn  = "warning"
+)
+
+type diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Severity string `json:"severity"`
+	Msg      string `json:"message"`
+}
+
+func (d *diagnostic) String() string {
+	pos := token.Position{Filename: d.File, Line: d.Line, Column: d.Col}
+	if pos.Filename == "" && !pos.IsValid() {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Msg)
+	}
+	return fmt.Sprintf("%v: %s: %s", pos, d.Severity, d.Msg)
+}
+
+type diagnostics struct {
+	mu      sync.Mutex
+	items   []*diagnostic
+	nerrs   int
+	jsonout bool
+	printed int // items already written
+}
+
+var diags = &diagnostics{}
+
+func (dg *diagnostics) add(pos token.Position, severity string, format string, args ...interface{}) {
+	d := &diagnostic{}
+	d.File = trimgopath(pos.Filename)
+	d.Line = pos.Line
+	d.Col = pos.Column
+	d.Severity = severity
+	d.Msg = fmt.Sprintf(format, args...)
+
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	for _, d1 := range dg.items {
+		if *d1 == *d {
+			return // the same node reached twice
+		}
+	}
+	dg.items = append(dg.items, d)
+	if severity == diagerror {
+		dg.nerrs++
+	}
+}
+func (dg *diagnostics) errorf(pos token.Position, format string, args ...interface{}) {
+	dg.add(pos, diagerror, format, args...)
+}
+func (dg *diagnostics) warnf(pos token.Position, format string, args ...interface{}) {
+	dg.add(pos, diagwarn, format, args...)
+}
+
+// parser and type checker errors
+func (dg *diagnostics) adderr(err error, severity string) {
+	switch te := err.(type) {
+	case scanner.ErrorList:
+		for _, e := range te {
+			dg.add(e.Pos, severity, "%s", e.Msg)
+		}
+	case *scanner.Error:
+		dg.add(te.Pos, severity, "%s", te.Msg)
+	case types.Error:
+		dg.add(te.Fset.Position(te.Pos), severity, "%s", te.Msg)
+	default:
+		dg.add(token.Position{}, severity, "%v", err)
+	}
+}
+
+func (dg *diagnostics) haserrs() bool {
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	return dg.nerrs > 0
+}
+
+// flush writes what is not written yet, ordered by position
+func (dg *diagnostics) flush() {
+	dg.mu.Lock()
+	defer dg.mu.Unlock()
+	items := dg.items[dg.printed:]
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	var w io.Writer = os.Stderr
+	if dg.jsonout {
+		w = os.Stdout
+	}
+	enc := json.NewEncoder(w)
+	for _, d := range items {
+		if dg.jsonout {
+			enc.Encode(d)
+		} else {
+			fmt.Fprintln(w, d.String())
+		}
+	}
+	dg.printed = len(dg.items)
+}
+
+// exitiferrs stops the build if anything went wrong so far
+func (dg *diagnostics) exitiferrs() {
+	if !dg.haserrs() {
+		return
+	}
+	dg.flush()
+	os.Exit(1)
+}
+
+// e may be nil, for types not written in the source
+func (c *basecomp) errorf(e ast.Node, format string, args ...interface{}) {
+	diags.errorf(c.nodepos(e), format, args...)
+}
+func (c *basecomp) warnf(e ast.Node, format string, args ...interface{}) {
+	diags.warnf(c.nodepos(e), format, args...)
+}
+func (c *basecomp) nodepos(e ast.Node) token.Position {
+	if e == nil || reflect.ValueOf(e).IsNil() {
+		return token.Position{}
+	}
+	return c.psctx.fset.Position(e.Pos())
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cygo/golden"
+)
+
+// TestGolden transpiles each package in tpkgs the way utests.sh does,
+// compiles opkgs/foo.c with the local C compiler against the cxrt runtime,
+// runs it and compares its output and exit status with
+// tpkgs/<pkg>/expected.out, see package golden. Known gaps are listed in
+// tpkgs/golden.skip.
+//
+// The runtime libraries (libcrn.a etc, see CMakeLists.txt) are looked up in
+// $CXRT_LIBDIR, by default this directory. $CYGO_CFLAGS and $CYGO_LDFLAGS
+// are appended to the compile command.
+func TestGolden(t *testing.T) {
+	cc := os.Getenv("CC")
+	if cc == "" {
+		cc = "cc"
+	}
+	if _, err := exec.LookPath(cc); err != nil {
+		t.Skipf("%s not found: %v", cc, err)
+	}
+	libdir := os.Getenv("CXRT_LIBDIR")
+	if libdir == "" {
+		libdir = "."
+	}
+	libdir, _ = filepath.Abs(libdir)
+	if _, err := os.Stat(filepath.Join(libdir, "libcrn.a")); err != nil {
+		t.Skipf("cxrt runtime not built, set CXRT_LIBDIR: %v", err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "cygo-golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	transpiler := filepath.Join(tmpdir, "bysrc")
+	gobuild := exec.Command("go", "build", "-o", transpiler, ".")
+	if out, err := gobuild.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	err = os.MkdirAll("opkgs", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Run(t, "tpkgs", "tpkgs/golden.skip",
+		func(name, dir, exepath string) error {
+			return buildGolden(transpiler, cc, libdir, "./"+dir+"/", exepath)
+		})
+}
+
+func buildGolden(transpiler, cc, libdir, pkgdir, exepath string) error {
+	os.Remove("opkgs/foo.c")
+	os.Remove("opkgs/foo.c.cflags")
+	os.Remove("opkgs/foo.c.ldflags")
+	cmdo := exec.Command(transpiler, pkgdir)
+	out, err := cmdo.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("transpile: %v\n%s", err, golden.LastLines(out, 30))
+	}
+	if _, err := os.Stat("opkgs/foo.c"); err != nil {
+		return fmt.Errorf("transpile: %v\n%s", err, golden.LastLines(out, 30))
+	}
+
+	rootdir, _ := filepath.Abs("..")
+	args := []string{
+		"-std=c11", "-D_GNU_SOURCE", "-DGC_THREADS", "-g", "-O0",
+		"-I" + filepath.Join(rootdir, "src"),
+		"-I" + filepath.Join(rootdir, "include"),
+		"-I" + filepath.Join(rootdir, "corona-c"),
+		"-I" + filepath.Join(rootdir, "3rdparty/cltc/src/include"),
+		"-I" + filepath.Join(rootdir, "3rdparty/cltc/src"),
+	}
+	// the #cgo flags of all packages the program uses
+	cflags, err := ioutil.ReadFile("opkgs/foo.c.cflags")
+	if err != nil {
+		return fmt.Errorf("transpile: %v", err)
+	}
+	ldflags, err := ioutil.ReadFile("opkgs/foo.c.ldflags")
+	if err != nil {
+		return fmt.Errorf("transpile: %v", err)
+	}
+	args = append(args, strings.Fields(string(cflags))...)
+	args = append(args, strings.Fields(os.Getenv("CYGO_CFLAGS"))...)
+	args = append(args, "-o", exepath, "opkgs/foo.c", "-L"+libdir)
+	args = append(args, strings.Fields(string(ldflags))...)
+	args = append(args, "-lc")
+	args = append(args, strings.Fields(os.Getenv("CYGO_LDFLAGS"))...)
+	cmdo = exec.Command(cc, args...)
+	out, err = cmdo.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v\n%s", cc, err, golden.LastLines(out, 30))
+	}
+	return nil
+}
@@ -29,8 +29,10 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/thoas/go-funk"
@@ -175,30 +177,35 @@ func restorestdout(cfp *C.FILE) {
 
 ///
 // TODO stdio.h:27: error: include file 'bits/libc-header-start.h' not found
-func tccpp(codebuf string, filename string, incdirs []string) error {
-	const (
-		ppk_tccfly = 1
-		ppk_tcccmd = 2
-		ppk_gcccmd = 3
-	)
-	var ppkind = ppk_tcccmd
-	switch ppkind {
-	case ppk_tccfly:
-		return tccppfly(codebuf, filename, incdirs)
-	case ppk_tcccmd:
-		return tccppcmd(codebuf, filename, incdirs)
-	case ppk_gcccmd: // TODO still not work!!!
-		return gccppcmd(codebuf, filename, incdirs)
+func tccpp(codebuf string, filename string, cflags []string) error {
+	return getcpp().String(codebuf, filename, cflags...)
+}
+
+// -cpp, tcc by default
+func getcpp() Cpreprocessor {
+	switch *cppname {
+	case "tccfly":
+		return tccflypp{}
+	case "tcc", "gcc", "clang":
+		return cmdpp{*cppname}
 	default:
-		panic("not support")
+		log.Fatalln("unknown -cpp", *cppname)
 	}
+	return nil
 }
 
-func tccppfly(codebuf string, filename string, incdirs []string) error {
+// in process by libtcc
+type tccflypp struct{}
+
+func (tccflypp) Name() string { return "tccfly" }
+
+func (tccflypp) Incdirs() []string { return get_compile_incdirs("tcc") }
+
+func (pp tccflypp) String(codebuf string, filename string, cflags ...string) error {
 	tcc := newTcc()
 	rv := tcc.AddSysIncdir("/usr/include")
 	tcc.AddSysIncdir("/usr/lib/tcc/include")
-	tcc.AddIncdirs(incdirs...)
+	tcc.AddIncdirs(pp.Incdirs()...)
 	tcc.AddLibdir("/usr/lib")
 	tcc.AddLib("c")
 	// rv := tcc.AddFile("/usr/lib/crtn.o")
@@ -209,7 +216,9 @@ func tccppfly(codebuf string, filename string, incdirs []string) error {
 	// tcc.SetOutputType(TCC_OUTPUT_MEMORY)
 	tcc.SetOptions("-o " + filename)
 	tcc.SetOptions("-v -E")
-	tcc.SetOptions("-DGC_THREADS")
+	if len(cflags) > 0 {
+		tcc.SetOptions(strings.Join(cflags, " "))
+	}
 
 	cfp := redirstdout2file(filename)
 	rv = tcc.CompileStr(codebuf)
@@ -221,53 +230,54 @@ func tccppfly(codebuf string, filename string, incdirs []string) error {
 		return fmt.Errorf("run error %d", rv)
 	}
 	if gopp.FileSize(filename) == 0 {
-		return fmt.Errorf("empty cppout file", filename)
+		return fmt.Errorf("empty cppout file %s", filename)
 	}
 	return nil
 }
 
-func xccppsave(codebuf string, filename string) (string, error) {
+func (pp tccflypp) File(codefile string, filename string, cflags ...string) error {
+	bcc, err := ioutil.ReadFile(codefile)
+	if err != nil {
+		return err
+	}
+	return pp.String(string(bcc), filename, cflags...)
+}
+
+// tcc/gcc/clang -E
+type cmdpp struct {
+	exe string
+}
+
+func (pp cmdpp) Name() string { return pp.exe }
+
+func (pp cmdpp) Incdirs() []string { return get_compile_incdirs(pp.exe) }
+
+func (pp cmdpp) String(codebuf string, filename string, cflags ...string) error {
 	srcfile := filename + ".nopp.c"
 	err := ioutil.WriteFile(srcfile, []byte(codebuf), 0644)
 	gopp.ErrPrint(err, filename)
-
-	return srcfile, err
+	if err != nil {
+		return err
+	}
+	defer os.Remove(srcfile)
+	return pp.File(srcfile, filename, cflags...)
 }
 
-// contains -Dfoo=1 -I bar
-func xccpp_cmd_args(isgcc bool, srcfile, filename string) []string {
+// contains -Dfoo=1 -I bar, cflags are the package's #cgo ones
+func (pp cmdpp) File(codefile string, filename string, cflags ...string) error {
 	var args []string
-	args = append(args, gopp.IfElseStr(isgcc, "gcc", "tcc"))
-	for _, incdir := range get_compile_incdirs(false) {
+	for _, incdir := range pp.Incdirs() {
 		args = append(args, "-I", incdir)
 	}
-	for _, defitem := range get_compile_predefs() {
-		args = append(args, defitem)
-	}
-	args = append(args, "-E", "-o", filename, srcfile)
-	return args
-}
-
-func tccppcmd(codebuf string, filename string, incdirs []string) error {
-	srcfile, err := xccppsave(codebuf, filename)
-	defer os.Remove(srcfile)
-	args := xccpp_cmd_args(false, srcfile, filename)
-	cmdo := exec.Command(args[0], args[1:]...)
-	errout, err := cmdo.CombinedOutput()
-	gopp.ErrPrint(err, cmdo.Path, cmdo.Args, string(errout))
-
-	return err
-}
-
-func gccppcmd(codebuf string, filename string, incdirs []string) error {
-	srcfile, err := xccppsave(codebuf, filename)
-	defer os.Remove(srcfile)
-	args := xccpp_cmd_args(true, srcfile, filename)
-	cmdo := exec.Command(args[0], args[1:]...)
+	args = append(args, cflags...)
+	args = append(args, "-E", "-o", filename, codefile)
+	cmdo := exec.Command(pp.exe, args...)
 	errout, err := cmdo.CombinedOutput()
 	gopp.ErrPrint(err, cmdo.Path, cmdo.Args, string(errout))
-
-	return err
+	if err != nil {
+		return fmt.Errorf("%s -E: %v\n%s", pp.exe, err, errout)
+	}
+	return nil
 }
 
 var preincdirs = []string{
@@ -317,8 +327,8 @@ func init_cxrtroot() {
 	}
 }
 
-// default tcc
-func get_compile_incdirs(isgcc bool) []string {
+// of cppname, tcc/tccfly, gcc or clang
+func get_compile_incdirs(cppname string) []string {
 	var incdirs []string
 	wkdir, err := os.Getwd()
 	gopp.ErrPrint(err)
@@ -331,19 +341,36 @@ func get_compile_incdirs(isgcc bool) []string {
 		}
 		incdirs = append(incdirs, d)
 	}
-	if isgcc {
-		incdirs = append(incdirs, "/usr/lib/gcc/x86_64-pc-linux-gnu/9.2.1/include")
-	} else {
+	switch cppname {
+	case "gcc":
+		if incdir := gccincdir(); incdir != "" {
+			incdirs = append(incdirs, incdir)
+		}
+	case "clang":
+		// its own resource dir comes first anyway
+	default:
 		incdirs = append(incdirs, cxrtroot+"/3rdparty/tcc")
 		incdirs = append(incdirs, "/usr/lib/tcc/include/")
 	}
 	return incdirs
 }
 
-// -Dfoo=1 -Dbar=2
-func get_compile_predefs() []string {
-	predefs := "-DGC_THREADS" // TODO auto from #cgo pragma
-	return strings.Fields(predefs)
+var gccincdiro struct {
+	sync.Once
+	dir string
+}
+
+// gcc's own include dir, stddef.h etc, of whatever version is installed
+func gccincdir() string {
+	gccincdiro.Do(func() {
+		out, err := exec.Command("gcc", "-print-file-name=include").Output()
+		gopp.ErrPrint(err)
+		dir := strings.TrimSpace(string(out))
+		if err == nil && filepath.IsAbs(dir) {
+			gccincdiro.dir = dir
+		}
+	})
+	return gccincdiro.dir
 }
 
 // "-DFOO=1 -DBAR -DBAZ=fff"
@@ -375,10 +402,14 @@ func cp2_split_predefs(predefs string) map[string]interface{} {
 	return res
 }
 
-// C preprocessor
+// C preprocessor, tcc by default, -cpp gcc/clang for headers only the
+// system compiler can handle. cparser1 cleans up the gnu extensions
+// in their output.
 type Cpreprocessor interface {
-	String(codebuf string, filename string, incdirs ...string) error
-	File(codefile string, filename string, incdirs ...string) error
+	Name() string
+	Incdirs() []string
+	String(codebuf string, filename string, cflags ...string) error
+	File(codefile string, filename string, cflags ...string) error
 }
 
 // C compile env populator
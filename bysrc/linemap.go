@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generated C code between go statements, see g2nc.clinereset
+const clineresetmark = "// cxline reset"
+
+// go position of a run of C lines
+type clinerange struct {
+	cfirst int
+	clast  int
+	gofile string
+	goline int  // of cfirst
+	glue   bool // all at goline, C code between go spans
+}
+
+// fixclines resolves the reset marks in the generated C file fname to
+// #line directives pointing back to fname itself, and writes the sidecar
+// fname.linemap with the go position of each C line range and the go name
+// of each C function, which xgo/xlog uses for backtraces.
+//
+// With keepdirs false all the #line directives are dropped, so that debug
+// info refers to the C code, and only the linemap knows the go positions.
+// The first line names fname by its absolute path either way, the debug
+// info has it so, and so has the C record, for xlog to tell its frames
+// from those of other C files.
+// Either way the C lines after a reset, fiber and export wrappers, init
+// funcs, are at foo.c in the debug info, the linemap puts them at the go
+// line before, of the declaration they were generated for.
+//
+// run after clang-format, which moves the C lines around. gofile is the
+// rest of the line, it may have spaces.
+//
+//	C <cfile>
+//	F <cfuncname> <gofuncname>
+//	L <cfirst> <clast> <goline> <gofile>
+//	G <cfirst> <clast> <goline> <gofile>
+func fixclines(fname string, comps []*g2nc, keepdirs bool) error {
+	bcc, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	absfname, err := filepath.Abs(fname)
+	if err != nil {
+		return err
+	}
+
+	outlines := []string{fmt.Sprintf("#line 2 %q", absfname)}
+	ranges := []*clinerange{}
+	var currng *clinerange
+	gofile, goline := "", 0     // of the next line, if gofile != ""
+	gluefile, glueline := "", 0 // the last go line, for the lines after a reset
+	for _, line := range strings.Split(string(bcc), "\n") {
+		cline := len(outlines) + 1
+		trline := strings.TrimSpace(line)
+		if trline == clineresetmark {
+			if keepdirs {
+				outlines = append(outlines,
+					fmt.Sprintf("#line %d %q", cline+1, absfname))
+			}
+			if gofile != "" {
+				gluefile, glueline = gofile, goline-1
+			}
+			gofile, currng = "", nil
+			continue
+		}
+		if strings.HasPrefix(trline, "#line ") {
+			fields := strings.SplitN(trline, " ", 3)
+			lineno, err1 := strconv.Atoi(fields[1])
+			file, err2 := strconv.Unquote(fields[len(fields)-1])
+			if len(fields) == 3 && err1 == nil && err2 == nil {
+				gofile, goline, currng = file, lineno, nil
+			}
+			if keepdirs {
+				outlines = append(outlines, line)
+			}
+			continue
+		}
+		outlines = append(outlines, line)
+		if gofile == "" {
+			if gluefile == "" {
+				continue
+			}
+			if currng == nil {
+				currng = &clinerange{cfirst: cline, gofile: gluefile, goline: glueline, glue: true}
+				ranges = append(ranges, currng)
+			}
+			currng.clast = cline
+			continue
+		}
+		if currng == nil {
+			currng = &clinerange{cfirst: cline, gofile: gofile, goline: goline}
+			ranges = append(ranges, currng)
+		}
+		currng.clast = cline
+		goline++
+	}
+
+	err = ioutil.WriteFile(fname, []byte(strings.Join(outlines, "\n")), 0644)
+	if err != nil {
+		return err
+	}
+
+	cfuncs := []string{}
+	gofuncs := map[string]string{}
+	for _, comp := range comps {
+		for cname, goname := range comp.cfuncs {
+			cfuncs = append(cfuncs, cname)
+			gofuncs[cname] = goname
+		}
+	}
+	sort.Strings(cfuncs)
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("C %s\n", absfname))
+	for _, cname := range cfuncs {
+		sb.WriteString(fmt.Sprintf("F %s %s\n", cname, gofuncs[cname]))
+	}
+	for _, rng := range ranges {
+		kind := "L"
+		if rng.glue {
+			kind = "G"
+		}
+		sb.WriteString(fmt.Sprintf("%s %d %d %d %s\n",
+			kind, rng.cfirst, rng.clast, rng.goline, rng.gofile))
+	}
+	return ioutil.WriteFile(fname+".linemap", []byte(sb.String()), 0644)
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"gopp"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
-	"runtime"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,11 +17,21 @@ import (
 
 var fname string
 
+var jsondiags = flag.Bool("json", false, "print diagnostics as json, one object per line on stdout")
+var nochecks = flag.Bool("nochecks", false, "no runtime index, slice, nil and divide by zero checks")
+var cppname = flag.String("cpp", "tcc", "C preprocessor for cgo preambles, tcc, tccfly, gcc or clang")
+var buildmode = flag.String("buildmode", bmexe, "exe, or c-archive/c-shared to build opkgs/lib<pkg>.a/.so and .h")
+
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+	diags.jsonout = *jsondiags
+	if flag.NArg() < 1 {
 		log.Fatalln("must specify a go source file to tranpiler")
 	}
-	fname = os.Args[1]
+	fname = flag.Arg(0)
+	if *buildmode != bmexe && !islibmode() {
+		log.Fatalln("unknown -buildmode", *buildmode)
+	}
 	fio, err := os.Lstat(fname)
 	gopp.ErrPrint(err)
 	if err != nil {
@@ -29,7 +41,6 @@ func main() {
 		log.Fatalln("Not a dir", fname)
 	}
 
-	gopaths := gopp.Gopaths()
 	builtin_imppath := "xgo/builtin"
 	builtin_pkgpath := find_builtin_path(builtin_imppath)
 	gopp.Assert(builtin_pkgpath != "", "not found", builtin_imppath)
@@ -45,7 +56,8 @@ func main() {
 	fill_builtin_methods(bimths)
 
 	var builtin_psctx *ParserContext
-	gopaths = append(gopaths, runtime.GOROOT())
+	// package dir => import path, resolved through go.mod, see modload.go
+	pkgimppaths := map[string]string{builtin_pkgpath: builtin_imppath, fname: "main"}
 
 	for len(pkgpaths) > 0 {
 		fname := pkgpaths[0]
@@ -83,14 +95,15 @@ func main() {
 				imppath == "internal/race" {
 				continue
 			}
-			for _, gopath1 := range gopaths {
-				impdir := gopath1 + "/src/" + imppath
-				if gopp.FileExist(impdir) {
-					log.Println("got", impdir)
-					pkgpaths = append(pkgpaths, impdir+":"+pkgrenames[imppath])
-					break
-				}
+			impdir := resolveimport(imppath, fname)
+			if impdir == "" {
+				continue // C
+			}
+			log.Println("got", impdir)
+			if _, ok := pkgimppaths[impdir]; !ok {
+				pkgimppaths[impdir] = imppath
 			}
+			pkgpaths = append(pkgpaths, impdir+":"+pkgrenames[imppath])
 		}
 		log.Println("=================", fname)
 		dedups[fname] = true
@@ -104,9 +117,7 @@ func main() {
 	pkgnodeg := map[string]graph.Node{}
 	for i := len(comps) - 1; i >= 0; i-- {
 		psctx := comps[i].psctx
-		curpkg := psctx.path
-		curpkg = trimgopath(curpkg)
-		curpkg = gopp.IfElseStr(curpkg == ".", "main", curpkg)
+		curpkg := pkgimppaths[psctx.path]
 		na, ok := pkgnodeg[curpkg]
 		if !ok {
 			na = pkgdepg.MakeNode()
@@ -145,9 +156,7 @@ func main() {
 
 		for i := len(comps) - 1; i >= 0; i-- {
 			psctx := comps[i].psctx
-			curpkg := psctx.path
-			curpkg = trimgopath(curpkg)
-			curpkg = gopp.IfElseStr(curpkg == ".", "main", curpkg)
+			curpkg := pkgimppaths[psctx.path]
 			if curpkg == val {
 				comps2 = append(comps2, comps[i])
 				break
@@ -185,14 +194,44 @@ func main() {
 		}
 	}
 
-	code = comps[0].genBuiltinTypesMetatype() + code + mainpkgcode
+	// nothing written if anything unsupported
+	diags.exitiferrs()
+	diags.flush()
+
 	fname := "opkgs/foo." + extname
+	lmpath, _ := filepath.Abs(fname + ".linemap")
+	code = fmt.Sprintf("const char* cxlinemap_path = %q;\n", lmpath) +
+		comps[0].genBuiltinTypesMetatype() + code + mainpkgcode
 	ioutil.WriteFile(fname, []byte(code), 0644)
 	linecnt := strings.Count(code, "\n")
 	log.Println("clangfmt ...", fname, len(code), linecnt)
 	btime := time.Now()
 	clangfmt(fname)
+	// CYGO_CLINES=1 to debug the generated C code instead of the go source
+	err = fixclines(fname, comps, os.Getenv("CYGO_CLINES") == "")
+	gopp.ErrPrint(err, fname)
 	log.Println("gencode lines", linecnt, len(code), time.Since(btime))
+
+	// for the final compile and link, cc $(cat foo.c.cflags) foo.c $(cat foo.c.ldflags)
+	pkgflags := []*cgoflags{}
+	for _, comp := range comps {
+		pkgflags = append(pkgflags, comp.psctx.cgoflags)
+	}
+	allflags := mergecgoflags(pkgflags)
+	err = ioutil.WriteFile(fname+".cflags", []byte(strings.Join(allflags.cflags, " ")+"\n"), 0644)
+	gopp.ErrPrint(err, fname)
+	err = ioutil.WriteFile(fname+".ldflags", []byte(strings.Join(allflags.ldflags, " ")+"\n"), 0644)
+	gopp.ErrPrint(err, fname)
+
+	if islibmode() {
+		libname := filepath.Base(strings.TrimRight(flag.Arg(0), "/"))
+		libname = gopp.IfElseStr(libname == ".", "main", libname)
+		err = buildlib(fname, libname, comps, allflags)
+		gopp.ErrPrint(err, fname)
+		if err != nil {
+			os.Exit(1)
+		}
+	}
 }
 func clangfmt(fname string) {
 	exepath, err := exec.LookPath("clang-format")
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"gopp"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// import path => package directory, module aware.
+// in order: xgo overrides (fmt => xgo/fmt), the main module, its vendor
+// directory, then the main module's build list: the modules it requires
+// and what they require, each at the highest version any of them asks for
+// (minimal version selection, as the go tool does), with its replace
+// directives applied. then $GOPATH/src and $GOROOT/src like before.
+// the main module is the one of the package given on the command line,
+// every import resolves against it, whichever module the importer is in.
+
+type modreplace struct {
+	path    string // module path or local directory
+	version string // empty for local directory
+}
+
+type gomodule struct {
+	path     string // module path
+	dir      string // where go.mod is
+	requires map[string]string
+	replaces map[string]modreplace // old path, or path@version => new
+
+	buildlist map[string]string // main module only, path => selected version
+}
+
+var gomodsmu sync.Mutex
+var gomods = map[string]*gomodule{} // go.mod dir =>
+
+// the go.mod of the module dir belongs to, nil if none (GOPATH mode)
+func findgomod(dir string) *gomodule {
+	if os.Getenv("GO111MODULE") == "off" {
+		return nil
+	}
+	dir, _ = filepath.Abs(dir)
+	for ; ; dir = filepath.Dir(dir) {
+		if gopp.FileExist(filepath.Join(dir, "go.mod")) {
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+
+	gomodsmu.Lock()
+	defer gomodsmu.Unlock()
+	if mod, ok := gomods[dir]; ok {
+		return mod
+	}
+	mod, err := parsegomod(dir)
+	if err != nil {
+		diags.errorf(token.Position{Filename: filepath.Join(dir, "go.mod")}, "%v", err)
+		diags.exitiferrs()
+	}
+	gomods[dir] = mod
+	return mod
+}
+
+var mainmodonce sync.Once
+var mainmod *gomodule
+
+// the module of the package being built with its build list, nil in
+// GOPATH mode
+func mainmodule() *gomodule {
+	mainmodonce.Do(func() {
+		mainmod = findgomod(fname)
+		if mainmod != nil {
+			mainmod.loadbuildlist()
+		}
+	})
+	return mainmod
+}
+
+// just what's needed to find packages: module, require, replace
+func parsegomod(dir string) (*gomodule, error) {
+	mod, err := parsegomodfile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	mod.dir = dir
+	return mod, nil
+}
+
+func parsegomodfile(file string) (*gomodule, error) {
+	mod := &gomodule{requires: map[string]string{}, replaces: map[string]modreplace{}}
+	fo, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fo.Close()
+
+	block := ""
+	lineno := 0
+	scanner := bufio.NewScanner(fo)
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		if pos := strings.Index(line, "//"); pos >= 0 {
+			line = line[:pos]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		for i, fld := range fields {
+			fields[i] = strings.Trim(fld, "\"`")
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("go.mod:%d: invalid module line", lineno)
+			}
+			mod.path = fields[1]
+		case "require":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("go.mod:%d: invalid require line", lineno)
+			}
+			mod.requires[fields[1]] = fields[2]
+		case "replace":
+			// old [v] => new [v]
+			arrow := -1
+			for i, fld := range fields {
+				if fld == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 2 || arrow > 3 || len(fields)-arrow < 2 || len(fields)-arrow > 3 {
+				return nil, fmt.Errorf("go.mod:%d: invalid replace line", lineno)
+			}
+			old := fields[1]
+			if arrow == 3 {
+				old += "@" + fields[2]
+			}
+			rep := modreplace{path: fields[arrow+1]}
+			if len(fields)-arrow == 3 {
+				rep.version = fields[arrow+2]
+			} else if !islocalmodpath(rep.path) {
+				return nil, fmt.Errorf("go.mod:%d: replacement module without version", lineno)
+			}
+			mod.replaces[old] = rep
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if mod.path == "" {
+		return nil, fmt.Errorf("go.mod: no module line")
+	}
+	return mod, nil
+}
+
+// minimal version selection over the require graph, replace directives
+// of the main module only, like the go tool
+func (mod *gomodule) loadbuildlist() {
+	mod.buildlist = map[string]string{}
+	seen := map[string]bool{} // path@version
+	var walk func(requires map[string]string)
+	walk = func(requires map[string]string) {
+		for path, ver := range requires {
+			if seen[path+"@"+ver] {
+				continue
+			}
+			seen[path+"@"+ver] = true
+			if semvercmp(ver, mod.buildlist[path]) > 0 {
+				mod.buildlist[path] = ver
+			}
+			if dep := mod.depgomod(path, ver); dep != nil {
+				walk(dep.requires)
+			}
+		}
+	}
+	walk(mod.requires)
+
+	// a local replacement of a module nothing requires, lenient
+	for old := range mod.replaces {
+		path := strings.Split(old, "@")[0]
+		if _, ok := mod.buildlist[path]; !ok {
+			mod.buildlist[path] = ""
+		}
+	}
+}
+
+// the go.mod of path@version, after replacement, nil if not at hand.
+// the module cache keeps it in cache/download as the go tool fetched it
+func (mod *gomodule) depgomod(path, version string) *gomodule {
+	rep, ok := mod.replaces[path+"@"+version]
+	if !ok {
+		rep, ok = mod.replaces[path]
+	}
+	files := []string{}
+	switch {
+	case ok && rep.version == "":
+		repdir := rep.path
+		if !filepath.IsAbs(repdir) {
+			repdir = filepath.Join(mod.dir, repdir)
+		}
+		files = append(files, filepath.Join(repdir, "go.mod"))
+	case ok:
+		files = append(files, moddownloadfile(rep.path, rep.version, ".mod"),
+			filepath.Join(modcachedir(rep.path, rep.version), "go.mod"))
+	default:
+		files = append(files, moddownloadfile(path, version, ".mod"),
+			filepath.Join(modcachedir(path, version), "go.mod"))
+	}
+	for _, file := range files {
+		if dep, err := parsegomodfile(file); err == nil {
+			return dep
+		}
+	}
+	log.Println("no go.mod for", path, version)
+	return nil
+}
+
+// -1, 0 or 1 as semver a is lower, equal or higher than b. "" is
+// lower than any version, a pre-release lower than its release,
+// build metadata like +incompatible doesn't count
+func semvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	if b == "" {
+		return 1
+	}
+	split := func(v string) ([]string, string) {
+		v = strings.TrimPrefix(v, "v")
+		if pos := strings.Index(v, "+"); pos >= 0 {
+			v = v[:pos]
+		}
+		pre := ""
+		if pos := strings.Index(v, "-"); pos >= 0 {
+			v, pre = v[:pos], v[pos+1:]
+		}
+		return strings.Split(v, "."), pre
+	}
+	// numeric identifiers by value and lower than others
+	cmpid := func(x, y string) int {
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			return intcmp(xn, yn)
+		case xerr == nil:
+			return -1
+		case yerr == nil:
+			return 1
+		}
+		return strings.Compare(x, y)
+	}
+	anums, apre := split(a)
+	bnums, bpre := split(b)
+	for i := 0; i < len(anums) || i < len(bnums); i++ {
+		x, y := "0", "0"
+		if i < len(anums) {
+			x = anums[i]
+		}
+		if i < len(bnums) {
+			y = bnums[i]
+		}
+		if r := cmpid(x, y); r != 0 {
+			return r
+		}
+	}
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+	aids := strings.Split(apre, ".")
+	bids := strings.Split(bpre, ".")
+	for i := 0; i < len(aids) && i < len(bids); i++ {
+		if r := cmpid(aids[i], bids[i]); r != 0 {
+			return r
+		}
+	}
+	return intcmp(len(aids), len(bids))
+}
+
+func intcmp(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func islocalmodpath(path string) bool {
+	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") ||
+		filepath.IsAbs(path)
+}
+
+// the module cache escapes upper case letters as !lower
+func modcachedir(path, version string) string {
+	return filepath.Join(gomodcache(), modescape(path)+"@"+modescape(version))
+}
+
+// a file of path@version in the module cache's download dir, .mod or .zip
+func moddownloadfile(path, version, ext string) string {
+	return filepath.Join(gomodcache(), "cache", "download", modescape(path), "@v", modescape(version)+ext)
+}
+
+func gomodcache() string {
+	cachedir := os.Getenv("GOMODCACHE")
+	if cachedir == "" {
+		cachedir = filepath.Join(gopp.Gopaths()[0], "pkg", "mod")
+	}
+	return cachedir
+}
+
+// upper case letters as !lower, like the module cache
+func modescape(s string) string {
+	var sb strings.Builder
+	for _, ch := range s {
+		if ch >= 'A' && ch <= 'Z' {
+			sb.WriteByte('!')
+			ch += 'a' - 'A'
+		}
+		sb.WriteRune(ch)
+	}
+	return sb.String()
+}
+
+// longest of paths that is imppath or a parent of it
+func longestmodprefix(imppath string, paths map[string]string) string {
+	res := ""
+	for path := range paths {
+		if (imppath == path || strings.HasPrefix(imppath, path+"/")) && len(path) > len(res) {
+			res = path
+		}
+	}
+	return res
+}
+
+func (mod *gomodule) resolve(imppath string) string {
+	if imppath == mod.path || strings.HasPrefix(imppath, mod.path+"/") {
+		return filepath.Join(mod.dir, imppath[len(mod.path):])
+	}
+	if vdir := filepath.Join(mod.dir, "vendor", imppath); gopp.FileExist(vdir) {
+		return vdir
+	}
+
+	versions := mod.buildlist
+	modpath := longestmodprefix(imppath, versions)
+	if modpath == "" {
+		return ""
+	}
+	version := versions[modpath]
+	subdir := imppath[len(modpath):]
+
+	rep, ok := mod.replaces[modpath+"@"+version]
+	if !ok {
+		rep, ok = mod.replaces[modpath]
+	}
+	switch {
+	case ok && rep.version == "":
+		repdir := rep.path
+		if !filepath.IsAbs(repdir) {
+			repdir = filepath.Join(mod.dir, repdir)
+		}
+		return filepath.Join(repdir, subdir)
+	case ok:
+		return filepath.Join(modcachedir(rep.path, rep.version), subdir)
+	case version != "":
+		return filepath.Join(modcachedir(modpath, version), subdir)
+	}
+	return ""
+}
+
+var xgorootonce sync.Once
+var xgoroot string
+
+// the directory of xgo, our go implementation of the std packages
+func xgorootdir() string {
+	xgorootonce.Do(func() { xgoroot = filepath.Dir(find_builtin_path("xgo/builtin")) })
+	return xgoroot
+}
+
+// imppath imported by the package in fromdir, "" if not found.
+// modules resolve through the main module, see mainmodule
+func resolveimport(imppath string, fromdir string) string {
+	xgoroot := xgorootdir()
+	if strings.HasPrefix(imppath, "xgo/") {
+		return filepath.Join(xgoroot, imppath[4:])
+	}
+	// std packages we have our own, fmt => xgo/fmt
+	if !strings.Contains(strings.Split(imppath, "/")[0], ".") {
+		if dir := filepath.Join(xgoroot, imppath); gopp.FileExist(dir) {
+			return dir
+		}
+	}
+
+	if mod := mainmodule(); mod != nil {
+		if dir := mod.resolve(imppath); dir != "" && gopp.FileExist(dir) {
+			return dir
+		}
+	}
+
+	gopaths := append(gopp.Gopaths(), runtime.GOROOT())
+	for _, gopath1 := range gopaths {
+		impdir := gopath1 + "/src/" + imppath
+		if gopp.FileExist(impdir) {
+			return impdir
+		}
+	}
+	return ""
+}
+
+// type checks imported packages from the directories resolveimport gives,
+// signatures only, like go/internal/srcimporter.
+type mypkgimporter struct {
+	fcpkg *types.Package
+	dir   string // of the importing package
+}
+
+var imppkgsmu sync.Mutex
+var imppkgs = map[string]*types.Package{} // dir =>
+
+func (this *mypkgimporter) Import(path string) (*types.Package, error) {
+	return this.ImportFrom(path, this.dir, 0)
+}
+
+func (this *mypkgimporter) ImportFrom(path, srcdir string, mode types.ImportMode) (pkgo *types.Package, err error) {
+	log.Println("importing ...", path)
+	if path == "C" {
+		return this.fcpkg, nil
+	}
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	dir := resolveimport(path, gopp.IfElseStr(srcdir == "" || srcdir == ".", this.dir, srcdir))
+	if dir == "" {
+		err = fmt.Errorf("cannot find package %q", path)
+		gopp.ErrPrint(err, path)
+		return nil, err
+	}
+
+	imppkgsmu.Lock()
+	pkgo, ok := imppkgs[dir]
+	imppkgsmu.Unlock()
+	if ok {
+		if pkgo == nil {
+			return nil, fmt.Errorf("import cycle through package %q", path)
+		}
+		return pkgo, nil
+	}
+	imppkgsmu.Lock()
+	imppkgs[dir] = nil
+	imppkgsmu.Unlock()
+
+	bdpkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		gopp.ErrPrint(err, path)
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, filename := range append(bdpkg.GoFiles, bdpkg.CgoFiles...) {
+		fio, err := parser.ParseFile(fset, filepath.Join(dir, filename), nil, 0)
+		if err != nil {
+			gopp.ErrPrint(err, path)
+			return nil, err
+		}
+		files = append(files, fio)
+	}
+
+	var firsterr error
+	conf := types.Config{
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		Importer:         &mypkgimporter{this.fcpkg, dir},
+		Error: func(err error) {
+			if firsterr == nil {
+				firsterr = err
+			}
+		},
+	}
+	pkgo, _ = conf.Check(path, fset, files, nil)
+	gopp.ErrPrint(firsterr, path)
+	pkgo.MarkComplete() // like srcimporter, errors are reported by its own compile
+	imppkgsmu.Lock()
+	imppkgs[dir] = pkgo
+	imppkgsmu.Unlock()
+	return pkgo, nil
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"go/ast"
 	"go/build"
-	"go/importer"
 	"go/parser"
 	"go/printer"
 	"go/token"
@@ -17,6 +16,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -70,7 +70,8 @@ type ParserContext struct {
 	gb       *graph.Graph // decl depgraph in one package
 	bdpkgs   *build.Package
 	ccode    string
-	fcdefscc string // fake C defs content
+	fcdefscc string    // fake C defs content
+	cgoflags *cgoflags // #cgo lines of the C preamble
 }
 
 func NewParserContext(path string, pkgrename string, builtin_psctx *ParserContext) *ParserContext {
@@ -100,6 +101,29 @@ func NewParserContext(path string, pkgrename string, builtin_psctx *ParserContex
 	return this
 }
 
+// why build.ImportDir skipped file, its own error not the dir's
+func invalidgofile(dir string, file string, err error) {
+	filename := file
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, file)
+	}
+	_, perr := parser.ParseFile(token.NewFileSet(), filename, nil, parser.AllErrors)
+	if perr != nil {
+		diags.adderr(perr, diagerror)
+		return
+	}
+	pos := token.Position{Filename: filename}
+	if mperr, ok := err.(*build.MultiplePackageError); ok {
+		for i, file2 := range mperr.Files {
+			if file2 == file || file2 == filepath.Base(file) {
+				diags.errorf(pos, "package %s, want %s", mperr.Packages[i], mperr.Packages[0])
+				return
+			}
+		}
+	}
+	diags.errorf(pos, "invalid go file: %v", err)
+}
+
 // semachk parse but no semantics check: types.Check
 func (this *ParserContext) Init(semachk bool) error {
 	return this.Init_no_cgocmd(semachk)
@@ -109,10 +133,16 @@ func (this *ParserContext) Init(semachk bool) error {
 func (this *ParserContext) Init_no_cgocmd(semachk bool) error {
 
 	bdpkgs, err := build.ImportDir(this.path, build.ImportComment)
-	gopp.ErrPrint(err)
 	this.bdpkgs = bdpkgs
 	if len(bdpkgs.InvalidGoFiles) > 0 {
-		log.Fatalln("Have InvalidGoFiles", bdpkgs.InvalidGoFiles)
+		for _, file := range bdpkgs.InvalidGoFiles {
+			invalidgofile(this.path, file, err)
+		}
+		diags.exitiferrs()
+	}
+	if err != nil {
+		diags.errorf(token.Position{Filename: this.path}, "%v", err)
+		diags.exitiferrs()
 	}
 	log.Println(this.path, bdpkgs.Name, bdpkgs.GoFiles, bdpkgs.TestGoFiles,
 		bdpkgs.CgoFiles, bdpkgs.CFiles, bdpkgs.CXXFiles)
@@ -120,16 +150,34 @@ func (this *ParserContext) Init_no_cgocmd(semachk bool) error {
 	// parser step 2, got ast
 	this.fset = token.NewFileSet()
 	pkgs, err := parser.ParseDir(this.fset, this.path, this.dirFilter, 0|parser.AllErrors|parser.ParseComments)
-	gopp.ErrPrint(err)
+	if err != nil {
+		diags.adderr(err, diagerror)
+		diags.exitiferrs()
+	}
 	this.pkgs = pkgs
-	gopp.Assert(len(pkgs) == 1, "wtttt", len(pkgs), this.path)
+	if len(pkgs) != 1 {
+		names := []string{}
+		for name := range pkgs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		diags.errorf(token.Position{Filename: this.path}, "want one package, found %d: %v", len(pkgs), names)
+		diags.exitiferrs()
+	}
 	this.ccode = this.pickCCode()
+	this.cgoflags, err = parsecgoflags(this.path, this.pickCCode2())
+	if err != nil {
+		diags.errorf(token.Position{Filename: this.path}, "#cgo of %s: %v", bdpkgs.Name, err)
+		diags.exitiferrs()
+	}
 
 	cp1 := newcparser1(bdpkgs.Name)
+	cp1.cflags = cppflags(this.cgoflags.cflags)
 	err = cp1.parsestr(this.ccode)
 	this.cpr = cp1
 	if err != nil {
-		log.Fatalln(bdpkgs.Name, err)
+		diags.errorf(token.Position{Filename: this.path}, "C preamble of %s: %v", bdpkgs.Name, err)
+		diags.exitiferrs()
 	}
 
 	this.walkpass_valid_files()
@@ -149,9 +197,7 @@ func (this *ParserContext) Init_no_cgocmd(semachk bool) error {
 		return nil
 	}
 	this.walkpass_check() // semantics check
-	if this.chkerrs != nil {
-		os.Exit(-1)
-	}
+	diags.exitiferrs()
 
 	// this.walkpass_dotransforms(true)
 	// this.walkpass_resolve_ctypes()
@@ -196,12 +242,12 @@ func (pc *ParserContext) pkgimperror(err error) {
 		strings.Contains(err.Error(), "wrong number of return values") ||
 		strings.Contains(err.Error(), "redeclared in this block") ||
 		false {
-		log.Println("fatalerr", err)
+		diags.adderr(err, diagerror)
 		pc.chkerrs = append(pc.chkerrs, err)
 	} else if // TODO
 	strings.Contains(err.Error(), "(type) is not an expression") ||
 		false {
-		log.Println("warn5err", err)
+		diags.adderr(err, diagwarn)
 	} else if strings.Contains(err.Error(), "declared but not used") ||
 		strings.Contains(err.Error(), "not exported by package C") ||
 		strings.Contains(err.Error(), "too many arguments") ||
@@ -210,7 +256,7 @@ func (pc *ParserContext) pkgimperror(err error) {
 		// log.Println(err)
 		chkwarns = append(chkwarns, err)
 	} else {
-		log.Println("unkerr", err)
+		diags.adderr(err, diagwarn)
 		chkunks = append(chkunks, err)
 	}
 }
@@ -339,13 +385,12 @@ func (pc *ParserContext) walkpass_check() {
 	pc.conf.Error = pc.pkgimperror
 	pc.conf.FakeImportC = true
 	pc.conf.FakeImportC = false
-	pc.conf.Importer = &mypkgimporter{pc.fcpkg}
+	pc.conf.Importer = &mypkgimporter{pc.fcpkg, pc.path}
 
 	files := pc.files
 	// files = append(files, pc.fakecfile())
-	var err error
-	pc.typkgs, err = pc.conf.Check(pc.path, pc.fset, files, &pc.info)
-	pc.pkgimperror(err)
+	// all errors went to conf.Error already, the result is the first of them
+	pc.typkgs, _ = pc.conf.Check(pc.path, pc.fset, files, &pc.info)
 	log.Println("pkgcomplete", pc.typkgs.Name(), pc.typkgs.Complete())
 }
 
@@ -370,26 +415,6 @@ func (this *ParserContext) dirFilter(f os.FileInfo) bool {
 	return this.nameFilter(f.Name())
 }
 
-type mypkgimporter struct {
-	fcpkg *types.Package
-}
-
-func (this *mypkgimporter) Import(path string) (pkgo *types.Package, err error) {
-	log.Println("importing ...", path)
-	if path == "C" {
-		return this.fcpkg, nil
-	}
-	if true {
-		// go 1.12
-		fset := token.NewFileSet()
-		pkgo, err = importer.ForCompiler(fset, "source", nil).Import(path)
-	} else {
-		pkgo, err = importer.Default().Import(path)
-	}
-	gopp.ErrPrint(err, path)
-	return pkgo, err
-}
-
 func trimgopath(filename string) string {
 	gopaths := gopp.Gopaths()
 
@@ -1160,10 +1185,6 @@ func (pc *ParserContext) walkpass_func_deps2() {
 
 func (pc *ParserContext) walkpass_fill_funcvars() {
 	pkgs := pc.pkgs
-	var toperrvarobj *ast.Ident
-	var jmpfidxvarobj *ast.Ident
-	var errlnovarobj *ast.Ident
-	_ = toperrvarobj
 	for _, pkg := range pkgs {
 		astutil.Apply(pkg, func(c *astutil.Cursor) bool {
 			switch te := c.Node().(type) {
@@ -1181,16 +1202,13 @@ func (pc *ParserContext) walkpass_fill_funcvars() {
 					break
 				}
 
-				toperrvar, declvar := newVardecl("gxtvtoperr", newIdent("error"), te.Body.Pos())
+				_, declvar := newVardecl("gxtvtoperr", newIdent("error"), te.Body.Pos())
 				te.Body.List = append([]ast.Stmt{declvar}, te.Body.List...)
-				toperrvarobj = toperrvar
-				jmpfidxvar, declvar2 := newVardecl("gxjmpfromidx", newIdent("int"), te.Body.Pos())
+				_, declvar2 := newVardecl("gxjmpfromidx", newIdent("int"), te.Body.Pos())
 				te.Body.List = append([]ast.Stmt{declvar2}, te.Body.List...)
-				jmpfidxvarobj = jmpfidxvar
 
-				errlnovar, declvar3 := newVardecl("gxtvtoperr_lineno", newIdent("int"), te.Body.Pos())
+				_, declvar3 := newVardecl("gxtvtoperr_lineno", newIdent("int"), te.Body.Pos())
 				te.Body.List = append([]ast.Stmt{declvar3}, te.Body.List...)
-				errlnovarobj = errlnovar
 
 				// add return if not have
 				lastmt := te.Body.List[len(te.Body.List)-1]
@@ -1218,6 +1236,8 @@ func (pc *ParserContext) walkpass_fill_funcvars() {
 				}
 
 			case *ast.CatchStmt:
+				// post order, the enclosing FuncDecl declares its vars
+				// only after this, so refer to them by name
 				assign := &ast.AssignStmt{}
 				assign.TokPos = te.Pos()
 				assign.Tok = token.DEFINE
@@ -1225,25 +1245,23 @@ func (pc *ParserContext) walkpass_fill_funcvars() {
 				err2idt.Obj = ast.NewObj(ast.Var, err2idt.Name)
 				err2idt.NamePos = te.Pos()
 				assign.Lhs = append(assign.Lhs, err2idt)
-				assign.Rhs = append(assign.Rhs, toperrvarobj)
-				gopp.Assert(toperrvarobj != nil, "wtfff")
+				assign.Rhs = append(assign.Rhs, newIdent("gxtvtoperr"))
 				te.Init = assign
 				te.Tag = assign.Lhs[0]
-				log.Println(te, toperrvarobj == nil)
 
 				// erridx := gxjmpfromidx
 				erridxidt := newIdent("erridx")
 				erridxidt.Obj = ast.NewObj(ast.Var, erridxidt.Name)
 				erridxidt.NamePos = te.Pos()
 				assign.Lhs = append(assign.Lhs, erridxidt)
-				assign.Rhs = append(assign.Rhs, jmpfidxvarobj)
+				assign.Rhs = append(assign.Rhs, newIdent("gxjmpfromidx"))
 
 				// errlno := gxtvtoperr_lineno
 				errlnoidt := newIdent("errlno")
 				errlnoidt.Obj = ast.NewObj(ast.Var, errlnoidt.Name)
 				errlnoidt.NamePos = te.Pos()
 				assign.Lhs = append(assign.Lhs, errlnoidt)
-				assign.Rhs = append(assign.Rhs, errlnovarobj)
+				assign.Rhs = append(assign.Rhs, newIdent("gxtvtoperr_lineno"))
 
 			case *ast.SwitchStmt:
 			default:
@@ -7,15 +7,32 @@ import (
 	"go/types"
 	"gopp"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
-// imppath not include /xxx/src part
+// imppath not include /xxx/src part.
+// $CYGO_ROOT, $GOPATH/src, then the checkout cygo runs from, so it works
+// when the project is a module out of GOPATH.
 func find_builtin_path(builtin_imppath string) string {
-	gopaths := gopp.Gopaths()
+	roots := []string{}
+	if dir := os.Getenv("CYGO_ROOT"); dir != "" {
+		roots = append(roots, dir)
+	}
+	for _, gopath := range gopp.Gopaths() {
+		roots = append(roots, gopath+"/src")
+	}
+	if exepath, err := os.Executable(); err == nil {
+		roots = append(roots, filepath.Dir(filepath.Dir(exepath)))
+	}
+	if wkdir, err := os.Getwd(); err == nil {
+		roots = append(roots, filepath.Dir(wkdir))
+	}
+
 	builtin_pkgpath := ""
-	for _, gopath := range gopaths {
-		pkgpath := gopath + "/src/" + builtin_imppath
+	for _, root := range roots {
+		pkgpath := root + "/" + builtin_imppath
 		if gopp.FileExist(pkgpath) {
 			builtin_pkgpath = pkgpath
 			break
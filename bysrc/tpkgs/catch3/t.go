@@ -0,0 +1,22 @@
+package main
+
+import "xgo/xerrors"
+
+var Errnotfound = xerrors.New("not found")
+
+func lookup(key string) error {
+	return xerrors.Errorf("lookup %s: %w", key, Errnotfound)
+}
+
+func main() {
+	lookup("abc")
+	println(111)
+
+	catch{
+		case nil:
+		case Errnotfound:
+		println("wrapped notfound", err.Error())
+		default:
+		println(err)
+	}
+}
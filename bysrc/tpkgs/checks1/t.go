@@ -0,0 +1,50 @@
+package main
+
+type point struct {
+	x int
+}
+
+//cygo:nochecks
+func sum(arr []int) int {
+	s := 0
+	for i := 0; i < len(arr); i++ {
+		s += arr[i]
+	}
+	return s
+}
+
+func div(a int, b int) int {
+	return a / b
+}
+
+// stays unsigned, not an int64 division
+func udiv(a uint32, b uint32) uint32 {
+	a /= b
+	return a / b
+}
+
+func strat(s string, i int) byte {
+	return s[i]
+}
+
+func main() {
+	arr := []int{1, 2, 3}
+	println(sum(arr))
+	println(div(7, 2))
+	println(udiv(4294967295, 2) == 1073741823)
+
+	// up to the capacity, not the length
+	s := make([]int, 1, 4)
+	println(len(s[:cap(s)]), len(s[1:]))
+	println(strat("abc", 1) == 'b')
+
+	var p *point
+	if p == nil {
+		p = &point{}
+	}
+	p.x = 5
+	println(p.x)
+
+	idx := 3
+	println(arr[idx]) // panics
+}
@@ -0,0 +1,32 @@
+package main
+
+type namer interface {
+	Name(bool) string
+}
+
+type inner1 struct {
+	name string
+}
+
+func (this *inner1) Name(a bool) string {
+	return this.name
+}
+
+// Name is promoted from inner1
+type outer1 struct {
+	*inner1
+	age int
+}
+
+func getnamer() namer {
+	o := &outer1{}
+	o.inner1 = &inner1{}
+	o.inner1.name = "bob"
+	return o
+}
+
+func main() {
+	var n namer
+	n = getnamer()
+	println(n.Name(true))
+}
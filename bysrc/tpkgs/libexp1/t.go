@@ -0,0 +1,32 @@
+package main
+
+type counter struct {
+	n int
+}
+
+//export wordcount
+func WordCount(s string) int {
+	return s.fields().len
+}
+
+//export greet
+func Greet(name string) string {
+	return "hello, " + name
+}
+
+//export counter_new
+func NewCounter() *counter {
+	return &counter{}
+}
+
+//export counter_add
+func CounterAdd(c *counter, d int) int {
+	c.n += d
+	return c.n
+}
+
+func main() {
+	println(WordCount("a b  c"), Greet("cygo"))
+	c := NewCounter()
+	println(CounterAdd(c, 3))
+}
@@ -0,0 +1,7 @@
+module example.com/modimp1
+
+go 1.12
+
+require example.com/greet v0.1.0
+
+replace example.com/greet => ./greet
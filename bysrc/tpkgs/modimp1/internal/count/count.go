@@ -0,0 +1,8 @@
+package count
+
+var n = 0
+
+func Next() int {
+	n++
+	return n
+}
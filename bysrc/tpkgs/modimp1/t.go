@@ -0,0 +1,13 @@
+package main
+
+// resolved through go.mod, the replace directive and the main module
+
+import (
+	"example.com/greet"
+	"example.com/modimp1/internal/count"
+)
+
+func main() {
+	println(greet.Hello("cygo"))
+	println(count.Next(), count.Next())
+}
@@ -0,0 +1,46 @@
+package main
+
+import "xgo/xnet"
+
+func serve(ln xnet.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		go echo(c)
+	}
+}
+
+func echo(c xnet.Conn) {
+	buf := make([]byte, 512)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			break
+		}
+		c.Write(buf[:n])
+	}
+	c.Close()
+}
+
+func main() {
+	ln, err := xnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	go serve(ln)
+
+	c, err := xnet.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	c.Write([]byte("ping"))
+	buf := make([]byte, 16)
+	n, err := c.Read(buf)
+	println(string(buf[:n]), err == nil)
+	c.Close()
+}
@@ -0,0 +1,20 @@
+package main
+
+func main() {
+	str := "aé中😀z"
+	for idx, ch := range str {
+		println(idx, ch)
+	}
+	for idx := range str {
+		println(idx)
+	}
+
+	arr := [3]int{7, 8, 9}
+	for idx, elem := range arr {
+		println(idx, elem)
+	}
+	parr := &arr
+	for idx, elem := range parr {
+		println(idx, elem)
+	}
+}
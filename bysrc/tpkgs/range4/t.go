@@ -0,0 +1,17 @@
+package main
+
+func main() {
+	c := make(chan int, 5)
+	for i := range 3 {
+		c <- i * 10
+	}
+	close(c)
+	for v := range c {
+		println(v)
+	}
+
+	n := 4
+	for i := range n {
+		println(i)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+func main() {
+	c1 := make(chan int, 1)
+	c2 := make(chan int)
+	var cnil chan int
+
+	// nothing ready
+	select {
+	case v := <-c1:
+		println("bad", v)
+	default:
+		println("default")
+	}
+
+	c1 <- 5
+	select {
+	case v := <-c1:
+		println("c1", v)
+	case <-cnil:
+		println("bad nil")
+	}
+
+	go func() {
+		c2 <- 7
+	}()
+	select {
+	case v, ok := <-c2:
+		println("c2", v, ok)
+	case cnil <- 1:
+		println("bad nil")
+	}
+
+	go func() {
+		<-c2
+	}()
+	select {
+	case c2 <- 9:
+		println("sent")
+	}
+	println(len(c1), cap(c1))
+
+	// both always ready, each gets picked
+	c3 := make(chan int, 1)
+	c4 := make(chan int, 1)
+	n3 := 0
+	n4 := 0
+	for i := 0; i < 100; i++ {
+		c3 <- 3
+		c4 <- 4
+		select {
+		case <-c3:
+			n3++
+			<-c4
+		case <-c4:
+			n4++
+			<-c3
+		}
+	}
+	println(n3 > 0, n4 > 0)
+}
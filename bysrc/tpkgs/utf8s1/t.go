@@ -0,0 +1,18 @@
+package main
+
+func main() {
+	str := "héllo 世界"
+	runes := []rune(str)
+	println(len(str), len(runes))
+	runes[0] = 'H'
+	runes[6] = '地'
+	println(string(runes))
+
+	var r rune = 0x4E2D
+	println(string(r) + string('文'))
+
+	println("straße ÀÉÎ привет".toupper())
+	println("ΑΒΓ ПРИВЕТ 中文".tolower())
+	println("élan".totitle())
+	println("中 文　字".fields().len)
+}
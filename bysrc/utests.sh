@@ -1,6 +1,6 @@
 #!/bin/bash
 
-files=$(ls -d tpkgs/* | grep -v ".go")
+files=$(ls -d tpkgs/*/ | sed 's,/$,,')
 
 totcnt=0
 for pkg in $files; do
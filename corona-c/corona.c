@@ -33,6 +33,7 @@ typedef struct machine {
     // 需要执行的队列，runnable状态的。在新fiber，恢复fiber时加到该队列
     crnunique* runq; // grid
     pmutex_t pkmu; // pack lock
+    pmutex_t intrmu; // crn_fiber_interrupt against its fibers parking and waking
     pcond_t pkcd;
     bool parking;
     int wantgclock;
@@ -827,6 +828,24 @@ void crn_procer_yield_commit(machine* mc, fiber* gr) {
         netpoller_yieldfd(yinfo->fd, yinfo->ytype, gr);
     }
     memset(yinfo, 0, sizeof(yieldinfo));
+
+    // interrupted between its check in the hook and here, or from now on
+    pmutex_lock(&mc->intrmu);
+    if (atomic_getint(&gr->intr) != 0) {
+        netpoller_cancel(gr);
+        crn_fiber_resume_same_thread(gr);
+    } else {
+        gr->intrpk = 1;
+    }
+    pmutex_unlock(&mc->intrmu);
+}
+// waking up from the netpoller, no more interruptible
+static void crn_fiber_intr_unpark(fiber* gr) {
+    if (atomic_getint(&gr->intrpk) == 0) return;
+    machine* mc = crn_machine_get(gr->mcid);
+    pmutex_lock(&mc->intrmu);
+    gr->intrpk = 0;
+    pmutex_unlock(&mc->intrmu);
 }
 static void* crn_procerx(void*arg) {
     machine* mc = (machine*)arg;
@@ -926,6 +945,7 @@ int crn_procer_yield(long fd, int ytype) {
     }
     crn_fiber_mark_curstk_used(gr);
     crn_fiber_suspend(gr);
+    crn_fiber_intr_unpark(gr);
     return 0;
 }
 int crn_procer_yield_multi(int ytype, int nfds, long fds[], int ytypes[]) {
@@ -961,6 +981,7 @@ int crn_procer_yield_multi(int ytype, int nfds, long fds[], int ytypes[]) {
     }
     crn_fiber_mark_curstk_used(gr);
     crn_fiber_suspend(gr);
+    crn_fiber_intr_unpark(gr);
     return 0;
 }
 bool crn_procer_resume_prechk(void* gr_, int ytype, int grid, int mcid) {
@@ -1012,6 +1033,86 @@ void crn_sched() {
     crn_procer_yield(1000, YIELD_TYPE_NANOSLEEP);
 }
 
+// for a later crn_fiber_interrupt, nilptr outside fibers
+void* crn_fiber_self(int* grid, int* mcid) {
+    fiber* gr = crn_fiber_getcur();
+    if (gr != nilptr) {
+        *grid = gr->id;
+        *mcid = gr->mcid;
+    }
+    return gr;
+}
+// the generation crn_fiber_interrupt needs, nested binds share it.
+// 0 outside fibers
+int crn_fiber_bind() {
+    fiber* gr = crn_fiber_getcur();
+    if (gr == nilptr) return 0;
+    machine* mc = crn_machine_get(gr->mcid);
+    pmutex_lock(&mc->intrmu);
+    if (gr->intrdepth++ == 0) gr->intrgen++;
+    int gen = gr->intrgen;
+    pmutex_unlock(&mc->intrmu);
+    return gen;
+}
+// clears the interrupt, the last one also drops the generation, so
+// a late crn_fiber_interrupt leaves nothing on an unbound fiber
+void crn_fiber_unbind() {
+    fiber* gr = crn_fiber_getcur();
+    if (gr == nilptr) return;
+    machine* mc = crn_machine_get(gr->mcid);
+    pmutex_lock(&mc->intrmu);
+    if (gr->intrdepth > 0 && --gr->intrdepth == 0) gr->intrgen++;
+    atomic_setint(&gr->intr, 0);
+    pmutex_unlock(&mc->intrmu);
+}
+// a fiber parked in the netpoller can be interrupted, chan waits
+// are not touched. caller holds intrmu
+static bool crn_fiber_intr_parked(fiber* gr) {
+    int ytype = gr->pkreason;
+    if (gr->intrpk == 0 || crn_fiber_getstate(gr) != waiting) return false;
+    return ytype != YIELD_TYPE_CHAN_SEND && ytype != YIELD_TYPE_CHAN_RECV &&
+        ytype != YIELD_TYPE_CHAN_SELECT && ytype != YIELD_TYPE_CHAN_SELECT_NOCASE;
+}
+// wakes gr up from a hooked blocking call or sleep, which fails with ECANCELED.
+// if gr is not parked on one, its next one fails right away.
+// until crn_fiber_unbind, the later ones fail too. gen is what
+// crn_fiber_bind gave, nothing happens if gr has unbound since.
+// chan waits are not touched, select on a done chan for them
+void crn_fiber_interrupt(void* gr_, int grid, int mcid, int gen) {
+    fiber* gr = (fiber*)gr_;
+    if (!crn_procer_resume_prechk(gr, 0, grid, mcid)) {
+        return;
+    }
+    fiber* curgr = crn_fiber_getcur();
+    machine* mc = crn_machine_get(mcid);
+    bool same = false;
+    pmutex_lock(&mc->intrmu);
+    if (gr->intrgen != gen || gr->intrdepth == 0) {
+        pmutex_unlock(&mc->intrmu);
+        return;
+    }
+    atomic_setint(&gr->intr, 1);
+    if (crn_fiber_intr_parked(gr)) {
+        gr->intrpk = 0;
+        netpoller_cancel(gr);
+        same = curgr != nilptr && curgr->mcid == mcid;
+        if (same) {
+            crn_fiber_resume_same_thread(gr);
+        } else {
+            crn_fiber_resume_xthread(gr, gr->pkreason);
+        }
+    }
+    pmutex_unlock(&mc->intrmu);
+    if (same) {
+        crn_procer_yield(1001, YIELD_TYPE_NANOSLEEP);
+    }
+}
+// stays until unbound, so every later blocking call fails too
+bool crn_fiber_interrupted() {
+    fiber* gr = crn_fiber_getcur();
+    return gr != nilptr && atomic_getint(&gr->intr) != 0;
+}
+
 static
 int __attribute__((no_instrument_function))
 hashtable_cmp_int(const void *key1, const void *key2) {
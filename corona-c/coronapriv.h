@@ -53,6 +53,7 @@ netpoller* netpoller_new();
 void netpoller_loop();
 void netpoller_yieldfd(long fd, int ytype, fiber* gr);
 void netpoller_use_threads();
+void netpoller_cancel(fiber* gr);
 
 // for fiber
 typedef struct coro_stack coro_stack;
@@ -84,6 +85,11 @@ struct fiber {
     int lock_osthr; // lock os thread
     void* used_stkbottom;
     int used_stksz;  // = used_stkbottom - stack.sptr(stktop)
+    int intr; // crn_fiber_interrupt'ed, hooked blocking calls fail until unbound
+    int intrgen; // bind generation, interrupts of an older one are dropped
+    int intrdepth; // nested crn_fiber_bind's
+    int intrpk; // parked in the netpoller, an interrupt may wake it up
+    void* pktimer; // netpoller timer parked on, if any
 };
 
 // procer callbacks, impl in corona.c
@@ -92,6 +98,10 @@ extern int crn_procer_yield_multi(int ytype, int nfds, long fds[], int ytypes[])
 extern bool crn_in_procer();
 extern void crn_procer_resume_one(void* gr_, int ytype, int grid, int mcid);
 extern fiber* crn_fiber_getcur();
+extern int crn_fiber_bind();
+extern void crn_fiber_unbind();
+extern void crn_fiber_interrupt(void* gr_, int grid, int mcid, int gen);
+extern bool crn_fiber_interrupted();
 extern void* crn_fiber_getspec(void* spec);
 extern void crn_fiber_setspec(void* spec, void* val);
 
@@ -1,6 +1,8 @@
 #ifndef _CRN_PUB_H_
 #define _CRN_PUB_H_
 
+#include <stdbool.h>
+
 typedef struct corona corona;
 
 typedef struct crn_inner_stats {
@@ -21,5 +23,11 @@ extern void crn_sched();
 extern void crn_lock_osthread();
 extern void crn_get_stats(crn_inner_stats* st);
 
+extern void* crn_fiber_self(int* grid, int* mcid);
+extern int crn_fiber_bind();
+extern void crn_fiber_unbind();
+extern void crn_fiber_interrupt(void* gr, int grid, int mcid, int gen);
+extern bool crn_fiber_interrupted();
+
 #endif
 
@@ -17,9 +17,10 @@ void hcdata_free(hcdata* d) {
     crn_gc_free(d);
 }
 void hcdata_woke_set(hcdata*d, fiber* wkgr, hchan* hc, int wkcase, void* elem) {
+    // wkgr is nilptr when closed outside fibers
     d->wokeby = wkgr;
-    d->wokeby_grid = wkgr->id;
-    d->wokeby_mcid = wkgr->mcid;
+    d->wokeby_grid = wkgr != nilptr ? wkgr->id : 0;
+    d->wokeby_mcid = wkgr != nilptr ? wkgr->mcid : 0;
     d->wokehc = hc;
     d->wokecase = wkcase;
     if (wkcase == caseSend) {
@@ -30,9 +31,22 @@ void hcdata_woke_set(hcdata*d, fiber* wkgr, hchan* hc, int wkcase, void* elem) {
     }
 }
 
-static void hchan_finalizer(void* hc) {
+// next waiter of q, skips select waiters already woken by another chan
+hcdata* hchan_dequeue(szqueue_t* q) {
+    for (;;) {
+        hcdata* hcdt = (hcdata*)szqueue_remove(q);
+        if (hcdt == nilptr) return nilptr;
+        if (hcdt->seldone == nilptr) return hcdt;
+        if (atomic_casint(hcdt->seldone, 0, 1)) return hcdt;
+    }
+}
+
+static void hchan_finalizer(void* hcx) {
+    hchan* hc = (hchan*)hcx;
     linfo("hchan dtor %p %d\n", hc, gettid());
-    // assert(1==2);
+    chan_dispose(hc->c);
+    szqueue_dispose(hc->recvq);
+    szqueue_dispose(hc->sendq);
 }
 
 hchan* hchan_new(int cap) {
@@ -49,50 +63,27 @@ hchan* hchan_new(int cap) {
     return hc;
 }
 
+// parked recvers and senders wake up, buffered elems are still received,
+// then recvs return nilptr right away. hc is left to the GC
 int hchan_close(hchan* hc) {
-    if (!atomic_casint(&hc->closed, 0, 1)) {
-        return true;
-    }
-
     fiber* mygr = crn_fiber_getcur();
-    assert(mygr != nilptr);
 
     pmutex_lock(&hc->lock);
-    int qsz = 0;
-    qsz = hc->recvq->size;
-    if (qsz > 0) { linfo("discard recvq %d\n", qsz); }
-    while (hc->recvq != nilptr) {
-        hcdata* hcdt = (hcdata*)szqueue_remove(hc->recvq);
-        fiber* gr = hcdt->gr;
-        if (gr == nilptr) {
-            break;
-        }
-        hcdata_woke_set(hcdt, mygr, hc, caseClose, nilptr);
-        crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
-        // hcdata_free(hcdt);
+    if (!atomic_casint(&hc->closed, 0, 1)) {
+        pmutex_unlock(&hc->lock);
+        return false;
     }
-    if (hc->recvq != nilptr) szqueue_dispose(hc->recvq);
-
-    qsz = hc->sendq->size;
-    if (qsz > 0) { linfo("discard sendq %d\n", qsz); }
-    while(hc->sendq != nilptr) {
-        hcdata* hcdt = (hcdata*)szqueue_remove(hc->sendq);
-        fiber* gr = hcdt->gr;
-        if (gr == nilptr) {
-            break;
-        }
+    int qsz = hc->recvq->size + hc->sendq->size;
+    if (qsz > 0) { linfo("wake waiters %d\n", qsz); }
+    for (;;) {
+        hcdata* hcdt = hchan_dequeue(hc->recvq);
+        if (hcdt == nilptr) hcdt = hchan_dequeue(hc->sendq);
+        if (hcdt == nilptr) break;
         hcdata_woke_set(hcdt, mygr, hc, caseClose, nilptr);
-        crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
-        // hcdata_free(hcdt);
+        pmutex_unlock(&hc->lock);
+        crn_procer_resume_one(hcdt->gr, 0, hcdt->grid, hcdt->mcid);
+        pmutex_lock(&hc->lock);
     }
-    if (hc->sendq != nilptr) szqueue_dispose(hc->sendq);
-
-    int bufsz = chan_size(hc->c);
-    if (bufsz > 0) { linfo("Warning, discard bufsz %d\n", bufsz); }
-    chan_dispose(hc->c);
-    hc->c = nilptr;
-    bzero(hc, sizeof(hchan));
-    crn_gc_free(hc);
     pmutex_unlock(&hc->lock);
     return true;
 }
@@ -102,17 +93,22 @@ int hchan_is_closed(hchan* hc) {
 int hchan_cap(hchan* hc) { return hc->cap; }
 int hchan_len(hchan* hc) { return chan_size(hc->c); }
 
-// TODO when sending/recving, hchan closed case
 int hchan_send(hchan* hc, void* data) {
     fiber* mygr = crn_fiber_getcur();
     assert(mygr != nilptr);
 
     pmutex_lock(&hc->lock);
+    if (hc->closed) {
+        pmutex_unlock(&hc->lock);
+        linfo("send on closed chan %p\n", hc);
+        assert(1==2);
+        return 0;
+    }
     if (hc->cap == 0) {
         // if any fiber waiting, put data to it elem and then wakeup
         // else put self to sendq and then parking self
 
-        hcdata* hcdt = (hcdata*)szqueue_remove(hc->recvq);
+        hcdata* hcdt = hchan_dequeue(hc->recvq);
         if (hcdt != nilptr) {
             fiber* gr = hcdt->gr;
             // assert(gr->id == hcdt->grid);
@@ -141,9 +137,11 @@ int hchan_send(hchan* hc, void* data) {
         int bufsz = chan_size(hc->c);
         if (bufsz < hc->cap) {
             chan_send(hc->c, data);
-            hcdata* hcdt = (hcdata*)szqueue_remove(hc->recvq);
-            fiber* gr = hcdt->gr;
+            hcdata* hcdt = hchan_dequeue(hc->recvq);
+            fiber* gr = hcdt != nilptr ? hcdt->gr : nilptr;
             if (gr != nilptr) {
+                // hand the oldest buffered elem to the parked recver
+                chan_recv(hc->c, &data);
                 assert(gr->id == hcdt->grid);
                 hcdata_woke_set(hcdt, mygr, hc, caseRecv, data);
                 crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
@@ -153,8 +151,8 @@ int hchan_send(hchan* hc, void* data) {
         }else{
             // if has recvq, put to peer hcelem, wakeup peer and return
             // put data to my hcelem, put self to sendq, then parking self
-            hcdata* hcdt = (hcdata*)szqueue_remove(hc->recvq);
-            fiber* gr = hcdt->gr;
+            hcdata* hcdt = hchan_dequeue(hc->recvq);
+            fiber* gr = hcdt != nilptr ? hcdt->gr : nilptr;
             if (gr != nilptr) {
                 // assert(gr->id == hcdt->grid);
                 hcdata_woke_set(hcdt, mygr, hc, caseRecv, data);
@@ -175,21 +173,28 @@ int hchan_send(hchan* hc, void* data) {
     }
 }
 
+// 0 and *pdata nilptr once hc is closed and drained
 int hchan_recv(hchan* hc, void** pdata) {
     fiber* mygr = crn_fiber_getcur();
     assert(mygr != nilptr);
 
     pmutex_lock(&hc->lock);
+    if (hc->closed && chan_size(hc->c) == 0) {
+        pmutex_unlock(&hc->lock);
+        *pdata = nilptr;
+        return 0;
+    }
     if (hc->cap == 0) {
         // if have elem not nil, get it
         // else if any sendq, wakeup them,
         // else parking
 
-        hcdata* hcdt = (hcdata*)szqueue_remove(hc->sendq);
+        hcdata* hcdt = hchan_dequeue(hc->sendq);
         if (hcdt != nilptr) {
             fiber* gr = hcdt->gr;
             // assert(gr->id == hcdt->grid);
             *pdata = hcdt->sdelem;
+            hcdata_woke_set(hcdt, mygr, hc, caseSend, hcdt->sdelem);
             linfo("resume sender %d/%d by %d/%d\n", hcdt->grid, hcdt->mcid, mygr->id, mygr->mcid);
             pmutex_unlock(&hc->lock);
             crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
@@ -207,7 +212,7 @@ int hchan_recv(hchan* hc, void** pdata) {
             mygr->hclock = &hc->lock;
             crn_procer_yield(-1, YIELD_TYPE_CHAN_RECV);
             assert(*pdata != invlidptr);
-            return 1;
+            return hcdt->wokecase != caseClose;
         }
     }else{
         // if size > 0, recv right now
@@ -216,15 +221,25 @@ int hchan_recv(hchan* hc, void** pdata) {
         int bufsz = chan_size(hc->c);
         if (bufsz > 0) {
             chan_recv(hc->c, pdata);
+            // a parked sender fills the freed slot
+            hcdata* hcdt = hchan_dequeue(hc->sendq);
+            if (hcdt != nilptr) {
+                chan_send(hc->c, hcdt->sdelem);
+                hcdata_woke_set(hcdt, mygr, hc, caseSend, hcdt->sdelem);
+                pmutex_unlock(&hc->lock);
+                crn_procer_resume_one(hcdt->gr, 0, hcdt->grid, hcdt->mcid);
+                return 1;
+            }
             pmutex_unlock(&hc->lock);
             return 1;
         }
 
-        hcdata* hcdt = (hcdata*)szqueue_remove(hc->sendq);
-        fiber* gr = hcdt->gr;
+        hcdata* hcdt = hchan_dequeue(hc->sendq);
+        fiber* gr = hcdt != nilptr ? hcdt->gr : nilptr;
         if (gr != nilptr) {
             // assert(gr->id == hcdt->grid);
             *pdata = hcdt->sdelem;
+            hcdata_woke_set(hcdt, mygr, hc, caseSend, hcdt->sdelem);
             pmutex_unlock(&hc->lock);
             crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
             return 1;
@@ -236,7 +251,7 @@ int hchan_recv(hchan* hc, void** pdata) {
         assert(rv != -1);
         pmutex_unlock(&hc->lock);
         crn_procer_yield(-1, YIELD_TYPE_CHAN_RECV);
-        return 1;
+        return hcdt->wokecase != caseClose;
     }
 }
 
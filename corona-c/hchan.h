@@ -26,6 +26,7 @@ typedef struct hcdata  {
     int wokecase; // caseSend/caseRecv
     fiber* wokeby; //
     void* wokehc; // hchan*
+    int* seldone; // shared by one select's cases, first waker wins
 } hcdata;
 
 int hchan_is_closed(hchan* hc);
@@ -34,10 +35,14 @@ int hchan_len(hchan* hc);
 
 hcdata* hcdata_new(fiber* gr);
 void hcdata_free(hcdata* d);
+void hcdata_woke_set(hcdata*d, fiber* wkgr, hchan* hc, int wkcase, void* elem);
+hcdata* hchan_dequeue(szqueue_t* q);
 
 typedef struct scase scase;
 scase* scase_new(hchan* hc, uint16_t kind, void* elem);
 void scase_free(scase* cas);
+void* scase_elem(scase* cas);
+bool goselect(int* rcasi, scase** cas0, int ncases);
 
 #endif
 
@@ -179,6 +179,14 @@ int socketpair(int domain, int type, int protocol, int sv[2])
     return rv;
 }
 
+// a context done, see crn_fiber_interrupt. blocking calls then give
+// up with ECANCELED, what is already there is still returned
+static int hook_interrupted() {
+    if (!crn_fiber_interrupted()) return 0;
+    errno = ECANCELED;
+    return 1;
+}
+
 int connect(int fd, const struct sockaddr *addr, socklen_t addrlen)
 {
     if (!connect_f) initHook();
@@ -209,6 +217,7 @@ int connect(int fd, const struct sockaddr *addr, socklen_t addrlen)
             return rv;
         }
         // linfo("yield %d %d %d\n", fd, rv, eno);
+        if (hook_interrupted()) return -1;
         crn_procer_yield(fd, YIELD_TYPE_CONNECT);
     }
     assert(1==2); // unreachable
@@ -233,6 +242,7 @@ int accept(int sockfd, struct sockaddr *addr, socklen_t *addrlen)
             linfo("fd=%d err=%d eno=%d err=%s\n", sockfd, rv, errno, strerror(errno));
             return rv;
         }
+        if (hook_interrupted()) return -1;
         crn_procer_yield(sockfd, YIELD_TYPE_ACCEPT);
     }
     assert(1==2); // unreachable
@@ -271,6 +281,7 @@ ssize_t read(int fd, void *buf, size_t count)
             // hookcb_setin_poll(fd, false, true); // cannot clear flag, or unexpected yeild/suspend
             return rv;
         }
+        if (hook_interrupted()) return -1;
         crn_procer_yield(fd, YIELD_TYPE_READ);
     }
     assert(1==2); // unreachable
@@ -310,6 +321,7 @@ ssize_t recv(int sockfd, void *buf, size_t len, int flags)
             linfo("invalid fd=%d val=%d\n", sockfd, fdvalid);
             assert(fd_is_valid(sockfd) == 1);
         }
+        if (hook_interrupted()) return -1;
         crn_procer_yield(sockfd, YIELD_TYPE_RECV);
     }
     assert(1==2); // unreachable
@@ -337,6 +349,7 @@ ssize_t recvfrom(int sockfd, void *buf, size_t len, int flags,
             linfo("fd=%d rv=%d eno=%d err=%s\n", sockfd, rv, eno, strerror(eno));
             return rv;
         }
+        if (hook_interrupted()) return -1;
         crn_procer_yield(sockfd, YIELD_TYPE_RECVFROM);
     }
     assert(1==2); // unreachable
@@ -390,10 +403,12 @@ ssize_t recvmsg(int sockfd, struct msghdr *msg, int flags)
             ytypes[0] = YIELD_TYPE_RECVMSG;
             tfds[1] = timeoms;
             ytypes[1] = YIELD_TYPE_MSLEEP;
+            if (hook_interrupted()) return -1;
             crn_procer_yield_multi(YIELD_TYPE_RECVMSG_TIMEOUT, 2, tfds, ytypes);
         }else{
             // linfo("recvmsg yeild fd=%d isudp=%d rv=%d eno=%d err=%s\n", sockfd, isudp, rv, eno, strerror(eno));
             // assert(1==2);
+            if (hook_interrupted()) return -1;
             crn_procer_yield(sockfd, YIELD_TYPE_RECVMSG);
         }
     }
@@ -421,6 +436,7 @@ ssize_t write(int fd, const void *buf, size_t count)
 
         bool inpoll = hookcb_getin_poll(fd, false);
         linfo("write yeild %d n %d nb %d inpoll %d\n", fd, count, fd_is_nonblocking(fd), inpoll);
+        if (hook_interrupted()) return -1;
         crn_procer_yield(fd, YIELD_TYPE_WRITE);
     }
     assert(1==2); // unreachable
@@ -448,6 +464,7 @@ ssize_t writev(int fd, const struct iovec *iov, int iovcnt)
             return rv;
         }
         // linfo("writev yield fd=%d rv=%d len=%d\n", fd, rv, totlen);
+        if (hook_interrupted()) return -1;
         crn_procer_yield(fd, YIELD_TYPE_WRITEV);
     }
     assert(1==2);
@@ -479,6 +496,7 @@ ssize_t send(int sockfd, const void *buf, size_t len, int flags)
             linfo("fd=%d rv=%d eno=%d err=%s\n", sockfd, rv, eno, strerror(eno));
             return rv;
         }
+        if (hook_interrupted()) return -1;
         crn_procer_yield(sockfd, YIELD_TYPE_SEND);
     }
     assert(1==2); // unreachable
@@ -520,6 +538,7 @@ ssize_t sendmsg(int sockfd, const struct msghdr *msg, int flags)
             linfo("fd=%d rv=%d eno=%d err=%s\n", sockfd, rv, eno, strerror(eno));
             return rv;
         }
+        if (hook_interrupted()) return -1;
         crn_procer_yield(sockfd, YIELD_TYPE_SENDMSG);
     }
     assert(1==2); // unreachable
@@ -636,6 +655,7 @@ int __poll(struct pollfd fds[], nfds_t nfds, int timeout)
 
         // linfo("poll yeild %d timeo %d rv %d\n", i, timeout, rv);
         int fixyn = i == 0 ? ynfds : (ynfds-1);
+        if (hook_interrupted()) return -1;
         crn_procer_yield_multi(YIELD_TYPE_UUPOLL, fixyn, tfds, tytypes);
     }
     assert(1==2);
@@ -786,6 +806,7 @@ unsigned int sleep(unsigned int seconds)
         int dtime = etime-btime;
         if (dtime >= seconds) { return 0; }
         leftsec = seconds - dtime;
+        if (hook_interrupted()) { return leftsec; }
         // linfo("leftsec=%d dtime=%d etime=%d btime=%d\n", leftsec, etime-btime, etime, btime);
     }
 }
@@ -798,8 +819,9 @@ int usleep(useconds_t usec)
 
     time_t btime = time(0);
     {
+        if (hook_interrupted()) return -1;
         int rv = crn_procer_yield(usec, YIELD_TYPE_USLEEP);
-        return 0;
+        return hook_interrupted() ? -1 : 0;
     }
 }
 
@@ -810,8 +832,9 @@ int nanosleep(const struct timespec *req, struct timespec *rem)
     // linfo("%d, %d\n", req->tv_sec, req->tv_nsec);
     {
         long ns = req->tv_sec * 1000000000 + req->tv_nsec;
+        if (hook_interrupted()) return -1;
         int rv = crn_procer_yield(ns, YIELD_TYPE_NANOSLEEP);
-        return 0;
+        return hook_interrupted() ? -1 : 0;
     }
 }
 
@@ -16,6 +16,8 @@ scase* scase_new(hchan* hc, uint16_t kind, void* elem) {
     scase* cas = (scase*)crn_gc_malloc(sizeof(scase));
     fiber* mygr = crn_fiber_getcur();
     hcdata* hcdt= hcdata_new(mygr);
+    cas->hc = hc;
+    cas->kind = kind;
     if (kind == caseRecv) {
         hcdt->rvelem = &cas->hcelem;
     }else if(kind == caseSend){
@@ -33,28 +35,29 @@ void scase_free(scase* cas) {
 
 static
 void sellock(scase** cas0, uint16_t* lockorder, int ncases) {
+    hchan* last = nilptr;
     for (int i = 0; i < ncases; i++) {
         scase* cas = cas0[lockorder[i]];
+        if (cas->hc == nilptr || cas->hc == last) continue;
+        last = cas->hc;
         pmutex_lock(&cas->hc->lock);
     }
 }
 static
 void selunlock(scase** cas0, uint16_t* lockorder, int ncases) {
+    hchan* last = nilptr;
     for (int i = ncases-1; i >= 0; i--) {
         scase* cas = cas0[lockorder[i]];
+        if (cas->hc == nilptr || cas->hc == last) continue;
+        last = cas->hc;
         pmutex_unlock(&cas->hc->lock);
     }
 }
-static
-bool selparkcommit() {
-    return false;
-}
-static
-void selblock() {
-}
+
+void* scase_elem(scase* cas) { return cas->hcelem; }
 
 static
-bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
+bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, uint16_t* pollorder, int ncases) {
     fiber* mygr = crn_fiber_getcur();
     sellock(cas0, order0, ncases);
     linfo("rcasi=%d cas0=%p order0=%p ncases=%d\n", *rcasi, cas0, order0, ncases);
@@ -62,9 +65,7 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
     scase* sk = nilptr;
     hcdata* hcdt = nilptr;
     fiber* gr = nilptr;
-    fiber* wkgr = nilptr;
-    int casewk = 0;
-    hchan* wkhc = nilptr;
+    int seldone = 0;
 
     int dfti = 0;
     scase* dftv = nilptr;
@@ -73,33 +74,28 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
     bool recvok = false;
     int retline = 0;
 
-    // TODO order and dedup
-
  loop:
-    // pass 1 - look for something already waiting
+    // pass 1 - look for something already waiting, in poll order
+    dftv = nilptr;
     for (int i = 0; i < ncases; i ++) {
-        casi = order0[i];
+        casi = pollorder[i];
         cas = cas0[casi];
         hc = cas->hc;
 
         switch (cas->kind) {
         case caseNil:
-            assert(1==2); break;
+            break;
         case caseRecv:
-            hcdt = szqueue_remove(hc->sendq);
-            gr = hcdt->gr;
-            if (gr != nilptr) { assert(gr->id == hcdt->grid); }
-            if (gr != nilptr) goto recv;
             if (hchan_len(hc)>0) goto bufrecv;
+            hcdt = hchan_dequeue(hc->sendq);
+            if (hcdt != nilptr) goto recv;
             if (hchan_is_closed(hc)) goto rclose;
             break;
 
         case caseSend:
             if (hchan_is_closed(hc)) goto sclose;
-            hcdt = szqueue_remove(hc->recvq);
-            gr = hcdt->gr;
-            if (gr != nilptr) { assert(gr->id == hcdt->grid); }
-            if (gr != nilptr) goto send;
+            hcdt = hchan_dequeue(hc->recvq);
+            if (hcdt != nilptr) goto send;
             if (hchan_len(hc) < hchan_cap(hc)) goto bufsend;
             break;
         case caseDefault:
@@ -119,70 +115,53 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
     }
 
     // pass 2 - enqueue on all chans
+    seldone = 0;
     for (int i = 0; i < ncases; i ++) {
         casi = i;
         cas = cas0[casi];
-        if (cas->kind == caseNil) continue;
-
         hc = cas->hc;
+        hcdt = cas->hcdt;
+        hcdt->seldone = &seldone;
+        hcdt->wokehc = nilptr;
 
         switch (cas->kind) {
+        case caseNil:
+            break;
         case caseRecv:
-            hcdt = cas->hcdt;
             szqueue_add(hc->recvq, hcdt);
-            hcdt = nilptr;
             break;
         case caseSend:
-            hcdt = cas->hcdt;
             szqueue_add(hc->sendq, hcdt);
-            hcdt = nilptr;
             break;
         default:
             assert(1==2); break;
         }
     }
+    hcdt = nilptr;
 
     // wait for someone to wake us up
     selunlock(cas0, order0, ncases);
-    linfo("should here %d\n", 0);
     crn_procer_yield(-1, YIELD_TYPE_CHAN_SELECT);
-    linfo("should here %d\n", 0);
     sellock(cas0, order0, ncases);
 
     // pass 3  - dequeue from unsuccessful chans
     casi = -1;
     cas = nilptr;
-
-    /* wkgr = mygr->wokeby; */
-    /* wkhc = mygr->wokehc; */
-    /* casewk = mygr->wokecase; */
     for (int i = 0; i < ncases; i ++) {
         sk = cas0[i];
-        if (sk->kind == caseNil) continue;
-
-        wkgr = cas->hcdt->wokeby;
-        wkhc = cas->hcdt->wokehc;
-        casewk = cas->hcdt->wokecase;
+        if (sk->kind != caseRecv && sk->kind != caseSend) continue;
 
-        // try match which case woke
-        if (casewk == sk->kind && sk->hc == wkhc) {
+        // the waker set wokehc on the one hcdata it dequeued
+        if (cas == nilptr && sk->hcdt->wokehc == sk->hc) {
             casi = i;
             cas = sk;
-            linfo("case woke i=%d direction=%d by=%p val=%p\n", i, casewk, wkgr, sk->hcelem);
-        }
-        else{
+            linfo("case woke i=%d direction=%d by=%p val=%p\n", i,
+                  sk->hcdt->wokecase, sk->hcdt->wokeby, sk->hcelem);
+        } else {
             hc = sk->hc;
-            if (sk->kind == caseSend) {
-                hcdt = szqueue_remove(hc->sendq);
-            }else{
-                hcdt = szqueue_remove(hc->recvq);
-            }
-            assert(hcdt != nilptr);
-            gr = hcdt->gr;
-            assert(gr == mygr);
-            gr = nilptr;
-            hcdt = nilptr;
+            szqueue_remove_value(sk->kind == caseSend ? hc->sendq : hc->recvq, sk->hcdt);
         }
+        sk->hcdt->seldone = nilptr;
     }
 
     if (cas == nilptr) {
@@ -192,7 +171,10 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
     hc = cas->hc;
     linfo("wait-return: cas0=%p hc=%p cas=%p kind=%d\n", cas0, hc, cas, cas->kind);
 
-    if (cas->kind == caseRecv) {
+    if (cas->hcdt->wokecase == caseClose) {
+        if (cas->kind == caseSend) goto sclose;
+        cas->hcelem = nilptr;
+    } else if (cas->kind == caseRecv) {
         recvok = true;
     }
 
@@ -203,7 +185,15 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
  bufrecv:
     recvok = true;
     chan_recv(hc->c, &cas->hcelem);
+    // a parked sender fills the freed slot
+    hcdt = hchan_dequeue(hc->sendq);
+    gr = hcdt != nilptr ? hcdt->gr : nilptr;
+    if (gr != nilptr) {
+        chan_send(hc->c, hcdt->sdelem);
+        hcdata_woke_set(hcdt, mygr, hc, caseSend, hcdt->sdelem);
+    }
     selunlock(cas0, order0, ncases);
+    if (gr != nilptr) crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
     retline = __LINE__;
     goto retc;
 
@@ -214,6 +204,10 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
     goto retc;
 
  recv:
+    // take the parked sender's elem
+    gr = hcdt->gr;
+    cas->hcelem = hcdt->sdelem;
+    hcdata_woke_set(hcdt, mygr, hc, caseSend, hcdt->sdelem);
     selunlock(cas0, order0, ncases);
     crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
     linfo("syncrecv: cas0=%p hc=%p val=%p\n", cas0, hc, cas->hcelem);
@@ -223,12 +217,17 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
 
  rclose:
     selunlock(cas0, order0, ncases);
+    cas->hcelem = nilptr;
     recvok = false;
     retline = __LINE__;
     goto retc;
 
  send:
+    // hand my elem to the parked recver
+    gr = hcdt->gr;
+    hcdata_woke_set(hcdt, mygr, hc, caseRecv, cas->hcelem);
     selunlock(cas0, order0, ncases);
+    crn_procer_resume_one(gr, 0, hcdt->grid, hcdt->mcid);
     linfo("syncsend: cas0=%p hc=%p val=%p\n", cas0, hc, cas->hcelem);
     retline = __LINE__;
     goto retc;
@@ -239,6 +238,7 @@ bool selectgo(int* rcasi, scase** cas0, uint16_t* order0, int ncases) {
     return recvok;
 
  sclose:
+    selunlock(cas0, order0, ncases);
     linfo("send closed chan %d", 0);
     assert(1==2);
     return false;
@@ -249,18 +249,37 @@ static void blocknocase() {
 }
 
 bool goselect(int* rcasi, scase** cas0, int ncases) {
-    if (ncases == 0) {
+    int nready = 0;
+    for (int i = 0; i < ncases; i ++) {
+        if (cas0[i]->kind != caseNil) nready ++;
+    }
+    if (nready == 0) {
         // parking forever
         blocknocase();
         assert(1==2); // not reachable
     }
 
+    // poll order is random, so no ready case starves the later ones
     assert(ncases <= 32);
+    uint16_t pollorder[32] = {0};
+    for (int i = 1; i < ncases; i ++) {
+        int j = rand() % (i+1);
+        pollorder[i] = pollorder[j];
+        pollorder[j] = i;
+    }
+
+    // lock order by chan address, so two selects on the same chans
+    // never lock in opposite order, and dups are adjacent
     uint16_t order0[32] = {0};
     for (int i = 0; i < ncases; i ++) {
-        order0[i] = i;
+        int j = i;
+        while (j > 0 && (uintptr_t)cas0[order0[j-1]]->hc > (uintptr_t)cas0[i]->hc) {
+            order0[j] = order0[j-1];
+            j --;
+        }
+        order0[j] = i;
     }
-    return selectgo(rcasi, cas0, order0, ncases);
+    return selectgo(rcasi, cas0, order0, pollorder, ncases);
 }
 
 // go 1.12.5
@@ -129,6 +129,10 @@ static int netpoller_next_timeout() {
 
 static int netpoller_resume_one(evdata* d) {
     void* dd = d->data;
+    if (dd == nilptr) { // cancelled timer
+        evdata_free(d);
+        return 0;
+    }
     int ytype = d->ytype;
     int grid = d->grid;
     int mcid = d->mcid;
@@ -160,6 +164,8 @@ static int netpoller_dispatch_timers2() {
         if ( rv <= 0) {
             expires[expcnt++] = curd;
             pqueue_pop(np->timers, nilptr);
+            fiber* gr = (fiber*)curd->data;
+            if (gr != nilptr && gr->pktimer == curd) { gr->pktimer = nilptr; }
         }else{
             break;
         }
@@ -506,6 +512,7 @@ void netpoller_timer(long ns, int ytype, fiber* gr) {
         d->seqno = ++np->seqno;
         rv = pqueue_push(np->timers, d);
         assert(rv == CC_OK);
+        gr->pktimer = d;
     pthread_mutex_unlock(&np->evmu);
     crn_post_gclock_proc(__func__);
     uint64_t tmval = 1;
@@ -522,6 +529,44 @@ void netpoller_timer(long ns, int ytype, fiber* gr) {
     // linfo("timer add %d d=%p %ld sec=%d nsec=%d\n", tmfd, d, ns, ts.tv_sec, ts.tv_nsec);
 }
 
+// drop what gr is parked on, so nothing resumes it later.
+// the timer stays queued without a fiber, fds are disarmed
+void netpoller_cancel(fiber* gr) {
+    netpoller* np = gnpl__;
+
+    crn_pre_gclock_proc(__func__);
+    pthread_mutex_lock(&np->evmu);
+    evdata* dt = (evdata*)gr->pktimer;
+    if (dt != nilptr) {
+        dt->data = nilptr;
+        gr->pktimer = nilptr;
+    }
+    int nfds = sizeof(np->evfds)/sizeof(np->evfds[0]);
+    for (int fd = 0; fd < nfds; fd++) {
+        evdata2* d2 = np->evfds[fd];
+        if (d2 == nilptr) continue;
+        int hit = 0;
+        if (d2->dr != nilptr && d2->dr->data == gr) { d2->dr = nilptr; hit = 1; }
+        if (d2->dw != nilptr && d2->dw->data == gr) { d2->dw = nilptr; hit = 1; }
+        if (!hit) continue;
+
+        epoll_ctl(np->epfd, EPOLL_CTL_DEL, fd, 0);
+        int newev = 0;
+        if (d2->dr != nilptr) { newev |= EPOLLIN; }
+        if (d2->dw != nilptr) { newev |= EPOLLOUT; }
+        if (newev == 0) {
+            np->evfds[fd] = nilptr;
+            continue;
+        }
+        struct epoll_event evt = {0};
+        evt.events = newev | EPOLLET;
+        evt.data.fd = fd;
+        epoll_ctl(np->epfd, EPOLL_CTL_ADD, fd, &evt);
+    }
+    pthread_mutex_unlock(&np->evmu);
+    crn_post_gclock_proc(__func__);
+}
+
 // what to do
 static struct addrinfo* netpoller_dump_addrinfo(struct evutil_addrinfo* addr) {
     assert(1==2);
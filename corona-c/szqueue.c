@@ -116,3 +116,22 @@ void* szqueue_peek(szqueue_t* queue)
 {
     return queue->size ? queue->data[queue->next] : NULL;
 }
+
+// Removes the first occurrence of value, keeping the order of the others.
+// Returns 1 if it was found, 0 otherwise.
+int szqueue_remove_value(szqueue_t* queue, void* value)
+{
+    int found = 0;
+    size_t n = queue->size;
+    for (size_t i = 0; i < n; i++)
+    {
+        void* v = szqueue_remove(queue);
+        if (!found && v == value)
+        {
+            found = 1;
+            continue;
+        }
+        szqueue_add(queue, v);
+    }
+    return found;
+}
@@ -32,4 +32,8 @@ void* szqueue_remove(szqueue_t* queue);
 // queue is empty.
 void* szqueue_peek(szqueue_t*);
 
+// Removes the first occurrence of value, keeping the order of the others.
+// Returns 1 if it was found, 0 otherwise.
+int szqueue_remove_value(szqueue_t* queue, void* value);
+
 #endif
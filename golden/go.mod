@@ -0,0 +1,3 @@
+module cygo/golden
+
+go 1.12
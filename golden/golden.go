@@ -0,0 +1,158 @@
+// Package golden runs the sample programs of a backend and compares their
+// output with the expected.out recorded beside each of them. The byir and
+// bysrc golden tests share it.
+//
+//	go test -run Golden            # check
+//	go test -run Golden -update    # rewrite expected.out from our output
+package golden
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite expected.out files with the current output")
+
+// Timeout bounds each run of a sample.
+const Timeout = 60 * time.Second
+
+// Build builds the sample in dir to the executable exepath.
+type Build func(name, dir, exepath string) error
+
+// Run builds, runs and checks each directory of root as a subtest.
+// Directories listed in skipfile are skipped with the reason given there,
+// any other one without an expected.out fails.
+func Run(t *testing.T, root, skipfile string, build Build) {
+	skips, err := ReadSkipList(skipfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range dirs {
+		if !fi.IsDir() {
+			continue
+		}
+		name := fi.Name()
+		t.Run(name, func(t *testing.T) {
+			if reason, ok := skips[name]; ok {
+				t.Skip(reason)
+			}
+
+			dir := filepath.Join(root, name)
+			expected := filepath.Join(dir, "expected.out")
+			want, err := ioutil.ReadFile(expected)
+			if err != nil && !(os.IsNotExist(err) && *update) {
+				t.Fatalf("%v; record one with -update or list %s in %s",
+					err, name, skipfile)
+			}
+
+			exepath := filepath.Join(tmpdir, name)
+			err = build(name, dir, exepath)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+
+			got, err := RunProgram(exepath)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+
+			if *update {
+				err = ioutil.WriteFile(expected, got, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output mismatch\n--- want\n%s\n--- got\n%s", want, got)
+			}
+		})
+	}
+}
+
+// RunProgram runs exepath and gives its output, stdout and stderr since
+// println writes to stderr, normalized for comparison. A non-zero exit
+// status is recorded on a last line of its own.
+func RunProgram(exepath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, exepath)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("timed out after %v", Timeout)
+	}
+	if err, ok := err.(*exec.ExitError); ok {
+		fmt.Fprintf(&out, "[exit status %d]\n", err.ExitCode())
+	} else if err != nil {
+		return nil, err
+	}
+	return Normalize(out.Bytes()), nil
+}
+
+var nonNilPointerRe = regexp.MustCompile(`0x[0-9a-f]*[1-9a-f][0-9a-f]*`)
+
+// Normalize replaces addresses, which change from run to run. Nil
+// pointers are kept, so that they can't be confused with real ones.
+func Normalize(out []byte) []byte {
+	return nonNilPointerRe.ReplaceAll(out, []byte("0xPTR"))
+}
+
+// ReadSkipList reads lines of "<dir> <reason>", ignoring blank lines and
+// # comments. A missing file lists nothing.
+func ReadSkipList(path string) (map[string]string, error) {
+	fd, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	skips := map[string]string{}
+	s := bufio.NewScanner(fd)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		skips[fields[0]] = strings.Join(fields[1:], " ")
+	}
+	return skips, s.Err()
+}
+
+// LastLines is the tail of a tool's output for an error message.
+func LastLines(out []byte, n int) []byte {
+	lines := bytes.Split(bytes.TrimRight(out, "\n"), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -18,6 +18,12 @@ extern int hchan_cap(hchan* hc);
 extern int hchan_len(hchan* hc);
 extern int hchan_send(hchan* hc, void* data);
 extern int hchan_recv(hchan* hc, void** pdata);
+extern int hchan_is_closed(hchan* hc);
+extern int hchan_close(hchan* hc);
+typedef struct scase scase;
+extern scase* scase_new(hchan* hc, uint16_t kind, void* elem);
+extern void* scase_elem(scase* cas);
+extern bool goselect(int* rcasi, scase** cas0, int ncases);
 
 int cxargc = 0;
 char** cxargv = {0};
@@ -92,6 +98,7 @@ void cxrt_chan_send(void*ch, void*arg) {
     assert(ch != nilptr);
     hchan_send(ch, arg);
 }
+// nilptr once ch is closed and drained
 void* cxrt_chan_recv(void*ch) {
     // return nilptr;
     assert(ch != nilptr);
@@ -99,6 +106,36 @@ void* cxrt_chan_recv(void*ch) {
     hchan_recv(ch, &data);
     return data;
 }
+void cxrt_chan_close(void*ch) {
+    assert(ch != nilptr);
+    hchan_close(ch);
+}
+// for range, nilptr once ch is closed and drained
+void* cxrt_chan_recv_open(void*ch) {
+    assert(ch != nilptr);
+    void* data = nilptr;
+    hchan_recv(ch, &data);
+    return data;
+}
+int cxrt_chan_len(void*ch) { return ch == nilptr ? 0 : hchan_len(ch); }
+int cxrt_chan_cap(void*ch) { return ch == nilptr ? 0 : hchan_cap(ch); }
+
+// select cases, kind is 1 recv, 2 send, 3 default as corona's hselect.
+// a nil ch is never ready
+void* cxrt_select_case(void*ch, int kind, void*arg) {
+    if (ch == nilptr && kind != 3) {
+        kind = 0;
+    }
+    return scase_new(ch, kind, arg);
+}
+// index of the chosen case to casi, false if it received from a closed ch
+bool cxrt_select(void** cases, int n, int* casi) {
+    return goselect(casi, (scase**)cases, n);
+}
+// what a recv case got, nilptr if the ch was closed
+void* cxrt_select_recved(void*cas) {
+    return scase_elem(cas);
+}
 
 /////
 error* error_new_zero() {
@@ -179,6 +216,34 @@ pid_t cxgettid() {
 #endif
 }
 
+// box layout of all named interfaces, the methods follow
+typedef struct cxifacebox {
+    voidptr thisptr;
+    cxmethods* thismths;
+} cxifacebox;
+
+// fnptr of the method of the concrete value in iface, called with its
+// thisptr. nilptr if iface is nil or that has no name method of type sig,
+// sig nilptr matches any
+voidptr cxrt_ifacemethod(voidptr iface, charptr name, charptr sig) {
+    cxifacebox* box = (cxifacebox*)iface;
+    if (box == nilptr || box->thismths == nilptr) return nilptr;
+    for (int i = 0; i < box->thismths->count; i++) {
+        cxmethod* mth = &box->thismths->mths[i];
+        if (strcmp(mth->name, name) != 0) continue;
+        if (sig != nilptr && strcmp(mth->sig, sig) != 0) continue;
+        return mth->fnptr;
+    }
+    return nilptr;
+}
+
+// C name of the concrete type in iface, main__foo*, nilptr if unknown
+charptr cxrt_ifacetype(voidptr iface) {
+    cxifacebox* box = (cxifacebox*)iface;
+    if (box == nilptr || box->thismths == nilptr) return nilptr;
+    return box->thismths->tystr;
+}
+
 cxeface* cxrt_type2eface(voidptr _type, voidptr data) {
     _metatype* mty = (_metatype*)_type;
     cxeface* efc = (cxeface*)cxmalloc(sizeof(cxeface));
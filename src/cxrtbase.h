@@ -82,8 +82,22 @@ typedef struct cxiface {
     ifacetab* itab; // itab
     voidptr data;
 } cxiface;
+// what a named interface box keeps after thisptr, all methods of the
+// concrete type in it, not only the ones the interface declares
+typedef struct cxmethod {
+    charptr name;
+    charptr sig; // func(error) bool
+    voidptr fnptr;
+} cxmethod;
+typedef struct cxmethods {
+    charptr tystr; // the concrete type, main__foo*
+    int count;
+    cxmethod* mths;
+} cxmethods;
 cxeface cxeface_new_of2(void* data, int sz);
 cxeface* cxrt_type2eface(voidptr _type, voidptr data);
+voidptr cxrt_ifacemethod(voidptr iface, charptr name, charptr sig);
+charptr cxrt_ifacetype(voidptr iface);
 
 // utils
 // void println(const char* fmt, ...);
@@ -102,6 +116,13 @@ extern void cxrt_fiber_post(void* fn /*void (*fn)(void*)*/, void*arg);
 extern void* cxrt_chan_new(int sz);
 extern void cxrt_chan_send(void*ch, void*arg);
 extern void* cxrt_chan_recv(void*ch);
+extern void* cxrt_chan_recv_open(void*ch);
+extern void cxrt_chan_close(void*ch);
+extern int cxrt_chan_len(void*ch);
+extern int cxrt_chan_cap(void*ch);
+extern void* cxrt_select_case(void*ch, int kind, void*arg);
+extern bool cxrt_select(void** cases, int n, int* casi);
+extern void* cxrt_select_recved(void*cas);
 extern void cxrt_set_finalizer(void*ptr, void(*fn)(void*));
 
 #include <sys/types.h>
@@ -150,6 +150,13 @@ func (arr *cxarray3) slice(start int, end int) *cxarray3 {
 	return newarr
 }
 
+// arr[start:]
+//
+//export cxarray3_slice_from
+func (arr *cxarray3) slicefrom(start int) *cxarray3 {
+	return arr.slice(start, arr.len)
+}
+
 // It takes a list as argument, and returns its first element.
 func (arr *cxarray3) car() voidptr {
 	return arr.get(0)
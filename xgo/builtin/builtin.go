@@ -298,6 +298,21 @@ func nildo(obj voidptr, nilfn func()) {
 // TODO
 func condreturn(cond bool, args ...interface{})
 
+// inline assembly, lowered to gcc extended asm, at&t syntax
+//
+//	asm("rdtsc", asmout("=a", lo), asmout("=d", hi))
+//	asm("lock; xaddq %0, %1", asmout("+r", v), asmout("+m", *p), asmclob("memory"))
+//
+// operands are %0, %1... outputs first then inputs, whatever the order here.
+// outputs bind assignable go variables, constraint register classes are
+// checked against the operand type width.
+func asm(code string, operands ...asmop)
+func asmout(constraint string, lval Type) asmop
+func asmin(constraint string, val Type) asmop
+func asmclob(regs ...string) asmop
+
+type asmop int
+
 // if only two arguments, then what?
 // expr1 and expr2 should literal or ident, or simple BinaryExpr
 func ifelse(cond bool, expr1 Type, expr2 Type) Type
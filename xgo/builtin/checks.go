@@ -0,0 +1,111 @@
+package builtin
+
+/*
+#include <stdio.h>
+*/
+import "C"
+
+// runtime checks emitted by the compiler around index, slice, pointer
+// dereference and integer division, unless built with -nochecks or the
+// function has //cygo:nochecks. pos is the go file:line:col.
+
+func panic_runtime(pos byteptr, msg string) {
+	C.fprintf(C.stderr, "panic: runtime error: %.*s\n\n%s\n", msg.len, msg.ptr, pos)
+	abort()
+}
+
+//export cxrt_chkidx
+func chkidx(idx int, len int, pos byteptr) int {
+	if idx < 0 || idx >= len {
+		panic_runtime(pos, "index out of range ["+idx.repr()+"] with length "+len.repr())
+	}
+	return idx
+}
+
+// max is the capacity of a slice, the length of a string
+//
+//export cxrt_chkslice
+func chkslice(low int, high int, max int, what string, pos byteptr) {
+	if high < 0 || high > max {
+		panic_runtime(pos, "slice bounds out of range [:"+high.repr()+"] with "+what+" "+max.repr())
+	}
+	if low < 0 || low > high {
+		panic_runtime(pos, "slice bounds out of range ["+low.repr()+":"+high.repr()+"]")
+	}
+}
+
+//export cxrt_chknil
+func chknil(ptr voidptr, pos byteptr) voidptr {
+	if ptr == nil {
+		panic_runtime(pos, "invalid memory address or nil pointer dereference")
+	}
+	return ptr
+}
+
+// the compiler casts the result back to the divisor's type
+//
+//export cxrt_chkdiv
+func chkdiv(d int64, pos byteptr) int64 {
+	if d == 0 {
+		panic_runtime(pos, "integer divide by zero")
+	}
+	return d
+}
+
+//export cxarray3_get_at_chk
+func (a0 *cxarray3) getchk(idx int, pos byteptr) *voidptr {
+	len := 0
+	if a0 != nil {
+		len = a0.len
+	}
+	chkidx(idx, len, pos)
+	return a0.get(idx)
+}
+
+//export cxarray3_replace_at_chk
+func (a0 *cxarray3) setchk(v voidptr, idx int, out *voidptr, pos byteptr) voidptr {
+	len := 0
+	if a0 != nil {
+		len = a0.len
+	}
+	chkidx(idx, len, pos)
+	return a0.set(v, idx, out)
+}
+
+//export cxarray3_slice_chk
+func (arr *cxarray3) slicechk(start int, end int, pos byteptr) *cxarray3 {
+	cap := 0
+	if arr != nil {
+		cap = arr.cap
+	}
+	chkslice(start, end, cap, "capacity", pos)
+	return arr.slice(start, end)
+}
+
+//export cxarray3_slice_from_chk
+func (arr *cxarray3) slicefromchk(start int, pos byteptr) *cxarray3 {
+	len := 0
+	if arr != nil {
+		len = arr.len
+	}
+	return arr.slicechk(start, len, pos)
+}
+
+//export cxstring3_sub_chk
+func (s0 string) subchk(start int, end int, pos byteptr) string {
+	chkslice(start, end, s0.Len(), "length", pos)
+	return s0.sub(start, end)
+}
+
+//export cxstring3_sub_from_chk
+func (s0 string) subfromchk(start int, pos byteptr) string {
+	return s0.subchk(start, s0.Len(), pos)
+}
+
+// where s0[idx] is
+//
+//export cxstring3_at_chk
+func (s0 string) atchk(idx int, pos byteptr) byteptr {
+	chkidx(idx, s0.Len(), pos)
+	return voidptr(usize(s0.ptr) + usize(idx))
+}
@@ -0,0 +1,157 @@
+package builtin
+
+/*
+#include <stdbool.h>
+#include <string.h>
+
+extern void* cxrt_ifacemethod(void* iface, char* name, char* sig);
+extern char* cxrt_ifacetype(void* iface);
+
+// boxes of named interfaces start with the concrete this
+static void* builtin_ifacethis(void* iface) {
+    return iface == 0 ? 0 : *(void**)iface;
+}
+
+// the result of the no argument method name of type sig of the value in
+// iface to *out, false if it has no such method
+static bool builtin_ifacecall0(void* iface, char* name, char* sig, void* out) {
+    void* fn = cxrt_ifacemethod(iface, name, sig);
+    if (fn == 0) return false;
+    *(void**)out = ((void* (*)(void*))fn)(*(void**)iface);
+    return true;
+}
+
+// the bool of the one argument method, -1 if iface has no such method
+static int builtin_ifacecall1b(void* iface, char* name, char* sig, void* arg) {
+    void* fn = cxrt_ifacemethod(iface, name, sig);
+    if (fn == 0) return -1;
+    return ((bool (*)(void*, void*))fn)(*(void**)iface, arg);
+}
+
+// the concrete type of iface is exactly tystr behind nptr pointers
+static bool builtin_ifaceistype(void* iface, char* tystr, int nptr) {
+    char* name = cxrt_ifacetype(iface);
+    int n = strlen(tystr);
+    if (name == 0 || strncmp(name, tystr, n) != 0) return false;
+    for (name += n; nptr > 0 && *name == '*'; nptr--) name++;
+    return nptr == 0 && *name == 0;
+}
+
+// the value in iface to dst, a pointer one as is, else size bytes of
+// what its this points to
+static void builtin_ifacecopy(void* iface, void* dst, bool isptr, int size) {
+    void* this = *(void**)iface;
+    if (isptr) {
+        *(void**)dst = this;
+    } else {
+        memcpy(dst, this, size);
+    }
+}
+*/
+import "C"
+
+// an error box keeps all methods of its concrete type, see
+// cxrt_ifacemethod, so Unwrap, Is and As are found on any error
+// though the error interface declares only Error
+
+// the same error value, boxes may differ
+func errors_same(err error, target error) bool {
+	if err == nil || target == nil {
+		return err == target
+	}
+	return C.builtin_ifacethis(err) == C.builtin_ifacethis(target)
+}
+
+// what the Error() or else String() of the value in iface returns,
+// false if it has neither. for printing interfaces
+func iface_string(iface voidptr) (string, bool) {
+	var s string
+	if C.builtin_ifacecall0(iface, "Error".ptr, "func() string".ptr, &s) {
+		return s, true
+	}
+	if C.builtin_ifacecall0(iface, "String".ptr, "func() string".ptr, &s) {
+		return s, true
+	}
+	return "", false
+}
+
+// what err.Unwrap() error returns, nil if err has no such method
+func errors_unwrap(err error) error {
+	var next error
+	if !C.builtin_ifacecall0(err, "Unwrap".ptr, "func() error".ptr, &next) {
+		return nil
+	}
+	return next
+}
+
+// what err.Unwrap() []error returns, false if err has no such method
+func errors_unwrapn(err error) ([]error, bool) {
+	var errs []error
+	ok := C.builtin_ifacecall0(err, "Unwrap".ptr, "func() []error".ptr, &errs)
+	return errs, ok
+}
+
+// err or an error it wraps is target, the same value or one whose
+// Is(error) bool says so. catch cases match errors with this
+//
+//export cxrt_errors_is
+func errors_is(err error, target error) bool {
+	if err == nil || target == nil {
+		return err == target
+	}
+	for err != nil {
+		if errors_same(err, target) {
+			return true
+		}
+		if C.builtin_ifacecall1b(err, "Is".ptr, "func(error) bool".ptr, target) == 1 {
+			return true
+		}
+		errs, ok := errors_unwrapn(err)
+		if ok {
+			for _, e := range errs {
+				if errors_is(e, target) {
+					return true
+				}
+			}
+			return false
+		}
+		err = errors_unwrap(err)
+	}
+	return false
+}
+
+// the first error of err and what it wraps that has the concrete type
+// target points to is stored there, or that As(interface{}) bool says
+// so. target is a pointer to a variable of a concrete error type,
+// like &perr for perr *PathError
+func errors_as(err error, target interface{}) bool {
+	var efc *Eface = target
+	if err == nil || efc == nil || efc.Type.Kind != Ptr || *efc.Data == nil {
+		return false
+	}
+	elem := efc.Type.elemty
+	nptr := 0
+	for base := elem; base.Kind == Ptr; base = base.elemty {
+		nptr++
+	}
+	for err != nil {
+		if C.builtin_ifaceistype(err, elem.Str, nptr) {
+			C.builtin_ifacecopy(err, *efc.Data, elem.Kind == Ptr, elem.Size)
+			return true
+		}
+		if C.builtin_ifacecall1b(err, "As".ptr, "func(interface{}) bool".ptr, target) == 1 {
+			return true
+		}
+		errs, ok := errors_unwrapn(err)
+		if ok {
+			for _, e := range errs {
+				if errors_as(e, target) {
+					return true
+				}
+			}
+			return false
+		}
+		err = errors_unwrap(err)
+	}
+	return false
+}
@@ -1,7 +1,8 @@
 package builtin
 
 /*
-#cgo LDFLAGS: -lcrn
+#cgo CFLAGS: -DGC_THREADS
+#cgo LDFLAGS: -lcrn -lgc -lpthread -ldl
 
 #include <stdio.h>
 
@@ -11,6 +12,9 @@ extern int crn_goid();
 extern void* hchan_new(int);
 extern void hchan_send(voidptr, voidptr);
 extern void* hchan_recv(voidptr, voidptr);
+extern int hchan_is_closed(voidptr);
+extern int hchan_len(voidptr);
+extern int hchan_close(voidptr);
 */
 import "C"
 
@@ -47,3 +51,23 @@ func chan_recv(ch voidptr) voidptr {
 	C.hchan_recv(ch, &data)
 	return data
 }
+
+//export cxrt_chan_close
+func chan_close(ch voidptr) {
+	assert(ch != nil)
+	C.hchan_close(ch)
+}
+
+// for range over ch, nil once ch is closed and drained.
+// sent values are boxed, so never nil otherwise
+//
+//export cxrt_chan_recv_open
+func chan_recv_open(ch voidptr) voidptr {
+	assert(ch != nil)
+	if C.hchan_is_closed(ch) != 0 && C.hchan_len(ch) == 0 {
+		return nil
+	}
+	var data voidptr
+	C.hchan_recv(ch, &data)
+	return data // nil if woke up by close
+}
@@ -0,0 +1,66 @@
+package builtin
+
+/*
+#include <pthread.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define GC_THREADS
+#include <gc/gc.h>
+
+static pthread_key_t libmode_thrkey;
+static pthread_once_t libmode_keyonce = PTHREAD_ONCE_INIT;
+
+// runs on the exiting thread, only the ones we registered have a value
+static void libmode_thread_exit(void* v) {
+    GC_unregister_my_thread();
+}
+static void libmode_keyinit() {
+    pthread_key_create(&libmode_thrkey, libmode_thread_exit);
+}
+
+// registers the calling thread, unregistered when it exits
+static void libmode_thread_enter() {
+    if (GC_thread_is_registered()) return;
+    struct GC_stack_base sb;
+    GC_get_stack_base(&sb);
+    GC_register_my_thread(&sb);
+    pthread_once(&libmode_keyonce, libmode_keyinit);
+    pthread_setspecific(libmode_thrkey, (void*)1);
+}
+*/
+import "C"
+
+// support for -buildmode=c-archive/c-shared, the generated exported
+// wrappers convert arguments with these and call cygo_init first.
+
+// threads not created by us must be known to the gc before they touch
+// gc memory, or their stacks are not scanned. a pthread key destructor
+// unregisters them again on exit. such a thread runs the export outside
+// any corona fiber, so hooked calls block it as plain libc would
+//
+//export cxrt_lib_thread_enter
+func lib_thread_enter() {
+	C.libmode_thread_enter()
+}
+
+// nil is ""
+//
+//export cxrt_lib_gostring
+func lib_gostring(p byteptr) string {
+	if p == nil {
+		return ""
+	}
+	return gostring(p)
+}
+
+// malloc'ed copy, the caller frees it
+//
+//export cxrt_lib_cstring
+func lib_cstring(s string) byteptr {
+	p := C.malloc(s.len + 1)
+	C.memcpy(p, s.ptr, s.len)
+	var bp byteptr = p
+	bp[s.len] = 0
+	return bp
+}
@@ -13,10 +13,13 @@ func (ch byte) isspace() bool {
 	return false
 }
 func (ch rune) isspace() bool {
-	if ch == ' ' || ch == '\n' || ch == '\t' {
+	switch ch {
+	case ' ', '\n', '\t', '\v', '\f', '\r', 0x85, 0xA0:
+		return true
+	case 0x1680, 0x2028, 0x2029, 0x202F, 0x205F, 0x3000:
 		return true
 	}
-	return false
+	return ch >= 0x2000 && ch <= 0x200A
 }
 func (ch byte) isdigit() bool {
 	if ch >= '0' && ch <= '9' {
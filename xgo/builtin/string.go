@@ -98,21 +98,6 @@ func string3_new_char(ch byte) string {
 	return s
 }
 
-// TODO
-func cxstring3_new_rune(ch rune) string {
-	var s string
-	s.ptr = malloc3(8)
-	s.len = 3
-
-	var p byteptr
-	p = (byteptr)(&ch)
-	s.ptr[0] = p[0]
-	s.ptr[1] = p[1]
-	s.ptr[2] = p[2]
-	s.ptr[3] = p[3]
-	return s
-}
-
 func (s string) Ptr() byteptr {
 	return s.ptr
 }
@@ -155,6 +140,13 @@ func (s0 string) sub(start int, end int) string {
 	return ns
 }
 
+// s0[start:]
+//
+//export cxstring3_sub_from
+func (s0 string) subfrom(start int) string {
+	return s0.sub(start, s0.len)
+}
+
 func (s string) subnear(idx int, n int) string {
 	return s
 }
@@ -205,12 +197,12 @@ func (s0 string) ne(s1 string) bool {
 
 //export cxstring3_le
 func (s0 string) le(s1 string) bool {
-	return false
+	return !s1.lt(s0)
 }
 
 //export cxstring3_ge
 func (s0 string) ge(s1 string) bool {
-	return false
+	return !s0.lt(s1)
 }
 
 //export cxstring3_lt
@@ -230,7 +222,7 @@ func (s0 string) lt(s1 string) bool {
 
 //export cxstring3_gt
 func (s0 string) gt(s1 string) bool {
-	return false
+	return s1.lt(s0)
 }
 
 func (s string) split(sep string) []string {
@@ -373,6 +365,18 @@ func (s string) index(sep string) int {
 	return res
 }
 
+// byte index of the first r in s, or -1
+func (s string) indexrune(r rune) int {
+	width := 0
+	for idx := 0; idx < s.len; idx += width {
+		ch := cxstring3_decoderune(s, idx, &width)
+		if ch == r && width > 0 {
+			return idx
+		}
+	}
+	return -1
+}
+
 func (s string) rindex(sep string) int {
 	res := -1
 	slen := s.len
@@ -447,51 +451,35 @@ func (s string) replaceall(old string, new string) string {
 }
 
 func (s string) toupper() string {
-	slen := s.len
-	ns := ""
-	for i := 0; i < slen; i++ {
-		ch := s[i]
-		if ch >= 'a' && ch <= 'z' {
-			ch2 := ch - 32
-			ns += string(ch2)
-		} else {
-			ns += string(ch)
-		}
-	}
-	return ns
+	return s.maprunes(2, false)
 }
 func (s string) tolower() string {
-	slen := s.len
-	ns := ""
-	for i := 0; i < slen; i++ {
-		ch := s[i]
-		if ch >= 'A' && ch <= 'Z' {
-			ch2 := ch + 32
-			ns += string(ch2)
-		} else {
-			ns += string(ch)
-		}
-	}
-	return ns
+	return s.maprunes(3, false)
 }
 func (s string) totitle() string {
-	slen := s.len
-	ns := ""
-	for i := 0; i < slen; i++ {
-		ch := s[i]
-		if i == 0 && ch >= 'a' && ch <= 'z' {
-			ch2 := ch - 32
-			ns += string(ch2)
-		} else {
-			ns += string(ch)
-		}
-	}
-	return ns
+	return s.maprunes(2, true)
 }
 
 // sep with space or \t
 func (s string) fields() []string {
-	return nil
+	res := []string{}
+	pos := -1
+	width := 0
+	for idx := 0; idx < s.len; idx += width {
+		ch := cxstring3_decoderune(s, idx, &width)
+		if ch.isspace() {
+			if pos >= 0 {
+				res = append(res, s[pos:idx])
+				pos = -1
+			}
+		} else if pos < 0 {
+			pos = idx
+		}
+	}
+	if pos >= 0 {
+		res = append(res, s[pos:])
+	}
+	return res
 }
 
 // TODO
@@ -547,13 +535,10 @@ func (s string) isnumber() bool {
 	return true
 }
 func (s string) isprintable() bool {
-	slen := s.len
-	for i := 0; i < slen; i++ {
-		ch := s[i]
-		if ch >= '0' && ch <= '9' {
-		} else if ch >= 'A' && ch <= 'Z' {
-		} else if ch >= 'a' && ch <= 'z' {
-		} else {
+	width := 0
+	for idx := 0; idx < s.Len(); idx += width {
+		ch := cxstring3_decoderune(s, idx, &width)
+		if !ch.isprintable() {
 			return false
 		}
 	}
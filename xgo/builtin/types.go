@@ -201,6 +201,25 @@ func type2eface(mtype voidptr, data voidptr) *Eface {
 	return efc
 }
 
+// a pointer boxes as itself, kind Ptr with what it points to in elemty.
+// nptr levels of pointers to the non pointer type elemty, 2 for **T
+//
+//export cxrt_ptr2eface
+func ptr2eface(elemty voidptr, ptr voidptr, nptr int) *Eface {
+	var elem *Metatype = elemty
+	var newmty *Metatype
+	for i := 0; i < nptr; i++ {
+		newmty = memdup3(elem, sizeof(*elem))
+		newmty.Kind = Ptr
+		newmty.Size = sizeof(voidptr)
+		newmty.elemty = elem
+		elem = newmty
+	}
+
+	efc := Eface_new(newmty, memdup3(&ptr, sizeof(voidptr)))
+	return efc
+}
+
 func type2eface_map(mtype *Metatype, data voidptr) *Eface {
 	var mapobjpp **mirmap = data
 	var mapobj *mirmap = *mapobjpp
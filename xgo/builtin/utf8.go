@@ -0,0 +1,297 @@
+package builtin
+
+// utf8 encoding and unicode case mapping for the builtin string type,
+// []rune(s), string(runes), string(r) and range over string use these.
+
+const (
+	runeerror = 0xFFFD
+	runeself  = 0x80
+	runemax   = 0x10FFFF
+	utfmax    = 4
+)
+
+// decodes the rune at the start of p[:n], its byte length to *width.
+// invalid encoding gives runeerror of width 1, like go.
+func decoderune3(p byteptr, n int, width *int) rune {
+	if n <= 0 {
+		*width = 0
+		return runeerror
+	}
+	b0 := int(p[0])
+	if b0 < runeself {
+		*width = 1
+		return rune(b0)
+	}
+
+	need := 0
+	var r int
+	var min int
+	if b0&0xE0 == 0xC0 {
+		need, r, min = 1, b0&0x1F, 0x80
+	} else if b0&0xF0 == 0xE0 {
+		need, r, min = 2, b0&0x0F, 0x800
+	} else if b0&0xF8 == 0xF0 {
+		need, r, min = 3, b0&0x07, 0x10000
+	} else {
+		*width = 1
+		return runeerror
+	}
+	if need >= n {
+		*width = 1
+		return runeerror
+	}
+	for i := 1; i <= need; i++ {
+		bx := int(p[i])
+		if bx&0xC0 != 0x80 {
+			*width = 1
+			return runeerror
+		}
+		r = r<<6 | bx&0x3F
+	}
+	if r < min || r > runemax || (r >= 0xD800 && r <= 0xDFFF) {
+		*width = 1
+		return runeerror
+	}
+	*width = need + 1
+	return rune(r)
+}
+
+// bytes needed to encode r, invalid ones are encoded as runeerror
+func runelen3(r rune) int {
+	v := int(r)
+	if v < 0 {
+		return 3
+	} else if v < 0x80 {
+		return 1
+	} else if v < 0x800 {
+		return 2
+	} else if v >= 0xD800 && v <= 0xDFFF {
+		return 3
+	} else if v < 0x10000 {
+		return 3
+	} else if v <= runemax {
+		return 4
+	}
+	return 3
+}
+
+// writes r to p, which has room for utfmax bytes, gives the length
+func encoderune3(p byteptr, r rune) int {
+	v := int(r)
+	if v < 0 || v > runemax || (v >= 0xD800 && v <= 0xDFFF) {
+		v = runeerror
+	}
+	if v < 0x80 {
+		p[0] = byte(v)
+		return 1
+	} else if v < 0x800 {
+		p[0] = byte(0xC0 | v>>6)
+		p[1] = byte(0x80 | v&0x3F)
+		return 2
+	} else if v < 0x10000 {
+		p[0] = byte(0xE0 | v>>12)
+		p[1] = byte(0x80 | (v>>6)&0x3F)
+		p[2] = byte(0x80 | v&0x3F)
+		return 3
+	}
+	p[0] = byte(0xF0 | v>>18)
+	p[1] = byte(0x80 | (v>>12)&0x3F)
+	p[2] = byte(0x80 | (v>>6)&0x3F)
+	p[3] = byte(0x80 | v&0x3F)
+	return 4
+}
+
+// rune at byte index idx of s, its byte length to *width
+//
+//export cxstring3_decoderune
+func cxstring3_decoderune(s string, idx int, width *int) rune {
+	p := byteptr(voidptr(usize(s.ptr) + usize(idx)))
+	return decoderune3(p, s.len-idx, width)
+}
+
+// string(r)
+//
+//export cxstring3_new_rune
+func cxstring3_new_rune(ch rune) string {
+	var s string
+	s.ptr = malloc3(utfmax + 1)
+	s.len = encoderune3(s.ptr, ch)
+	return s
+}
+
+// string(runes)
+//
+//export cxstring3_from_runes
+func cxstring3_from_runes(runes []rune) string {
+	n := 0
+	for i := 0; i < runes.len; i++ {
+		n += runelen3(runes[i])
+	}
+	var s string
+	s.ptr = malloc3(n + 1)
+	pos := 0
+	for i := 0; i < runes.len; i++ {
+		p := byteptr(voidptr(usize(s.ptr) + usize(pos)))
+		pos += encoderune3(p, runes[i])
+	}
+	s.len = pos
+	return s
+}
+
+// []rune(s)
+//
+//export cxstring3_to_runes
+func cxstring3_to_runes(s string) []rune {
+	runes := []rune{}
+	width := 0
+	for idx := 0; idx < s.Len(); idx += width {
+		r := cxstring3_decoderune(s, idx, &width)
+		runes = append(runes, r)
+	}
+	return runes
+}
+
+func (s string) runecount() int {
+	cnt := 0
+	width := 0
+	for idx := 0; idx < s.Len(); idx += width {
+		cxstring3_decoderune(s, idx, &width)
+		cnt++
+	}
+	return cnt
+}
+
+func (s string) isutf8() bool {
+	width := 0
+	for idx := 0; idx < s.Len(); idx += width {
+		r := cxstring3_decoderune(s, idx, &width)
+		if r == runeerror && width == 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// case mapping, rows of lo, hi, delta to upper, delta to lower.
+// upperlower marks alternating upper/lower pairs starting at lo with an
+// upper one. a subset of go's unicode.CaseRanges: latin, greek, cyrillic,
+// armenian, georgian, cherokee, fullwidth latin and deseret.
+const upperlower = runemax + 1
+
+var caseranges = []int{
+	0x0041, 0x005A, 0, 32,
+	0x0061, 0x007A, -32, 0,
+	0x00B5, 0x00B5, 743, 0,
+	0x00C0, 0x00D6, 0, 32,
+	0x00D8, 0x00DE, 0, 32,
+	0x00E0, 0x00F6, -32, 0,
+	0x00F8, 0x00FE, -32, 0,
+	0x00FF, 0x00FF, 121, 0,
+	0x0100, 0x012F, upperlower, upperlower,
+	0x0130, 0x0130, 0, -199,
+	0x0131, 0x0131, -232, 0,
+	0x0132, 0x0137, upperlower, upperlower,
+	0x0139, 0x0148, upperlower, upperlower,
+	0x014A, 0x0177, upperlower, upperlower,
+	0x0178, 0x0178, 0, -121,
+	0x0179, 0x017E, upperlower, upperlower,
+	0x017F, 0x017F, -300, 0,
+	0x01CD, 0x01DC, upperlower, upperlower,
+	0x01DE, 0x01EF, upperlower, upperlower,
+	0x01F8, 0x021F, upperlower, upperlower,
+	0x0222, 0x0233, upperlower, upperlower,
+	0x0246, 0x024F, upperlower, upperlower,
+	0x0386, 0x0386, 0, 38,
+	0x0388, 0x038A, 0, 37,
+	0x038C, 0x038C, 0, 64,
+	0x038E, 0x038F, 0, 63,
+	0x0391, 0x03A1, 0, 32,
+	0x03A3, 0x03AB, 0, 32,
+	0x03AC, 0x03AC, -38, 0,
+	0x03AD, 0x03AF, -37, 0,
+	0x03B1, 0x03C1, -32, 0,
+	0x03C2, 0x03C2, -31, 0,
+	0x03C3, 0x03CB, -32, 0,
+	0x03CC, 0x03CC, -64, 0,
+	0x03CD, 0x03CE, -63, 0,
+	0x03D8, 0x03EF, upperlower, upperlower,
+	0x0400, 0x040F, 0, 80,
+	0x0410, 0x042F, 0, 32,
+	0x0430, 0x044F, -32, 0,
+	0x0450, 0x045F, -80, 0,
+	0x0460, 0x0481, upperlower, upperlower,
+	0x048A, 0x04BF, upperlower, upperlower,
+	0x04C0, 0x04C0, 0, 15,
+	0x04C1, 0x04CE, upperlower, upperlower,
+	0x04CF, 0x04CF, -15, 0,
+	0x04D0, 0x052F, upperlower, upperlower,
+	0x0531, 0x0556, 0, 48,
+	0x0561, 0x0586, -48, 0,
+	0x10A0, 0x10C5, 0, 7264,
+	0x13A0, 0x13EF, 0, 38864,
+	0x13F0, 0x13F5, 0, 8,
+	0x13F8, 0x13FD, -8, 0,
+	0x1E00, 0x1E95, upperlower, upperlower,
+	0x1EA0, 0x1EFF, upperlower, upperlower,
+	0x2D00, 0x2D25, -7264, 0,
+	0xAB70, 0xABBF, -38864, 0,
+	0xFF21, 0xFF3A, 0, 32,
+	0xFF41, 0xFF5A, -32, 0,
+	0x10400, 0x10427, 0, 40,
+	0x10428, 0x1044F, -40, 0,
+}
+
+// col 2 for upper, 3 for lower
+func runecase3(r rune, col int) rune {
+	v := int(r)
+	lo := 0
+	hi := caseranges.len / 4
+	for lo < hi {
+		mid := (lo + hi) / 2
+		rlo := caseranges[mid*4]
+		rhi := caseranges[mid*4+1]
+		if v < rlo {
+			hi = mid
+		} else if v > rhi {
+			lo = mid + 1
+		} else {
+			delta := caseranges[mid*4+col]
+			if delta == upperlower {
+				// even offsets from rlo are upper, odd ones lower
+				off := (v - rlo) &^ 1
+				if col == 3 {
+					off++
+				}
+				return rune(rlo + off)
+			}
+			return rune(v + delta)
+		}
+	}
+	return r
+}
+
+func (ch rune) toupper() rune { return runecase3(ch, 2) }
+func (ch rune) tolower() rune { return runecase3(ch, 3) }
+func (ch rune) totitle() rune { return runecase3(ch, 2) }
+func (ch rune) isupper() bool { return ch.tolower() != ch }
+func (ch rune) islower() bool { return ch.toupper() != ch }
+
+// not a control character nor an invalid encoding
+func (ch rune) isprintable() bool {
+	if ch < 0x20 || ch == 0x7F || (ch >= 0x80 && ch < 0xA0) {
+		return false
+	}
+	return ch != runeerror && ch <= runemax
+}
+
+// maps each rune to upper (2) or lower (3) case, title only maps the first
+func (s string) maprunes(col int, title bool) string {
+	runes := cxstring3_to_runes(s)
+	for i := 0; i < runes.len; i++ {
+		if title && i > 0 {
+			break
+		}
+		runes[i] = runecase3(runes[i], col)
+	}
+	return cxstring3_from_runes(runes)
+}
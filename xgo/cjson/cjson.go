@@ -1,7 +1,7 @@
 package cjson
 
 /*
-#cgo CFLAGS: -IPKGDIR/
+#cgo CFLAGS: -I${SRCDIR}/
 #cgo CFLAGS: -I/home/me/oss/src/cxrt/xgo/cjson/
 
 #include "/home/me/oss/src/cxrt/xgo/cjson/cJSON.h"
@@ -1,6 +1,8 @@
 package curl
 
 /*
+#cgo LDFLAGS: -lcurl
+
 #include <curl/curl.h>
 #include <curl/easy.h>
 // #include <cxrtbase.h>
@@ -0,0 +1,59 @@
+package fmt
+
+// what Errorf returns with no or one %w
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (e *wrapError) Error() string {
+	return e.msg
+}
+
+// the %w error, nil if none
+func (e *wrapError) Unwrap() error {
+	return e.err
+}
+
+// what Errorf returns with more than one %w
+type wrapErrors struct {
+	msg  string
+	errs []error
+}
+
+func (e *wrapErrors) Error() string {
+	return e.msg
+}
+
+func (e *wrapErrors) Unwrap() []error {
+	return e.errs
+}
+
+// an error of the formatted message, like Sprintf. %w prints an error
+// arg like %v and the result wraps it, see xerrors.Unwrap/Is/As
+func Errorf(format string, args ...interface{}) error {
+	p := newprinter(args)
+	p.wrapok = true
+	p.doprintf(format)
+
+	var err error
+	if p.wraps.len <= 1 {
+		w := &wrapError{}
+		w.msg = p.buf
+		if p.wraps.len == 1 {
+			idx := p.wraps[0]
+			w.err = argerror(args[idx])
+		}
+		err = w
+		return err
+	}
+	w := &wrapErrors{}
+	w.msg = p.buf
+	w.errs = []error{}
+	for _, idx := range p.wraps {
+		e := argerror(args[idx])
+		w.errs = append(w.errs, e)
+	}
+	err = w
+	return err
+}
@@ -1,24 +1,590 @@
 package fmt
 
+/*
+#include <math.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+static int fmt_int(char* buf, int n, char* spec, long long v) {
+    int rv = snprintf(buf, n, spec, v);
+    return rv < n ? rv : n - 1;
+}
+
+static int fmt_uint(char* buf, int n, char* spec, unsigned long long v) {
+    int rv = snprintf(buf, n, spec, v);
+    return rv < n ? rv : n - 1;
+}
+
+// NaN, +Inf and -Inf like go
+static int fmt_float(char* buf, int n, char* spec, double f) {
+    int rv;
+    if (isnan(f)) rv = snprintf(buf, n, "NaN");
+    else if (isinf(f)) rv = snprintf(buf, n, f > 0 ? "+Inf" : "-Inf");
+    else rv = snprintf(buf, n, spec, f);
+    return rv < n ? rv : n - 1;
+}
+
+// the fewest %e digits after the point that read back as f,
+// of bits 32 or 64
+static int fmt_shortest(double f, int bits) {
+    char tmp[40];
+    for (int d = 0; d < 16; d++) {
+        snprintf(tmp, sizeof(tmp), "%.*e", d, f);
+        if (bits == 32 ? strtof(tmp, 0) == (float)f : strtod(tmp, 0) == f) return d;
+    }
+    return 16;
+}
+
+// the exponent %.*e of f has
+static int fmt_exp10(double f, int prec) {
+    char tmp[40];
+    snprintf(tmp, sizeof(tmp), "%.*e", prec, f);
+    char* e = strchr(tmp, 'e');
+    return e == 0 ? 0 : atoi(e + 1);
+}
+*/
+import "C"
+
+// state of one Sprintf or Errorf
+type printer struct {
+	buf    string
+	args   []interface{}
+	argi   int
+	wrapok bool  // in Errorf
+	wraps  []int // args of the %w ones
+
+	// the verb at hand
+	minus bool
+	plus  bool
+	sharp bool
+	space bool
+	zero  bool
+	wid   int // -1 if none
+	prec  int // -1 if none
+	verb  byte
+}
+
+func newprinter(args []interface{}) *printer {
+	p := &printer{}
+	p.args = args
+	p.wraps = []int{}
+	return p
+}
+
+// format with printf verbs over the args:
+//
+//	%v the value in a default format, %T its type
+//	%t bool, %d %b %o %x %X %c %q %U integers
+//	%e %E %f %g %G floats, %s %q %x %X strings
+//	%p pointers, %% a percent sign
+//
+// flags + - # 0 space, width and precision, * takes them from an int
+// arg. errors and other interfaces print what their Error or String
+// methods return. a wrong verb or missing arg prints like
+// %!d(string=hi) or %!d(MISSING)
 func Sprintf(format string, args ...interface{}) string {
-	slen := len(format)
-	prepercnt := false
-	for i := 0; i < slen; i++ {
-		ch := format[i]
-		if prepercnt {
-			if ch == 'd' {
-				println("int", args[i])
-			} else if ch == 's' {
-				println("str", args[i])
-			} else if ch == 'f' {
-
-			} else if ch == 'p' {
+	p := newprinter(args)
+	p.doprintf(format)
+	return p.buf
+}
+
+func Printf(format string, args ...interface{}) (int, error) {
+	s := Sprintf(format, args...)
+	C.printf("%.*s".ptr, s.len, s.ptr)
+	return s.len, nil
+}
 
+func (p *printer) doprintf(format string) {
+	end := format.len
+	for i := 0; i < end; i++ {
+		if format[i] != '%' {
+			j := i
+			for j < end && format[j] != '%' {
+				j++
+			}
+			p.buf += format[i:j]
+			i = j - 1
+			continue
+		}
+		p.minus = false
+		p.plus = false
+		p.sharp = false
+		p.space = false
+		p.zero = false
+		i++
+		for ; i < end; i++ {
+			c := format[i]
+			if c == '-' {
+				p.minus = true
+			} else if c == '+' {
+				p.plus = true
+			} else if c == '#' {
+				p.sharp = true
+			} else if c == ' ' {
+				p.space = true
+			} else if c == '0' {
+				p.zero = true
 			} else {
+				break
+			}
+		}
+		wid, ni := p.getnum(format, i)
+		p.wid = wid
+		i = ni
+		if p.wid < -1 {
+			p.minus = true
+			p.wid = -p.wid
+		}
+		p.prec = -1
+		if i < end && format[i] == '.' {
+			prec, ni := p.getnum(format, i+1)
+			p.prec = prec
+			i = ni
+			if p.prec < 0 {
+				p.prec = 0
+			}
+		}
+		if i >= end {
+			p.buf += "%!(NOVERB)"
+			break
+		}
+		p.verb = format[i]
+		if p.verb == '%' {
+			p.buf += "%"
+			continue
+		}
+		if p.argi >= p.args.len {
+			p.buf += "%!" + verbstr(p.verb) + "(MISSING)"
+			continue
+		}
+		if p.verb == 'w' && p.wrapok && iserror(p.args[p.argi]) {
+			argi := p.argi
+			p.wraps = append(p.wraps, argi)
+			p.verb = 'v'
+		}
+		p.printarg(p.args[p.argi])
+		p.argi++
+	}
+	if p.argi < p.args.len {
+		p.buf += "%!(EXTRA "
+		for j := p.argi; j < p.args.len; j++ {
+			if j > p.argi {
+				p.buf += ", "
+			}
+			p.verb = 'v'
+			p.wid = -1
+			p.prec = -1
+			p.buf += typename(p.args[j]) + "="
+			p.printarg(p.args[j])
+		}
+		p.buf += ")"
+	}
+}
+
+// decimal digits at i, or * for the next int arg. -1 if neither
+func (p *printer) getnum(format string, i int) (int, int) {
+	if i < format.len && format[i] == '*' {
+		if p.argi >= p.args.len {
+			p.buf += "%!(BADWIDTH)"
+			return -1, i + 1
+		}
+		v, ok := efcint(p.args[p.argi])
+		p.argi++
+		if !ok {
+			p.buf += "%!(BADWIDTH)"
+			return -1, i + 1
+		}
+		n := int(v)
+		return n, i + 1
+	}
+	n := -1
+	for ; i < format.len && format[i] >= '0' && format[i] <= '9'; i++ {
+		if n < 0 {
+			n = 0
+		}
+		n = n*10 + int(format[i]-'0')
+	}
+	return n, i
+}
+
+func verbstr(verb byte) string {
+	bs := make([]byte, 1)
+	bs[0] = verb
+	return string(bs)
+}
+
+// the C name of the type of arg, like int, main__foo or *main__foo
+func typename(arg interface{}) string {
+	var efc *Eface = arg
+	if efc == nil {
+		return "<nil>"
+	}
+	if efc.Kind() == Ptr {
+		return "*" + efc.Name()
+	}
+	return efc.Name()
+}
+
+// arg holds an error or another interface
+func iserror(arg interface{}) bool {
+	var efc *Eface = arg
+	return efc != nil && efc.Kind() == Interface
+}
 
+// the error arg holds, see iserror
+func argerror(arg interface{}) error {
+	var efc *Eface = arg
+	var errp *error = efc.Data
+	return *errp
+}
+
+// the int kinds of arg as int64, false if it is none
+func efcint(arg interface{}) (int64, bool) {
+	var efc *Eface = arg
+	if efc == nil {
+		return 0, false
+	}
+	kind := efc.Kind()
+	if kind != Int && kind != Int8 && kind != Int16 && kind != Int32 && kind != Int64 {
+		return 0, false
+	}
+	p := voidptr(efc.Data)
+	size := efc.Size() // int is a C int
+	switch size {
+	case 1:
+		return int64(*(*int8)(p)), true
+	case 2:
+		return int64(*(*int16)(p)), true
+	case 4:
+		return int64(*(*int32)(p)), true
+	}
+	return *(*int64)(p), true
+}
+
+// the uint kinds of arg as uint64, false if it is none
+func efcuint(arg interface{}) (uint64, bool) {
+	var efc *Eface = arg
+	if efc == nil {
+		return 0, false
+	}
+	kind := efc.Kind()
+	if kind != Uint && kind != Uint8 && kind != Uint16 && kind != Uint32 &&
+		kind != Uint64 && kind != Uintptr {
+		return 0, false
+	}
+	p := voidptr(efc.Data)
+	size := efc.Size()
+	switch size {
+	case 1:
+		return uint64(*(*uint8)(p)), true
+	case 2:
+		return uint64(*(*uint16)(p)), true
+	case 4:
+		return uint64(*(*uint32)(p)), true
+	}
+	return *(*uint64)(p), true
+}
+
+func (p *printer) printarg(arg interface{}) {
+	var efc *Eface = arg
+	if efc == nil {
+		if p.verb == 'v' {
+			p.pad("<nil>")
+		} else {
+			p.buf += "%!" + verbstr(p.verb) + "(<nil>)"
+		}
+		return
+	}
+	if p.verb == 'T' {
+		p.pad(typename(arg))
+		return
+	}
+	data := voidptr(efc.Data)
+	kind := efc.Kind()
+	iv, isint := efcint(arg)
+	uv, isuint := efcuint(arg)
+	if kind == Bool {
+		if p.verb != 'v' && p.verb != 't' {
+			p.badverb(arg)
+			return
+		}
+		if *(*bool)(data) {
+			p.pad("true")
+		} else {
+			p.pad("false")
+		}
+	} else if isint {
+		p.fmtint(iv, 0, true, arg)
+	} else if isuint {
+		p.fmtint(0, uv, false, arg)
+	} else if kind == Float32 {
+		f := float64(*(*float32)(data))
+		p.fmtfloat(f, 32, arg)
+	} else if kind == Float64 {
+		p.fmtfloat(*(*float64)(data), 64, arg)
+	} else if kind == String {
+		p.fmtstr(*(*string)(data), arg)
+	} else if kind == Interface {
+		box := *(*voidptr)(data)
+		if box == nil {
+			p.pad("<nil>")
+			return
+		}
+		s, ok := iface_string(box)
+		if !ok {
+			p.pad("<" + efc.Name() + ">")
+			return
+		}
+		p.fmtstr(s, arg)
+	} else if kind == Ptr || kind == Voidptr || kind == Byteptr ||
+		kind == Charptr || kind == UnsafePointer {
+		ptr := *(*voidptr)(data)
+		if p.verb == 'v' || p.verb == 'p' {
+			p.sharp = !p.sharp // 0x, but not for %#p
+			p.verb = 'x'
+		}
+		if p.verb != 'x' && p.verb != 'X' && p.verb != 'd' {
+			p.badverb(arg)
+			return
+		}
+		p.fmtint(0, uint64(usize(ptr)), false, arg)
+	} else {
+		p.buf += "%!" + verbstr(p.verb) + "(" + typename(arg) + ")"
+	}
+}
+
+// %!d(string=hi)
+func (p *printer) badverb(arg interface{}) {
+	p.buf += "%!" + verbstr(p.verb) + "(" + typename(arg) + "="
+	p.verb = 'v'
+	p.minus = false
+	p.plus = false
+	p.sharp = false
+	p.space = false
+	p.zero = false
+	p.wid = -1
+	p.prec = -1
+	p.printarg(arg)
+	p.buf += ")"
+}
+
+// s padded with spaces, or zeros for the 0 flag, to the width
+func (p *printer) pad(s string) {
+	if p.wid <= s.len {
+		p.buf += s
+		return
+	}
+	padch := " "
+	if p.zero && !p.minus {
+		padch = "0"
+	}
+	padding := padch.repeat(p.wid - s.len)
+	if p.minus {
+		p.buf += s + padding
+	} else {
+		p.buf += padding + s
+	}
+}
+
+// the printf spec of the flags, width and precision at hand, with conv
+func (p *printer) cspec(conv string) string {
+	spec := "%"
+	if p.minus {
+		spec += "-"
+	}
+	if p.plus {
+		spec += "+"
+	}
+	if p.sharp {
+		spec += "#"
+	}
+	if p.space {
+		spec += " "
+	}
+	if p.zero && !p.minus {
+		spec += "0"
+	}
+	if p.wid >= 0 {
+		spec += p.wid.repr()
+	}
+	if p.prec >= 0 {
+		spec += "." + p.prec.repr()
+	}
+	return spec + conv
+}
+
+// iv if signed, else uv
+func (p *printer) fmtint(iv int64, uv uint64, signed bool, arg interface{}) {
+	verb := p.verb
+	if verb == 'c' || verb == 'q' || verb == 'U' {
+		var r rune = rune(uv)
+		if signed {
+			r = rune(iv)
+		}
+		if verb == 'U' {
+			u := uint64(r)
+			spec := "U+%04llX"
+			p.pad(p.cuint(spec, u))
+			return
+		}
+		s := string(r)
+		if verb == 'q' {
+			s = quote(s, '\'')
+		}
+		p.pad(s)
+		return
+	}
+	if verb == 'b' {
+		p.pad(binstr(iv, uv, signed))
+		return
+	}
+	conv := ""
+	if verb == 'd' || verb == 'v' {
+		conv = "d"
+	} else if verb == 'o' || verb == 'x' || verb == 'X' {
+		conv = verbstr(verb)
+	} else {
+		p.badverb(arg)
+		return
+	}
+	if signed {
+		spec := p.cspec("ll" + conv)
+		buf := make([]byte, 80+p.wid+p.prec)
+		n := C.fmt_int(buf.ptr, buf.len, spec.cstr(), iv)
+		part := buf[:n]
+		p.buf += string(part)
+		return
+	}
+	if conv == "d" {
+		conv = "u"
+	}
+	p.buf += p.cuint(p.cspec("ll"+conv), uv)
+}
+
+func (p *printer) cuint(spec string, uv uint64) string {
+	buf := make([]byte, 80+p.wid+p.prec)
+	n := C.fmt_uint(buf.ptr, buf.len, spec.cstr(), uv)
+	part := buf[:n]
+	return string(part)
+}
+
+// 101 of 5, -101 of -5
+func binstr(iv int64, uv uint64, signed bool) string {
+	neg := signed && iv < 0
+	if signed {
+		uv = uint64(iv)
+		if neg {
+			uv = uint64(-iv)
+		}
+	}
+	s := ""
+	for uv >= 2 {
+		s = ifelse(uv%2 == 1, "1", "0") + s
+		uv = uv / 2
+	}
+	s = ifelse(uv == 1, "1", "0") + s
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// %v and %g without precision take the fewest digits that read back
+// as f, in %e for exponents < -4 or >= 6, in %f else. like go
+func (p *printer) fmtfloat(f float64, bits int, arg interface{}) {
+	verb := p.verb
+	if verb != 'v' && verb != 'e' && verb != 'E' && verb != 'f' && verb != 'F' &&
+		verb != 'g' && verb != 'G' {
+		p.badverb(arg)
+		return
+	}
+	conv := verbstr(verb)
+	if verb == 'F' {
+		conv = "f"
+	}
+	if verb == 'v' || (p.prec < 0 && (verb == 'g' || verb == 'G')) {
+		digs := C.fmt_shortest(f, bits)
+		exp := C.fmt_exp10(f, digs)
+		if exp < -4 || exp >= 6 {
+			p.prec = digs
+			conv = ifelse(verb == 'G', "E", "e")
+		} else {
+			p.prec = digs - exp
+			if p.prec < 0 {
+				p.prec = 0
 			}
+			conv = "f"
+		}
+	}
+	spec := p.cspec(conv)
+	buf := make([]byte, 360+p.wid+p.prec)
+	n := C.fmt_float(buf.ptr, buf.len, spec.cstr(), f)
+	part := buf[:n]
+	p.buf += string(part)
+}
+
+func (p *printer) fmtstr(s string, arg interface{}) {
+	verb := p.verb
+	if p.prec >= 0 && p.prec < s.len {
+		s = s[:p.prec]
+	}
+	if verb == 'v' || verb == 's' {
+		p.pad(s)
+	} else if verb == 'q' {
+		p.pad(quote(s, '"'))
+	} else if verb == 'x' || verb == 'X' {
+		digits := "0123456789abcdef"
+		if verb == 'X' {
+			digits = "0123456789ABCDEF"
+		}
+		bs := make([]byte, s.len*2)
+		for i := 0; i < s.len; i++ {
+			bs[2*i] = digits[int(s[i]>>4)]
+			bs[2*i+1] = digits[int(s[i]&0xf)]
+		}
+		p.pad(string(bs))
+	} else {
+		p.badverb(arg)
+	}
+}
+
+// s in q quotes, with go escapes for q, \ and control bytes
+func quote(s string, q byte) string {
+	digits := "0123456789abcdef"
+	bs := make([]byte, s.len*4+2)
+	pos := 0
+	bs[pos] = q
+	pos++
+	for i := 0; i < s.len; i++ {
+		c := s[i]
+		var esc byte
+		if c == q || c == '\\' {
+			esc = c
+		} else if c == '\n' {
+			esc = 'n'
+		} else if c == '\r' {
+			esc = 'r'
+		} else if c == '\t' {
+			esc = 't'
+		}
+		if esc != 0 {
+			bs[pos] = '\\'
+			bs[pos+1] = esc
+			pos += 2
+		} else if c < 0x20 || c == 0x7f {
+			bs[pos] = '\\'
+			bs[pos+1] = 'x'
+			bs[pos+2] = digits[int(c>>4)]
+			bs[pos+3] = digits[int(c&0xf)]
+			pos += 4
+		} else {
+			bs[pos] = c
+			pos++
 		}
-		prepercnt = ch == '%'
 	}
-	return "aaa"
+	bs[pos] = q
+	pos++
+	part := bs[:pos]
+	return string(part)
 }
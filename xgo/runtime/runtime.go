@@ -3,6 +3,9 @@ package runtime
 // memory, thread, libc
 
 /*
+#cgo CFLAGS: -DGC_THREADS
+#cgo LDFLAGS: -lgc -lpthread
+
 #include <stdlib.h>
 #include <stdio.h>
 #include <pthread.h>
@@ -0,0 +1,27 @@
+package unicode
+
+// go's unicode case and class functions over the builtin rune tables,
+// which cover latin, greek, cyrillic, armenian, georgian, cherokee,
+// fullwidth latin and deseret. other scripts, cjk included, have no case.
+
+const (
+	MaxRune         = 0x10FFFF
+	ReplacementChar = 0xFFFD
+	MaxASCII        = 0x7F
+	MaxLatin1       = 0xFF
+)
+
+func ToUpper(r rune) rune { return r.toupper() }
+func ToLower(r rune) rune { return r.tolower() }
+func ToTitle(r rune) rune { return r.totitle() }
+func IsUpper(r rune) bool { return r.isupper() }
+func IsLower(r rune) bool { return r.islower() }
+func IsSpace(r rune) bool { return r.isspace() }
+func IsPrint(r rune) bool { return r.isprintable() }
+func IsDigit(r rune) bool { return r >= '0' && r <= '9' }
+
+// cjk unified ideographs, extension a and compatibility ideographs
+func IsHan(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) || (r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0xF900 && r <= 0xFAFF) || (r >= 0x20000 && r <= 0x2FA1F)
+}
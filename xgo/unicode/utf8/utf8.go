@@ -0,0 +1,92 @@
+package utf8
+
+// go's unicode/utf8 over the builtin rune decoder
+
+const (
+	RuneError = 0xFFFD
+	RuneSelf  = 0x80
+	MaxRune   = 0x10FFFF
+	UTFMax    = 4
+)
+
+func ValidRune(r rune) bool {
+	if r < 0 || r > MaxRune {
+		return false
+	}
+	return r < 0xD800 || r > 0xDFFF
+}
+
+// -1 if r is not a valid rune
+func RuneLen(r rune) int {
+	if !ValidRune(r) {
+		return -1
+	}
+	return runelen3(r)
+}
+
+func RuneStart(b byte) bool { return b&0xC0 != 0x80 }
+
+// writes r to p, which must be large enough, gives the bytes written
+func EncodeRune(p []byte, r rune) int {
+	buf := [UTFMax]byte{}
+	n := encoderune3(&buf[0], r)
+	for i := 0; i < n; i++ {
+		p[i] = buf[i]
+	}
+	return n
+}
+
+func AppendRune(p []byte, r rune) []byte {
+	buf := [UTFMax]byte{}
+	n := encoderune3(&buf[0], r)
+	for i := 0; i < n; i++ {
+		p = append(p, buf[i])
+	}
+	return p
+}
+
+func DecodeRune(p []byte) (rune, int) {
+	width := 0
+	if p.len == 0 {
+		return RuneError, 0
+	}
+	r := decoderune3(byteptr(p.ptr), p.len, &width)
+	return r, width
+}
+
+func DecodeRuneInString(s string) (rune, int) {
+	width := 0
+	r := cxstring3_decoderune(s, 0, &width)
+	return r, width
+}
+
+// last rune of s and its width
+func DecodeLastRuneInString(s string) (rune, int) {
+	if s.len == 0 {
+		return RuneError, 0
+	}
+	start := s.len - 1
+	for lim := s.len - UTFMax; start > 0 && start > lim; start-- {
+		if RuneStart(s[start]) {
+			break
+		}
+	}
+	width := 0
+	r := cxstring3_decoderune(s, start, &width)
+	if start+width != s.len {
+		return RuneError, 1
+	}
+	return r, width
+}
+
+func RuneCount(p []byte) int {
+	return RuneCountInString(gostringn(byteptr(p.ptr), p.len))
+}
+
+func RuneCountInString(s string) int { return s.runecount() }
+
+func Valid(p []byte) bool {
+	return ValidString(gostringn(byteptr(p.ptr), p.len))
+}
+
+func ValidString(s string) bool { return s.isutf8() }
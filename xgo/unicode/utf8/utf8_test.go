@@ -0,0 +1,18 @@
+package utf8
+
+func test_decode1() {
+	s := "a中文é"
+	println(len(s), RuneCountInString(s), ValidString(s))
+	r, n := DecodeRuneInString(s[1:])
+	println(r, n)
+	r, n = DecodeLastRuneInString(s)
+	println(r, n)
+	println(ValidString(s[:2]))
+}
+
+func test_encode1() {
+	p := []byte{}
+	p = AppendRune(p, 0x4E2D)
+	p = AppendRune(p, 'x')
+	println(p.len, RuneLen(0x4E2D), RuneLen(0x1F600))
+}
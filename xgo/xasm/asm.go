@@ -52,8 +52,50 @@ type VM interface {
 	pop()
 }
 
-func outasm(code string, outs ...interface{}, ins ...interface{}, clobs ...string) {
-	// => __asm__(code :"=r"(out0) : "r"(in0) : "clob0")
+// cpu time stamp counter
+func Rdtsc() uint64 {
+	var lo uint32
+	var hi uint32
+	asm("rdtsc", asmout("=a", lo), asmout("=d", hi))
+	return uint64(hi)<<32 | uint64(lo)
+}
+
+// waits for prior instructions, then reads the counter and cpu id
+func Rdtscp() (uint64, uint32) {
+	var lo uint32
+	var hi uint32
+	var aux uint32
+	asm("rdtscp", asmout("=a", lo), asmout("=d", hi), asmout("=c", aux))
+	return uint64(hi)<<32 | uint64(lo), aux
+}
+
+// spin wait hint
+func Pause() {
+	asm("pause", asmclob("memory"))
+}
+
+// atomically *p += delta, gives the old value
+func Xadd64(p *int64, delta int64) int64 {
+	asm("lock; xaddq %0, %1", asmout("+r", delta), asmout("+m", *p), asmclob("memory", "cc"))
+	return delta
+}
+
+// 16 byte aligned pair for Cas128
+type Uint128 struct {
+	Lo uint64
+	Hi uint64
+}
+
+// double width compare and swap with cmpxchg16b, which c11 atomics
+// only give through libatomic locks. p must be 16 byte aligned.
+func Cas128(p *Uint128, old Uint128, new Uint128) bool {
+	var ok uint8
+	lo := old.Lo
+	hi := old.Hi
+	asm("lock; cmpxchg16b %1; setz %0",
+		asmout("=q", ok), asmout("+m", *p), asmout("+a", lo), asmout("+d", hi),
+		asmin("b", new.Lo), asmin("c", new.Hi), asmclob("memory", "cc"))
+	return ok != 0
 }
 
 func keep() {}
@@ -0,0 +1,24 @@
+package xasm
+
+func test_rdtsc1() {
+	t0 := Rdtsc()
+	Pause()
+	t1 := Rdtsc()
+	println(t1 > t0)
+}
+
+func test_atomic1() {
+	var v int64 = 5
+	println(Xadd64(&v, 3), v)
+
+	p := &Uint128{1, 2}
+	println(Cas128(p, Uint128{1, 2}, Uint128{3, 4}), p.Lo, p.Hi)
+	println(Cas128(p, Uint128{1, 2}, Uint128{5, 6}), p.Lo, p.Hi)
+}
+
+// an int operand is a C int, 32 bit registers
+func test_asmint1() {
+	a := 40
+	asm("addl $2, %0", asmout("+r", a))
+	println(a) // 42
+}
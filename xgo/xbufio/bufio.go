@@ -0,0 +1,522 @@
+package xbufio
+
+import (
+	"xgo/xerrors"
+	"xgo/xio"
+)
+
+// Buffered Reader and Writer over xio, and a Scanner splitting input into
+// lines or words, like go's bufio.
+
+const defaultbufsz = 4096
+
+var ErrBufferFull = xerrors.New("bufio: buffer full")
+var ErrInvalidUnreadByte = xerrors.New("bufio: invalid use of UnreadByte")
+var ErrTooLong = xerrors.New("bufio.Scanner: token too long")
+var ErrNegativeAdvance = xerrors.New("bufio.Scanner: SplitFunc returns negative advance count")
+var ErrAdvanceTooFar = xerrors.New("bufio.Scanner: SplitFunc returns advance count beyond input")
+
+// one Read of rd into buf at off. slices are copies, so only a Read at 0
+// can go straight into buf
+func readat(rd xio.Reader, buf []byte, off int) (int, error) {
+	if off == 0 {
+		return rd.Read(buf)
+	}
+	part := make([]byte, buf.len-off)
+	n, err := rd.Read(part)
+	if n > 0 {
+		memcpy3(voidptr(usize(buf.ptr)+usize(off)), part.ptr, n)
+	}
+	return n, err
+}
+
+// index of c in buf[start:end], -1 if not there
+func indexbyte(buf []byte, start int, end int, c byte) int {
+	for i := start; i < end; i++ {
+		if buf[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+type Reader struct {
+	rd       xio.Reader
+	buf      []byte
+	r        int   // next unread byte
+	w        int   // end of the read ones
+	err      error // from rd, given out once buf is drained
+	lastbyte int   // for UnreadByte, -1 if none
+}
+
+func NewReaderSize(rd xio.Reader, size int) *Reader {
+	if size < 16 {
+		size = 16
+	}
+	b := &Reader{}
+	b.rd = rd
+	b.buf = make([]byte, size)
+	b.lastbyte = -1
+	return b
+}
+
+func NewReader(rd xio.Reader) *Reader {
+	return NewReaderSize(rd, defaultbufsz)
+}
+
+// bytes read but not consumed yet
+func (b *Reader) Buffered() int { return b.w - b.r }
+
+func (b *Reader) readerr() error {
+	err := b.err
+	b.err = nil
+	return err
+}
+
+// one Read that gives something, unread bytes move to the front first
+func (b *Reader) fill() {
+	if b.r == b.w {
+		b.r = 0
+		b.w = 0
+	} else if b.r > 0 {
+		memmove3(b.buf.ptr, voidptr(usize(b.buf.ptr)+usize(b.r)), b.w-b.r)
+		b.w -= b.r
+		b.r = 0
+	}
+	for i := 0; i < 100; i++ {
+		n, err := readat(b.rd, b.buf, b.w)
+		if n > 0 {
+			b.w += n
+		}
+		if err != nil {
+			b.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	b.err = xio.ErrNoProgress
+}
+
+// at most one Read of the underlying reader, reads bigger than
+// the buffer go straight into p
+func (b *Reader) Read(p []byte) (int, error) {
+	if p.len == 0 {
+		if b.Buffered() > 0 {
+			return 0, nil
+		}
+		return 0, b.readerr()
+	}
+	if b.r == b.w {
+		if b.err != nil {
+			return 0, b.readerr()
+		}
+		if p.len >= b.buf.len {
+			n, err := b.rd.Read(p)
+			if n > 0 {
+				b.lastbyte = int(p[n-1])
+			}
+			return n, err
+		}
+		b.r = 0
+		b.w = 0
+		n, err := b.rd.Read(b.buf)
+		if n <= 0 {
+			return 0, err
+		}
+		b.w = n
+		b.err = err
+	}
+	n := b.w - b.r
+	if n > p.len {
+		n = p.len
+	}
+	memcpy3(p.ptr, voidptr(usize(b.buf.ptr)+usize(b.r)), n)
+	b.r += n
+	b.lastbyte = int(b.buf[b.r-1])
+	return n, nil
+}
+
+func (b *Reader) ReadByte() (byte, error) {
+	for b.r == b.w {
+		if b.err != nil {
+			return 0, b.readerr()
+		}
+		b.fill()
+	}
+	c := b.buf[b.r]
+	b.r++
+	b.lastbyte = int(c)
+	return c, nil
+}
+
+// only right after a read
+func (b *Reader) UnreadByte() error {
+	if b.lastbyte < 0 || (b.r == 0 && b.w > 0) {
+		return ErrInvalidUnreadByte
+	}
+	if b.r > 0 {
+		b.r--
+	} else {
+		b.w = 1
+	}
+	b.buf[b.r] = byte(b.lastbyte)
+	b.lastbyte = -1
+	return nil
+}
+
+// the next n bytes without consuming them, fewer with an error.
+// ErrBufferFull if n is more than the buffer
+func (b *Reader) Peek(n int) ([]byte, error) {
+	b.lastbyte = -1
+	for b.w-b.r < n && b.w-b.r < b.buf.len && b.err == nil {
+		b.fill()
+	}
+	if n > b.buf.len {
+		return b.buf[b.r:b.w], ErrBufferFull
+	}
+	var err error
+	avail := b.w - b.r
+	if avail < n {
+		n = avail
+		err = b.readerr()
+		if err == nil {
+			err = ErrBufferFull
+		}
+	}
+	return b.buf[b.r : b.r+n], err
+}
+
+// up to and with delim. an error only if delim is not there,
+// with what was read before it, like EOF at the end
+func (b *Reader) ReadBytes(delim byte) ([]byte, error) {
+	res := make([]byte, 0)
+	for {
+		i := indexbyte(b.buf, b.r, b.w, delim)
+		if i >= 0 {
+			part := b.buf[b.r : i+1]
+			res = append(res, part...)
+			b.r = i + 1
+			break
+		}
+		if b.r < b.w {
+			part := b.buf[b.r:b.w]
+			res = append(res, part...)
+			b.r = b.w
+		}
+		if b.err != nil {
+			return res, b.readerr()
+		}
+		b.fill()
+	}
+	if res.len > 0 {
+		b.lastbyte = int(res[res.len-1])
+	}
+	return res, nil
+}
+
+func (b *Reader) ReadString(delim byte) (string, error) {
+	line, err := b.ReadBytes(delim)
+	return string(line), err
+}
+
+type Writer struct {
+	wr  xio.Writer
+	buf []byte
+	n   int
+	err error // sticky, later writes fail with it
+}
+
+func NewWriterSize(wr xio.Writer, size int) *Writer {
+	if size <= 0 {
+		size = defaultbufsz
+	}
+	b := &Writer{}
+	b.wr = wr
+	b.buf = make([]byte, size)
+	return b
+}
+
+func NewWriter(wr xio.Writer) *Writer {
+	return NewWriterSize(wr, defaultbufsz)
+}
+
+func (b *Writer) Buffered() int  { return b.n }
+func (b *Writer) Available() int { return b.buf.len - b.n }
+
+// writes out the buffer, what was not taken stays for the next Flush
+func (b *Writer) Flush() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.n == 0 {
+		return nil
+	}
+	part := b.buf[:b.n]
+	n, err := b.wr.Write(part)
+	if n < b.n && err == nil {
+		err = xio.ErrShortWrite
+	}
+	if err != nil {
+		if n > 0 && n < b.n {
+			memmove3(b.buf.ptr, voidptr(usize(b.buf.ptr)+usize(n)), b.n-n)
+		}
+		if n > 0 {
+			b.n -= n
+		}
+		b.err = err
+		return err
+	}
+	b.n = 0
+	return nil
+}
+
+// n < len(p) comes with an error
+func (b *Writer) Write(p []byte) (int, error) {
+	nn := 0
+	for p.len-nn > b.Available() && b.err == nil {
+		if b.n == 0 {
+			// nothing buffered, big writes skip the buffer
+			part := p[nn:]
+			n, err := b.wr.Write(part)
+			nn += n
+			b.err = err
+			break
+		}
+		n := b.Available()
+		memcpy3(voidptr(usize(b.buf.ptr)+usize(b.n)), voidptr(usize(p.ptr)+usize(nn)), n)
+		b.n += n
+		nn += n
+		b.Flush()
+	}
+	if b.err != nil {
+		return nn, b.err
+	}
+	n := p.len - nn
+	memcpy3(voidptr(usize(b.buf.ptr)+usize(b.n)), voidptr(usize(p.ptr)+usize(nn)), n)
+	b.n += n
+	return p.len, nil
+}
+
+func (b *Writer) WriteByte(c byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.Available() <= 0 && b.Flush() != nil {
+		return b.err
+	}
+	b.buf[b.n] = c
+	b.n++
+	return nil
+}
+
+func (b *Writer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+// advance is how much of data to consume, tok the next token or nil
+// to read more first. atEOF says no more data will come
+type SplitFunc func(data []byte, atEOF bool) (int, []byte, error)
+
+const MaxScanTokenSize = 64 << 10
+
+// Scan tokens of a reader, lines by default
+type Scanner struct {
+	rd      xio.Reader
+	split   SplitFunc
+	maxtok  int
+	tok     []byte
+	buf     []byte
+	start   int // first unconsumed byte of buf
+	end     int
+	err     error // from rd or split, EOF at the end
+	done    bool
+	empties int // empty tokens in a row without advance
+}
+
+func NewScanner(rd xio.Reader) *Scanner {
+	s := &Scanner{}
+	s.rd = rd
+	s.split = ScanLines
+	s.maxtok = MaxScanTokenSize
+	s.buf = make([]byte, defaultbufsz)
+	s.tok = make([]byte, 0)
+	return s
+}
+
+// before the first Scan
+func (s *Scanner) Split(split SplitFunc) { s.split = split }
+
+// max is the longest token, size the first buffer
+func (s *Scanner) Buffer(size int, max int) {
+	if size > 0 {
+		s.buf = make([]byte, size)
+	}
+	s.maxtok = max
+}
+
+// the latest token, a copy
+func (s *Scanner) Bytes() []byte { return s.tok }
+func (s *Scanner) Text() string {
+	tok := s.tok
+	return string(tok)
+}
+
+// nil at EOF
+func (s *Scanner) Err() error {
+	if s.err == xio.EOF {
+		return nil
+	}
+	return s.err
+}
+
+func (s *Scanner) seterr(err error) {
+	if s.err == nil || s.err == xio.EOF {
+		s.err = err
+	}
+}
+
+// false at the end of input or on an error, see Err
+func (s *Scanner) Scan() bool {
+	if s.done {
+		return false
+	}
+	split := s.split
+	for {
+		if s.end > s.start || s.err != nil {
+			data := s.buf[s.start:s.end]
+			adv, tok, err := split(data, s.err != nil)
+			if err != nil {
+				s.seterr(err)
+				s.done = true
+				return false
+			}
+			if adv < 0 {
+				s.seterr(ErrNegativeAdvance)
+				s.done = true
+				return false
+			}
+			if adv > data.len {
+				s.seterr(ErrAdvanceTooFar)
+				s.done = true
+				return false
+			}
+			s.start += adv
+			if tok != nil {
+				s.tok = tok
+				if adv > 0 {
+					s.empties = 0
+				} else {
+					s.empties++
+					if s.empties > 100 {
+						panic("bufio.Scan: too many empty tokens without progressing")
+					}
+				}
+				return true
+			}
+		}
+		if s.err != nil {
+			s.done = true
+			return false
+		}
+
+		// room for more
+		if s.start == s.end {
+			s.start = 0
+			s.end = 0
+		} else if s.start > 0 {
+			memmove3(s.buf.ptr, voidptr(usize(s.buf.ptr)+usize(s.start)), s.end-s.start)
+			s.end -= s.start
+			s.start = 0
+		}
+		if s.end == s.buf.len {
+			if s.buf.len >= s.maxtok {
+				s.seterr(ErrTooLong)
+				s.done = true
+				return false
+			}
+			newsz := s.buf.len * 2
+			if newsz > s.maxtok {
+				newsz = s.maxtok
+			}
+			buf := make([]byte, newsz)
+			memcpy3(buf.ptr, s.buf.ptr, s.end)
+			s.buf = buf
+		}
+
+		for i := 0; ; i++ {
+			n, err := readat(s.rd, s.buf, s.end)
+			if n > 0 {
+				s.end += n
+			}
+			if err != nil {
+				s.seterr(err)
+				break
+			}
+			if n > 0 {
+				s.empties = 0
+				break
+			}
+			if i >= 100 {
+				s.seterr(xio.ErrNoProgress)
+				break
+			}
+		}
+	}
+}
+
+// lines without the \n and an optional \r before it.
+// the last one may have no \n
+func ScanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && data.len == 0 {
+		return 0, nil, nil
+	}
+	i := indexbyte(data, 0, data.len, '\n')
+	if i >= 0 {
+		end := i
+		if end > 0 && data[end-1] == '\r' {
+			end--
+		}
+		return i + 1, data[:end], nil
+	}
+	if atEOF {
+		end := data.len
+		if data[end-1] == '\r' {
+			end--
+		}
+		return data.len, data[:end], nil
+	}
+	return 0, nil, nil
+}
+
+func isspace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// space separated words, ascii spaces only
+func ScanWords(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < data.len && isspace(data[start]) {
+		start++
+	}
+	for i := start; i < data.len; i++ {
+		if isspace(data[i]) {
+			return i + 1, data[start:i], nil
+		}
+	}
+	if atEOF && data.len > start {
+		return data.len, data[start:], nil
+	}
+	return start, nil, nil
+}
+
+// each byte a token
+func ScanBytes(data []byte, atEOF bool) (int, []byte, error) {
+	if data.len == 0 {
+		return 0, nil, nil
+	}
+	return 1, data[:1], nil
+}
+
+func Keep() {}
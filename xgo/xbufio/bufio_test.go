@@ -0,0 +1,86 @@
+package xbufio
+
+import "xgo/xio"
+
+// a Reader over s, at most max bytes per Read
+type testreader struct {
+	data []byte
+	pos  int
+	max  int
+}
+
+func newtestreader(s string, max int) *testreader {
+	r := &testreader{}
+	r.data = []byte(s)
+	r.max = max
+	return r
+}
+
+func (r *testreader) Read(p []byte) (int, error) {
+	if r.pos >= r.data.len {
+		return 0, xio.EOF
+	}
+	n := r.data.len - r.pos
+	if n > p.len {
+		n = p.len
+	}
+	if n > r.max {
+		n = r.max
+	}
+	memcpy3(p.ptr, voidptr(usize(r.data.ptr)+usize(r.pos)), n)
+	r.pos += n
+	return n, nil
+}
+
+type testwriter struct {
+	data   []byte
+	writes int
+}
+
+func (w *testwriter) Write(p []byte) (int, error) {
+	w.data = append(w.data, p...)
+	w.writes++
+	return p.len, nil
+}
+
+func test_reader1() {
+	br := NewReaderSize(newtestreader("line one\nline two\nrest", 5), 16)
+	line, err := br.ReadString('\n')
+	println(line, err == nil) // line one\n
+	c, _ := br.ReadByte()
+	br.UnreadByte()
+	peek, _ := br.Peek(4)
+	println(c == 'l', string(peek)) // true line
+	line, err = br.ReadString('\n')
+	println(line, err == nil)
+	line, err = br.ReadString('\n')
+	println(line, err == xio.EOF) // rest true
+}
+
+func test_writer1() {
+	w := &testwriter{}
+	w.data = make([]byte, 0)
+	bw := NewWriterSize(w, 8)
+	bw.WriteString("abc")
+	bw.WriteByte('d')
+	println(bw.Buffered(), bw.Available(), w.writes) // 4 4 0
+	bw.WriteString("efghijkl")
+	bw.Flush()
+	println(string(w.data), w.writes) // abcdefghijkl 2
+}
+
+func test_scanner1() {
+	sc := NewScanner(newtestreader("one\r\ntwo\n\nthree", 2))
+	for sc.Scan() {
+		println("[" + sc.Text() + "]") // [one] [two] [] [three]
+	}
+	println(sc.Err() == nil)
+
+	sc = NewScanner(newtestreader("  many   words here ", 3))
+	sc.Split(ScanWords)
+	cnt := 0
+	for sc.Scan() {
+		cnt++
+	}
+	println(cnt) // 3
+}
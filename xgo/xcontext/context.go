@@ -0,0 +1,309 @@
+package xcontext
+
+/*
+#include <pthread.h>
+#include <stdbool.h>
+#include <time.h>
+
+extern void* crn_fiber_self(int* grid, int* mcid);
+extern int crn_fiber_bind();
+extern void crn_fiber_unbind();
+extern void crn_fiber_interrupt(void* gr, int grid, int mcid, int gen);
+
+// hooked, parks the fiber on a netpoller timer
+static int xcontext_sleep(long long usec) {
+    struct timespec ts = {usec / 1000000, (usec % 1000000) * 1000};
+    return nanosleep(&ts, 0);
+}
+*/
+import "C"
+import (
+	"xgo/xerrors"
+	"xgo/xtime"
+)
+
+// Cancellation, deadlines and request values, like go's context.
+// A Context is done once it is canceled, its deadline passes or its parent
+// is done, then Done() is closed and Err() tells why. Done() works in select.
+// Fibers waiting in hooked calls (read, write, accept, connect, poll,
+// sleep ...) are interrupted too after a Bind.
+
+var Canceled = xerrors.New("context canceled")
+var DeadlineExceeded = xerrors.New("context deadline exceeded")
+
+type CancelFunc func()
+
+type Context struct {
+	parent   *Context
+	done     chan int    // nil if this one cannot be canceled itself
+	deadline *xtime.Time // nil if none
+	key      string
+	val      voidptr
+	haskey   bool
+
+	mu       C.pthread_mutex_t
+	err      error
+	children []*Context
+	fibers   []*fiberref // Bind'ed, and the deadline timer
+}
+
+// a fiber to interrupt, while still bound with gen
+type fiberref struct {
+	gr   voidptr
+	grid int
+	mcid int
+	gen  int
+}
+
+var background *Context
+
+func init() {
+	background = &Context{}
+}
+
+// never done, no values, no deadline. the root of every tree
+func Background() *Context { return background }
+func TODO() *Context       { return background }
+
+func (ctx *Context) lock()   { C.pthread_mutex_lock(&ctx.mu) }
+func (ctx *Context) unlock() { C.pthread_mutex_unlock(&ctx.mu) }
+
+// the nearest one that can be canceled, nil up to Background
+func (ctx *Context) cancelctx() *Context {
+	for c := ctx; c != nil; c = c.parent {
+		if c.done != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// nil for Background, receiving from it blocks forever
+func (ctx *Context) Done() chan int {
+	c := ctx.cancelctx()
+	if c == nil {
+		return nil
+	}
+	return c.done
+}
+
+// nil until done, then Canceled or DeadlineExceeded
+func (ctx *Context) Err() error {
+	c := ctx.cancelctx()
+	if c == nil {
+		return nil
+	}
+	c.lock()
+	err := c.err
+	c.unlock()
+	return err
+}
+
+func (ctx *Context) Deadline() (*xtime.Time, bool) {
+	for c := ctx; c != nil; c = c.parent {
+		if c.deadline != nil {
+			return c.deadline, true
+		}
+	}
+	return nil, false
+}
+
+// nil if no one up the tree has key
+func (ctx *Context) Value(key string) voidptr {
+	for c := ctx; c != nil; c = c.parent {
+		if c.haskey && c.key == key {
+			return c.val
+		}
+	}
+	return nil
+}
+
+func newcancelctx(parent *Context) *Context {
+	c := &Context{}
+	c.parent = parent
+	c.done = make(chan int)
+	c.children = make([]*Context, 0)
+	c.fibers = make([]*fiberref, 0)
+
+	p := parent.cancelctx()
+	if p == nil {
+		return c
+	}
+	p.lock()
+	err := p.err
+	if err == nil {
+		p.children = append(p.children, c)
+	}
+	p.unlock()
+	if err != nil {
+		c.cancel(err, false)
+	}
+	return c
+}
+
+// first call wins, children go too
+func (ctx *Context) cancel(err error, unlink bool) {
+	ctx.lock()
+	if ctx.err != nil {
+		ctx.unlock()
+		return
+	}
+	ctx.err = err
+	children := ctx.children
+	fibers := ctx.fibers
+	ctx.children = make([]*Context, 0)
+	ctx.fibers = make([]*fiberref, 0)
+	ctx.unlock()
+
+	close(ctx.done)
+	for _, child := range children {
+		child.cancel(err, false)
+	}
+	for _, ref := range fibers {
+		ref.interrupt()
+	}
+	if unlink {
+		p := ctx.parent.cancelctx()
+		if p != nil {
+			p.removechild(ctx)
+		}
+	}
+}
+
+func (ctx *Context) removechild(child *Context) {
+	ctx.lock()
+	for i, c := range ctx.children {
+		if c == child {
+			ctx.children = append(ctx.children[:i], ctx.children[i+1:]...)
+			break
+		}
+	}
+	ctx.unlock()
+}
+
+// false if already done
+func (ctx *Context) addfiber(ref *fiberref) bool {
+	ctx.lock()
+	ok := ctx.err == nil
+	if ok {
+		ctx.fibers = append(ctx.fibers, ref)
+	}
+	ctx.unlock()
+	return ok
+}
+
+func (ctx *Context) removefiber(ref *fiberref) {
+	ctx.lock()
+	for i, r := range ctx.fibers {
+		if r == ref {
+			ctx.fibers = append(ctx.fibers[:i], ctx.fibers[i+1:]...)
+			break
+		}
+	}
+	ctx.unlock()
+}
+
+// the calling fiber bound for interrupts, nil outside fibers.
+// unbind it on the same fiber
+func bindself() *fiberref {
+	ref := &fiberref{}
+	ref.gr = C.crn_fiber_self(&ref.grid, &ref.mcid)
+	if ref.gr == nil {
+		return nil
+	}
+	ref.gen = C.crn_fiber_bind()
+	return ref
+}
+
+func (ref *fiberref) unbind() {
+	C.crn_fiber_unbind()
+}
+
+// a no-op once the fiber unbound, so a late cancel leaves nothing behind
+func (ref *fiberref) interrupt() {
+	C.crn_fiber_interrupt(ref.gr, ref.grid, ref.mcid, ref.gen)
+}
+
+// done when cancel is called or parent is done
+func WithCancel(parent *Context) (*Context, CancelFunc) {
+	c := newcancelctx(parent)
+	return c, func() { c.cancel(Canceled, true) }
+}
+
+// done at d too, the earlier deadline of parent wins
+func WithDeadline(parent *Context, d *xtime.Time) (*Context, CancelFunc) {
+	pd, ok := parent.Deadline()
+	if ok && !pd.After(d) {
+		return WithCancel(parent)
+	}
+	c := newcancelctx(parent)
+	c.deadline = d
+	if d.Sub(xtime.Now()) <= 0 {
+		c.cancel(DeadlineExceeded, true)
+	} else {
+		go timerproc(c)
+	}
+	return c, func() { c.cancel(Canceled, true) }
+}
+
+func WithTimeout(parent *Context, timeout xtime.Duration) (*Context, CancelFunc) {
+	return WithDeadline(parent, xtime.Now().Add(timeout))
+}
+
+// carries key and val, done with parent
+func WithValue(parent *Context, key string, val voidptr) *Context {
+	c := &Context{}
+	c.parent = parent
+	c.key = key
+	c.val = val
+	c.haskey = true
+	return c
+}
+
+// sleeps on the netpoller until the deadline, an earlier cancel
+// interrupts the sleep
+func timerproc(c *Context) {
+	ref := bindself()
+	if !c.addfiber(ref) {
+		ref.unbind()
+		return
+	}
+	for {
+		left := int64(c.deadline.Sub(xtime.Now()) / xtime.Microsecond)
+		if left <= 0 {
+			break
+		}
+		C.xcontext_sleep(left)
+		if c.Err() != nil {
+			ref.unbind()
+			return // canceled before
+		}
+	}
+	c.removefiber(ref)
+	ref.unbind()
+	c.cancel(DeadlineExceeded, true)
+}
+
+// until the returned func is called, the calling fiber's hooked blocking
+// calls fail with ECANCELED once ctx is done, at once if it already is.
+// chan waits are not interrupted, select on Done() for them. binds nest,
+// the inner one's func clears the interrupt, check Err() after it
+func (ctx *Context) Bind() func() {
+	c := ctx.cancelctx()
+	if c == nil {
+		return func() {}
+	}
+	ref := bindself()
+	if ref == nil {
+		return func() {}
+	}
+	if !c.addfiber(ref) {
+		ref.interrupt()
+	}
+	return func() {
+		c.removefiber(ref)
+		ref.unbind()
+	}
+}
+
+func Keep() {}
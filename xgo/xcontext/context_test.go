@@ -0,0 +1,69 @@
+package xcontext
+
+import (
+	"xgo/xos"
+	"xgo/xtime"
+)
+
+func test_cancel1() {
+	ctx, cancel := WithCancel(Background())
+	child, cancel2 := WithCancel(ctx)
+	vctx := WithValue(child, "k1", voidptr(ctx))
+	println(vctx.Value("k1") == voidptr(ctx), vctx.Value("k2") == nil)
+
+	go func() {
+		xtime.Sleepms(20)
+		cancel()
+	}()
+	select {
+	case <-vctx.Done():
+		println("done", vctx.Err() == Canceled)
+	}
+	println(child.Err() == Canceled, Background().Err() == nil)
+	cancel2() // no-op now
+}
+
+func test_timeout1() {
+	btime := xtime.Now()
+	ctx, cancel := WithTimeout(Background(), 50*xtime.Millisecond)
+	_, ok := ctx.Deadline()
+	<-ctx.Done()
+	println(ok, ctx.Err() == DeadlineExceeded, xtime.Since(btime) < xtime.Second)
+	cancel()
+
+	// parent deadline is earlier, the child goes with it
+	ctx, cancel = WithTimeout(Background(), 20*xtime.Millisecond)
+	child, cancel2 := WithTimeout(ctx, 10*xtime.Second)
+	<-child.Done()
+	println(child.Err() == DeadlineExceeded)
+	cancel2()
+	cancel()
+}
+
+// a read nothing will ever answer and a long sleep, both cut short
+func test_bind1() {
+	r, w, _ := xos.Pipe()
+	ctx, cancel := WithTimeout(Background(), 50*xtime.Millisecond)
+	unbind := ctx.Bind()
+	btime := xtime.Now()
+	buf := make([]byte, 16)
+	_, err := r.Read(buf)
+	println(err != nil, xtime.Since(btime) < xtime.Second)
+	xtime.Sleep(10 * xtime.Second) // ctx already done, returns at once
+	println(xtime.Since(btime) < xtime.Second)
+	unbind()
+	cancel()
+	r.Close()
+	w.Close()
+}
+
+// a cancel after unbind leaves the fiber alone
+func test_bind2() {
+	ctx, cancel := WithCancel(Background())
+	unbind := ctx.Bind()
+	unbind()
+	cancel()
+	btime := xtime.Now()
+	xtime.Sleepms(30)
+	println(xtime.Since(btime) >= 30*xtime.Millisecond) // true
+}
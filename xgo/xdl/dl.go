@@ -17,8 +17,14 @@ const (
 	RTLD_LOCAL  = C.RTLD_LOCAL
 )
 
+// nil on failure, see Error
+func Open(filename string) voidptr            { return open(filename) }
+func Sym(handle voidptr, name string) voidptr { return sym(handle, name) }
+func Close(handle voidptr)                    { close(handle) }
+func Error() string                           { return error() }
+
 func open(filename string) voidptr {
-	return C.dlopen(filename.ptr, 0)
+	return C.dlopen(filename.ptr, RTLD_NOW)
 }
 func close(handle voidptr) {
 	C.dlclose(handle)
@@ -30,5 +36,8 @@ func sym(handle voidptr, name string) voidptr {
 
 func error() string {
 	p := C.dlerror()
-	return gotring(p)
+	if p == nil {
+		return ""
+	}
+	return gostring(p)
 }
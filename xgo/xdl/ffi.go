@@ -1,6 +1,9 @@
 package xdl
 
 /*
+#cgo pkg-config: libffi
+#include <stdlib.h>
+#include <string.h>
 #include <ffi.h>
 
 static void* cgo_ffi_type_void() {return (void*)&ffi_type_void;}
@@ -15,6 +18,16 @@ static void* cgo_ffi_type_sint64() {return (void*)&ffi_type_sint64;}
 static void* cgo_ffi_type_float() {return (void*)&ffi_type_float;}
 static void* cgo_ffi_type_double() {return (void*)&ffi_type_double;}
 static void* cgo_ffi_type_pointer() {return (void*)&ffi_type_pointer;}
+
+// size and alignment are filled by ffi_prep_cif
+static void* cgo_ffi_type_struct(void** elems, int n) {
+    ffi_type* t = (ffi_type*)calloc(1, sizeof(ffi_type));
+    t->type = FFI_TYPE_STRUCT;
+    t->elements = (ffi_type**)calloc(n+1, sizeof(ffi_type*));
+    memcpy(t->elements, elems, n*sizeof(ffi_type*));
+    return t;
+}
+static int cgo_ffi_type_size(void* t) { return ((ffi_type*)t)->size; }
 */
 import "C"
 
@@ -96,15 +109,7 @@ func init() {
 	FFITypePointer = C.cgo_ffi_type_pointer()
 }
 
-//go:cgo_import_dynamic libffi_prep_cif ffi_prep_cif  "libffi.so"
-//go:cgo_import_dynamic libffi_prep_cif_var ffi_prep_cif_var  "libffi.so"
-//go:cgo_import_dynamic libffi_call ffi_call  "libffi.so"
-
-func goasm_ffi_prep_cif(voidptr, uint32, uint32, voidptr, voidptr) uint32
-func goasm_ffi_prep_cif_var(voidptr, uint32, uint32, uint32, voidptr, voidptr) uint32
-func goasm_ffi_call(voidptr, voidptr, voidptr, voidptr)
-func goasm_ffi_default_abi() uint32
-
+// same layout as ffi_cif, the rest is ours
 type Cif struct {
 	abi      uint32
 	nargs    uint32
@@ -113,55 +118,259 @@ type Cif struct {
 	nbytes   uint32
 	flags    uint32
 
-	retval uint64
-	argvec []voidptr
+	retsz    int // of a struct return
+	rety     int
+	argtys   []int
+	argtypos []voidptr
+}
+
+// what one Call fills, so calls through the same Cif can run at once
+type callframe struct {
+	retval   uint64
+	retbuf   voidptr // struct return
+	argvec   []voidptr
+	argslots []uint64
 }
 
 func (cif *Cif) cptr() voidptr { return voidptr(&cif.abi) }
-func (cif *Cif) rptr() voidptr { return voidptr(&cif.retval) }
-func (cif *Cif) vptr() voidptr {
-	if len(cif.argvec) > 0 {
-		return voidptr(&cif.argvec[0])
+
+func (cif *Cif) newframe() *callframe {
+	frm := &callframe{}
+	if cif.retsz > 0 {
+		frm.retbuf = malloc3(cif.retsz)
+	}
+	frm.argvec = make([]voidptr, len(cif.argtys))
+	frm.argslots = make([]uint64, len(cif.argtys))
+	return frm
+}
+
+func (frm *callframe) rptr() voidptr {
+	if frm.retbuf != nil {
+		return frm.retbuf
+	}
+	return voidptr(&frm.retval)
+}
+func (frm *callframe) vptr() voidptr {
+	if len(frm.argvec) > 0 {
+		return voidptr(&frm.argvec[0])
 	}
 	return nil
 }
 
-func PrepCif(retype int, argtys []int) *Cif {
+func newcif(retype int, argtys []int) *Cif {
 	var cif = &Cif{}
-	cifc := cif.cptr()
-	retypo := ity2pty(retype)
-	argtypos := ity2ptys(argtys)
-	var ap voidptr
-	if len(argtypos) > 0 {
-		ap = voidptr(&argtypos[0])
-		cif.argvec = make([]voidptr, len(argtys))
+	cif.rety = retype
+	cif.argtys = argtys
+	cif.argtypos = ity2ptys(argtys)
+	return cif
+}
+
+func (cif *Cif) atptr() voidptr {
+	if len(cif.argtypos) > 0 {
+		return voidptr(&cif.argtypos[0])
 	}
+	return nil
+}
 
-	r := goasm_ffi_prep_cif(cifc, goasm_ffi_default_abi(), uint32(len(argtys)), retypo, ap)
-	// log.Printf("r=%d,cif=%+v\n", r, cif)
-	if int(r) != FFI_OK {
+// after prep, struct types know their size
+func (cif *Cif) prepret(r int) *Cif {
+	if r != FFI_OK {
+		println("ffi prep cif failed:", r)
+		return nil
+	}
+	if isstructty(cif.rety) {
+		sz := C.cgo_ffi_type_size(cif.rtype)
+		if sz < 8 { // ffi_arg
+			sz = 8
+		}
+		cif.retsz = sz
 	}
 	return cif
 }
-func PrepCifVar() *Cif {
-	var cif = &Cif{}
-	// println(FFITypeVoid, unsafe.Sizeof(cif))
-	println(FFITypeVoid, sizeof(cif))
-	cifc := cif.cptr()
-	r := goasm_ffi_prep_cif_var(cifc, goasm_ffi_default_abi(), 0, 0, FFITypeVoid, cifc)
-	// log.Printf("r=%d,cif=%+v\n", r, cif)
-	return cif
+
+// nil if libffi rejects the types
+func PrepCif(retype int, argtys []int) *Cif {
+	cif := newcif(retype, argtys)
+	r := C.ffi_prep_cif(cif.cptr(), C.FFI_DEFAULT_ABI, uint32(len(argtys)),
+		ity2pty(retype), cif.atptr())
+	return cif.prepret(int(r))
+}
+
+// for variadic C functions like printf, argtys has the fixed ones
+// then the variadic ones of this call, which must be promoted already,
+// TYPE_DOUBLE not TYPE_FLOAT, TYPE_SINT32 not smaller.
+func PrepCifVar(retype int, argtys []int, nfixed int) *Cif {
+	cif := newcif(retype, argtys)
+	r := C.ffi_prep_cif_var(cif.cptr(), C.FFI_DEFAULT_ABI, uint32(nfixed),
+		uint32(len(argtys)), ity2pty(retype), cif.atptr())
+	return cif.prepret(int(r))
 }
+
+// argvals are converted to the cif argument types, ints of any width,
+// floats, pointers, strings as char*, slices as their data pointer,
+// and struct values or pointers for StructType ones.
+// the return value has the go type of the cif return type,
+// a struct return is a pointer to a copy of its own.
+// a Cif is not changed by Call, fibers and threads can share it.
 func Call(cif *Cif, fnptr voidptr, argvals []interface{}) interface{} {
-	// 这些局部变量影响速度，否则还是可以与cgo比较的
-	var arg0val int = 5
-	cif.argvec[0] = voidptr(&arg0val)
-	if len(argvals) == 2 {
-		cif.argvec[1] = voidptr(&arg0val)
+	if len(argvals) != len(cif.argtys) {
+		println("ffi call want", len(cif.argtys), "args, got", len(argvals))
+		return nil
+	}
+	frm := cif.newframe()
+	for i := 0; i < len(argvals); i++ {
+		var efc *Eface = argvals[i]
+		ty := cif.argtys[i]
+		if isstructty(ty) {
+			frm.argvec[i] = efacestruct(efc)
+			continue
+		}
+		slot := voidptr(&frm.argslots[i])
+		switch ty {
+		case TYPE_UINT8, TYPE_SINT8:
+			*(*int8)(slot) = int8(efaceint(efc))
+		case TYPE_UINT16, TYPE_SINT16:
+			*(*int16)(slot) = int16(efaceint(efc))
+		case TYPE_INT, TYPE_UINT32, TYPE_SINT32:
+			*(*int32)(slot) = int32(efaceint(efc))
+		case TYPE_UINT64, TYPE_SINT64:
+			*(*int64)(slot) = efaceint(efc)
+		case TYPE_FLOAT:
+			*(*float32)(slot) = float32(efacefloat(efc))
+		case TYPE_DOUBLE, TYPE_LONGDOUBLE:
+			*(*float64)(slot) = efacefloat(efc)
+		default:
+			*(*voidptr)(slot) = efaceptr(efc)
+		}
+		frm.argvec[i] = slot
+	}
+
+	C.ffi_call(cif.cptr(), fnptr, frm.rptr(), frm.vptr())
+	return cif.retvalue(frm)
+}
+
+// integer returns are widened to ffi_arg in retval
+func (cif *Cif) retvalue(frm *callframe) interface{} {
+	rv := frm.retval
+	rvp := voidptr(&frm.retval)
+	if isstructty(cif.rety) {
+		return frm.retbuf
+	}
+	switch cif.rety {
+	case TYPE_VOID:
+		return nil
+	case TYPE_UINT8:
+		return uint8(rv)
+	case TYPE_SINT8:
+		return int8(rv)
+	case TYPE_UINT16:
+		return uint16(rv)
+	case TYPE_SINT16:
+		return int16(rv)
+	case TYPE_UINT32:
+		return uint32(rv)
+	case TYPE_INT, TYPE_SINT32:
+		return int(int32(rv))
+	case TYPE_UINT64:
+		return rv
+	case TYPE_SINT64:
+		return int64(rv)
+	case TYPE_FLOAT:
+		return *(*float32)(rvp)
+	case TYPE_DOUBLE, TYPE_LONGDOUBLE:
+		return *(*float64)(rvp)
 	}
+	return voidptr(usize(rv))
+}
 
-	goasm_ffi_call(cif.cptr(), fnptr, cif.rptr(), cif.vptr())
-	return cif.retval
+func efaceint(efc *Eface) int64 {
+	if efc == nil {
+		return 0
+	}
+	p := voidptr(efc.Data)
+	switch efc.Kind() {
+	case Bool:
+		if *(*bool)(p) {
+			return 1
+		}
+		return 0
+	case Int8:
+		return int64(*(*int8)(p))
+	case Uint8:
+		return int64(*(*uint8)(p))
+	case Int16:
+		return int64(*(*int16)(p))
+	case Uint16:
+		return int64(*(*uint16)(p))
+	case Int32:
+		return int64(*(*int32)(p))
+	case Uint32:
+		return int64(*(*uint32)(p))
+	case Int, Int64:
+		if efc.Size() == 4 { // int is a C int
+			return int64(*(*int32)(p))
+		}
+		return *(*int64)(p)
+	case Uint, Uint64, Uintptr:
+		if efc.Size() == 4 {
+			return int64(*(*uint32)(p))
+		}
+		return int64(*(*uint64)(p))
+	case Float32:
+		return int64(*(*float32)(p))
+	case Float64:
+		return int64(*(*float64)(p))
+	}
+	return int64(usize(efaceptr(efc)))
+}
+
+func efacefloat(efc *Eface) float64 {
+	if efc == nil {
+		return 0
+	}
+	p := voidptr(efc.Data)
+	switch efc.Kind() {
+	case Float32:
+		return float64(*(*float32)(p))
+	case Float64:
+		return *(*float64)(p)
+	}
+	return float64(efaceint(efc))
+}
+
+func efaceptr(efc *Eface) voidptr {
+	if efc == nil {
+		return nil
+	}
+	p := voidptr(efc.Data)
+	switch efc.Kind() {
+	case String:
+		s := *(*string)(p)
+		return s.cstr()
+	case Slice:
+		arr := *(**cxarray3)(p)
+		if arr == nil {
+			return nil
+		}
+		return arr.ptr
+	case Struct:
+		return p
+	case Int, Int64, Uint, Uint64, Uintptr:
+		return voidptr(usize(efaceint(efc))) // by efc.Size()
+	}
+	return *efc.Data
+}
+
+// struct values are passed by the copy in the interface,
+// pointers to structs by where they point
+func efacestruct(efc *Eface) voidptr {
+	if efc == nil {
+		return nil
+	}
+	if efc.Kind() == Struct {
+		return voidptr(efc.Data)
+	}
+	return *efc.Data
 }
 
 const cifsz = 32
@@ -191,6 +400,25 @@ const (
 	TYPE_COMPLEX    = int(C.FFI_TYPE_COMPLEX)
 )
 
+// type ids from StructType start here
+const typestructbase = 0x100
+
+var structtypos []voidptr
+
+func isstructty(ty int) bool { return ty >= typestructbase }
+
+// registers a struct of fields, which are TYPE_* or StructType ids,
+// the id can be used as argument or return type
+func StructType(fields []int) int {
+	elems := ity2ptys(fields)
+	var ep voidptr
+	if len(elems) > 0 {
+		ep = voidptr(&elems[0])
+	}
+	structtypos = append(structtypos, C.cgo_ffi_type_struct(ep, len(elems)))
+	return typestructbase + len(structtypos) - 1
+}
+
 func ity2ptys(tys []int) (ptys []voidptr) {
 	for _, ty := range tys {
 		ptys = append(ptys, ity2pty(ty))
@@ -199,6 +427,13 @@ func ity2ptys(tys []int) (ptys []voidptr) {
 }
 
 func ity2pty(ty int) voidptr {
+	if isstructty(ty) {
+		idx := ty - typestructbase
+		if idx < len(structtypos) {
+			return structtypos[idx]
+		}
+		return FFITypeVoid
+	}
 	switch ty {
 	case TYPE_VOID:
 		return FFITypeVoid
@@ -236,19 +471,12 @@ func ity2pty(ty int) voidptr {
 	return FFITypeVoid
 }
 
-func Keepme() {
-	var a int
-	_ = voidptr(nil)
-}
-
 func init() {
-	println("ffi const:", FFI_OK, FFI_BAD_TYPEDEF, FFI_BAD_ABI)
-	println("ffi dftabi:", goasm_ffi_default_abi())
 	// force keep
 	// rn := rand.Uint32() + 1
 	rn := 1
 	if rn == 0 {
-		println("ffi", PrepCif, PrepCifVar, Call)
+		println("ffi", PrepCif, PrepCifVar, Call, StructType)
 		println("ffi",
 			FFITypeVoid,
 			FFITypeUint8,
@@ -0,0 +1,44 @@
+package xdl
+
+func test_call1() {
+	h := Open("libc.so.6")
+	strlen := Sym(h, "strlen")
+	cif := PrepCif(TYPE_UINT64, []int{TYPE_POINTER})
+	println(Call(cif, strlen, []interface{}{"hello 世界"}))
+
+	labs := Sym(h, "labs")
+	cif = PrepCif(TYPE_SINT64, []int{TYPE_SINT64})
+	println(Call(cif, labs, []interface{}{-42}))
+
+	// an int is 4 bytes, its box too
+	abs := Sym(h, "abs")
+	cif = PrepCif(TYPE_SINT32, []int{TYPE_SINT32})
+	n := -7
+	println(Call(cif, abs, []interface{}{n}))
+
+	pow := Sym(h, "pow")
+	cif = PrepCif(TYPE_DOUBLE, []int{TYPE_DOUBLE, TYPE_DOUBLE})
+	println(Call(cif, pow, []interface{}{2.0, 10}))
+}
+
+func test_callvar1() {
+	h := Open("libc.so.6")
+	printf := Sym(h, "printf")
+	cif := PrepCifVar(TYPE_SINT32, []int{TYPE_POINTER, TYPE_SINT32, TYPE_DOUBLE}, 1)
+	println(Call(cif, printf, []interface{}{"%d %g\n", 7, 1.5}))
+}
+
+// C long quot, rem
+type divt struct {
+	quot int64
+	rem  int64
+}
+
+func test_callstruct1() {
+	h := Open("libc.so.6")
+	ldiv := Sym(h, "ldiv")
+	divty := StructType([]int{TYPE_SINT64, TYPE_SINT64})
+	cif := PrepCif(divty, []int{TYPE_SINT64, TYPE_SINT64})
+	var dv *divt = Call(cif, ldiv, []interface{}{17, 5})
+	println(dv.quot, dv.rem)
+}
@@ -1,40 +1,204 @@
 package xerrors
 
+import (
+	"xgo/fmt"
+	"xgo/xlog"
+)
+
 type ezerror struct {
 	s      string
-	stacks []string
+	err    error         // what it wraps, may be nil
+	frames []*xlog.Frame // where it was made, if CaptureStacks
 }
 
 func (err *ezerror) Error() string {
 	return err.s
 }
 
+func (err *ezerror) Unwrap() error {
+	return err.err
+}
+
+// "func file:line" of each frame, symbolized only now
 func (err *ezerror) Stacks() []string {
-	return err.stacks
+	return framelines(err.frames)
 }
 
-func New(s string) error {
+// an ezerror wrapping more than one, Errorf with several %w
+type ezerrors struct {
+	s      string
+	errs   []error
+	frames []*xlog.Frame
+}
+
+func (err *ezerrors) Error() string {
+	return err.s
+}
+
+func (err *ezerrors) Unwrap() []error {
+	return err.errs
+}
+
+func (err *ezerrors) Stacks() []string {
+	return framelines(err.frames)
+}
+
+func framelines(frames []*xlog.Frame) []string {
+	stacks := []string{}
+	if frames.len == 0 {
+		return stacks
+	}
+	frms := xlog.Symbolize(frames)
+	for _, frm := range frms {
+		lineno := frm.Lineno
+		line := frm.Funcname + " " + frm.File + ":" + lineno.repr()
+		stacks = append(stacks, line)
+	}
+	return stacks
+}
+
+type joinError struct {
+	errs []error
+}
+
+func (err *joinError) Error() string {
+	s := ""
+	for idx, e := range err.errs {
+		if idx > 0 {
+			s += "\n"
+		}
+		s += e.Error()
+	}
+	return s
+}
+
+func (err *joinError) Unwrap() []error {
+	return err.errs
+}
+
+var capturing = false
+
+// errors made by New, Wrap and Errorf keep where they were made from now
+// on, see Stacks. off by default, a backtrace per error is not cheap
+func CaptureStacks(on bool) {
+	capturing = on
+}
+
+// the backtrace up to the caller of xerrors
+func captureframes() []*xlog.Frame {
+	frms := []*xlog.Frame{}
+	if !capturing {
+		return frms
+	}
+	all := xlog.Backtrace()
+	inside := true
+	for _, frm := range all {
+		name := frm.Funcname
+		if inside && (name.prefixed("xlog__") || name.prefixed("xerrors__")) {
+			continue
+		}
+		inside = false
+		frms = append(frms, frm)
+	}
+	return frms
+}
+
+func newezerror(s string, wrapped error) error {
+	ez := &ezerror{}
+	ez.s = s
+	ez.err = wrapped
+	ez.frames = captureframes()
 	var err error
-	err = &ezerror{s}
+	err = ez
 	return err
 }
 
-func Wrap(err error, s string) error {
-	var olderrpp **ezerror = &err
-	var olderrp = *olderrpp
+func New(s string) error {
+	return newezerror(s, nil)
+}
 
-	olds := err.Error()
-	var nerr error
-	err1 := &ezerror{}
-	err1.s = s
-	err1.stacks = olderrp.stacks
-	err1.stacks = append(err1.stacks, olds)
-	nerr = err1
-	return nerr
+// "s: err", wrapping err
+func Wrap(err error, s string) error {
+	if err == nil {
+		return nil
+	}
+	return newezerror(s+": "+err.Error(), err)
 }
 
+// fmt.Errorf, with %w wrapping its arg, plus the stack if captured.
+// it unwraps to the %w args either way
 func Errorf(format string, args ...interface{}) error {
-	return nil
+	err := fmt.Errorf(format, args...)
+	if !capturing {
+		return err
+	}
+	errs, ok := errors_unwrapn(err)
+	if !ok {
+		return newezerror(err.Error(), errors_unwrap(err))
+	}
+	ezs := &ezerrors{}
+	ezs.s = err.Error()
+	ezs.errs = errs
+	ezs.frames = captureframes()
+	err = ezs
+	return err
+}
+
+// what err.Unwrap() error returns, nil if it has no such method
+func Unwrap(err error) error {
+	return errors_unwrap(err)
+}
+
+// err or any error it wraps is target, by identity or an Is method
+func Is(err error, target error) bool {
+	return errors_is(err, target)
+}
+
+// the first error in err's chain of the type target points to is
+// stored there, like
+//
+//	var perr *xos.PathError
+//	if xerrors.As(err, &perr) { ... }
+func As(err error, target interface{}) bool {
+	return errors_as(err, target)
+}
+
+// an error wrapping errs, nil ones dropped, nil if none is left.
+// its message is theirs joined by newlines
+func Join(errs ...error) error {
+	je := &joinError{}
+	je.errs = []error{}
+	for _, e := range errs {
+		if e != nil {
+			je.errs = append(je.errs, e)
+		}
+	}
+	if je.errs.len == 0 {
+		return nil
+	}
+	var err error
+	err = je
+	return err
+}
+
+// the stack of the first error in err's chain that captured one, see
+// CaptureStacks
+func Stacks(err error) []string {
+	for err != nil {
+		var ezs *ezerrors
+		if errors_as(err, &ezs) && ezs.frames.len > 0 {
+			return ezs.Stacks()
+		}
+		var ez *ezerror
+		if errors_as(err, &ez) && ez.frames.len > 0 {
+			return ez.Stacks()
+		}
+		if ez == nil {
+			break
+		}
+		err = ez.err
+	}
+	return []string{}
 }
 
 func Keep() {
@@ -0,0 +1,66 @@
+package xerrors
+
+import "xgo/fmt"
+
+var errbase = New("base")
+
+func test_wrap1() {
+	err := fmt.Errorf("read %s: %w", "a.txt", errbase)
+	println(err.Error())        // read a.txt: base
+	println(Unwrap(err) != nil) // true
+	println(Is(err, errbase))   // true
+	err2 := Wrap(err, "load")
+	println(err2.Error())             // load: read a.txt: base
+	println(Is(err2, errbase))        // true
+	println(Is(New("base"), errbase)) // false
+	println(Unwrap(errbase) == nil)   // true
+}
+
+func test_join1() {
+	err1 := New("e1")
+	err2 := New("e2")
+	err := Join(err1, nil, err2)
+	println(err.Error())                          // e1\ne2
+	println(Is(err, err1), Is(err, err2))         // true true
+	println(Join(nil, nil) == nil)                // true
+	err = fmt.Errorf("both %w %w", err1, errbase) // wraps both
+	println(Is(err, errbase), Unwrap(err) == nil) // true true
+}
+
+func test_as1() {
+	err := fmt.Errorf("ctx: %w", errbase)
+	var ez *ezerror
+	println(As(err, &ez), ez.s) // true base
+	var je *joinError
+	println(As(err, &je)) // false
+	var ezp **ezerror
+	println(As(err, &ezp)) // false, the type is *ezerror exactly
+}
+
+func test_stacks1() {
+	println(Stacks(errbase).len) // 0
+	CaptureStacks(true)
+	err := Errorf("at %d", 1)
+	CaptureStacks(false)
+	stacks := Stacks(err)
+	println(err.Error(), stacks.len > 0) // at 1 true
+}
+
+// the same %w chain with stacks on or off
+func test_stacks2() {
+	CaptureStacks(true)
+	err := Errorf("x: %w", errbase)
+	err2 := Errorf("y %w %w", errbase, err)
+	CaptureStacks(false)
+	uw := Unwrap(err)
+	stacks := Stacks(err)
+	println(uw.Error(), stacks.len > 0)             // base true
+	println(Unwrap(err2) == nil, Is(err2, errbase)) // true true
+}
+
+func test_errorf1() {
+	err := fmt.Errorf("code %d, %v", 42, errbase)
+	println(err.Error(), Unwrap(err) == nil) // code 42, base true
+	err = fmt.Errorf("%w", 5)
+	println(err.Error()) // %!w(int=5)
+}
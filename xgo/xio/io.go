@@ -0,0 +1,213 @@
+package xio
+
+import "xgo/xerrors"
+
+// The Reader/Writer glue, like go's io. xos.File, xnet.Conn, xnet.Body,
+// xbufio and the pipe here all fit.
+
+// returned by Read at the end of input, not a failure
+var EOF = xerrors.New("EOF")
+var ErrUnexpectedEOF = xerrors.New("unexpected EOF")
+var ErrShortWrite = xerrors.New("short write")
+var ErrClosedPipe = xerrors.New("io: read/write on closed pipe")
+
+// many Reads in a row returned nothing and no error
+var ErrNoProgress = xerrors.New("multiple Read calls return no data or error")
+
+const (
+	SeekStart   = 0
+	SeekCurrent = 1
+	SeekEnd     = 2
+)
+
+// n > 0 bytes may come with an error, use them first
+type Reader interface {
+	Read(p []byte) (int, error)
+}
+
+// n < len(p) comes with an error
+type Writer interface {
+	Write(p []byte) (int, error)
+}
+
+type Closer interface {
+	Close() error
+}
+
+type Seeker interface {
+	Seek(offset int64, whence int) (int64, error)
+}
+
+type ReadWriter interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+}
+
+type ReadCloser interface {
+	Read(p []byte) (int, error)
+	Close() error
+}
+
+type WriteCloser interface {
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+type ReadWriteCloser interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+const copybufsz = 32 << 10
+
+// until EOF on src, which is not an error then
+func Copy(dst Writer, src Reader) (int64, error) {
+	buf := make([]byte, copybufsz)
+	return CopyBuffer(dst, src, buf)
+}
+
+func CopyBuffer(dst Writer, src Reader, buf []byte) (int64, error) {
+	var written int64
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			part := buf[:nr]
+			nw, werr := dst.Write(part)
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+			if nw != nr {
+				return written, ErrShortWrite
+			}
+		}
+		if rerr == EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// n bytes, EOF if none was there, ErrUnexpectedEOF if some
+func CopyN(dst Writer, src Reader, n int64) (int64, error) {
+	buf := make([]byte, copybufsz)
+	var written int64
+	for written < n {
+		want := n - written
+		if want > int64(buf.len) {
+			want = int64(buf.len)
+		}
+		part := buf[:int(want)]
+		nr, rerr := src.Read(part)
+		if nr > 0 {
+			data := part[:nr]
+			nw, werr := dst.Write(data)
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if rerr == EOF {
+			if written == 0 {
+				return 0, EOF
+			}
+			return written, ErrUnexpectedEOF
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+	return written, nil
+}
+
+// until EOF, which is not an error then
+func ReadAll(r Reader) ([]byte, error) {
+	res := make([]byte, 0)
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			part := buf[:n]
+			res = append(res, part...)
+		}
+		if err == EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+}
+
+// all of buf, EOF if nothing was read, ErrUnexpectedEOF if some
+func ReadFull(r Reader, buf []byte) (int, error) {
+	n := 0
+	for n < buf.len {
+		part := buf[n:]
+		nr, err := r.Read(part)
+		if nr > 0 {
+			memcpy3(voidptr(usize(buf.ptr)+usize(n)), part.ptr, nr)
+			n += nr
+		}
+		if err == EOF {
+			if n == 0 {
+				return 0, EOF
+			}
+			if n < buf.len {
+				return n, ErrUnexpectedEOF
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func WriteString(w Writer, s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+type multiwriter struct {
+	writers []Writer
+}
+
+// every Write goes to all of writers in order, the first error stops it
+func MultiWriter(writers ...Writer) Writer {
+	mw := &multiwriter{}
+	mw.writers = make([]Writer, 0)
+	for _, w := range writers {
+		mw.writers = append(mw.writers, w)
+	}
+	return mw
+}
+
+func (mw *multiwriter) Write(p []byte) (int, error) {
+	for _, w := range mw.writers {
+		n, err := w.Write(p)
+		if err != nil {
+			return n, err
+		}
+		if n != p.len {
+			return n, ErrShortWrite
+		}
+	}
+	return p.len, nil
+}
+
+type discard struct{}
+
+func (d *discard) Write(p []byte) (int, error) { return p.len, nil }
+
+// takes anything
+var Discard Writer
+
+func init() {
+	Discard = &discard{}
+}
+
+func Keep() {}
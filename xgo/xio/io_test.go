@@ -0,0 +1,93 @@
+package xio
+
+// a Reader over s, at most max bytes per Read
+type testreader struct {
+	data []byte
+	pos  int
+	max  int
+}
+
+func newtestreader(s string, max int) *testreader {
+	r := &testreader{}
+	r.data = []byte(s)
+	r.max = max
+	return r
+}
+
+func (r *testreader) Read(p []byte) (int, error) {
+	if r.pos >= r.data.len {
+		return 0, EOF
+	}
+	n := r.data.len - r.pos
+	if n > p.len {
+		n = p.len
+	}
+	if n > r.max {
+		n = r.max
+	}
+	memcpy3(p.ptr, voidptr(usize(r.data.ptr)+usize(r.pos)), n)
+	r.pos += n
+	return n, nil
+}
+
+type testwriter struct {
+	data []byte
+}
+
+func (w *testwriter) Write(p []byte) (int, error) {
+	w.data = append(w.data, p...)
+	return p.len, nil
+}
+
+func test_copy1() {
+	w := &testwriter{}
+	w.data = make([]byte, 0)
+	n, err := Copy(w, newtestreader("hello world", 3))
+	println(n, err == nil, string(w.data)) // 11 true hello world
+
+	w.data = make([]byte, 0)
+	n, err = CopyN(w, newtestreader("hello world", 3), 5)
+	println(n, err == nil, string(w.data)) // 5 true hello
+	n, err = CopyN(w, newtestreader("abc", 3), 5)
+	println(n, err == ErrUnexpectedEOF) // 3 true
+}
+
+func test_readall1() {
+	data, err := ReadAll(newtestreader("some bytes", 4))
+	println(string(data), err == nil)
+
+	buf := make([]byte, 4)
+	r := newtestreader("abcdef", 1)
+	n, err := ReadFull(r, buf)
+	println(n, string(buf), err == nil) // 4 abcd true
+	n, err = ReadFull(r, buf)
+	println(n, err == ErrUnexpectedEOF) // 2 true
+	n, err = ReadFull(r, buf)
+	println(n, err == EOF) // 0 true
+}
+
+func test_multiwriter1() {
+	w1 := &testwriter{}
+	w1.data = make([]byte, 0)
+	w2 := &testwriter{}
+	w2.data = make([]byte, 0)
+	mw := MultiWriter(w1, w2, Discard)
+	WriteString(mw, "both")
+	println(string(w1.data), string(w2.data))
+}
+
+func test_pipe1() {
+	r, w := Pipe()
+	go func() {
+		w.Write([]byte("through "))
+		w.Write([]byte("the pipe"))
+		w.Close()
+	}()
+	data, err := ReadAll(r)
+	println(string(data), err == nil) // through the pipe true
+
+	r, w = Pipe()
+	r.Close()
+	_, err = w.Write([]byte("x"))
+	println(err == ErrClosedPipe)
+}
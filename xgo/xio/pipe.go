@@ -0,0 +1,171 @@
+package xio
+
+/*
+#include <pthread.h>
+*/
+import "C"
+
+// synchronous in-memory pipe, each Write waits until Reads took all of it.
+// chans do the waiting so a parked fiber never holds its thread
+
+type pipechunk struct {
+	b []byte
+}
+
+type pipe struct {
+	wrch chan *pipechunk // a Write's data
+	rdch chan int        // how much a Read took of it
+	wrmu chan int        // one Write at a time
+	done chan int        // closed by the first Close of either side
+
+	mu      C.pthread_mutex_t
+	rclosed bool
+	wclosed bool
+	rerr    error // the reader's CloseWithError, for writes
+	werr    error // the writer's CloseWithError, for reads
+}
+
+type PipeReader struct {
+	p *pipe
+}
+
+type PipeWriter struct {
+	p *pipe
+}
+
+func Pipe() (*PipeReader, *PipeWriter) {
+	p := &pipe{}
+	p.wrch = make(chan *pipechunk)
+	p.rdch = make(chan int)
+	p.wrmu = make(chan int, 1)
+	p.done = make(chan int)
+	r := &PipeReader{}
+	r.p = p
+	w := &PipeWriter{}
+	w.p = p
+	return r, w
+}
+
+func (p *pipe) lock()   { C.pthread_mutex_lock(&p.mu) }
+func (p *pipe) unlock() { C.pthread_mutex_unlock(&p.mu) }
+
+func (p *pipe) readerr() error {
+	p.lock()
+	err := ErrClosedPipe
+	if !p.rclosed && p.werr != nil {
+		err = p.werr
+	}
+	p.unlock()
+	return err
+}
+
+func (p *pipe) writeerr() error {
+	p.lock()
+	err := ErrClosedPipe
+	if !p.wclosed && p.rerr != nil {
+		err = p.rerr
+	}
+	p.unlock()
+	return err
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	select {
+	case chunk := <-p.wrch:
+		n := chunk.b.len
+		if n > b.len {
+			n = b.len
+		}
+		memcpy3(b.ptr, chunk.b.ptr, n)
+		select {
+		case p.rdch <- n:
+		case <-p.done:
+		}
+		return n, nil
+	case <-p.done:
+		return 0, p.readerr()
+	}
+}
+
+func (p *pipe) write(b []byte) (int, error) {
+	select {
+	case p.wrmu <- 1:
+	case <-p.done:
+		return 0, p.writeerr()
+	}
+	n := 0
+	for {
+		chunk := &pipechunk{}
+		chunk.b = b[n:]
+		select {
+		case p.wrch <- chunk:
+			select {
+			case nr := <-p.rdch:
+				n += nr
+			case <-p.done:
+				<-p.wrmu
+				return n, p.writeerr()
+			}
+		case <-p.done:
+			<-p.wrmu
+			return n, p.writeerr()
+		}
+		if n >= b.len {
+			break
+		}
+	}
+	<-p.wrmu
+	return n, nil
+}
+
+// first close of either side wakes everyone
+func (p *pipe) close(reader bool, err error) {
+	p.lock()
+	first := !p.rclosed && !p.wclosed
+	if reader {
+		p.rclosed = true
+		p.rerr = err
+	} else {
+		p.wclosed = true
+		p.werr = err
+	}
+	p.unlock()
+	if first {
+		close(p.done)
+	}
+}
+
+// what the writer sent, EOF after it closed
+func (r *PipeReader) Read(b []byte) (int, error) { return r.p.read(b) }
+
+// writes then fail with ErrClosedPipe
+func (r *PipeReader) Close() error {
+	r.p.close(true, ErrClosedPipe)
+	return nil
+}
+
+// writes then fail with err, ErrClosedPipe if nil
+func (r *PipeReader) CloseWithError(err error) error {
+	if err == nil {
+		err = ErrClosedPipe
+	}
+	r.p.close(true, err)
+	return nil
+}
+
+func (w *PipeWriter) Write(b []byte) (int, error) { return w.p.write(b) }
+
+// reads then get EOF
+func (w *PipeWriter) Close() error {
+	w.p.close(false, EOF)
+	return nil
+}
+
+// reads then fail with err, EOF if nil
+func (w *PipeWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = EOF
+	}
+	w.p.close(false, err)
+	return nil
+}
@@ -1,7 +1,7 @@
 package xlog
 
 /*
-#cgo LDFLAGS: -ldwarf
+#cgo LDFLAGS: -ldwarf -lelf
 
 #include <execinfo.h>
 #include <libdwarf/dwarf.h>
@@ -118,9 +118,14 @@ func lazyinit_dwarf() {
 
 // backtrace with file/line
 func Callers() []*Frame {
+	frms := Backtrace()
+	return Symbolize(frms)
+}
+
+// fill file/line of frms from Backtrace, which may be taken long before
+func Symbolize(frms []*Frame) []*Frame {
 	lazyinit_dwarf()
 
-	frms := Backtrace()
 	for idx := 0; idx < frms.len; idx++ {
 		frm := frms[idx]
 		// file, lineno := addr2line1(frm.Funcaddr) // TODO crash
@@ -135,6 +140,16 @@ func Callers() []*Frame {
 			frm.File = filename
 			frm.Lineno = fileline
 		}
+		if found && filename.suffixed(".c") {
+			// generated code between its #line spans, or all of it with
+			// CYGO_CLINES=1, see bysrc fixclines. not cxrt, corona, libc
+			lazyinit_linemap()
+			gofile, goline, ok := lnmap.gopos(fileline)
+			if ok && lnmap.isgenfile(filename) {
+				frm.File = gofile
+				frm.Lineno = goline
+			}
+		}
 		frm.Line = lineno.repr()
 	}
 	return frms
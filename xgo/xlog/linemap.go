@@ -0,0 +1,156 @@
+package xlog
+
+/*
+#include <stdio.h>
+#include <stdlib.h>
+
+// defined by the generated code, see bysrc fixclines
+extern const char* cxlinemap_path;
+*/
+import "C"
+
+// go positions and function names of the generated C code, from the
+// foo.c.linemap which bysrc writes beside foo.c:
+//
+//	C <cfile>
+//	F <cfuncname> <gofuncname>
+//	L <cfirst> <clast> <goline> <gofile>
+//	G <cfirst> <clast> <goline> <gofile>
+//
+// cfile is the generated C file, by its absolute path as in the debug
+// info. G ranges are C code between go spans, all at goline. gofile and
+// cfile are the rest of the line, they may have spaces.
+// $CYGO_LINEMAP overrides the path recorded at transpile time.
+type linerange struct {
+	cfirst int
+	clast  int
+	goline int
+	gofile string
+	glue   bool
+}
+type linefunc struct {
+	cname  string
+	goname string
+}
+type linemap struct {
+	cfile  string
+	ranges []*linerange
+	funcs  []*linefunc
+}
+
+var lnmap *linemap
+
+func lazyinit_linemap() {
+	if lnmap == nil {
+		lm := &linemap{}
+		lm.load(linemap_path())
+		globmu.lock()
+		if lnmap == nil {
+			lnmap = lm
+		}
+		globmu.unlock()
+	}
+}
+
+func linemap_path() string {
+	eptr := C.getenv("CYGO_LINEMAP".ptr)
+	if eptr != nil {
+		return gostring(eptr)
+	}
+	return gostring(C.cxlinemap_path)
+}
+
+func (lm *linemap) load(filename string) {
+	mode := "r"
+	fp := C.fopen(filename.ptr, mode.ptr)
+	if fp == nil {
+		return
+	}
+	defer C.fclose(fp)
+
+	buf := make([]byte, 4096)
+	for {
+		rv := C.fgets(buf.ptr, buf.len, fp)
+		if rv == nil {
+			break
+		}
+		line := gostring(rv)
+		if line.suffixed("\n") {
+			line = line[:line.len-1]
+		}
+		lm.parseline(line)
+	}
+}
+
+// at most n fields, the last one is the rest of line with its spaces
+func splitn(line string, n int) []string {
+	fields := []string{}
+	for fields.len < n-1 {
+		pos := line.index(" ")
+		if pos < 0 {
+			break
+		}
+		field := line[:pos]
+		fields = append(fields, field)
+		line = line[pos+1:]
+	}
+	fields = append(fields, line)
+	return fields
+}
+
+func (lm *linemap) parseline(line string) {
+	fields := splitn(line, 5)
+	if fields.len >= 2 && fields[0] == "C" {
+		cfile := splitn(line, 2)
+		lm.cfile = cfile[1]
+	} else if fields.len == 3 && fields[0] == "F" {
+		fn := &linefunc{}
+		fn.cname = fields[1]
+		fn.goname = fields[2]
+		lm.funcs = append(lm.funcs, fn)
+	} else if fields.len == 5 && (fields[0] == "L" || fields[0] == "G") {
+		rng := &linerange{}
+		rng.cfirst = fields[1].toint()
+		rng.clast = fields[2].toint()
+		rng.goline = fields[3].toint()
+		rng.gofile = fields[4]
+		rng.glue = fields[0] == "G"
+		lm.ranges = append(lm.ranges, rng)
+	}
+}
+
+// go function name of C function cname
+func (lm *linemap) goname(cname string) (string, bool) {
+	for idx := 0; idx < lm.funcs.len; idx++ {
+		fn := lm.funcs[idx]
+		if fn.cname == cname {
+			return fn.goname, true
+		}
+	}
+	return "", false
+}
+
+// of the generated C file, not another C one
+func (lm *linemap) isgenfile(filename string) bool {
+	return lm.cfile.len > 0 && filename == lm.cfile
+}
+
+// go file/line of line cline of the generated C file, ranges are ordered
+func (lm *linemap) gopos(cline int) (string, int, bool) {
+	lo := 0
+	hi := lm.ranges.len
+	for lo < hi {
+		mid := (lo + hi) / 2
+		rng := lm.ranges[mid]
+		if cline < rng.cfirst {
+			hi = mid
+		} else if cline > rng.clast {
+			lo = mid + 1
+		} else if rng.glue {
+			return rng.gofile, rng.goline, true
+		} else {
+			return rng.gofile, rng.goline + cline - rng.cfirst, true
+		}
+	}
+	return "", 0, false
+}
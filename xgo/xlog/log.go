@@ -73,6 +73,11 @@ func trim_gopath(s string) string {
 }
 
 func demangle_funcname(s string) string {
+	lazyinit_linemap()
+	goname, ok := lnmap.goname(s)
+	if ok {
+		return goname
+	}
 	// s2 := xstrings.Replace(s, pkgsep, ".", 1)
 	s2 := s.replace(pkgsep, ".", 1)
 	return s2
@@ -1,46 +1,575 @@
 package xnet
 
-type Request struct {
-	Method  string
-	Headers map[string]string
-	Uri     string
-}
+/*
+#include <pthread.h>
+*/
+import "C"
+import (
+	"xgo/xerrors"
+	"xgo/xio"
+	"xgo/xtime"
+)
+
+// HTTP/1.1 client over Dial, no libcurl.
+// idle keep-alive connections are pooled per host:port, a Response.Body
+// read to the end or closed gives its connection back.
+// http only, no https.
+
+var errbadurl = xerrors.New("http: bad url")
+var errscheme = xerrors.New("http: unsupported protocol scheme")
+var errtoomanyredirs = xerrors.New("http: too many redirects")
+var errbadstatus = xerrors.New("http: malformed status line")
+
+const (
+	defmaxredirs = 10
+	defmaxidle   = 2
+	maxdrainlen  = 256 << 10 // Body.Close reads up to it to reuse the connection
+)
 
 type Response struct {
 	Stcode   int
-	Stline   string
-	Ctlength i64
+	Stline   string // HTTP/1.1 200 OK
+	Proto    string
+	Ctlength i64 // -1 if not known
 	Headers  map[string]string
-	Data     string
+	Body     *Body // must be closed, even if not read
+	Request  *Request
+}
+
+func (rsp *Response) Header(key string) string {
+	return rsp.Headers[canonicalkey(key)]
 }
 
 type Client struct {
+	Timeout      xtime.Duration // whole request, reading Body included. 0 for none
+	MaxRedirects int            // 10 if 0, -1 to return redirects as is
+	MaxIdleConns int            // per host, 2 if 0
+
+	mu   C.pthread_mutex_t
+	idle []*clientconn
 }
 
-func NewRequest(method string, uri string, data voidptr) *Request {
+func NewClient() *Client {
+	cli := &Client{}
+	return cli
+}
+
+var DefaultClient = NewClient()
+
+type clientconn struct {
+	key    string // host:port
+	c      Conn
+	rd     *connreader
+	wrote  bool // some of the current request went out
+	gotrsp bool // some of its response came in
+}
+
+func (cli *Client) lock() {
+	C.pthread_mutex_lock(&cli.mu)
+	if cli.idle == nil {
+		cli.idle = make([]*clientconn, 0) // zero Client
+	}
+}
+func (cli *Client) unlock() {
+	C.pthread_mutex_unlock(&cli.mu)
+}
+
+// an idle one if any, reused true then
+func (cli *Client) getconn(key string) (*clientconn, bool, error) {
+	var cc *clientconn
+	cli.lock()
+	for i := cli.idle.len - 1; i >= 0; i-- {
+		if cli.idle[i].key == key {
+			cc = cli.idle[i]
+			var lefts []*clientconn
+			for j, cc2 := range cli.idle {
+				if j != i {
+					lefts = append(lefts, cc2)
+				}
+			}
+			cli.idle = lefts
+			break
+		}
+	}
+	cli.unlock()
+	if cc != nil {
+		return cc, true, nil
+	}
+
+	c, err := Dial("tcp", key)
+	if err != nil {
+		return nil, false, err
+	}
+	cc = &clientconn{}
+	cc.key = key
+	cc.c = c
+	cc.rd = newconnreader(c)
+	return cc, false, nil
+}
+
+func (cli *Client) putconn(cc *clientconn) {
+	maxidle := cli.MaxIdleConns
+	if maxidle == 0 {
+		maxidle = defmaxidle
+	}
+	cc.c.SetDeadline(nil)
+	cli.lock()
+	cnt := 0
+	for _, cc2 := range cli.idle {
+		if cc2.key == cc.key {
+			cnt++
+		}
+	}
+	if cnt < maxidle {
+		cli.idle = append(cli.idle, cc)
+		cc = nil
+	}
+	cli.unlock()
+	if cc != nil {
+		cc.c.Close()
+	}
+}
+
+// closes the pooled connections, the client stays usable
+func (cli *Client) CloseIdleConnections() {
+	cli.lock()
+	idle := cli.idle
+	cli.idle = make([]*clientconn, 0)
+	cli.unlock()
+	for _, cc := range idle {
+		cc.c.Close()
+	}
+}
+
+func NewRequest(method string, uri string, body []byte) *Request {
 	req := &Request{}
 	req.Method = method
 	req.Uri = uri
-
+	if body != nil {
+		req.Body = body
+	} else {
+		req.Body = make([]byte, 0)
+	}
+	req.Headers = map[string]string{}
 	return req
 }
 
-func (c *Client) Do(req *Request) (*Response, error) {
+// follows redirects, a non 2xx status is no error
+func (cli *Client) Do(req *Request) (*Response, error) {
+	var deadline *xtime.Time
+	if cli.Timeout > 0 {
+		deadline = xtime.Now().Add(cli.Timeout)
+	}
+	maxredirs := cli.MaxRedirects
+	if maxredirs == 0 {
+		maxredirs = defmaxredirs
+	}
+	for nredir := 0; ; nredir++ {
+		rsp, err := cli.do1(req, deadline)
+		if err != nil {
+			return nil, err
+		}
+		loc := rsp.Headers["Location"]
+		if maxredirs < 0 || !isredirect(rsp.Stcode) || loc.len == 0 {
+			return rsp, nil
+		}
+		rsp.Body.Close()
+		if nredir >= maxredirs {
+			return nil, errtoomanyredirs
+		}
+		req = redirectreq(req, rsp.Stcode, loc)
+	}
+	return nil, nil
+}
+
+func isredirect(code int) bool {
+	return code == 301 || code == 302 || code == 303 || code == 307 || code == 308
+}
+
+// 303, and 301/302 after a POST, turn into a GET without body.
+// credentials are not sent on to another host
+func redirectreq(req *Request, code int, loc string) *Request {
+	req2 := NewRequest(req.Method, resolveloc(req.Uri, loc), req.Body)
+	samehost := urlhostport(req.Uri) == urlhostport(req2.Uri)
+	if req.Headers != nil {
+		for k, v := range req.Headers {
+			if !samehost && issensitivehdr(k) {
+				continue
+			}
+			req2.Headers[k] = v
+		}
+	}
+	if code == 303 || ((code == 301 || code == 302) && req.Method == MethodPost) {
+		req2.Method = MethodGet
+		req2.Body = make([]byte, 0)
+		delete(req2.Headers, "Content-Type")
+		delete(req2.Headers, "Content-Length")
+	}
+	return req2
+}
+
+// lowercased host:port of an url, "" if it does not parse
+func urlhostport(uri string) string {
+	uo := ParseUrl(uri)
+	if uo == nil {
+		return ""
+	}
+	port := uo.Port
+	if port.len == 0 {
+		port = "80"
+	}
+	host := uo.Host
+	return host.tolower() + ":" + port
+}
+
+func issensitivehdr(key string) bool {
+	key = canonicalkey(key)
+	return key == "Authorization" || key == "Www-Authenticate" ||
+		key == "Cookie" || key == "Cookie2"
+}
+
+// Location relative to the url it came from
+func resolveloc(base string, loc string) string {
+	if loc.index("://") > 0 {
+		return loc
+	}
+	pos := base.index("://")
+	scheme := base[:pos]
+	if loc.prefixed("//") {
+		return scheme + ":" + loc
+	}
+	rest := base[pos+3:]
+	slash := rest.index("/")
+	if slash < 0 {
+		slash = rest.len
+	}
+	hostpart := base[:pos+3+slash]
+	if loc.prefixed("/") {
+		return hostpart + loc
+	}
+	dir := rest[slash:]
+	qpos := dir.index("?")
+	if qpos >= 0 {
+		dir = dir[:qpos]
+	}
+	dpos := dir.rindex("/")
+	if dpos < 0 {
+		return hostpart + "/" + loc
+	}
+	return hostpart + dir[:dpos+1] + loc
+}
+
+// [::1] => ::1
+func unbracket(host string) string {
+	if host.prefixed("[") && host.suffixed("]") {
+		return host[1 : host.len-1]
+	}
+	return host
+}
+
+func (cli *Client) do1(req *Request, deadline *xtime.Time) (*Response, error) {
+	uo := ParseUrl(req.Uri)
+	if uo == nil {
+		return nil, errbadurl
+	}
+	scheme := uo.Scheme.tolower()
+	if scheme != "http" {
+		return nil, errscheme
+	}
+	port := uo.Port
+	hosthdr := uo.Host
+	if port.len == 0 {
+		port = "80"
+	} else {
+		hosthdr = uo.Host + ":" + port
+	}
+	key := JoinHostPort(unbracket(uo.Host), port)
+	target := "/" + uo.Path
+	if uo.Query.len > 0 {
+		target += "?" + uo.Query
+	}
+
+	for attempt := 0; ; attempt++ {
+		cc, reused, err := cli.getconn(key)
+		if err != nil {
+			return nil, err
+		}
+		rsp, err := cli.roundtrip(cc, req, target, hosthdr, deadline)
+		if err == nil {
+			return rsp, nil
+		}
+		cc.c.Close()
+		// the server may close an idle connection any time, one more try
+		// if it cannot have seen the request, or seeing it twice is fine
+		if !reused || attempt > 0 || !canretry(cc, req) {
+			return nil, err
+		}
+	}
 	return nil, nil
 }
 
-func Get() {
+// nothing went out, or the method is idempotent and no answer came
+func canretry(cc *clientconn, req *Request) bool {
+	if !cc.wrote {
+		return true
+	}
+	if cc.gotrsp {
+		return false
+	}
+	m := req.Method
+	return m == MethodGet || m == MethodHead || m == MethodPut || m == MethodDelete ||
+		m == "OPTIONS" || m == "TRACE"
+}
+
+func (cli *Client) roundtrip(cc *clientconn, req *Request, target string, hosthdr string,
+	deadline *xtime.Time) (*Response, error) {
+	cc.c.SetDeadline(deadline)
 
+	str := req.Method + " " + target + " HTTP/1.1\r\n"
+	str += "Host: " + hosthdr + "\r\n"
+	hasua := false
+	if req.Headers != nil {
+		for k, v := range req.Headers {
+			if k != "Host" && k != "Content-Length" {
+				str += k + ": " + v + "\r\n"
+			}
+			hasua = hasua || k == "User-Agent"
+		}
+	}
+	if !hasua {
+		str += "User-Agent: xgo-xnet\r\n"
+	}
+	bodylen := 0
+	if req.Body != nil {
+		bodylen = req.Body.len
+	}
+	if bodylen > 0 || req.Method == MethodPost || req.Method == MethodPut {
+		str += "Content-Length: " + bodylen.repr() + "\r\n"
+	}
+	str += "\r\n"
+	cc.wrote = false
+	cc.gotrsp = false
+	n, err := cc.c.Write([]byte(str))
+	cc.wrote = n > 0
+	if err == nil && bodylen > 0 {
+		_, err = cc.c.Write(req.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &Response{}
+	rsp.Request = req
+	for {
+		line, err := cc.rd.readline()
+		if err != nil {
+			return nil, err
+		}
+		cc.gotrsp = true
+		if !line.prefixed("HTTP/1.") || line.len < 12 {
+			return nil, errbadstatus
+		}
+		codestr := line[9:12]
+		if !codestr.isdigit() {
+			return nil, errbadstatus
+		}
+		rsp.Stline = line
+		rsp.Proto = line[:8]
+		rsp.Stcode = codestr.toint()
+		rsp.Headers, err = readheaders(cc.rd)
+		if err != nil {
+			return nil, err
+		}
+		if rsp.Stcode != 100 {
+			break // 100 Continue before the real one
+		}
+	}
+
+	body := &Body{}
+	body.cli = cli
+	body.cc = cc
+	body.rd = cc.rd
+	connhdr := rsp.Headers["Connection"]
+	connhdr = connhdr.tolower()
+	if rsp.Proto == "HTTP/1.0" {
+		body.reuse = connhdr.index("keep-alive") >= 0
+	} else {
+		body.reuse = connhdr.index("close") < 0
+	}
+	rsp.Ctlength = -1
+	if req.Method == MethodHead || rsp.Stcode == 204 || rsp.Stcode == 304 ||
+		rsp.Stcode < 200 {
+		rsp.Ctlength = 0
+	} else if ischunked(rsp.Headers) {
+		body.chunked = true
+	} else {
+		n, err := contentlength(rsp.Headers)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			body.left = -1 // until the server closes
+			body.reuse = false
+		} else {
+			body.left = n
+			rsp.Ctlength = i64(n)
+		}
+	}
+	rsp.Body = body
+	return rsp, nil
 }
 
-func Post() {
+// streams a response body off its connection
+type Body struct {
+	cli     *Client
+	cc      *clientconn // nil once given back or closed
+	rd      *connreader
+	chunked bool
+	left    int // of the body, or of the current chunk. -1 to read until close
+	reuse   bool
+	err     error // EOF when done
+}
 
+// EOF at the end
+func (b *Body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.chunked && b.left == 0 {
+		line, err := b.rd.readline()
+		if err != nil {
+			return 0, b.fail(err)
+		}
+		pos := line.index(";")
+		if pos >= 0 {
+			line = line[:pos]
+		}
+		size := parsehex(line.trimsp())
+		if size < 0 {
+			return 0, b.fail(errbadchunk)
+		}
+		if size == 0 {
+			_, err = readheaders(b.rd)
+			if err != nil {
+				return 0, b.fail(err)
+			}
+			b.finish()
+			return 0, xio.EOF
+		}
+		b.left = size
+	}
+	if b.left == 0 {
+		b.finish()
+		return 0, xio.EOF
+	}
+	n := p.len
+	if b.left > 0 && n > b.left {
+		n = b.left
+	}
+	m, err := b.rd.readsome(p, n)
+	if err != nil {
+		if b.left < 0 && err == xio.EOF {
+			b.finish()
+			return 0, xio.EOF
+		}
+		return 0, b.fail(err)
+	}
+	if b.left > 0 {
+		b.left -= m
+		if b.chunked && b.left == 0 {
+			line, err := b.rd.readline()
+			if err != nil {
+				return m, b.fail(err)
+			}
+			if line.len != 0 {
+				return m, b.fail(errbadchunk)
+			}
+		}
+	}
+	return m, nil
 }
 
-func Put() {
+// the whole rest of the body
+func (b *Body) ReadAll() ([]byte, error) {
+	var res []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := b.Read(buf)
+		if n > 0 {
+			part := buf[:n]
+			res = append(res, part...)
+		}
+		if err == xio.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
 
+// reads what is left, up to maxdrainlen, so the connection can be reused
+func (b *Body) Close() error {
+	if b.cc == nil {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	for drained := 0; drained < maxdrainlen && b.cc != nil; {
+		n, err := b.Read(buf)
+		if err != nil {
+			break
+		}
+		drained += n
+	}
+	if b.cc != nil {
+		b.cc.c.Close()
+		b.cc = nil
+	}
+	if b.err == nil {
+		b.err = xerrors.New("http: read on closed response body")
+	}
+	return nil
 }
 
-func Delete() {
+func (b *Body) finish() {
+	b.err = xio.EOF
+	if b.cc == nil {
+		return
+	}
+	if b.reuse && !b.rd.buffered() {
+		b.cli.putconn(b.cc)
+	} else {
+		b.cc.c.Close()
+	}
+	b.cc = nil
+}
+
+func (b *Body) fail(err error) error {
+	b.err = err
+	if b.cc != nil {
+		b.cc.c.Close()
+		b.cc = nil
+	}
+	return err
+}
+
+func Get(uri string) (*Response, error) {
+	return DefaultClient.Do(NewRequest(MethodGet, uri, nil))
+}
+
+func Post(uri string, ctype string, body []byte) (*Response, error) {
+	req := NewRequest(MethodPost, uri, body)
+	req.Headers["Content-Type"] = ctype
+	return DefaultClient.Do(req)
+}
+
+func Put(uri string, ctype string, body []byte) (*Response, error) {
+	req := NewRequest(MethodPut, uri, body)
+	req.Headers["Content-Type"] = ctype
+	return DefaultClient.Do(req)
+}
 
+func Delete(uri string) (*Response, error) {
+	return DefaultClient.Do(NewRequest(MethodDelete, uri, nil))
 }
@@ -0,0 +1,79 @@
+package xnet
+
+import "xgo/xtime"
+
+func readall1(rsp *Response) string {
+	data, err := rsp.Body.ReadAll()
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func test_clientget1() {
+	srv, ln := newtestsrv()
+	base := "http://" + ln.Addr().String()
+
+	rsp, err := Get(base + "/hello/x")
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	println(rsp.Stline, rsp.Ctlength, readall1(rsp)) // HTTP/1.1 200 OK 13 hello /hello/x
+
+	rsp, _ = Post(base+"/echo?q=1", "text/plain", []byte("ping"))
+	println(rsp.Header("x-query"), readall1(rsp)) // q=1 ping
+
+	rsp, _ = Get(base + "/big")
+	data, _ := rsp.Body.ReadAll()
+	println(rsp.Header("Transfer-Encoding"), data.len) // chunked 12800
+
+	rsp, _ = Get(base + "/redir") // to /hello/r
+	println(rsp.Stcode, readall1(rsp), rsp.Request.Uri)
+
+	rsp, _ = Get(base + "/nothere")
+	println(rsp.Stcode)
+	rsp.Body.Close()
+
+	DefaultClient.CloseIdleConnections()
+	srv.Shutdown(2 * xtime.Second)
+}
+
+// keep-alive connections are reused
+func test_clientpool1() {
+	srv, ln := newtestsrv()
+	uri := "http://" + ln.Addr().String() + "/addr"
+	cli := NewClient()
+	rsp, _ := cli.Do(NewRequest(MethodGet, uri, nil))
+	a1 := readall1(rsp)
+	rsp, _ = cli.Do(NewRequest(MethodGet, uri, nil))
+	a2 := readall1(rsp)
+	println(a1 == a2)
+
+	// the pooled one closed by Shutdown, the retry on a new one refused
+	srv.Shutdown(2 * xtime.Second)
+	_, err := cli.Do(NewRequest(MethodGet, uri, nil))
+	// dial tcp 127.0.0.1:N: OSErr 111: Connection refused
+	emsg := err.Error()
+	println(emsg.index("OSErr 111: Connection refused") > 0) // true
+	cli.CloseIdleConnections()
+}
+
+func test_resolveloc1() {
+	println(resolveloc("http://a.b/x/y?z", "w"), resolveloc("http://a.b", "/w"))
+	println(resolveloc("http://a.b/x", "//c.d/e"), resolveloc("http://a.b/x", "http://c.d/"))
+	_, err := Get("https://a.b/")
+	println(err.Error())
+}
+
+// credentials stay on the host they were meant for
+func test_redirecthdrs1() {
+	req := NewRequest(MethodGet, "http://a.b/x", nil)
+	req.Headers["Authorization"] = "Basic eDp5"
+	req.Headers["Cookie"] = "k=v"
+	req.Headers["Accept"] = "*/*"
+	req2 := redirectreq(req, 302, "/y")
+	println(len(req2.Headers)) // 3
+	req2 = redirectreq(req, 302, "http://c.d/y")
+	println(len(req2.Headers), req2.Headers["Accept"]) // 1 */*
+}
@@ -1,8 +1,377 @@
 package xnet
 
+import "xgo/xerrors"
+
 const (
 	MethodGet    = "GET"
+	MethodHead   = "HEAD"
 	MethodPost   = "POST"
 	MethodPut    = "PUT"
 	MethodDelete = "DELETE"
 )
+
+const (
+	maxlinelen = 8192
+	maxheaders = 128
+)
+
+var errlinetoolong = xerrors.New("http: line too long")
+var errtoomanyhdrs = xerrors.New("http: too many headers")
+var errbadheader = xerrors.New("http: malformed header line")
+var errbadlength = xerrors.New("http: bad Content-Length")
+var errbadchunk = xerrors.New("http: malformed chunked body")
+var errbodytoolarge = xerrors.New("http: body too large")
+
+type Request struct {
+	Method  string
+	Headers map[string]string // canonical keys, Content-Type
+	Uri     string            // full url for Client, /path?query on server side
+	Body    []byte
+
+	// server side
+	Proto      string // HTTP/1.1
+	Path       string
+	Query      string // without ?
+	Host       string
+	RemoteAddr string
+	Close      bool // no more requests on this connection
+}
+
+// "" if not set
+func (r *Request) Header(key string) string {
+	if r.Headers == nil {
+		return ""
+	}
+	return r.Headers[canonicalkey(key)]
+}
+
+// Content-Type => Content-Type, content-type => Content-Type
+func canonicalkey(key string) string {
+	buf := make([]byte, key.len)
+	upper := true
+	for i := 0; i < key.len; i++ {
+		ch := key[i]
+		if upper && ch >= 'a' && ch <= 'z' {
+			ch -= 'a' - 'A'
+		} else if !upper && ch >= 'A' && ch <= 'Z' {
+			ch += 'a' - 'A'
+		}
+		buf[i] = ch
+		upper = ch == '-'
+	}
+	return string(buf)
+}
+
+// buffered reads over a Conn, shared by request and response parsing
+type connreader struct {
+	c   Conn
+	buf []byte
+	pos int
+	end int
+}
+
+func newconnreader(c Conn) *connreader {
+	rd := &connreader{}
+	rd.c = c
+	rd.buf = make([]byte, 4096)
+	return rd
+}
+
+// true if some bytes read but not consumed yet
+func (rd *connreader) buffered() bool { return rd.pos < rd.end }
+
+func (rd *connreader) fill() error {
+	n, err := rd.c.Read(rd.buf)
+	if err != nil {
+		return err
+	}
+	rd.pos = 0
+	rd.end = n
+	return nil
+}
+
+// a line without \r\n
+func (rd *connreader) readline() (string, error) {
+	var line []byte
+	for {
+		if rd.pos == rd.end {
+			err := rd.fill()
+			if err != nil {
+				return "", err
+			}
+		}
+		for i := rd.pos; i < rd.end; i++ {
+			if rd.buf[i] == '\n' {
+				part := rd.buf[rd.pos:i]
+				line = append(line, part...)
+				rd.pos = i + 1
+				if line.len > 0 && line[line.len-1] == '\r' {
+					line = line[:line.len-1]
+				}
+				return string(line), nil
+			}
+		}
+		part := rd.buf[rd.pos:rd.end]
+		line = append(line, part...)
+		rd.pos = rd.end
+		if line.len > maxlinelen {
+			return "", errlinetoolong
+		}
+	}
+	return "", nil
+}
+
+// exactly n bytes
+func (rd *connreader) readn(n int) ([]byte, error) {
+	var res []byte
+	for res.len < n {
+		if rd.pos == rd.end {
+			err := rd.fill()
+			if err != nil {
+				return res, err
+			}
+		}
+		m := rd.end - rd.pos
+		if m > n-res.len {
+			m = n - res.len
+		}
+		part := rd.buf[rd.pos : rd.pos+m]
+		res = append(res, part...)
+		rd.pos += m
+	}
+	return res, nil
+}
+
+// up to n bytes into p, at least one unless error
+func (rd *connreader) readsome(p []byte, n int) (int, error) {
+	if rd.pos == rd.end {
+		err := rd.fill()
+		if err != nil {
+			return 0, err
+		}
+	}
+	m := rd.end - rd.pos
+	if m > n {
+		m = n
+	}
+	memcpy3(p.ptr, voidptr(usize(rd.buf.ptr)+usize(rd.pos)), m)
+	rd.pos += m
+	return m, nil
+}
+
+// header lines up to the empty line, repeated keys joined with ", "
+func readheaders(rd *connreader) (map[string]string, error) {
+	hdrs := map[string]string{}
+	for cnt := 0; ; cnt++ {
+		line, err := rd.readline()
+		if err != nil {
+			return hdrs, err
+		}
+		if line.len == 0 {
+			break
+		}
+		if cnt >= maxheaders {
+			return hdrs, errtoomanyhdrs
+		}
+		pos := line.index(":")
+		if pos <= 0 {
+			return hdrs, errbadheader
+		}
+		key := canonicalkey(line[:pos].trimsp())
+		val := line[pos+1:].trimsp()
+		old := hdrs[key]
+		if old.len > 0 {
+			val = old + ", " + val
+		}
+		hdrs[key] = val
+	}
+	return hdrs, nil
+}
+
+// -1 if not a hex number
+func parsehex(s string) int {
+	if s.len == 0 || s.len > 15 {
+		return -1
+	}
+	n := 0
+	for i := 0; i < s.len; i++ {
+		ch := s[i]
+		if ch >= '0' && ch <= '9' {
+			n = n*16 + int(ch-'0')
+		} else if ch >= 'a' && ch <= 'f' {
+			n = n*16 + int(ch-'a') + 10
+		} else if ch >= 'A' && ch <= 'F' {
+			n = n*16 + int(ch-'A') + 10
+		} else {
+			return -1
+		}
+	}
+	return n
+}
+
+func ischunked(hdrs map[string]string) bool {
+	te := hdrs["Transfer-Encoding"]
+	return te.tolower().index("chunked") >= 0
+}
+
+// -1 if no Content-Length
+func contentlength(hdrs map[string]string) (int, error) {
+	cl := hdrs["Content-Length"]
+	if cl.len == 0 {
+		return -1, nil
+	}
+	if !cl.isdigit() {
+		return -1, errbadlength
+	}
+	return cl.toint(), nil
+}
+
+// by Transfer-Encoding: chunked or Content-Length, nil if neither.
+// maxlen 0 for no limit
+func readbody(rd *connreader, hdrs map[string]string, maxlen int) ([]byte, error) {
+	if ischunked(hdrs) {
+		return readchunked(rd, maxlen)
+	}
+	var empty []byte
+	n, err := contentlength(hdrs)
+	if err != nil || n <= 0 {
+		return empty, err
+	}
+	if maxlen > 0 && n > maxlen {
+		return empty, errbodytoolarge
+	}
+	return rd.readn(n)
+}
+
+func readchunked(rd *connreader, maxlen int) ([]byte, error) {
+	var body []byte
+	for {
+		line, err := rd.readline()
+		if err != nil {
+			return body, err
+		}
+		pos := line.index(";") // chunk extensions ignored
+		if pos >= 0 {
+			line = line[:pos]
+		}
+		size := parsehex(line.trimsp())
+		if size < 0 {
+			return body, errbadchunk
+		}
+		if size == 0 {
+			_, err = readheaders(rd) // trailers, dropped
+			return body, err
+		}
+		if maxlen > 0 && body.len+size > maxlen {
+			return body, errbodytoolarge
+		}
+		data, err := rd.readn(size)
+		if err != nil {
+			return body, err
+		}
+		body = append(body, data...)
+		line, err = rd.readline()
+		if err != nil {
+			return body, err
+		}
+		if line.len != 0 {
+			return body, errbadchunk
+		}
+	}
+	return body, nil
+}
+
+func StatusText(code int) string {
+	switch code {
+	case 100:
+		return "Continue"
+	case 101:
+		return "Switching Protocols"
+	case 200:
+		return "OK"
+	case 201:
+		return "Created"
+	case 202:
+		return "Accepted"
+	case 204:
+		return "No Content"
+	case 206:
+		return "Partial Content"
+	case 301:
+		return "Moved Permanently"
+	case 302:
+		return "Found"
+	case 304:
+		return "Not Modified"
+	case 307:
+		return "Temporary Redirect"
+	case 308:
+		return "Permanent Redirect"
+	case 400:
+		return "Bad Request"
+	case 401:
+		return "Unauthorized"
+	case 403:
+		return "Forbidden"
+	case 404:
+		return "Not Found"
+	case 405:
+		return "Method Not Allowed"
+	case 408:
+		return "Request Timeout"
+	case 411:
+		return "Length Required"
+	case 413:
+		return "Request Entity Too Large"
+	case 414:
+		return "Request URI Too Long"
+	case 431:
+		return "Request Header Fields Too Large"
+	case 500:
+		return "Internal Server Error"
+	case 501:
+		return "Not Implemented"
+	case 502:
+		return "Bad Gateway"
+	case 503:
+		return "Service Unavailable"
+	case 504:
+		return "Gateway Timeout"
+	case 505:
+		return "HTTP Version Not Supported"
+	}
+	return "Status " + code.repr()
+}
+
+// sorted, so headers go out in the same order every time
+func sortedkeys(m map[string]string) []string {
+	keys := make([]string, 0)
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+	for i := 1; i < keys.len; i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			k := keys[j]
+			keys[j] = keys[j-1]
+			keys[j-1] = k
+		}
+	}
+	return keys
+}
+
+// lower case, no 0x
+func hexrepr(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	digits := "0123456789abcdef"
+	buf := make([]byte, 16)
+	i := 16
+	for n > 0 {
+		i--
+		buf[i] = digits[n%16]
+		n /= 16
+	}
+	part := buf[i:]
+	return string(part)
+}
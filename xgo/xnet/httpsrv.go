@@ -1 +1,495 @@
 package xnet
+
+import (
+	"xgo/xcontext"
+	"xgo/xerrors"
+	"xgo/xsync"
+	"xgo/xtime"
+)
+
+// HTTP/1.1 server, one fiber per connection.
+// a request is read whole, body included, before its handler runs.
+// responses are buffered up to respbufsz, bigger ones go out chunked.
+
+type Handler interface {
+	ServeHTTP(w ResponseWriter, r *Request)
+}
+
+type ResponseWriter interface {
+	Header() map[string]string // set before the first Write
+	Write(b []byte) (int, error)
+	WriteHeader(code int)
+}
+
+var ErrServerClosed = xerrors.New("http: Server closed")
+var ErrShutdownTimeout = xerrors.New("http: Shutdown timed out")
+
+const (
+	respbufsz  = 4096
+	defmaxbody = 8 << 20
+)
+
+type funchandler struct {
+	f func(w ResponseWriter, r *Request)
+}
+
+func (h *funchandler) ServeHTTP(w ResponseWriter, r *Request) {
+	f := h.f
+	f(w, r)
+}
+
+func HandlerFunc(f func(w ResponseWriter, r *Request)) Handler {
+	h := &funchandler{}
+	h.f = f
+	return h
+}
+
+func Error(w ResponseWriter, msg string, code int) {
+	hdrs := w.Header()
+	hdrs["Content-Type"] = "text/plain; charset=utf-8"
+	w.WriteHeader(code)
+	w.Write([]byte(msg + "\n"))
+}
+
+func NotFound(w ResponseWriter, r *Request) {
+	Error(w, "404 page not found", 404)
+}
+
+// patterns ending with / match the whole subtree, others the exact path.
+// the longest matching pattern wins.
+type ServeMux struct {
+	patterns []string
+	handlers []Handler
+}
+
+func NewServeMux() *ServeMux {
+	mux := &ServeMux{}
+	mux.patterns = make([]string, 0)
+	mux.handlers = make([]Handler, 0)
+	return mux
+}
+
+var DefaultServeMux = NewServeMux()
+
+func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	for i, pat := range mux.patterns {
+		if pat == pattern {
+			mux.handlers[i] = handler
+			return
+		}
+	}
+	mux.patterns = append(mux.patterns, pattern)
+	mux.handlers = append(mux.handlers, handler)
+}
+
+func (mux *ServeMux) HandleFunc(pattern string, f func(w ResponseWriter, r *Request)) {
+	mux.Handle(pattern, HandlerFunc(f))
+}
+
+// nil if no pattern matches
+func (mux *ServeMux) match(path string) Handler {
+	var h Handler
+	matchlen := -1
+	for i, pat := range mux.patterns {
+		if pat.len <= matchlen {
+			continue
+		}
+		if pat == path || (pat.suffixed("/") && path.prefixed(pat)) {
+			h = mux.handlers[i]
+			matchlen = pat.len
+		}
+	}
+	return h
+}
+
+func (mux *ServeMux) ServeHTTP(w ResponseWriter, r *Request) {
+	h := mux.match(r.Path)
+	if h == nil {
+		NotFound(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+func Handle(pattern string, handler Handler) {
+	DefaultServeMux.Handle(pattern, handler)
+}
+
+func HandleFunc(pattern string, f func(w ResponseWriter, r *Request)) {
+	DefaultServeMux.HandleFunc(pattern, f)
+}
+
+type response struct {
+	c        Conn
+	req      *Request
+	headers  map[string]string
+	status   int
+	wrotehdr bool // status line and headers sent
+	chunked  bool
+	buf      []byte
+	err      error // first write error, the connection is dropped then
+}
+
+func newresponse(c Conn, req *Request) *response {
+	w := &response{}
+	w.c = c
+	w.req = req
+	w.headers = map[string]string{}
+	w.buf = make([]byte, 0)
+	return w
+}
+
+func (w *response) Header() map[string]string { return w.headers }
+
+// only the first call counts
+func (w *response) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *response) bodyallowed() bool {
+	if w.req.Method == MethodHead {
+		return false
+	}
+	return w.status >= 200 && w.status != 204 && w.status != 304
+}
+
+func (w *response) Write(b []byte) (int, error) {
+	w.WriteHeader(200)
+	if w.err != nil {
+		return 0, w.err
+	}
+	if !w.bodyallowed() {
+		return b.len, nil
+	}
+	w.buf = append(w.buf, b...)
+	if w.buf.len >= respbufsz {
+		if !w.wrotehdr {
+			w.chunked = true
+			w.sendheader(-1)
+		}
+		w.sendchunk()
+	}
+	return b.len, w.err
+}
+
+func (w *response) send(s string) {
+	if w.err != nil {
+		return
+	}
+	_, err := w.c.Write([]byte(s))
+	if err != nil {
+		w.err = err
+	}
+}
+
+// ctlen -1 for chunked
+func (w *response) sendheader(ctlen int) {
+	w.wrotehdr = true
+	hdrs := w.headers
+	if w.chunked {
+		hdrs["Transfer-Encoding"] = "chunked"
+		delete(hdrs, "Content-Length")
+	} else if ctlen >= 0 && w.bodyallowed() {
+		hdrs["Content-Length"] = ctlen.repr()
+	}
+	if w.req.Close {
+		hdrs["Connection"] = "close"
+	} else if w.req.Proto == "HTTP/1.0" {
+		hdrs["Connection"] = "keep-alive"
+	}
+	ctype := hdrs["Content-Type"]
+	if ctype.len == 0 && w.bodyallowed() {
+		hdrs["Content-Type"] = "text/plain; charset=utf-8"
+	}
+
+	str := "HTTP/1.1 " + w.status.repr() + " " + StatusText(w.status) + "\r\n"
+	for _, k := range sortedkeys(hdrs) {
+		str += k + ": " + hdrs[k] + "\r\n"
+	}
+	str += "\r\n"
+	w.send(str)
+}
+
+func (w *response) sendchunk() {
+	if w.buf.len == 0 {
+		return
+	}
+	w.send(hexrepr(w.buf.len) + "\r\n")
+	if w.err == nil {
+		_, w.err = w.c.Write(w.buf)
+	}
+	w.send("\r\n")
+	w.buf = make([]byte, 0)
+}
+
+// after the handler returned
+func (w *response) finish() {
+	w.WriteHeader(200)
+	if !w.wrotehdr {
+		w.sendheader(w.buf.len)
+		if w.buf.len > 0 && w.err == nil {
+			_, w.err = w.c.Write(w.buf)
+		}
+	} else if w.chunked {
+		w.sendchunk()
+		w.send("0\r\n\r\n")
+	}
+}
+
+type Server struct {
+	Addr         string  // :80 if empty
+	Handler      Handler // DefaultServeMux if nil
+	ReadTimeout  xtime.Duration
+	WriteTimeout xtime.Duration
+	IdleTimeout  xtime.Duration // between keep-alive requests
+	MaxBodyBytes int            // 8M if 0
+
+	ln      Listener
+	ctx     *xcontext.Context // canceled by Shutdown, Accept and idle reads bound to it
+	cancel  xcontext.CancelFunc
+	drained chan int // a wakeup for Shutdown when Serve or a connection ends
+	closing int      // atomic, set by Shutdown
+	serving int      // atomic, Serve running
+	nconns  int      // atomic, connections open
+}
+
+func ListenAndServe(addr string, handler Handler) error {
+	srv := &Server{}
+	srv.Addr = addr
+	srv.Handler = handler
+	return srv.ListenAndServe()
+}
+
+func (srv *Server) ListenAndServe() error {
+	addr := srv.Addr
+	if addr.len == 0 {
+		addr = ":80"
+	}
+	ln, err := Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// until Shutdown, which makes it return ErrServerClosed. ln is closed then
+func (srv *Server) Serve(ln Listener) error {
+	srv.ln = ln
+	srv.ctx, srv.cancel = xcontext.WithCancel(xcontext.Background())
+	srv.drained = make(chan int, 1)
+	xsync.Setint(&srv.serving, 1)
+	var err error
+	for xsync.Getint(&srv.closing) == 0 {
+		unbind := srv.ctx.Bind()
+		c, err1 := ln.Accept()
+		unbind()
+		if xsync.Getint(&srv.closing) != 0 {
+			if err1 == nil {
+				c.Close()
+			}
+			break
+		}
+		if err1 != nil {
+			err = err1
+			break
+		}
+		xsync.Addint(&srv.nconns, 1)
+		go serveconn(srv, c)
+	}
+	ln.Close()
+	xsync.Setint(&srv.serving, 0)
+	srv.wakedrained()
+	if err != nil {
+		return err
+	}
+	return ErrServerClosed
+}
+
+// never blocks, one pending wakeup is enough as Shutdown rechecks
+func (srv *Server) wakedrained() {
+	select {
+	case srv.drained <- 1:
+	default:
+	}
+}
+
+// stops accepting, then waits for open connections to finish their
+// current request. idle ones are closed. timeout 0 to wait forever
+func (srv *Server) Shutdown(timeout xtime.Duration) error {
+	xsync.Setint(&srv.closing, 1)
+	if srv.cancel == nil {
+		return nil // never served
+	}
+	cancel := srv.cancel
+	cancel()
+
+	tctx, tcancel := xcontext.WithCancel(xcontext.Background())
+	if timeout > 0 {
+		tctx, tcancel = xcontext.WithTimeout(xcontext.Background(), timeout)
+	}
+	var err error
+	for xsync.Getint(&srv.nconns) > 0 || xsync.Getint(&srv.serving) != 0 {
+		select {
+		case <-srv.drained:
+		case <-tctx.Done():
+			err = ErrShutdownTimeout
+		}
+		if err != nil {
+			break
+		}
+	}
+	tcancel()
+	return err
+}
+
+func (srv *Server) handler() Handler {
+	if srv.Handler == nil {
+		return DefaultServeMux
+	}
+	return srv.Handler
+}
+
+func serveconn(srv *Server, c Conn) {
+	rd := newconnreader(c)
+	for waitrequest(srv, c, rd) {
+		if srv.ReadTimeout > 0 {
+			c.SetReadDeadline(xtime.Now().Add(srv.ReadTimeout))
+		} else {
+			c.SetReadDeadline(nil)
+		}
+		req, code := readrequest(srv, c, rd)
+		if req == nil {
+			if code > 0 {
+				writeerror(c, code)
+			}
+			break
+		}
+		if xsync.Getint(&srv.closing) != 0 {
+			req.Close = true
+		}
+		if srv.WriteTimeout > 0 {
+			c.SetWriteDeadline(xtime.Now().Add(srv.WriteTimeout))
+		}
+		w := newresponse(c, req)
+		h := srv.handler()
+		h.ServeHTTP(w, req)
+		w.finish()
+		if w.err != nil || req.Close {
+			break
+		}
+	}
+	c.Close()
+	xsync.Addint(&srv.nconns, -1)
+	srv.wakedrained()
+}
+
+// until the next request starts coming.
+// false on close, idle timeout or Shutdown, which interrupts the read
+func waitrequest(srv *Server, c Conn, rd *connreader) bool {
+	if rd.buffered() {
+		return true // pipelined
+	}
+	if srv.IdleTimeout > 0 {
+		c.SetReadDeadline(xtime.Now().Add(srv.IdleTimeout))
+	} else {
+		c.SetReadDeadline(nil)
+	}
+	unbind := srv.ctx.Bind()
+	err := rd.fill()
+	unbind()
+	return err == nil
+}
+
+// nil and the status to answer with, 0 to just drop the connection
+func readrequest(srv *Server, c Conn, rd *connreader) (*Request, int) {
+	line, err := rd.readline()
+	if err != nil {
+		if err == errlinetoolong {
+			return nil, 414
+		}
+		return nil, 0
+	}
+	fields := line.split(" ")
+	if fields.len != 3 {
+		return nil, 400
+	}
+	req := &Request{}
+	req.Method = fields[0]
+	req.Uri = fields[1]
+	req.Proto = fields[2]
+	if req.Proto != "HTTP/1.1" && req.Proto != "HTTP/1.0" {
+		return nil, 505
+	}
+	req.RemoteAddr = c.RemoteAddr().String()
+
+	uri := req.Uri
+	if uri.prefixed("http://") || uri.prefixed("https://") {
+		// absolute form, from proxies
+		uri = uri[uri.index("//")+2:]
+		pos := uri.index("/")
+		if pos < 0 {
+			uri = "/"
+		} else {
+			uri = uri[pos:]
+		}
+	}
+	pos := uri.index("?")
+	if pos >= 0 {
+		req.Path = uri[:pos]
+		req.Query = uri[pos+1:]
+	} else {
+		req.Path = uri
+	}
+
+	req.Headers, err = readheaders(rd)
+	if err != nil {
+		if err == errlinetoolong || err == errtoomanyhdrs {
+			return nil, 431
+		}
+		if err == errbadheader {
+			return nil, 400
+		}
+		return nil, 0
+	}
+	req.Host = req.Headers["Host"]
+	connhdr := req.Headers["Connection"]
+	connhdr = connhdr.tolower()
+	if req.Proto == "HTTP/1.0" {
+		req.Close = connhdr.index("keep-alive") < 0
+	} else {
+		req.Close = connhdr.index("close") >= 0
+	}
+
+	expect := req.Headers["Expect"]
+	expect = expect.tolower()
+	if expect == "100-continue" && req.Proto == "HTTP/1.1" {
+		c.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+	}
+	maxbody := srv.MaxBodyBytes
+	if maxbody == 0 {
+		maxbody = defmaxbody
+	}
+	req.Body, err = readbody(rd, req.Headers, maxbody)
+	if err != nil {
+		if err == errbodytoolarge {
+			return nil, 413
+		}
+		if err == errbadlength || err == errbadchunk || err == errbadheader {
+			return nil, 400
+		}
+		return nil, 0
+	}
+	return req, 0
+}
+
+// for requests that never reach a handler
+func writeerror(c Conn, code int) {
+	msg := StatusText(code) + "\n"
+	str := "HTTP/1.1 " + code.repr() + " " + StatusText(code) + "\r\n"
+	str += "Content-Type: text/plain; charset=utf-8\r\n"
+	str += "Content-Length: " + msg.len.repr() + "\r\n"
+	str += "Connection: close\r\n\r\n" + msg
+	c.Write([]byte(str))
+}
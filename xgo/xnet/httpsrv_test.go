@@ -0,0 +1,107 @@
+package xnet
+
+import (
+	"xgo/xio"
+	"xgo/xtime"
+)
+
+func hello1(w ResponseWriter, r *Request) {
+	w.Write([]byte("hello " + r.Path))
+}
+
+func echo1(w ResponseWriter, r *Request) {
+	hdrs := w.Header()
+	hdrs["X-Query"] = r.Query
+	w.Write(r.Body)
+}
+
+func redir1(w ResponseWriter, r *Request) {
+	hdrs := w.Header()
+	hdrs["Location"] = "hello/r"
+	w.WriteHeader(302)
+}
+
+// more than respbufsz, goes out chunked
+func big1(w ResponseWriter, r *Request) {
+	line := []byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcde\n")
+	for i := 0; i < 200; i++ {
+		w.Write(line)
+	}
+}
+
+func addr1(w ResponseWriter, r *Request) {
+	w.Write([]byte(r.RemoteAddr))
+}
+
+func newtestsrv() (*Server, Listener) {
+	mux := NewServeMux()
+	mux.HandleFunc("/hello/", hello1)
+	mux.HandleFunc("/echo", echo1)
+	mux.HandleFunc("/redir", redir1)
+	mux.HandleFunc("/big", big1)
+	mux.HandleFunc("/addr", addr1)
+	srv := &Server{}
+	srv.Handler = mux
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		println(err.Error())
+		return nil, nil
+	}
+	go func() {
+		err := srv.Serve(ln)
+		println(err.Error()) // http: Server closed
+	}()
+	return srv, ln
+}
+
+// whole response to one request, until the peer closes
+func roundtrip1(addr string, reqstr string) string {
+	c, err := Dial("tcp", addr)
+	if err != nil {
+		return err.Error()
+	}
+	c.Write([]byte(reqstr))
+	var res []byte
+	buf := make([]byte, 512)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			break
+		}
+		part := buf[:n]
+		res = append(res, part...)
+	}
+	c.Close()
+	return string(res)
+}
+
+func test_servemux1() {
+	srv, ln := newtestsrv()
+	addr := ln.Addr().String()
+
+	// keep-alive, both answered on one connection
+	println(roundtrip1(addr, "GET /hello/a HTTP/1.1\r\nHost: x\r\n\r\n"+
+		"GET /nothere HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	println(roundtrip1(addr, "POST /echo?a=1 HTTP/1.1\r\nHost: x\r\n"+
+		"Transfer-Encoding: chunked\r\nConnection: close\r\n\r\n"+
+		"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"))
+	println(roundtrip1(addr, "BAD\r\n\r\n")) // 400
+	println(srv.Shutdown(2*xtime.Second) == nil)
+}
+
+func test_shutdown1() {
+	srv, ln := newtestsrv()
+	c, _ := Dial("tcp", ln.Addr().String()) // stays idle
+	btime := xtime.Now()
+	err := srv.Shutdown(0)
+	println(err == nil, xtime.Since(btime) < xtime.Second)
+	buf := make([]byte, 16)
+	_, err = c.Read(buf)
+	println(err == xio.EOF)
+	c.Close()
+}
+
+func test_canonicalkey1() {
+	println(canonicalkey("content-TYPE"), canonicalkey("x-forwarded-for"))
+	println(parsehex("1aF"), parsehex("x"), hexrepr(4096))
+}
@@ -1,11 +1,35 @@
 package xnet
 
+import "xgo/xtime"
+
+type Addr interface {
+	Network() string // tcp, udp, unix ...
+	String() string  // host:port, or the unix socket path
+}
+
 type Listener interface {
-	Accept() (int, error)
+	Accept() (Conn, error)
+	Close() error
+	Addr() Addr
 }
 
 type Conn interface {
 	Read(b []byte) (int, error)
 	Write(b []byte) (int, error)
 	Close() error
+	LocalAddr() Addr
+	RemoteAddr() Addr
+	SetDeadline(t *xtime.Time) error
+	SetReadDeadline(t *xtime.Time) error
+	SetWriteDeadline(t *xtime.Time) error
+}
+
+type PacketConn interface {
+	ReadFrom(b []byte) (int, Addr, error)
+	WriteTo(b []byte, addr Addr) (int, error)
+	Close() error
+	LocalAddr() Addr
+	SetDeadline(t *xtime.Time) error
+	SetReadDeadline(t *xtime.Time) error
+	SetWriteDeadline(t *xtime.Time) error
 }
@@ -0,0 +1,509 @@
+package xnet
+
+/*
+#include <errno.h>
+#include <string.h>
+#include <unistd.h>
+#include <poll.h>
+#include <sys/socket.h>
+#include <sys/un.h>
+#include <netinet/in.h>
+#include <arpa/inet.h>
+#include <netdb.h>
+
+static int xnet_errno() { return errno; }
+
+// numeric ip of host to ipbuf, family AF_INET/AF_INET6/AF_UNSPEC, 0 or EAI_xxx
+static int xnet_resolve(const char* host, int family, char* ipbuf, int buflen) {
+    struct addrinfo hints;
+    struct addrinfo* res = 0;
+    memset(&hints, 0, sizeof(hints));
+    hints.ai_family = family;
+    int rv = getaddrinfo(host, 0, &hints, &res);
+    if (rv != 0) return rv;
+    void* addr = res->ai_family == AF_INET6 ?
+        (void*)&((struct sockaddr_in6*)res->ai_addr)->sin6_addr :
+        (void*)&((struct sockaddr_in*)res->ai_addr)->sin_addr;
+    inet_ntop(res->ai_family, addr, ipbuf, buflen);
+    freeaddrinfo(res);
+    return 0;
+}
+
+// sockaddr of numeric ip ("" for any) and port, or of a unix path to buf,
+// which has room for a sockaddr_storage. gives the length, 0 if invalid.
+static int xnet_sockaddr(void* buf, int family, const char* ip, int port) {
+    memset(buf, 0, sizeof(struct sockaddr_storage));
+    if (family == AF_UNIX) {
+        struct sockaddr_un* sa = buf;
+        if (strlen(ip) >= sizeof(sa->sun_path)) return 0;
+        sa->sun_family = AF_UNIX;
+        strcpy(sa->sun_path, ip);
+        return sizeof(*sa);
+    }
+    if (family == AF_INET6) {
+        struct sockaddr_in6* sa = buf;
+        sa->sin6_family = AF_INET6;
+        sa->sin6_port = htons(port);
+        if (ip[0] == 0) sa->sin6_addr = in6addr_any;
+        else if (inet_pton(AF_INET6, ip, &sa->sin6_addr) != 1) return 0;
+        return sizeof(*sa);
+    }
+    struct sockaddr_in* sa = buf;
+    sa->sin_family = AF_INET;
+    sa->sin_port = htons(port);
+    if (ip[0] == 0) sa->sin_addr.s_addr = htonl(INADDR_ANY);
+    else if (inet_pton(AF_INET, ip, &sa->sin_addr) != 1) return 0;
+    return sizeof(*sa);
+}
+
+// ip or unix path of the sockaddr in buf to ipbuf, its family to *family,
+// gives the port
+static int xnet_sockaddr_ip(void* buf, char* ipbuf, int buflen, int* family) {
+    struct sockaddr* sa = buf;
+    ipbuf[0] = 0;
+    *family = sa->sa_family;
+    switch (sa->sa_family) {
+    case AF_INET:
+        inet_ntop(AF_INET, &((struct sockaddr_in*)sa)->sin_addr, ipbuf, buflen);
+        return ntohs(((struct sockaddr_in*)sa)->sin_port);
+    case AF_INET6:
+        inet_ntop(AF_INET6, &((struct sockaddr_in6*)sa)->sin6_addr, ipbuf, buflen);
+        return ntohs(((struct sockaddr_in6*)sa)->sin6_port);
+    case AF_UNIX:
+        strncpy(ipbuf, ((struct sockaddr_un*)sa)->sun_path, buflen - 1);
+        ipbuf[buflen - 1] = 0;
+        return 0;
+    }
+    return 0;
+}
+
+static int xnet_sockname(int fd, void* buf, int peer) {
+    socklen_t len = sizeof(struct sockaddr_storage);
+    memset(buf, 0, len);
+    return peer ? getpeername(fd, buf, &len) : getsockname(fd, buf, &len);
+}
+
+static int xnet_recvfrom(int fd, void* p, int n, void* buf) {
+    socklen_t len = sizeof(struct sockaddr_storage);
+    return recvfrom(fd, p, n, 0, buf, &len);
+}
+
+// hooked by corona, yields the fiber
+static int xnet_poll1(int fd, int events, int timeoms) {
+    struct pollfd pfd;
+    pfd.fd = fd;
+    pfd.events = events;
+    pfd.revents = 0;
+    return poll(&pfd, 1, timeoms);
+}
+
+static int xnet_reuseaddr(int fd) {
+    int val = 1;
+    return setsockopt(fd, SOL_SOCKET, SO_REUSEADDR, &val, sizeof(val));
+}
+*/
+import "C"
+import (
+	"xgo/xerrors"
+	"xgo/xio"
+	"xgo/xos"
+	"xgo/xtime"
+)
+
+// net style Dial/Listen over tcp, tcp4, tcp6, udp, udp4, udp6 and unix.
+// the socket calls are hooked by corona, they block only the calling
+// fiber. errors carry errno, see xos.NewSyscallError.
+
+const sockaddrsz = 128 // sizeof(struct sockaddr_storage)
+
+// Read or Write after the deadline set by SetDeadline
+var ErrDeadlineExceeded = xerrors.New("i/o timeout")
+
+func neterror(op string) error {
+	return xos.NewSyscallError(op, C.xnet_errno())
+}
+
+type sockaddr struct {
+	network  string
+	family   int
+	socktype int
+	ip       string // or unix path
+	port     int
+}
+
+func (a *sockaddr) Network() string { return a.network }
+
+func (a *sockaddr) String() string {
+	if a.family == C.AF_UNIX {
+		return a.ip
+	}
+	return JoinHostPort(a.ip, a.port.repr())
+}
+
+// to buf of sockaddrsz, gives the length, 0 if invalid
+func (a *sockaddr) tosys(buf voidptr) int {
+	return C.xnet_sockaddr(buf, a.family, a.ip.cstr(), a.port)
+}
+
+// host:port or [host]:port
+func SplitHostPort(hostport string) (string, string, error) {
+	pos := hostport.rindex(":")
+	if pos < 0 {
+		return "", "", xerrors.New("missing port in address " + hostport)
+	}
+	host := hostport[:pos]
+	port := hostport[pos+1:]
+	if host.prefixed("[") && host.suffixed("]") {
+		host = host[1 : host.len-1]
+	} else if host.index(":") >= 0 {
+		return "", "", xerrors.New("too many colons in address " + hostport)
+	}
+	return host, port, nil
+}
+
+func JoinHostPort(host string, port string) string {
+	if host.index(":") >= 0 {
+		return "[" + host + "]:" + port
+	}
+	return host + ":" + port
+}
+
+// address of network, a host name is resolved to its first ip
+func resolveaddr(op string, network string, address string) (*sockaddr, error) {
+	a := &sockaddr{}
+	a.network = network
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		a.socktype = C.SOCK_STREAM
+	case "udp", "udp4", "udp6":
+		a.socktype = C.SOCK_DGRAM
+	case "unix":
+		a.family = C.AF_UNIX
+		a.socktype = C.SOCK_STREAM
+		a.ip = address
+		return a, nil
+	default:
+		return nil, xos.NewSyscallError(op+" "+network, C.EAFNOSUPPORT)
+	}
+
+	host, port, err := SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if port.len > 0 {
+		if !port.isdigit() {
+			return nil, xerrors.New(op + " " + address + ": invalid port")
+		}
+		a.port = port.toint()
+	}
+	family := C.AF_UNSPEC
+	if network.suffixed("4") {
+		family = C.AF_INET
+	} else if network.suffixed("6") {
+		family = C.AF_INET6
+	}
+	if host.len > 0 {
+		ipbuf := malloc3(64)
+		rv := C.xnet_resolve(host.cstr(), family, ipbuf, 64)
+		if rv != 0 {
+			return nil, xerrors.New(op + " " + address + ": " + gostring(C.gai_strerror(rv)))
+		}
+		a.ip = gostring(ipbuf)
+	}
+	if family == C.AF_UNSPEC {
+		family = C.AF_INET
+		if a.ip.index(":") >= 0 {
+			family = C.AF_INET6
+		}
+	}
+	a.family = family
+	return a, nil
+}
+
+// of the socket fd, peer or local
+func sysaddr(network string, socktype int, fd int, peer bool) *sockaddr {
+	a := &sockaddr{}
+	a.network = network
+	a.socktype = socktype
+	buf := malloc3(sockaddrsz)
+	rv := C.xnet_sockname(fd, buf, peer)
+	if rv != 0 {
+		return a
+	}
+	return addrof(a, buf)
+}
+
+// fills a from the sockaddr in buf
+func addrof(a *sockaddr, buf voidptr) *sockaddr {
+	ipbuf := malloc3(sockaddrsz)
+	family := 0
+	a.port = C.xnet_sockaddr_ip(buf, ipbuf, sockaddrsz, &family)
+	a.family = family
+	a.ip = gostring(ipbuf)
+	return a
+}
+
+// socket of a, bound to it if bind, else connected
+func sysocket(op string, a *sockaddr, bind bool) (int, error) {
+	buf := malloc3(sockaddrsz)
+	salen := a.tosys(buf)
+	if salen == 0 {
+		return -1, xos.NewSyscallError(op+" "+a.String(), C.EINVAL)
+	}
+	fd := C.socket(a.family, a.socktype, 0)
+	if fd < 0 {
+		return -1, neterror(op + " " + a.network)
+	}
+	var rv int
+	if bind {
+		if a.family != C.AF_UNIX {
+			C.xnet_reuseaddr(fd)
+		}
+		rv = C.bind(fd, buf, salen)
+	} else {
+		rv = C.connect(fd, buf, salen)
+	}
+	if rv != 0 {
+		err := neterror(op + " " + a.network + " " + a.String())
+		C.close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func Dial(network string, address string) (Conn, error) {
+	ra, err := resolveaddr("dial", network, address)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := sysocket("dial", ra, false)
+	if err != nil {
+		return nil, err
+	}
+	return newnetconn(fd, network, ra.socktype), nil
+}
+
+// stream ones, tcp or unix
+func Listen(network string, address string) (Listener, error) {
+	la, err := resolveaddr("listen", network, address)
+	if err != nil {
+		return nil, err
+	}
+	if la.socktype != C.SOCK_STREAM {
+		return nil, xos.NewSyscallError("listen "+network+", use ListenPacket", C.EPROTOTYPE)
+	}
+	fd, err := sysocket("listen", la, true)
+	if err != nil {
+		return nil, err
+	}
+	rv := C.listen(fd, C.SOMAXCONN)
+	if rv != 0 {
+		err = neterror("listen " + network + " " + address)
+		C.close(fd)
+		return nil, err
+	}
+	ln := &netlistener{}
+	ln.fd = fd
+	ln.laddr = sysaddr(network, la.socktype, fd, false)
+	if la.family == C.AF_UNIX {
+		ln.unlink = address
+	}
+	return ln, nil
+}
+
+// datagram ones, udp
+func ListenPacket(network string, address string) (PacketConn, error) {
+	la, err := resolveaddr("listen", network, address)
+	if err != nil {
+		return nil, err
+	}
+	if la.socktype != C.SOCK_DGRAM {
+		return nil, xos.NewSyscallError("listen "+network+", use Listen", C.EPROTOTYPE)
+	}
+	fd, err := sysocket("listen", la, true)
+	if err != nil {
+		return nil, err
+	}
+	return newnetconn(fd, network, la.socktype), nil
+}
+
+type netlistener struct {
+	fd     int
+	laddr  *sockaddr
+	unlink string // unix socket file removed on Close
+}
+
+func (ln *netlistener) Accept() (Conn, error) {
+	if ln.fd < 0 {
+		return nil, xos.NewSyscallError("accept", C.EBADF)
+	}
+	fd := C.accept(ln.fd, 0, 0)
+	if fd < 0 {
+		return nil, neterror("accept")
+	}
+	return newnetconn(fd, ln.laddr.network, ln.laddr.socktype), nil
+}
+
+func (ln *netlistener) Close() error {
+	if ln.fd < 0 {
+		return xos.NewSyscallError("close", C.EBADF)
+	}
+	rv := C.close(ln.fd)
+	ln.fd = -1
+	if ln.unlink.len > 0 {
+		C.unlink(ln.unlink.cstr())
+	}
+	if rv != 0 {
+		return neterror("close")
+	}
+	return nil
+}
+
+func (ln *netlistener) Addr() Addr { return ln.laddr }
+
+type netconn struct {
+	fd        int
+	socktype  int
+	laddr     *sockaddr
+	raddr     *sockaddr
+	rdeadline int64 // unix usec, 0 for none
+	wdeadline int64
+}
+
+func newnetconn(fd int, network string, socktype int) *netconn {
+	c := &netconn{}
+	c.fd = fd
+	c.socktype = socktype
+	c.laddr = sysaddr(network, socktype, fd, false)
+	c.raddr = sysaddr(network, socktype, fd, true)
+	return c
+}
+
+// until fd is ready for events or the deadline passed
+func (c *netconn) wait(op string, events int, deadline int64) error {
+	if c.fd < 0 {
+		return xos.NewSyscallError(op, C.EBADF)
+	}
+	if deadline == 0 {
+		return nil
+	}
+	timeoms := (deadline - xtime.Now().UnixMicro()) / 1000
+	if timeoms <= 0 {
+		return ErrDeadlineExceeded
+	}
+	rv := C.xnet_poll1(c.fd, events, timeoms)
+	if rv == 0 {
+		return ErrDeadlineExceeded
+	}
+	if rv < 0 {
+		return neterror(op)
+	}
+	return nil
+}
+
+// EOF when the peer closed a stream
+func (c *netconn) Read(b []byte) (int, error) {
+	err := c.wait("read", C.POLLIN, c.rdeadline)
+	if err != nil {
+		return 0, err
+	}
+	rv := C.read(c.fd, b.ptr, b.len)
+	if rv < 0 {
+		return 0, neterror("read")
+	}
+	if rv == 0 && b.len > 0 && c.socktype == C.SOCK_STREAM {
+		return 0, xio.EOF
+	}
+	return rv, nil
+}
+
+// all of b, or an error
+func (c *netconn) Write(b []byte) (int, error) {
+	n := 0
+	for n < b.len {
+		err := c.wait("write", C.POLLOUT, c.wdeadline)
+		if err != nil {
+			return n, err
+		}
+		p := voidptr(usize(b.ptr) + usize(n))
+		rv := C.write(c.fd, p, b.len-n)
+		if rv < 0 {
+			return n, neterror("write")
+		}
+		n += rv
+	}
+	return n, nil
+}
+
+func (c *netconn) ReadFrom(b []byte) (int, Addr, error) {
+	err := c.wait("read", C.POLLIN, c.rdeadline)
+	if err != nil {
+		return 0, nil, err
+	}
+	buf := malloc3(sockaddrsz)
+	rv := C.xnet_recvfrom(c.fd, b.ptr, b.len, buf)
+	if rv < 0 {
+		return 0, nil, neterror("read")
+	}
+	a := &sockaddr{}
+	a.network = c.laddr.network
+	a.socktype = c.socktype
+	return rv, addrof(a, buf), nil
+}
+
+func (c *netconn) WriteTo(b []byte, addr Addr) (int, error) {
+	err := c.wait("write", C.POLLOUT, c.wdeadline)
+	if err != nil {
+		return 0, err
+	}
+	ra, err := resolveaddr("write", addr.Network(), addr.String())
+	if err != nil {
+		return 0, err
+	}
+	buf := malloc3(sockaddrsz)
+	salen := ra.tosys(buf)
+	rv := C.sendto(c.fd, b.ptr, b.len, 0, buf, salen)
+	if rv < 0 {
+		return 0, neterror("write")
+	}
+	return rv, nil
+}
+
+func (c *netconn) Close() error {
+	if c.fd < 0 {
+		return xos.NewSyscallError("close", C.EBADF)
+	}
+	rv := C.close(c.fd)
+	c.fd = -1
+	if rv != 0 {
+		return neterror("close")
+	}
+	return nil
+}
+
+func (c *netconn) LocalAddr() Addr  { return c.laddr }
+func (c *netconn) RemoteAddr() Addr { return c.raddr }
+
+// nil or zero t for no deadline
+func deadlineof(t *xtime.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMicro()
+}
+
+func (c *netconn) SetDeadline(t *xtime.Time) error {
+	c.rdeadline = deadlineof(t)
+	c.wdeadline = c.rdeadline
+	return nil
+}
+
+func (c *netconn) SetReadDeadline(t *xtime.Time) error {
+	c.rdeadline = deadlineof(t)
+	return nil
+}
+
+func (c *netconn) SetWriteDeadline(t *xtime.Time) error {
+	c.wdeadline = deadlineof(t)
+	return nil
+}
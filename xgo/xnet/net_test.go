@@ -0,0 +1,50 @@
+package xnet
+
+import "xgo/xio"
+
+func test_splithostport1() {
+	host, port, err := SplitHostPort("[::1]:8080")
+	println(host, port, err == nil)
+	println(JoinHostPort("::1", "8080"), JoinHostPort("127.0.0.1", "80"))
+	_, _, err = SplitHostPort("localhost")
+	println(err.Error())
+}
+
+func test_echo1() {
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	println(ln.Addr().String())
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		buf := make([]byte, 64)
+		n, _ := c.Read(buf)
+		c.Write(buf[:n])
+		c.Close()
+	}()
+
+	c, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	c.Write([]byte("hello"))
+	buf := make([]byte, 64)
+	n, _ := c.Read(buf)
+	println(string(buf[:n]), c.RemoteAddr().String())
+	_, err = c.Read(buf)
+	println(err == xio.EOF)
+	c.Close()
+	ln.Close()
+}
+
+func test_dialrefused1() {
+	_, err := Dial("tcp", "127.0.0.1:1")
+	println(err.Error()) // dial tcp 127.0.0.1:1: OSErr 111: Connection refused
+}
@@ -2,39 +2,419 @@ package xos
 
 /*
 #include <errno.h>
+#include <fcntl.h>
+#include <poll.h>
+#include <signal.h>
+#include <string.h>
+#include <unistd.h>
+#include <sys/syscall.h>
+#include <sys/wait.h>
+
+#ifndef SYS_pidfd_open
+#define SYS_pidfd_open 434
+#endif
+
+extern char** environ;
+static int xos_waitfd(int fd, int events); // file.go
+static int xos_read(int fd, void* buf, int n);
+
+static void xos_cstrarr_set(char** arr, int idx, char* s) { arr[idx] = s; }
+
+// fork and exec path, fd0-2 become the child's stdin/out/err.
+// errno of the failed step, 0 when the child runs path
+static int xos_forkexec(char* path, char** argv, char** envp, char* dir,
+                        int fd0, int fd1, int fd2, int* pidout) {
+    int errpipe[2];
+    if (pipe2(errpipe, O_CLOEXEC) < 0) return errno;
+    int pid = fork();
+    if (pid < 0) {
+        int eno = errno;
+        close(errpipe[0]);
+        close(errpipe[1]);
+        return eno;
+    }
+    if (pid == 0) {
+        // raw syscalls only, libc locks and the corona hooks are not fork safe
+        int fds[3] = {fd0, fd1, fd2};
+        int eno = 0;
+        for (int i = 0; i < 3; i++) {
+            if (fds[i] < 3 && fds[i] != i) { // out of the way of dup3
+                int nfd = syscall(SYS_fcntl, fds[i], F_DUPFD_CLOEXEC, 3);
+                if (nfd < 0) goto fail;
+                fds[i] = nfd;
+            }
+        }
+        for (int i = 0; i < 3; i++) {
+            int rv = fds[i] == i ? syscall(SYS_fcntl, i, F_SETFD, 0) :
+                syscall(SYS_dup3, fds[i], i, 0);
+            if (rv < 0) goto fail;
+        }
+        if (dir != 0 && dir[0] != 0 && syscall(SYS_chdir, dir) < 0) goto fail;
+        sigset_t set;
+        sigemptyset(&set);
+        syscall(SYS_rt_sigprocmask, SIG_SETMASK, &set, 0, _NSIG/8);
+        syscall(SYS_execve, path, argv, envp != 0 ? envp : environ);
+    fail:
+        eno = errno;
+        syscall(SYS_write, errpipe[1], &eno, sizeof(eno));
+        syscall(SYS_exit_group, 127);
+    }
+    close(errpipe[1]);
+    *pidout = pid;
+
+    // EOF once exec closed it
+    int eno = 0;
+    fcntl(errpipe[0], F_SETFL, O_NONBLOCK);
+    int rv = xos_read(errpipe[0], &eno, sizeof(eno));
+    close(errpipe[0]);
+    if (rv == sizeof(eno)) {
+        waitpid(pid, 0, 0);
+        return eno;
+    }
+    return 0;
+}
+
+static int xos_pidfd_open(int pid) {
+    return syscall(SYS_pidfd_open, pid, 0);
+}
+
+// status as from waitpid, -errno on failure.
+// with a pidfd the fiber is parked in the netpoller until the child exits,
+// without, on old kernels, polled every 10ms
+static int xos_waitpid(int pid, int pidfd) {
+    if (pidfd >= 0 && xos_waitfd(pidfd, POLLIN) < 0) pidfd = -1;
+    for (;;) {
+        int st = 0;
+        int rv = waitpid(pid, &st, pidfd >= 0 ? 0 : WNOHANG);
+        if (rv == pid) return st;
+        if (rv < 0 && errno != EINTR) return -errno;
+        if (rv == 0) usleep(10000);
+    }
+}
+
+static int xos_exitcode(int st) { return WIFEXITED(st) ? WEXITSTATUS(st) : -1; }
+static int xos_termsig(int st) { return WIFSIGNALED(st) ? WTERMSIG(st) : 0; }
+static char* xos_signame(int sig) { return strsignal(sig); }
 */
 import "C"
+import "xgo/xerrors"
+
+const (
+	SIGHUP  = C.SIGHUP
+	SIGINT  = C.SIGINT
+	SIGQUIT = C.SIGQUIT
+	SIGKILL = C.SIGKILL
+	SIGPIPE = C.SIGPIPE
+	SIGTERM = C.SIGTERM
+	SIGUSR1 = C.SIGUSR1
+	SIGUSR2 = C.SIGUSR2
+	SIGCHLD = C.SIGCHLD
+)
 
 type Cmd struct {
-	cmd  string
-	args []string
+	Path string   // resolved through $PATH by Command
+	Args []string // Args[0] is the command name
+	Env  []string // KEY=VALUE, nil for ours
+	Dir  string   // "" for ours
+
+	// nil for /dev/null
+	Stdin  *File
+	Stdout *File
+	Stderr *File
+
+	Pid int
+
+	lookerr   error
+	childfds  []*File // closed once started
+	parentfds []*File // closed on Wait
+	pidfd     int
+	started   bool
+	waited    bool
+	exitcode  int
+	termsig   int
 }
 
-func Command(cmd string, args ...string) *Cmd {
-	cmdo := &Cmd{}
-	cmdo.cmd = cmd
-	cmdo.args = args
-	return cmdo
+func Command(name string, args ...string) *Cmd {
+	cmd := &Cmd{}
+	cmd.Path = name
+	cmd.Args = append([]string{name}, args...)
+	cmd.pidfd = -1
+	cmd.exitcode = -1
+	cmd.childfds = make([]*File, 0)
+	cmd.parentfds = make([]*File, 0)
+	if name.index("/") < 0 {
+		exepath, err := Lookup(name)
+		if err != nil {
+			cmd.lookerr = xerrors.New("exec: \"" + name + "\": executable file not found in $PATH")
+		} else {
+			cmd.Path = exepath
+		}
+	}
+	return cmd
 }
 
-func (cmd *Cmd) Run() error {
+// exit status as error from Wait
+type exiterror struct {
+	code int
+	sig  int
+}
+
+func (err *exiterror) Error() string {
+	if err.sig != 0 {
+		return "signal: " + gostring(C.xos_signame(err.sig))
+	}
+	return "exit status " + err.code.repr()
+}
+
+// parent end of a new pipe, nonblocking. the child end stays blocking,
+// as children expect, and is closed once started
+func (cmd *Cmd) pipe(childread bool) (*File, error) {
+	fds := make([]int, 2)
+	rv := C.pipe2(fds.ptr, C.O_CLOEXEC)
+	if rv != 0 {
+		return nil, NewSyscallError("pipe", Errno())
+	}
+	parent := NewFile(fds[0], "|0")
+	child := NewFile(fds[1], "|1")
+	if childread {
+		tmp := parent
+		parent = child
+		child = tmp
+	}
+	C.xos_setnonblock(parent.fd)
+	cmd.childfds = append(cmd.childfds, child)
+	return parent, nil
+}
+
+// write end of the child's stdin, close it to send EOF
+func (cmd *Cmd) StdinPipe() (*File, error) {
+	pw, err := cmd.pipe(true)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = cmd.childfds[cmd.childfds.len-1]
+	return pw, nil
+}
+
+// read end of the child's stdout, closed by Wait, read it all before
+func (cmd *Cmd) StdoutPipe() (*File, error) {
+	pr, err := cmd.pipe(false)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = cmd.childfds[cmd.childfds.len-1]
+	cmd.parentfds = append(cmd.parentfds, pr)
+	return pr, nil
+}
+
+func (cmd *Cmd) StderrPipe() (*File, error) {
+	pr, err := cmd.pipe(false)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.childfds[cmd.childfds.len-1]
+	cmd.parentfds = append(cmd.parentfds, pr)
+	return pr, nil
+}
+
+func (cmd *Cmd) closefds(fds []*File) {
+	for _, f := range fds {
+		if f.fd >= 0 {
+			f.Close()
+		}
+	}
+}
+
+// fd of f, or /dev/null opened into cmd.childfds
+func (cmd *Cmd) childfd(f *File, write bool) (int, error) {
+	if f != nil {
+		return f.fd, nil
+	}
+	flags := C.O_RDONLY | C.O_CLOEXEC
+	if write {
+		flags = C.O_WRONLY | C.O_CLOEXEC
+	}
+	fd := C.open("/dev/null".ptr, flags)
+	if fd < 0 {
+		return -1, NewSyscallError("open /dev/null", Errno())
+	}
+	cmd.childfds = append(cmd.childfds, NewFile(fd, "/dev/null"))
+	return fd, nil
+}
+
+func cstrarr(strs []string) voidptr {
+	arr := malloc3((strs.len + 1) * sizeof(voidptr))
+	for i, s := range strs {
+		C.xos_cstrarr_set(arr, i, s.cstr())
+	}
+	C.xos_cstrarr_set(arr, strs.len, nil)
+	return arr
+}
+
+func (cmd *Cmd) Start() error {
+	if cmd.lookerr != nil {
+		cmd.closefds(cmd.childfds)
+		cmd.closefds(cmd.parentfds)
+		return cmd.lookerr
+	}
+	if cmd.started {
+		return xerrors.New("exec: already started")
+	}
+	fd0, err := cmd.childfd(cmd.Stdin, false)
+	if err != nil {
+		cmd.closefds(cmd.childfds)
+		return err
+	}
+	fd1, err := cmd.childfd(cmd.Stdout, true)
+	if err != nil {
+		cmd.closefds(cmd.childfds)
+		return err
+	}
+	fd2, err := cmd.childfd(cmd.Stderr, true)
+	if err != nil {
+		cmd.closefds(cmd.childfds)
+		return err
+	}
+
+	argv := cstrarr(cmd.Args)
+	var envp voidptr
+	if cmd.Env != nil {
+		envp = cstrarr(cmd.Env)
+	}
+	var dir voidptr
+	if cmd.Dir.len > 0 {
+		dir = voidptr(cmd.Dir.cstr())
+	}
+	pid := 0
+	eno := C.xos_forkexec(cmd.Path.cstr(), argv, envp, dir, fd0, fd1, fd2, &pid)
+	cmd.closefds(cmd.childfds)
+	if eno != 0 {
+		cmd.closefds(cmd.parentfds)
+		return NewSyscallError("fork/exec "+cmd.Path, eno)
+	}
+	cmd.Pid = pid
+	cmd.pidfd = C.xos_pidfd_open(pid)
+	cmd.started = true
 	return nil
 }
 
-func (cmd *Cmd) Output() error {
+// until the child exits, nil for exit status 0
+func (cmd *Cmd) Wait() error {
+	if !cmd.started {
+		return xerrors.New("exec: not started")
+	}
+	if cmd.waited {
+		return xerrors.New("exec: Wait was already called")
+	}
+	cmd.waited = true
+	st := C.xos_waitpid(cmd.Pid, cmd.pidfd)
+	if cmd.pidfd >= 0 {
+		C.close(cmd.pidfd)
+		cmd.pidfd = -1
+	}
+	cmd.closefds(cmd.parentfds)
+	if st < 0 {
+		return NewSyscallError("wait", -st)
+	}
+	cmd.exitcode = C.xos_exitcode(st)
+	cmd.termsig = C.xos_termsig(st)
+	if cmd.exitcode == 0 {
+		return nil
+	}
+	err := &exiterror{}
+	err.code = cmd.exitcode
+	err.sig = cmd.termsig
+	return err
+}
+
+func (cmd *Cmd) Run() error {
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+// -1 if not exited yet or killed by a signal
+func (cmd *Cmd) ExitCode() int { return cmd.exitcode }
+
+// the signal that killed it, 0 if none
+func (cmd *Cmd) Signaled() int { return cmd.termsig }
+
+func (cmd *Cmd) Signal(sig int) error {
+	if !cmd.started || cmd.waited {
+		return xerrors.New("exec: process not running")
+	}
+	rv := C.kill(cmd.Pid, sig)
+	if rv != 0 {
+		return NewSyscallError("kill", Errno())
+	}
 	return nil
 }
 
-// err and out
-func (cmd *Cmd) Errout() error {
+func (cmd *Cmd) Kill() error { return cmd.Signal(SIGKILL) }
+
+// send sig to process pid
+func Kill(pid int, sig int) error {
+	rv := C.kill(pid, sig)
+	if rv != 0 {
+		return NewSyscallError("kill", Errno())
+	}
 	return nil
 }
 
+func readall(f *File) []byte {
+	var res []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			break
+		}
+		part := buf[:n]
+		res = append(res, part...)
+	}
+	return res
+}
+
+// stdout of Run
+func (cmd *Cmd) Output() ([]byte, error) {
+	pr, err := cmd.StdoutPipe()
+	if err != nil {
+		var empty []byte
+		return empty, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		var empty []byte
+		return empty, err
+	}
+	out := readall(pr)
+	return out, cmd.Wait()
+}
+
+// stdout and stderr of Run, interleaved
+func (cmd *Cmd) CombinedOutput() ([]byte, error) {
+	pr, err := cmd.StdoutPipe()
+	if err != nil {
+		var empty []byte
+		return empty, err
+	}
+	cmd.Stderr = cmd.Stdout
+	err = cmd.Start()
+	if err != nil {
+		var empty []byte
+		return empty, err
+	}
+	out := readall(pr)
+	return out, cmd.Wait()
+}
+
 func Lookup(exename string) (string, error) {
 	paths := Paths()
 	for _, dir := range paths {
 		exepath := dir + PathSep + exename
-		if FileExist(exepath) {
+		if IsExcutable(exepath) {
 			return exepath, nil
 		}
 	}
@@ -0,0 +1,40 @@
+package xos
+
+func test_output1() {
+	out, err := Command("echo", "hello", "world").Output()
+	println(string(out), err == nil) // hello world
+}
+
+func test_exitcode1() {
+	cmd := Command("sh", "-c", "exit 3")
+	err := cmd.Run()
+	println(err.Error(), cmd.ExitCode()) // exit status 3
+
+	cmd = Command("sleep", "10")
+	cmd.Start()
+	cmd.Kill()
+	err = cmd.Wait()
+	println(err.Error(), cmd.Signaled() == SIGKILL) // signal: Killed
+
+	err = Command("no-such-command-1").Run()
+	println(err.Error())
+}
+
+func test_pipes1() {
+	cmd := Command("tr", "a-z", "A-Z")
+	cmd.Dir = "/"
+	cmd.Env = []string{"LC_ALL=C"}
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	cmd.Start()
+	stdin.Write([]byte("abc\n"))
+	stdin.Close()
+	buf := make([]byte, 16)
+	n, _ := stdout.Read(buf)
+	part := buf[:n]
+	println(string(part)) // ABC
+	println(cmd.Wait() == nil)
+
+	out, _ := Command("sh", "-c", "echo out; echo err >&2").CombinedOutput()
+	println(string(out))
+}
@@ -29,10 +29,18 @@ func Errmsgof(eno int) string {
 }
 
 type oserror struct {
+	op   string
 	eno  int
 	emsg string
 }
 
+// for other packages, like go's os.NewSyscallError, op is like "connect"
+func NewSyscallError(op string, eno int) error {
+	err := newoserr(eno)
+	err.op = op
+	return err
+}
+
 func newoserr1() *oserror {
 	eno := Errno()
 	err := &oserror{}
@@ -53,9 +61,14 @@ func (err *oserror) Error() string {
 	}
 	if err.emsg.len == 0 {
 		emsg = "OSErr " + err.eno.repr() + ": " + Errmsgof(err.eno)
+		if err.op.len > 0 {
+			emsg = err.op + ": " + emsg
+		}
 		err.emsg = emsg
 	} else {
 		emsg = err.emsg
 	}
 	return emsg
 }
+
+func (err *oserror) Errno() int { return err.eno }
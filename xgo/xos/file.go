@@ -0,0 +1,334 @@
+package xos
+
+/*
+#include <errno.h>
+#include <fcntl.h>
+#include <poll.h>
+#include <stdint.h>
+#include <unistd.h>
+#include <string.h>
+#include <sys/stat.h>
+#include <dirent.h>
+
+// pipes and sockets are nonblocking, the corona hooks park the fiber on
+// EAGAIN. outside a fiber the hooks pass through, so wait here then
+static int xos_waitfd(int fd, int events) {
+    struct pollfd pfd = {fd, events, 0};
+    int rv = poll(&pfd, 1, -1);
+    return rv < 0 && errno != EINTR ? -1 : 0;
+}
+
+static int xos_read(int fd, void* buf, int n) {
+    for (;;) {
+        int rv = read(fd, buf, n);
+        if (rv >= 0) return rv;
+        if (errno == EINTR) continue;
+        if (errno != EAGAIN || xos_waitfd(fd, POLLIN) < 0) return -1;
+    }
+}
+
+static int xos_write(int fd, void* buf, int n) {
+    for (;;) {
+        int rv = write(fd, buf, n);
+        if (rv >= 0) return rv;
+        if (errno == EINTR) continue;
+        if (errno != EAGAIN || xos_waitfd(fd, POLLOUT) < 0) return -1;
+    }
+}
+
+static int xos_setnonblock(int fd) {
+    int flags = fcntl(fd, F_GETFL);
+    return flags < 0 ? -1 : fcntl(fd, F_SETFL, flags | O_NONBLOCK);
+}
+
+static void xos_fillstat(struct stat* st, int64_t* size, int* mode, int64_t* mtime) {
+    *size = st->st_size;
+    *mode = st->st_mode;
+    *mtime = (int64_t)st->st_mtim.tv_sec * 1000000 + st->st_mtim.tv_nsec / 1000;
+}
+
+// fd >= 0 for fstat, else stat or lstat of name
+static int xos_stat(int fd, char* name, int follow, int64_t* size, int* mode, int64_t* mtime) {
+    struct stat st;
+    int rv;
+    if (fd >= 0) rv = fstat(fd, &st);
+    else if (follow) rv = stat(name, &st);
+    else rv = lstat(name, &st);
+    if (rv != 0) return -1;
+    xos_fillstat(&st, size, mode, mtime);
+    return 0;
+}
+
+// a DIR* over a dup of fd, Close of the File closes both
+static void* xos_opendir(int fd) {
+    int fd2 = fcntl(fd, F_DUPFD_CLOEXEC, 0);
+    if (fd2 < 0) return 0;
+    DIR* dir = fdopendir(fd2);
+    if (dir == 0) close(fd2);
+    return dir;
+}
+
+// next entry without . and .., name copied to buf.
+// length of name, 0 at the end, -1 on error
+static int xos_readdir(void* dirx, char* buf, int bufsz, int* isdir) {
+    DIR* dir = (DIR*)dirx;
+    for (;;) {
+        errno = 0;
+        struct dirent* ent = readdir(dir);
+        if (ent == 0) return errno == 0 ? 0 : -1;
+        if (strcmp(ent->d_name, ".") == 0 || strcmp(ent->d_name, "..") == 0) continue;
+        if (ent->d_type == DT_UNKNOWN) {
+            struct stat st;
+            *isdir = fstatat(dirfd(dir), ent->d_name, &st, AT_SYMLINK_NOFOLLOW) == 0 && S_ISDIR(st.st_mode);
+        } else {
+            *isdir = ent->d_type == DT_DIR;
+        }
+        int n = strlen(ent->d_name);
+        n = n < bufsz ? n : bufsz;
+        memcpy(buf, ent->d_name, n);
+        return n;
+    }
+}
+*/
+import "C"
+import (
+	"xgo/xio"
+	"xgo/xtime"
+)
+
+// flags for OpenFile, one of the first three or'ed with the others
+const (
+	O_RDONLY = C.O_RDONLY
+	O_WRONLY = C.O_WRONLY
+	O_RDWR   = C.O_RDWR
+	O_APPEND = C.O_APPEND
+	O_CREATE = C.O_CREAT
+	O_EXCL   = C.O_EXCL
+	O_SYNC   = C.O_SYNC
+	O_TRUNC  = C.O_TRUNC
+)
+
+// an open fd
+type File struct {
+	fd   int
+	name string
+	dir  voidptr // for ReadDir
+}
+
+// close on exec, perm is masked by the umask when creating
+func OpenFile(name string, flag int, perm int) (*File, error) {
+	fd := C.open(name.ptr, flag|C.O_CLOEXEC, perm)
+	if fd < 0 {
+		return nil, NewSyscallError("open "+name, Errno())
+	}
+	return NewFile(fd, name), nil
+}
+
+// for reading
+func Open(name string) (*File, error) {
+	return OpenFile(name, O_RDONLY, 0)
+}
+
+// for reading and writing, truncated if it exists
+func Create(name string) (*File, error) {
+	return OpenFile(name, O_RDWR|O_CREATE|O_TRUNC, 0666)
+}
+
+func NewFile(fd int, name string) *File {
+	f := &File{}
+	f.fd = fd
+	f.name = name
+	return f
+}
+
+func (f *File) Fd() int      { return f.fd }
+func (f *File) Name() string { return f.name }
+
+// EOF at the end
+func (f *File) Read(b []byte) (int, error) {
+	if f.fd < 0 {
+		return 0, NewSyscallError("read", C.EBADF)
+	}
+	rv := C.xos_read(f.fd, b.ptr, b.len)
+	if rv < 0 {
+		return 0, NewSyscallError("read", Errno())
+	}
+	if rv == 0 && b.len > 0 {
+		return 0, xio.EOF
+	}
+	return rv, nil
+}
+
+// all of b, or an error
+func (f *File) Write(b []byte) (int, error) {
+	if f.fd < 0 {
+		return 0, NewSyscallError("write", C.EBADF)
+	}
+	n := 0
+	for n < b.len {
+		p := voidptr(usize(b.ptr) + usize(n))
+		rv := C.xos_write(f.fd, p, b.len-n)
+		if rv < 0 {
+			return n, NewSyscallError("write", Errno())
+		}
+		n += rv
+	}
+	return n, nil
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// new offset, whence is one of xio.SeekStart, SeekCurrent, SeekEnd
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.fd < 0 {
+		return 0, NewSyscallError("seek", C.EBADF)
+	}
+	rv := C.lseek(f.fd, offset, whence)
+	if rv < 0 {
+		return 0, NewSyscallError("seek", Errno())
+	}
+	return int64(rv), nil
+}
+
+// flush to disk
+func (f *File) Sync() error {
+	if f.fd < 0 {
+		return NewSyscallError("fsync", C.EBADF)
+	}
+	if C.fsync(f.fd) != 0 {
+		return NewSyscallError("fsync", Errno())
+	}
+	return nil
+}
+
+func (f *File) Stat() (*FileInfo, error) {
+	if f.fd < 0 {
+		return nil, NewSyscallError("stat", C.EBADF)
+	}
+	return statfile(f.fd, f.name, true)
+}
+
+// the next n entries of a directory, without . and ..
+// n <= 0 reads all the rest with a nil error,
+// n > 0 returns EOF when there is nothing left
+func (f *File) ReadDir(n int) ([]*DirEntry, error) {
+	res := make([]*DirEntry, 0)
+	if f.fd < 0 {
+		return res, NewSyscallError("readdir", C.EBADF)
+	}
+	if f.dir == nil {
+		f.dir = C.xos_opendir(f.fd)
+		if f.dir == nil {
+			return res, NewSyscallError("readdir", Errno())
+		}
+	}
+	buf := make([]byte, PATH_MAX)
+	for n <= 0 || res.len < n {
+		isdir := 0
+		rv := C.xos_readdir(f.dir, buf.ptr, buf.len, &isdir)
+		if rv < 0 {
+			return res, NewSyscallError("readdir", Errno())
+		}
+		if rv == 0 {
+			break
+		}
+		ent := &DirEntry{}
+		ent.dirname = f.name
+		ent.name = gostringn(buf.ptr, rv)
+		ent.isdir = isdir != 0
+		res = append(res, ent)
+	}
+	if n > 0 && res.len == 0 {
+		return res, xio.EOF
+	}
+	return res, nil
+}
+
+func (f *File) Close() error {
+	if f.fd < 0 {
+		return NewSyscallError("close", C.EBADF)
+	}
+	if f.dir != nil {
+		C.closedir(f.dir)
+		f.dir = nil
+	}
+	rv := C.close(f.fd)
+	f.fd = -1
+	if rv != 0 {
+		return NewSyscallError("close", Errno())
+	}
+	return nil
+}
+
+// close on exec, nonblocking
+func Pipe() (*File, *File, error) {
+	fds := make([]int, 2)
+	rv := C.pipe2(fds.ptr, C.O_CLOEXEC|C.O_NONBLOCK)
+	if rv != 0 {
+		return nil, nil, NewSyscallError("pipe", Errno())
+	}
+	return NewFile(fds[0], "|0"), NewFile(fds[1], "|1"), nil
+}
+
+// what stat tells
+type FileInfo struct {
+	name  string
+	size  int64
+	mode  int
+	mtime int64 // usec
+}
+
+// the last element of the path
+func (fi *FileInfo) Name() string         { return fi.name }
+func (fi *FileInfo) Size() int64          { return fi.size }
+func (fi *FileInfo) Mode() int            { return fi.mode }
+func (fi *FileInfo) IsDir() bool          { return (fi.mode & C.S_IFMT) == C.S_IFDIR }
+func (fi *FileInfo) ModTime() *xtime.Time { return xtime.UnixMicro(fi.mtime) }
+
+// follows symlinks
+func Stat(name string) (*FileInfo, error) {
+	return statfile(-1, name, true)
+}
+
+// the symlink itself
+func Lstat(name string) (*FileInfo, error) {
+	return statfile(-1, name, false)
+}
+
+func statfile(fd int, name string, follow bool) (*FileInfo, error) {
+	fi := &FileInfo{}
+	fi.name = basename(name)
+	rv := C.xos_stat(fd, name.ptr, follow, &fi.size, &fi.mode, &fi.mtime)
+	if rv != 0 {
+		return nil, NewSyscallError("stat "+name, Errno())
+	}
+	return fi, nil
+}
+
+func basename(name string) string {
+	for name.len > 1 && name[name.len-1] == '/' {
+		name = name[:name.len-1]
+	}
+	pos := name.rindex(PathSep)
+	if pos < 0 || name.len == 1 {
+		return name
+	}
+	return name[pos+1:]
+}
+
+// an entry of File.ReadDir
+type DirEntry struct {
+	dirname string
+	name    string
+	isdir   bool
+}
+
+func (ent *DirEntry) Name() string { return ent.name }
+func (ent *DirEntry) IsDir() bool  { return ent.isdir }
+
+// Lstat of the entry
+func (ent *DirEntry) Info() (*FileInfo, error) {
+	return Lstat(ent.dirname + PathSep + ent.name)
+}
@@ -0,0 +1,40 @@
+package xos
+
+func test_file1() {
+	name := Tmpdir() + "/xos_file_test1"
+	err := WriteFile(name, []byte("hello file"))
+	println(err == nil)
+	data, err := ReadFile(name)
+	println(string(data), err == nil) // hello file true
+
+	f, _ := OpenFile(name, O_RDWR, 0)
+	off, _ := f.Seek(6, 0)
+	buf := make([]byte, 16)
+	n, _ := f.Read(buf)
+	part := buf[:n]
+	println(off, string(part)) // 6 file
+	fi, _ := f.Stat()
+	println(fi.Name(), fi.Size(), fi.IsDir()) // xos_file_test1 10 false
+	f.Close()
+	Remove(name)
+
+	_, err = Open(name)
+	println(err != nil)
+}
+
+func test_readdir1() {
+	dir := Tmpdir() + "/xos_readdir_test1"
+	Mkdir(dir)
+	Touch(dir + "/a")
+	Mkdir(dir + "/b")
+	f, _ := Open(dir)
+	ents, err := f.ReadDir(-1)
+	println(ents.len, err == nil) // 2 true
+	for _, ent := range ents {
+		println(ent.Name(), ent.IsDir())
+	}
+	f.Close()
+	Remove(dir + "/a")
+	Rmdir(dir + "/b")
+	Rmdir(dir)
+}
@@ -29,6 +29,7 @@ int xos_gettid3() {
    extern char** cxrt_get_argv();
 */
 import "C"
+import "xgo/xio"
 
 // import "errors"
 
@@ -47,6 +48,7 @@ const (
 func Gettid() int {
 	return C.xos_gettid3()
 }
+func Getpid() int { return C.getpid() }
 
 func Touch(path string) bool {
 	fp := C.open(path.ptr, C.O_RDWR|C.O_CREAT, 0644)
@@ -190,46 +192,29 @@ func Remove(filename string) error {
 	return nil
 }
 
-// default safe, write to temp and then rename
+// created or truncated, DftMode for a new one
 func WriteFile(filename string, data []byte) error {
-	mode := "w+"
-	fp := C.fopen(filename.ptr, mode.ptr)
-	if fp != nil {
-		return newoserr1()
+	f, err := OpenFile(filename, O_WRONLY|O_CREATE|O_TRUNC, DftMode)
+	if err != nil {
+		return err
 	}
-	defer C.fclose(fp)
-	len := data.len
-	rv := C.fwrite(data.ptr, len, 1, fp)
-	if rv != len {
-		return newoserr1()
+	_, err = f.Write(data)
+	err2 := f.Close()
+	if err != nil {
+		return err
 	}
-	return nil
+	return err2
 }
 
+// all of it, EOF is not an error
 func ReadFile(filename string) ([]byte, error) {
-	mode := "r"
-	fp := C.fopen(filename.ptr, mode.ptr)
-	if fp != nil {
-		return nil, newoserr1()
-	}
-	defer C.fclose(fp)
-	var res []byte
-	buf := make([]byte, 8192)
-	for {
-		rv := C.fread(buf.ptr, buf.len, 1, fp)
-		if rv > 0 {
-			res = append(res, buf[:rv]...)
-		}
-		isferr := C.ferror(fp)
-		if isferr == 1 {
-			return nil, newoserr1()
-		}
-		iseof := C.feof(fp)
-		if iseof == 1 {
-			break
-		}
+	f, err := Open(filename)
+	if err != nil {
+		return nil, err
 	}
-	return res, nil
+	res, err := xio.ReadAll(f)
+	f.Close()
+	return res, err
 }
 
 func FileExist(filename string) bool {
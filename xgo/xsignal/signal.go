@@ -0,0 +1,253 @@
+package xsignal
+
+/*
+#cgo CFLAGS: -DGC_THREADS
+
+#include <errno.h>
+#include <fcntl.h>
+#include <pthread.h>
+#include <signal.h>
+#include <string.h>
+#include <unistd.h>
+#include <sys/syscall.h>
+#include <gc.h>
+
+static int xsignal_wfd = -1;
+
+// async signal safe, raw syscall since corona hooks write
+static void xsignal_handler(int sig) {
+    int eno = errno;
+    unsigned char b = sig;
+    syscall(SYS_write, xsignal_wfd, &b, 1);
+    errno = eno;
+}
+
+// read end of the self-pipe, both ends nonblocking
+static int xsignal_open() {
+    int fds[2] = {-1, -1};
+    if (pipe2(fds, O_CLOEXEC|O_NONBLOCK) != 0) return -1;
+    xsignal_wfd = fds[1];
+    return fds[0];
+}
+
+// not ours to take: the gc's stop the world signals and the
+// two glibc keeps below SIGRTMIN for its threads
+static int xsignal_reserved(int sig) {
+    if (sig == SIGKILL || sig == SIGSTOP) return 1;
+    if (sig == GC_get_suspend_signal() || sig == GC_get_thr_restart_signal()) return 1;
+    return sig >= 32 && sig < SIGRTMIN;
+}
+
+// in the set Notify, Ignore and Reset take with no signals given, like
+// go's os/signal that leaves out faults raised by the code itself
+static int xsignal_inall(int sig) {
+    switch (sig) {
+    case SIGSEGV: case SIGBUS: case SIGFPE: case SIGILL:
+        return 0;
+    }
+    return !xsignal_reserved(sig);
+}
+
+// how 0 default, 1 ignore, 2 catch to the pipe
+static int xsignal_setaction(int sig, int how) {
+    struct sigaction sa;
+    memset(&sa, 0, sizeof(sa));
+    sa.sa_handler = how == 2 ? xsignal_handler : how == 1 ? SIG_IGN : SIG_DFL;
+    sa.sa_flags = SA_RESTART;
+    sigfillset(&sa.sa_mask);
+    return sigaction(sig, &sa, 0);
+}
+*/
+import "C"
+import (
+	"xgo/xerrors"
+	"xgo/xos"
+)
+
+// Signals are caught by a handler that writes the signal number to a
+// self-pipe, a fiber reads it through the netpoller and sends it to every
+// channel Notify'ed for it. Sending never blocks, as with go's os/signal
+// a signal is dropped for a channel not ready to take it, so give Notify
+// a buffered one.
+
+const nsig = 65
+
+const (
+	acdefault = 0
+	acignore  = 1
+	accatch   = 2
+)
+
+var errbadsig = xerrors.New("signal: bad signal number")
+
+type handler struct {
+	ch   chan int
+	sigs []bool // by signal number
+}
+
+var mu C.pthread_mutex_t
+var handlers []*handler
+var rdfile *xos.File
+
+func init() {
+	handlers = make([]*handler, 0)
+}
+
+func lock()   { C.pthread_mutex_lock(&mu) }
+func unlock() { C.pthread_mutex_unlock(&mu) }
+
+// the pipe and its reader fiber, on first use
+func start() error {
+	if rdfile != nil {
+		return nil
+	}
+	fd := C.xsignal_open()
+	if fd < 0 {
+		return xos.NewSyscallError("pipe", xos.Errno())
+	}
+	rdfile = xos.NewFile(fd, "signal")
+	go dispatch(rdfile)
+	return nil
+}
+
+func dispatch(f *xos.File) {
+	buf := make([]byte, 64)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			println("signal:", err.Error())
+			break
+		}
+		for i := 0; i < n; i++ {
+			deliver(int(buf[i]))
+		}
+	}
+}
+
+func deliver(sig int) {
+	lock()
+	var chs []chan int
+	for _, h := range handlers {
+		if h.sigs[sig] {
+			chs = append(chs, h.ch)
+		}
+	}
+	unlock()
+	for _, ch := range chs {
+		select {
+		case ch <- sig:
+		default:
+		}
+	}
+}
+
+// anyone still wants sig, caller holds mu
+func wanted(sig int) bool {
+	for _, h := range handlers {
+		if h.sigs[sig] {
+			return true
+		}
+	}
+	return false
+}
+
+// relay sigs to ch, all asynchronous ones if none given.
+// calling it again for the same ch adds to its set
+func Notify(ch chan int, sigs ...int) error {
+	if ch == nil {
+		return xerrors.New("signal: Notify using nil channel")
+	}
+	for _, sig := range sigs {
+		if sig <= 0 || sig >= nsig || C.xsignal_reserved(sig) != 0 {
+			return errbadsig
+		}
+	}
+	lock()
+	defer unlock()
+	if err := start(); err != nil {
+		return err
+	}
+	var h *handler
+	for _, h2 := range handlers {
+		if h2.ch == ch {
+			h = h2
+		}
+	}
+	if h == nil {
+		h = &handler{}
+		h.ch = ch
+		h.sigs = make([]bool, nsig)
+		handlers = append(handlers, h)
+	}
+	if sigs.len == 0 {
+		for sig := 1; sig < nsig; sig++ {
+			if C.xsignal_inall(sig) != 0 {
+				h.sigs[sig] = true
+				C.xsignal_setaction(sig, accatch)
+			}
+		}
+		return nil
+	}
+	for _, sig := range sigs {
+		h.sigs[sig] = true
+		if C.xsignal_setaction(sig, accatch) != 0 {
+			return xos.NewSyscallError("sigaction", xos.Errno())
+		}
+	}
+	return nil
+}
+
+// no more relaying to ch, signals nobody else wants get their
+// default action back. ch is not closed
+func Stop(ch chan int) {
+	lock()
+	defer unlock()
+	for i, h := range handlers {
+		if h.ch != ch {
+			continue
+		}
+		handlers = append(handlers[:i], handlers[i+1:]...)
+		for sig := 1; sig < nsig; sig++ {
+			if h.sigs[sig] && !wanted(sig) {
+				C.xsignal_setaction(sig, acdefault)
+			}
+		}
+		break
+	}
+}
+
+// sigs, or all asynchronous ones, are ignored and not relayed anymore
+func Ignore(sigs ...int) {
+	setall(sigs, acignore)
+}
+
+// sigs, or all asynchronous ones, get their default action back
+func Reset(sigs ...int) {
+	setall(sigs, acdefault)
+}
+
+func setall(sigs []int, how int) {
+	lock()
+	defer unlock()
+	if sigs.len == 0 {
+		for sig := 1; sig < nsig; sig++ {
+			if C.xsignal_inall(sig) != 0 {
+				setone(sig, how)
+			}
+		}
+		return
+	}
+	for _, sig := range sigs {
+		if sig > 0 && sig < nsig && C.xsignal_reserved(sig) == 0 {
+			setone(sig, how)
+		}
+	}
+}
+
+// caller holds mu
+func setone(sig int, how int) {
+	for _, h := range handlers {
+		h.sigs[sig] = false
+	}
+	C.xsignal_setaction(sig, how)
+}
@@ -0,0 +1,46 @@
+package xsignal
+
+import (
+	"xgo/xos"
+	"xgo/xtime"
+)
+
+func test_notify1() {
+	ch := make(chan int, 1)
+	Notify(ch, xos.SIGUSR1, xos.SIGHUP)
+	xos.Kill(xos.Getpid(), xos.SIGUSR1)
+	sig := <-ch
+	println(sig == xos.SIGUSR1)
+
+	// graceful shutdown shape, nothing else ready
+	done := make(chan int, 1)
+	go func() {
+		xtime.Sleepms(50)
+		xos.Kill(xos.Getpid(), xos.SIGHUP)
+	}()
+	select {
+	case sig := <-ch:
+		println("signal", sig == xos.SIGHUP)
+	case <-done:
+		println("bad done")
+	}
+	Stop(ch)
+}
+
+// a full channel drops, it does not block the others
+func test_drop1() {
+	ch1 := make(chan int, 1)
+	ch2 := make(chan int, 2)
+	Notify(ch1, xos.SIGUSR2)
+	Notify(ch2, xos.SIGUSR2)
+	xos.Kill(xos.Getpid(), xos.SIGUSR2)
+	xos.Kill(xos.Getpid(), xos.SIGUSR2)
+	xtime.Sleepms(50)
+	println(len(ch1), len(ch2)) // 1 2
+	Stop(ch1)
+	Stop(ch2)
+	Ignore(xos.SIGUSR2)
+	xos.Kill(xos.Getpid(), xos.SIGUSR2) // still alive
+	println(Notify(ch1, xos.SIGKILL) != nil)
+	println(Notify(ch1, 32) != nil) // true, glibc's
+}
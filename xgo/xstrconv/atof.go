@@ -0,0 +1,114 @@
+package xstrconv
+
+/*
+#include <errno.h>
+#include <math.h>
+#include <stdlib.h>
+#include <string.h>
+
+// s[:n] as a float of bits 32 or 64, correctly rounded by libc.
+// 0 ok, -1 not all of s is a number, -2 out of range with *out +-Inf
+static int xstrconv_atof(char* s, int n, int bits, double* out) {
+    char sbuf[128];
+    char* buf = n < (int)sizeof(sbuf) ? sbuf : malloc(n + 1);
+    memcpy(buf, s, n);
+    buf[n] = 0;
+    char* end = 0;
+    errno = 0;
+    if (bits == 32) *out = strtof(buf, &end);
+    else *out = strtod(buf, &end);
+    int rv = 0;
+    if (end != buf + n) rv = -1;
+    else if (errno == ERANGE && isinf(*out)) rv = -2;
+    if (buf != sbuf) free(buf);
+    return rv;
+}
+
+static double xstrconv_inf(int sign) { return sign < 0 ? -INFINITY : INFINITY; }
+static double xstrconv_nan() { return NAN; }
+*/
+import "C"
+
+// s as a decimal or hexadecimal float of the go syntax, _ allowed
+// between digits, also inf, infinity and nan in any case.
+// bitSize 32 rounds to float32 first. out of range gives +-Inf
+// with ErrRange, underflow gives 0 or a denormal and no error
+func ParseFloat(s string, bitSize int) (float64, error) {
+	f, err := parsefloat(s, bitSize)
+	if err != nil {
+		return f, numerror("ParseFloat", s, err)
+	}
+	return f, nil
+}
+
+func parsefloat(s string, bitSize int) (float64, error) {
+	if s.len == 0 {
+		return 0, ErrSyntax
+	}
+	neg := false
+	body := s
+	if s[0] == '+' || s[0] == '-' {
+		neg = s[0] == '-'
+		body = s[1:]
+	}
+	word := body.tolower()
+	if word == "inf" || word == "infinity" {
+		if neg {
+			return C.xstrconv_inf(-1), nil
+		}
+		return C.xstrconv_inf(1), nil
+	}
+	if word == "nan" && body.len == s.len {
+		return C.xstrconv_nan(), nil
+	}
+	if !floatsyntax(body) {
+		return 0, ErrSyntax
+	}
+	if s.index("_") >= 0 {
+		if !underscoreok(s) {
+			return 0, ErrSyntax
+		}
+		s = s.replaceall("_", "")
+	}
+	var f float64
+	rv := C.xstrconv_atof(s.ptr, s.len, bitSize, &f)
+	if rv == -1 {
+		return 0, ErrSyntax
+	}
+	if rv == -2 {
+		return f, ErrRange
+	}
+	return f, nil
+}
+
+// the go forms strtod also takes are left out: leading spaces, a hex
+// mantissa without p exponent, nan(...). strtod checks the rest
+func floatsyntax(s string) bool {
+	if s.len == 0 {
+		return false
+	}
+	hex := s.len >= 2 && s[0] == '0' && lower(s[1]) == 'x'
+	start := 0
+	if hex {
+		start = 2
+	}
+	sawexp := false
+	for i := start; i < s.len; i++ {
+		c := s[i]
+		if (c >= '0' && c <= '9') || c == '.' || c == '_' {
+			continue
+		}
+		if hex && lower(c) >= 'a' && lower(c) <= 'f' && !sawexp {
+			continue
+		}
+		if (hex && lower(c) == 'p') || (!hex && lower(c) == 'e') {
+			sawexp = true
+			continue
+		}
+		if (c == '+' || c == '-') && i > 0 && (lower(s[i-1]) == 'e' || lower(s[i-1]) == 'p') {
+			continue
+		}
+		return false
+	}
+	return !hex || sawexp
+}
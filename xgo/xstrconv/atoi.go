@@ -0,0 +1,172 @@
+package xstrconv
+
+import "xgo/xerrors"
+
+const maxuint64 = 0xffffffffffffffff
+
+// bits of int, a C int here
+const IntSize = 32
+
+func lower(c byte) byte { return c | 0x20 }
+
+// s in base, 2 to 36. base 0 takes the prefix: 0b, 0o, 0 or 0x, and
+// allows _ between digits. bitSize 0 is IntSize.
+// out of range gives the max value with ErrRange
+func ParseUint(s string, base int, bitSize int) (uint64, error) {
+	n, err := parseuint(s, base, bitSize)
+	if err != nil {
+		return n, numerror("ParseUint", s, err)
+	}
+	return n, nil
+}
+
+// like ParseUint with an optional sign.
+// out of range gives the min or max value with ErrRange
+func ParseInt(s string, base int, bitSize int) (int64, error) {
+	n, err := parseint(s, base, bitSize)
+	if err != nil {
+		return n, numerror("ParseInt", s, err)
+	}
+	return n, nil
+}
+
+func parseuint(s string, base int, bitSize int) (uint64, error) {
+	if s.len == 0 {
+		return 0, ErrSyntax
+	}
+	base0 := base == 0
+	start := 0
+	if base0 {
+		base = 10
+		if s[0] == '0' {
+			if s.len >= 3 && lower(s[1]) == 'b' {
+				base = 2
+				start = 2
+			} else if s.len >= 3 && lower(s[1]) == 'o' {
+				base = 8
+				start = 2
+			} else if s.len >= 3 && lower(s[1]) == 'x' {
+				base = 16
+				start = 2
+			} else {
+				base = 8
+				start = 1
+			}
+		}
+	} else if base < 2 || base > 36 {
+		return 0, xerrors.New("invalid base " + Itoa(base))
+	}
+	if bitSize == 0 {
+		bitSize = IntSize
+	} else if bitSize < 0 || bitSize > 64 {
+		return 0, xerrors.New("invalid bit size " + Itoa(bitSize))
+	}
+
+	// the smallest n with n*base > maxuint64
+	cutoff := uint64(maxuint64)/uint64(base) + 1
+	maxval := uint64(maxuint64)
+	if bitSize < 64 {
+		maxval = (uint64(1) << uint(bitSize)) - 1
+	}
+
+	underscores := false
+	var n uint64
+	for i := start; i < s.len; i++ {
+		c := s[i]
+		d := 0
+		if c == '_' && base0 {
+			underscores = true
+			continue
+		} else if c >= '0' && c <= '9' {
+			d = int(c - '0')
+		} else if lower(c) >= 'a' && lower(c) <= 'z' {
+			d = int(lower(c)-'a') + 10
+		} else {
+			return 0, ErrSyntax
+		}
+		if d >= base {
+			return 0, ErrSyntax
+		}
+		if n >= cutoff {
+			return maxval, ErrRange
+		}
+		n *= uint64(base)
+		n1 := n + uint64(d)
+		if n1 < n || n1 > maxval {
+			return maxval, ErrRange
+		}
+		n = n1
+	}
+	if underscores && !underscoreok(s) {
+		return 0, ErrSyntax
+	}
+	return n, nil
+}
+
+func parseint(s string, base int, bitSize int) (int64, error) {
+	if s.len == 0 {
+		return 0, ErrSyntax
+	}
+	neg := false
+	if s[0] == '+' {
+		s = s[1:]
+	} else if s[0] == '-' {
+		neg = true
+		s = s[1:]
+	}
+	un, err := parseuint(s, base, bitSize)
+	if err != nil && err != ErrRange {
+		return 0, err
+	}
+	if bitSize == 0 {
+		bitSize = IntSize
+	}
+	cutoff := uint64(1) << uint(bitSize-1)
+	if !neg && un >= cutoff {
+		return int64(cutoff - 1), ErrRange
+	}
+	if neg && un > cutoff {
+		return int64(-cutoff), ErrRange
+	}
+	if neg {
+		return int64(-un), nil
+	}
+	return int64(un), nil
+}
+
+// _ only between digits, or after a base prefix
+func underscoreok(s string) bool {
+	saw := '^' // ^ start, 0 digit or prefix, _ underscore, ! other
+	i := 0
+	if s.len >= 1 && (s[0] == '-' || s[0] == '+') {
+		i = 1
+	}
+	hex := false
+	if s.len-i >= 2 && s[i] == '0' {
+		c := lower(s[i+1])
+		if c == 'b' || c == 'o' || c == 'x' {
+			hex = c == 'x'
+			i += 2
+			saw = '0'
+		}
+	}
+	for ; i < s.len; i++ {
+		c := s[i]
+		if (c >= '0' && c <= '9') || (hex && lower(c) >= 'a' && lower(c) <= 'f') {
+			saw = '0'
+			continue
+		}
+		if c == '_' {
+			if saw != '0' {
+				return false
+			}
+			saw = '_'
+			continue
+		}
+		if saw == '_' {
+			return false
+		}
+		saw = '!'
+	}
+	return saw != '_'
+}
@@ -0,0 +1,98 @@
+package xstrconv
+
+/*
+#include <math.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+// f in fmt e, E, f, g or G with prec digits into buf. prec < 0 takes the
+// fewest digits that read back as the same float of bits 32 or 64,
+// and %g then switches to %e for exponents < -4 or >= 6, like go
+static int xstrconv_ftoa(char* buf, int n, double f, int fmt, int prec, int bits) {
+    int rv;
+    if (isnan(f)) return snprintf(buf, n, "NaN");
+    if (isinf(f)) return snprintf(buf, n, f > 0 ? "+Inf" : "-Inf");
+    if (bits == 32) f = (float)f;
+    if (prec < 0) {
+        char tmp[40];
+        int digs = bits == 32 ? 9 : 17;
+        for (int d = 1; d < digs; d++) {
+            snprintf(tmp, sizeof(tmp), "%.*e", d - 1, f);
+            if (bits == 32 ? strtof(tmp, 0) == (float)f : strtod(tmp, 0) == f) {
+                digs = d;
+                break;
+            }
+        }
+        snprintf(tmp, sizeof(tmp), "%.*e", digs - 1, f);
+        int exp = atoi(strchr(tmp, 'e') + 1);
+        if (fmt == 'g' || fmt == 'G') {
+            if (exp < -4 || exp >= 6) fmt = fmt == 'G' ? 'E' : 'e';
+            else fmt = 'f';
+        }
+        if (fmt != 'f') {
+            prec = digs - 1;
+        } else {
+            // %f would print all digits of the binary value, 1e23 is
+            // 99999999999999991611392 then. pad the shortest ones with 0
+            char ds[20];
+            char* p = tmp;
+            int nd = 0, pos = 0;
+            for (; *p != 'e'; p++) {
+                if (*p >= '0' && *p <= '9') ds[nd++] = *p;
+            }
+            if (signbit(f) && pos < n - 1) buf[pos++] = '-';
+            for (int i = 0; i <= exp && pos < n - 1; i++) {
+                buf[pos++] = i < nd ? ds[i] : '0';
+            }
+            if (exp < 0 && pos < n - 1) buf[pos++] = '0';
+            int ifrom = exp + 1;
+            if (ifrom < nd && pos < n - 1) buf[pos++] = '.';
+            for (int i = ifrom; i < nd && pos < n - 1; i++) {
+                buf[pos++] = i < 0 ? '0' : ds[i];
+            }
+            buf[pos] = 0;
+            return pos;
+        }
+    }
+    switch (fmt) {
+    case 'e': rv = snprintf(buf, n, "%.*e", prec, f); break;
+    case 'E': rv = snprintf(buf, n, "%.*E", prec, f); break;
+    case 'f': rv = snprintf(buf, n, "%.*f", prec, f); break;
+    case 'g': rv = snprintf(buf, n, "%.*g", prec, f); break;
+    default: rv = snprintf(buf, n, "%.*G", prec, f); break;
+    }
+    return rv < n ? rv : n - 1;
+}
+*/
+import "C"
+
+// fmt is 'e' (-d.ddde+dd), 'E', 'f' (-ddd.ddd), 'g' (e for large
+// exponents, f otherwise) or 'G'. prec is the digits after the point for
+// e and f, all digits for g, -1 for the fewest that ParseFloat reads back
+// to the same value. bitSize 32 formats f as a float32.
+// +Inf, -Inf and NaN for those
+func FormatFloat(f float64, fmt byte, prec int, bitSize int) string {
+	if fmt != 'e' && fmt != 'E' && fmt != 'f' && fmt != 'g' && fmt != 'G' {
+		bad := make([]byte, 2)
+		bad[0] = '%'
+		bad[1] = fmt
+		return string(bad)
+	}
+	size := 340 // %f of 1e308
+	if prec > 0 {
+		size += prec
+	}
+	buf := make([]byte, size)
+	n := C.xstrconv_ftoa(buf.ptr, buf.len, f, fmt, prec, bitSize)
+	part := buf[:n]
+	return string(part)
+}
+
+// dst with FormatFloat(f, fmt, prec, bitSize) appended
+func AppendFloat(dst []byte, f float64, fmt byte, prec int, bitSize int) []byte {
+	s := FormatFloat(f, fmt, prec, bitSize)
+	part := []byte(s)
+	dst = append(dst, part...)
+	return dst
+}
@@ -0,0 +1,45 @@
+package xstrconv
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// lower case letters for digits >= 10, base is 2 to 36
+func FormatUint(i uint64, base int) string {
+	if base < 2 || base > 36 {
+		panic("strconv: illegal AppendInt/FormatInt base")
+	}
+	buf := make([]byte, 64)
+	pos := buf.len
+	b := uint64(base)
+	for {
+		pos--
+		buf[pos] = digits[int(i%b)]
+		i /= b
+		if i == 0 {
+			break
+		}
+	}
+	part := buf[pos:]
+	return string(part)
+}
+
+func FormatInt(i int64, base int) string {
+	if i >= 0 {
+		return FormatUint(uint64(i), base)
+	}
+	return "-" + FormatUint(-uint64(i), base)
+}
+
+// dst with FormatInt(i, base) appended
+func AppendInt(dst []byte, i int64, base int) []byte {
+	s := FormatInt(i, base)
+	part := []byte(s)
+	dst = append(dst, part...)
+	return dst
+}
+
+func AppendUint(dst []byte, i uint64, base int) []byte {
+	s := FormatUint(i, base)
+	part := []byte(s)
+	dst = append(dst, part...)
+	return dst
+}
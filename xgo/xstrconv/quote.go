@@ -0,0 +1,274 @@
+package xstrconv
+
+const lowerhex = "0123456789abcdef"
+
+// length of the valid utf-8 sequence at s[i], ending before end,
+// 1 for an invalid one
+func utf8len(s string, i int, end int) int {
+	c := s[i]
+	n := 1
+	if c < 0x80 {
+		return 1
+	} else if (c & 0xe0) == 0xc0 {
+		n = 2
+	} else if (c & 0xf0) == 0xe0 {
+		n = 3
+	} else if (c & 0xf8) == 0xf0 {
+		n = 4
+	} else {
+		return 1
+	}
+	if i+n > end {
+		return 1
+	}
+	v := uint32(c) & (0x7f >> uint(n))
+	for j := 1; j < n; j++ {
+		cc := s[i+j]
+		if (cc & 0xc0) != 0x80 {
+			return 1
+		}
+		v = (v << 6) | uint32(cc&0x3f)
+	}
+	if n == 2 && v < 0x80 {
+		return 1
+	}
+	if n == 3 && (v < 0x800 || (v >= 0xd800 && v < 0xe000)) {
+		return 1
+	}
+	if n == 4 && (v < 0x10000 || v > 0x10ffff) {
+		return 1
+	}
+	return n
+}
+
+func validrune(r uint32) bool {
+	return r < 0xd800 || (r >= 0xe000 && r <= 0x10ffff)
+}
+
+// r as utf-8 into buf at pos, the new pos
+func encoderune(buf []byte, pos int, r uint32) int {
+	if r < 0x80 {
+		buf[pos] = byte(r)
+		return pos + 1
+	}
+	if r < 0x800 {
+		buf[pos] = byte(0xc0 | (r >> 6))
+		buf[pos+1] = byte(0x80 | (r & 0x3f))
+		return pos + 2
+	}
+	if r < 0x10000 {
+		buf[pos] = byte(0xe0 | (r >> 12))
+		buf[pos+1] = byte(0x80 | ((r >> 6) & 0x3f))
+		buf[pos+2] = byte(0x80 | (r & 0x3f))
+		return pos + 3
+	}
+	buf[pos] = byte(0xf0 | (r >> 18))
+	buf[pos+1] = byte(0x80 | ((r >> 12) & 0x3f))
+	buf[pos+2] = byte(0x80 | ((r >> 6) & 0x3f))
+	buf[pos+3] = byte(0x80 | (r & 0x3f))
+	return pos + 4
+}
+
+func unhex(c byte) int {
+	if c >= '0' && c <= '9' {
+		return int(c - '0')
+	}
+	if lower(c) >= 'a' && lower(c) <= 'f' {
+		return int(lower(c)-'a') + 10
+	}
+	return -1
+}
+
+// s in double quotes with go escapes for ", \, control bytes and
+// invalid utf-8. valid utf-8 is kept as is
+func Quote(s string) string {
+	buf := make([]byte, s.len*4+2)
+	pos := 0
+	buf[pos] = '"'
+	pos++
+	for i := 0; i < s.len; {
+		c := s[i]
+		if c >= 0x80 {
+			n := utf8len(s, i, s.len)
+			if n > 1 {
+				for j := 0; j < n; j++ {
+					buf[pos] = s[i+j]
+					pos++
+				}
+				i += n
+				continue
+			}
+		}
+		i++
+		var esc byte
+		switch c {
+		case '"', '\\':
+			esc = c
+		case '\a':
+			esc = 'a'
+		case '\b':
+			esc = 'b'
+		case '\f':
+			esc = 'f'
+		case '\n':
+			esc = 'n'
+		case '\r':
+			esc = 'r'
+		case '\t':
+			esc = 't'
+		case '\v':
+			esc = 'v'
+		}
+		if esc != 0 {
+			buf[pos] = '\\'
+			buf[pos+1] = esc
+			pos += 2
+		} else if c < 0x20 || c >= 0x7f {
+			buf[pos] = '\\'
+			buf[pos+1] = 'x'
+			buf[pos+2] = lowerhex[int(c>>4)]
+			buf[pos+3] = lowerhex[int(c&0xf)]
+			pos += 4
+		} else {
+			buf[pos] = c
+			pos++
+		}
+	}
+	buf[pos] = '"'
+	pos++
+	part := buf[:pos]
+	return string(part)
+}
+
+// s as a go literal: "..." with escapes, `...` raw, or '.' one rune
+func Unquote(s string) (string, error) {
+	n := s.len
+	if n < 2 || s[0] != s[n-1] {
+		return "", ErrSyntax
+	}
+	quote := s[0]
+	buf := make([]byte, n)
+	pos := 0
+	if quote == '`' {
+		for i := 1; i < n-1; i++ {
+			c := s[i]
+			if c == '`' {
+				return "", ErrSyntax
+			}
+			if c != '\r' {
+				buf[pos] = c
+				pos++
+			}
+		}
+		part := buf[:pos]
+		return string(part), nil
+	}
+	if quote != '"' && quote != '\'' {
+		return "", ErrSyntax
+	}
+
+	units := 0 // runes or escaped bytes
+	end := n - 1
+	for i := 1; i < end; {
+		c := s[i]
+		if c == quote || c == '\n' {
+			return "", ErrSyntax
+		}
+		units++
+		if c != '\\' {
+			l := utf8len(s, i, end)
+			for j := 0; j < l; j++ {
+				buf[pos] = s[i+j]
+				pos++
+			}
+			i += l
+			continue
+		}
+		if i+1 >= end {
+			return "", ErrSyntax
+		}
+		c = s[i+1]
+		i += 2
+		var ch byte
+		switch c {
+		case 'a':
+			ch = '\a'
+		case 'b':
+			ch = '\b'
+		case 'f':
+			ch = '\f'
+		case 'n':
+			ch = '\n'
+		case 'r':
+			ch = '\r'
+		case 't':
+			ch = '\t'
+		case 'v':
+			ch = '\v'
+		case '\\':
+			ch = '\\'
+		case '\'', '"':
+			if c != quote {
+				return "", ErrSyntax
+			}
+			ch = c
+		}
+		if ch != 0 {
+			buf[pos] = ch
+			pos++
+		} else if c == 'x' || c == 'u' || c == 'U' {
+			cnt := 2
+			if c == 'u' {
+				cnt = 4
+			} else if c == 'U' {
+				cnt = 8
+			}
+			if i+cnt > end {
+				return "", ErrSyntax
+			}
+			var v uint32
+			for j := 0; j < cnt; j++ {
+				d := unhex(s[i+j])
+				if d < 0 {
+					return "", ErrSyntax
+				}
+				v = (v << 4) | uint32(d)
+			}
+			i += cnt
+			if c == 'x' {
+				buf[pos] = byte(v)
+				pos++
+			} else {
+				if !validrune(v) {
+					return "", ErrSyntax
+				}
+				pos = encoderune(buf, pos, v)
+			}
+		} else if c >= '0' && c <= '7' {
+			if i+2 > end {
+				return "", ErrSyntax
+			}
+			v := int(c - '0')
+			for j := 0; j < 2; j++ {
+				d := int(s[i+j]) - '0'
+				if d < 0 || d > 7 {
+					return "", ErrSyntax
+				}
+				v = v*8 + d
+			}
+			i += 2
+			if v > 255 {
+				return "", ErrSyntax
+			}
+			buf[pos] = byte(v)
+			pos++
+		} else {
+			return "", ErrSyntax
+		}
+	}
+	if quote == '\'' && units != 1 {
+		return "", ErrSyntax
+	}
+	part := buf[:pos]
+	return string(part), nil
+}
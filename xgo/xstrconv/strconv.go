@@ -1,19 +1,84 @@
 package xstrconv
 
-/*
-#include <stdlib.h>
-*/
-import "C"
+import "xgo/xerrors"
 
-func Atoi(s string) int {
-	rv := C.atoi(s.ptr)
-	return rv
+// Conversions between strings and numbers, bools and quoted strings,
+// like go's strconv. Parse errors are *NumError.
+
+// out of range for the bit size
+var ErrRange = xerrors.New("value out of range")
+
+// not a number of the wanted form
+var ErrSyntax = xerrors.New("invalid syntax")
+
+type NumError struct {
+	Func string // the failing function, like "ParseInt"
+	Num  string // the input
+	Err  error  // ErrRange, ErrSyntax or a base/bit size error
+}
+
+func (e *NumError) Error() string {
+	return "strconv." + e.Func + ": parsing " + Quote(e.Num) + ": " + e.Err.Error()
 }
-func Atol(s string) i64 {
-	rv := C.atoll(s.ptr)
-	return rv
+
+func (e *NumError) Unwrap() error { return e.Err }
+
+func numerror(fn string, s string, err error) *NumError {
+	e := &NumError{}
+	e.Func = fn
+	e.Num = s
+	e.Err = err
+	return e
 }
-func Atof(s string) f32 {
-	rv := C.atof(s.ptr)
-	return rv
+
+// ParseInt(s, 10, 32), int is 32 bits here
+func Atoi(s string) (int, error) {
+	n, err := parseint(s, 10, IntSize)
+	if err != nil {
+		return int(n), numerror("Atoi", s, err)
+	}
+	return int(n), nil
+}
+
+// ParseInt(s, 10, 64)
+func Atol(s string) (int64, error) {
+	n, err := parseint(s, 10, 64)
+	if err != nil {
+		return n, numerror("Atol", s, err)
+	}
+	return n, nil
 }
+
+// ParseFloat(s, 64)
+func Atof(s string) (float64, error) {
+	f, err := parsefloat(s, 64)
+	if err != nil {
+		return f, numerror("Atof", s, err)
+	}
+	return f, nil
+}
+
+// FormatInt(i, 10)
+func Itoa(i int) string {
+	return FormatInt(int64(i), 10)
+}
+
+// 1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False
+func ParseBool(s string) (bool, error) {
+	switch s {
+	case "1", "t", "T", "TRUE", "true", "True":
+		return true, nil
+	case "0", "f", "F", "FALSE", "false", "False":
+		return false, nil
+	}
+	return false, numerror("ParseBool", s, ErrSyntax)
+}
+
+func FormatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func Keep() {}
@@ -0,0 +1,54 @@
+package xstrconv
+
+func test_parseint1() {
+	n, err := ParseInt("-0x1f", 0, 64)
+	println(n, err == nil) // -31 true
+	n, err = ParseInt("1_000", 0, 64)
+	println(n, err == nil) // 1000 true
+	n, err = ParseInt("128", 10, 8)
+	println(n, err.Error()) // 127 strconv.ParseInt: parsing "128": value out of range
+	u, err := ParseUint("zz", 36, 0)
+	println(u, err == nil) // 1295 true
+	n, err = ParseInt("2147483648", 10, 0)
+	println(n, err != nil) // 2147483647 true, int is 32 bits
+	_, err = Atoi("12a")
+	println(err.Error()) // strconv.Atoi: parsing "12a": invalid syntax
+	b, _ := ParseBool("True")
+	println(b)
+}
+
+func test_format1() {
+	println(Itoa(-42), FormatInt(-255, 16), FormatUint(5, 2)) // -42 -ff 101
+	buf := []byte("n=")
+	buf = AppendInt(buf, 7, 10)
+	println(string(buf))                                                        // n=7
+	println(FormatFloat(0.1, 'g', -1, 64), FormatFloat(1e23, 'f', -1, 64))      // 0.1 100000000000000000000000
+	println(FormatFloat(3.14159, 'f', 2, 64), FormatFloat(1234567, 'e', 3, 64)) // 3.14 1.235e+06
+	println(FormatFloat(float64(float32(0.1)), 'g', -1, 32))                    // 0.1
+}
+
+func test_parsefloat1() {
+	f, err := ParseFloat("2.5e3", 64)
+	println(f == 2500, err == nil)
+	f, err = ParseFloat("0x1p-2", 64)
+	println(f == 0.25, err == nil)
+	f, err = ParseFloat("-Inf", 64)
+	println(FormatFloat(f, 'g', -1, 64), err == nil) // -Inf true
+	_, err = ParseFloat("1e400", 64)
+	println(err.Error()) // strconv.ParseFloat: parsing "1e400": value out of range
+	_, err = ParseFloat(" 1", 64)
+	println(err != nil)
+}
+
+func test_quote1() {
+	q := Quote("tab\there \"q\" \x01 é")
+	println(q) // "tab\there \"q\" \x01 é"
+	s, err := Unquote(q)
+	println(s == "tab\there \"q\" \x01 é", err == nil)
+	s, _ = Unquote("`raw\\n`")
+	println(s) // raw\n
+	s, _ = Unquote("'\\u00e9'")
+	println(s) // é
+	_, err = Unquote("'ab'")
+	println(err == ErrSyntax)
+}
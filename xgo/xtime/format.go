@@ -0,0 +1,1130 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtime
+
+import "xgo/xerrors"
+
+// Layouts show the reference time Mon Jan 2 15:04:05 MST 2006 the way
+// the Time should look, like go's time
+const (
+	Layout      = "01/02 03:04:05PM '06 -0700"
+	ANSIC       = "Mon Jan _2 15:04:05 2006"
+	UnixDate    = "Mon Jan _2 15:04:05 MST 2006"
+	RubyDate    = "Mon Jan 02 15:04:05 -0700 2006"
+	RFC822      = "02 Jan 06 15:04 MST"
+	RFC822Z     = "02 Jan 06 15:04 -0700"
+	RFC850      = "Monday, 02-Jan-06 15:04:05 MST"
+	RFC1123     = "Mon, 02 Jan 2006 15:04:05 MST"
+	RFC1123Z    = "Mon, 02 Jan 2006 15:04:05 -0700"
+	RFC3339     = "2006-01-02T15:04:05Z07:00"
+	RFC3339Nano = "2006-01-02T15:04:05.999999999Z07:00"
+	Kitchen     = "3:04PM"
+	Stamp       = "Jan _2 15:04:05"
+	StampMilli  = "Jan _2 15:04:05.000"
+	StampMicro  = "Jan _2 15:04:05.000000"
+	StampNano   = "Jan _2 15:04:05.000000000"
+	DateTime    = "2006-01-02 15:04:05"
+	DateOnly    = "2006-01-02"
+	TimeOnly    = "15:04:05"
+)
+
+// layout elements, the fractions also carry their digit count
+// in bits 8-15 and a comma separator in bit 16
+const (
+	stdlongmonth        = 1  // January
+	stdmonth            = 2  // Jan
+	stdnummonth         = 3  // 1
+	stdzeromonth        = 4  // 01
+	stdlongweekday      = 5  // Monday
+	stdweekday          = 6  // Mon
+	stdday              = 7  // 2
+	stdunderday         = 8  // _2
+	stdzeroday          = 9  // 02
+	stdunderyearday     = 10 // __2
+	stdzeroyearday      = 11 // 002
+	stdhour             = 12 // 15
+	stdhour12           = 13 // 3
+	stdzerohour12       = 14 // 03
+	stdminute           = 15 // 4
+	stdzerominute       = 16 // 04
+	stdsecond           = 17 // 5
+	stdzerosecond       = 18 // 05
+	stdlongyear         = 19 // 2006
+	stdyear             = 20 // 06
+	stdPM               = 21 // PM
+	stdpm               = 22 // pm
+	stdtz               = 23 // MST
+	stdisotz            = 24 // Z0700
+	stdisosecondstz     = 25 // Z070000
+	stdisoshorttz       = 26 // Z07
+	stdisocolontz       = 27 // Z07:00
+	stdisocolonsecondtz = 28 // Z07:00:00
+	stdnumtz            = 29 // -0700
+	stdnumsecondstz     = 30 // -070000
+	stdnumshorttz       = 31 // -07
+	stdnumcolontz       = 32 // -07:00
+	stdnumcolonsecondtz = 33 // -07:00:00
+	stdfracsecond0      = 34 // .0, .00, ... trailing zeros kept
+	stdfracsecond9      = 35 // .9, .99, ... trailing zeros dropped
+	stdmask             = 0xff
+)
+
+// sub at s[i]
+func hasat(s string, i int, sub string) bool {
+	if i+sub.len > s.len {
+		return false
+	}
+	for j := 0; j < sub.len; j++ {
+		if s[i+j] != sub[j] {
+			return false
+		}
+	}
+	return true
+}
+
+func isdigit(s string, i int) bool {
+	if i >= s.len {
+		return false
+	}
+	c := s[i]
+	return c >= '0' && c <= '9'
+}
+
+// the lower case letter at s[i] continues a word, like Janet
+func islowerat(s string, i int) bool {
+	if i >= s.len {
+		return false
+	}
+	c := s[i]
+	return c >= 'a' && c <= 'z'
+}
+
+// the layout before the first element, the element and the rest
+func nextstd(layout string) (string, int, string) {
+	for i := 0; i < layout.len; i++ {
+		c := layout[i]
+		std := 0
+		n := 0 // element length
+		pfx := i
+		switch c {
+		case 'J':
+			if hasat(layout, i, "January") {
+				std, n = stdlongmonth, 7
+			} else if hasat(layout, i, "Jan") && !islowerat(layout, i+3) {
+				std, n = stdmonth, 3
+			}
+		case 'M':
+			if hasat(layout, i, "Monday") {
+				std, n = stdlongweekday, 6
+			} else if hasat(layout, i, "Mon") && !islowerat(layout, i+3) {
+				std, n = stdweekday, 3
+			} else if hasat(layout, i, "MST") {
+				std, n = stdtz, 3
+			}
+		case '0':
+			if i+1 < layout.len && layout[i+1] >= '1' && layout[i+1] <= '6' {
+				n = 2
+				switch layout[i+1] {
+				case '1':
+					std = stdzeromonth
+				case '2':
+					std = stdzeroday
+				case '3':
+					std = stdzerohour12
+				case '4':
+					std = stdzerominute
+				case '5':
+					std = stdzerosecond
+				case '6':
+					std = stdyear
+				}
+			} else if hasat(layout, i, "002") {
+				std, n = stdzeroyearday, 3
+			}
+		case '1':
+			if hasat(layout, i, "15") {
+				std, n = stdhour, 2
+			} else {
+				std, n = stdnummonth, 1
+			}
+		case '2':
+			if hasat(layout, i, "2006") {
+				std, n = stdlongyear, 4
+			} else {
+				std, n = stdday, 1
+			}
+		case '_':
+			if hasat(layout, i, "_2006") {
+				// a literal _ and the year
+				std, n = stdlongyear, 5
+				pfx = i + 1
+			} else if hasat(layout, i, "_2") {
+				std, n = stdunderday, 2
+			} else if hasat(layout, i, "__2") {
+				std, n = stdunderyearday, 3
+			}
+		case '3':
+			std, n = stdhour12, 1
+		case '4':
+			std, n = stdminute, 1
+		case '5':
+			std, n = stdsecond, 1
+		case 'P':
+			if hasat(layout, i, "PM") {
+				std, n = stdPM, 2
+			}
+		case 'p':
+			if hasat(layout, i, "pm") {
+				std, n = stdpm, 2
+			}
+		case '-':
+			if hasat(layout, i, "-070000") {
+				std, n = stdnumsecondstz, 7
+			} else if hasat(layout, i, "-07:00:00") {
+				std, n = stdnumcolonsecondtz, 9
+			} else if hasat(layout, i, "-0700") {
+				std, n = stdnumtz, 5
+			} else if hasat(layout, i, "-07:00") {
+				std, n = stdnumcolontz, 6
+			} else if hasat(layout, i, "-07") {
+				std, n = stdnumshorttz, 3
+			}
+		case 'Z':
+			if hasat(layout, i, "Z070000") {
+				std, n = stdisosecondstz, 7
+			} else if hasat(layout, i, "Z07:00:00") {
+				std, n = stdisocolonsecondtz, 9
+			} else if hasat(layout, i, "Z0700") {
+				std, n = stdisotz, 5
+			} else if hasat(layout, i, "Z07:00") {
+				std, n = stdisocolontz, 6
+			} else if hasat(layout, i, "Z07") {
+				std, n = stdisoshorttz, 3
+			}
+		case '.', ',':
+			// fractional seconds only if the digits end here
+			if i+1 < layout.len && (layout[i+1] == '0' || layout[i+1] == '9') {
+				ch := layout[i+1]
+				j := i + 1
+				for j < layout.len && layout[j] == ch {
+					j++
+				}
+				if !isdigit(layout, j) {
+					std = stdfracsecond0
+					if ch == '9' {
+						std = stdfracsecond9
+					}
+					std |= (j - i - 1) << 8
+					if c == ',' {
+						std |= 0x10000
+					}
+					n = j - i
+				}
+			}
+		}
+		if std != 0 {
+			return layout[:pfx], std, layout[i+n:]
+		}
+	}
+	return layout, 0, ""
+}
+
+// x in decimal, zero padded to width
+func itoaw(x int, width int) string {
+	neg := x < 0
+	if neg {
+		x = -x
+	}
+	s := x.repr()
+	for s.len < width {
+		s = "0" + s
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// ".123" of nsec for a frac std
+func fracstr(nsec int, std int) string {
+	n := (std >> 8) & 0xff
+	trim := (std & stdmask) == stdfracsecond9
+	if trim && (n == 0 || nsec == 0) {
+		return ""
+	}
+	digits := itoaw(nsec, 9)
+	if n < 9 {
+		digits = digits[:n]
+	}
+	if trim {
+		end := digits.len
+		for end > 0 && digits[end-1] == '0' {
+			end--
+		}
+		if end == 0 {
+			return ""
+		}
+		digits = digits[:end]
+	}
+	if (std & 0x10000) != 0 {
+		return "," + digits
+	}
+	return "." + digits
+}
+
+// t by layout, which shows the reference time
+// Mon Jan 2 15:04:05 MST 2006 like t should look
+func (t *Time) Format(layout string) string {
+	name, offset := t.Zone()
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	res := ""
+	for layout.len > 0 {
+		prefix, std, suffix := nextstd(layout)
+		res += prefix
+		if std == 0 {
+			break
+		}
+		layout = suffix
+
+		code := std & stdmask
+		switch code {
+		case stdyear:
+			y := year
+			if y < 0 {
+				y = -y
+			}
+			res += itoaw(y%100, 2)
+		case stdlongyear:
+			res += itoaw(year, 4)
+		case stdmonth:
+			mname := month.String()
+			res += mname[:3]
+		case stdlongmonth:
+			res += month.String()
+		case stdnummonth:
+			res += itoaw(int(month), 0)
+		case stdzeromonth:
+			res += itoaw(int(month), 2)
+		case stdweekday:
+			wd := t.Weekday()
+			dname := wd.String()
+			res += dname[:3]
+		case stdlongweekday:
+			wd := t.Weekday()
+			res += wd.String()
+		case stdday:
+			res += itoaw(day, 0)
+		case stdunderday:
+			if day < 10 {
+				res += " "
+			}
+			res += itoaw(day, 0)
+		case stdzeroday:
+			res += itoaw(day, 2)
+		case stdunderyearday:
+			yday := t.YearDay()
+			if yday < 100 {
+				res += " "
+				if yday < 10 {
+					res += " "
+				}
+			}
+			res += itoaw(yday, 0)
+		case stdzeroyearday:
+			res += itoaw(t.YearDay(), 3)
+		case stdhour:
+			res += itoaw(hour, 2)
+		case stdhour12, stdzerohour12:
+			hr := hour % 12
+			if hr == 0 {
+				hr = 12
+			}
+			if code == stdzerohour12 {
+				res += itoaw(hr, 2)
+			} else {
+				res += itoaw(hr, 0)
+			}
+		case stdminute:
+			res += itoaw(min, 0)
+		case stdzerominute:
+			res += itoaw(min, 2)
+		case stdsecond:
+			res += itoaw(sec, 0)
+		case stdzerosecond:
+			res += itoaw(sec, 2)
+		case stdPM:
+			if hour >= 12 {
+				res += "PM"
+			} else {
+				res += "AM"
+			}
+		case stdpm:
+			if hour >= 12 {
+				res += "pm"
+			} else {
+				res += "am"
+			}
+		case stdtz:
+			if name.len > 0 {
+				res += name
+			} else {
+				// no name, -0700 then
+				res += offsetstr(offset, stdnumtz)
+			}
+		case stdfracsecond0, stdfracsecond9:
+			res += fracstr(t.nsec, std)
+		default:
+			// the Z and - zone offsets
+			if offset == 0 && code >= stdisotz && code <= stdisocolonsecondtz {
+				res += "Z"
+			} else {
+				res += offsetstr(offset, code)
+			}
+		}
+	}
+	return res
+}
+
+// +hh[[:]mm[[:]ss]] of offset seconds for one of the tz elements
+func offsetstr(offset int, code int) string {
+	res := "+"
+	if offset < 0 {
+		res = "-"
+		offset = -offset
+	}
+	res += itoaw(offset/3600, 2)
+	if code == stdisoshorttz || code == stdnumshorttz {
+		return res
+	}
+	colon := code == stdisocolontz || code == stdisocolonsecondtz ||
+		code == stdnumcolontz || code == stdnumcolonsecondtz
+	if colon {
+		res += ":"
+	}
+	res += itoaw((offset/60)%60, 2)
+	if code == stdisosecondstz || code == stdisocolonsecondtz ||
+		code == stdnumsecondstz || code == stdnumcolonsecondtz {
+		if colon {
+			res += ":"
+		}
+		res += itoaw(offset%60, 2)
+	}
+	return res
+}
+
+// like 2006-01-02 15:04:05.999999999 -0700 MST, with the monotonic
+// reading as m=+sec.nsec if t has one
+func (t *Time) String() string {
+	s := t.Format("2006-01-02 15:04:05.999999999 -0700 MST")
+	if t.mono != 0 {
+		m := t.mono
+		sign := " m=+"
+		if m < 0 {
+			sign = " m=-"
+			m = -m
+		}
+		msec := m / 1000000000
+		s += sign + msec.repr() + "." + itoaw(int(m%1000000000), 9)
+	}
+	return s
+}
+
+type ParseError struct {
+	Layout     string
+	Value      string
+	LayoutElem string
+	ValueElem  string
+	Message    string
+}
+
+func newparseerror(layout string, value string, layoutelem string, valueelem string, msg string) *ParseError {
+	e := &ParseError{}
+	e.Layout = layout
+	e.Value = value
+	e.LayoutElem = layoutelem
+	e.ValueElem = valueelem
+	e.Message = msg
+	return e
+}
+
+func quote(s string) string { return "\"" + s + "\"" }
+
+func (e *ParseError) Error() string {
+	if e.Message.len == 0 {
+		return "parsing time " + quote(e.Value) + " as " + quote(e.Layout) +
+			": cannot parse " + quote(e.ValueElem) + " as " + quote(e.LayoutElem)
+	}
+	return "parsing time " + quote(e.Value) + e.Message
+}
+
+var errbad = xerrors.New("bad value for field")
+
+// the decimal at value[0:], at most max digits, exactly max if fixed.
+// the number and its length, -1 for none
+func getnum(value string, fixed bool, max int) (int, int) {
+	if !isdigit(value, 0) {
+		return 0, -1
+	}
+	n := 0
+	i := 0
+	for i < max && isdigit(value, i) {
+		n = n*10 + int(value[i]-'0')
+		i++
+	}
+	if fixed && i != max {
+		return 0, -1
+	}
+	return n, i
+}
+
+// the index in names matching value's start in any case, and its length
+func matchname(names []string, value string, short bool) (int, int) {
+	for i, name := range names {
+		if short {
+			name = name[:3]
+		}
+		if value.len >= name.len {
+			part := value[:name.len]
+			lpart := part.tolower()
+			lname := name.tolower()
+			if lpart == lname {
+				return i, name.len
+			}
+		}
+	}
+	return -1, 0
+}
+
+// the length of +hh or -hh at value's start, hh up to 23, 0 if none
+func signedoffsetlen(value string) int {
+	if value.len == 0 || (value[0] != '+' && value[0] != '-') {
+		return 0
+	}
+	h := 0
+	i := 1
+	for isdigit(value, i) && h <= 23 {
+		h = h*10 + int(value[i]-'0')
+		i++
+	}
+	if i == 1 || h > 23 {
+		return 0
+	}
+	return i
+}
+
+// the length of a zone name at value's start, like MST, CEST, ChST,
+// GMT+8 or +07, 0 if none
+func zonenamelen(value string) int {
+	if value.len < 3 {
+		return 0
+	}
+	if hasat(value, 0, "ChST") || hasat(value, 0, "MeST") {
+		return 4
+	}
+	if hasat(value, 0, "GMT") {
+		return 3 + signedoffsetlen(value[3:])
+	}
+	if value[0] == '+' || value[0] == '-' {
+		return signedoffsetlen(value)
+	}
+	n := 0
+	for n < value.len && n < 6 && value[n] >= 'A' && value[n] <= 'Z' {
+		n++
+	}
+	if n == 3 {
+		return 3
+	}
+	if n == 4 && (value[3] == 'T' || hasat(value, 0, "WITA")) {
+		return 4
+	}
+	if n == 5 && value[4] == 'T' {
+		return 5
+	}
+	return 0
+}
+
+// value without the literal prefix, spaces in prefix match any
+// run of spaces
+func skip(value string, prefix string) (string, bool) {
+	i := 0
+	j := 0
+	for j < prefix.len {
+		if prefix[j] == ' ' {
+			if i < value.len && value[i] != ' ' {
+				return value, false
+			}
+			for j < prefix.len && prefix[j] == ' ' {
+				j++
+			}
+			for i < value.len && value[i] == ' ' {
+				i++
+			}
+			continue
+		}
+		if i >= value.len || value[i] != prefix[j] {
+			return value, false
+		}
+		i++
+		j++
+	}
+	return value[i:], true
+}
+
+// the Time value shows in layout. without a zone in value it is UTC,
+// with an offset it is Local if that matches, a fixed zone otherwise
+func Parse(layout string, value string) (*Time, error) {
+	return parse(layout, value, UTC, Local)
+}
+
+// like Parse, loc for values without a zone and for zone names
+func ParseInLocation(layout string, value string, loc *Location) (*Time, error) {
+	return parse(layout, value, loc, loc)
+}
+
+func parse(layout string, value string, defloc *Location, local *Location) (*Time, error) {
+	alayout := layout
+	avalue := value
+	rangeerr := ""
+	amset := false
+	pmset := false
+
+	year := 0
+	month := -1
+	day := -1
+	yday := -1
+	hour := 0
+	min := 0
+	sec := 0
+	nsec := 0
+	var z *Location
+	zoneoff := -1
+	zonename := ""
+
+	for {
+		prefix, std, suffix := nextstd(layout)
+		stdstr := layout[prefix.len : layout.len-suffix.len]
+		rest, ok := skip(value, prefix)
+		if !ok {
+			return nil, newparseerror(alayout, avalue, prefix, value, "")
+		}
+		value = rest
+		if std == 0 {
+			if value.len != 0 {
+				return nil, newparseerror(alayout, avalue, "", value, ": extra text: "+quote(value))
+			}
+			break
+		}
+		layout = suffix
+		hold := value
+		var err error
+		n := 0 // value bytes taken
+
+		code := std & stdmask
+		switch code {
+		case stdyear:
+			year, n = getnum(value, true, 2)
+			if year >= 69 {
+				// unix time starts Dec 31 1969 in some zones
+				year += 1900
+			} else {
+				year += 2000
+			}
+		case stdlongyear:
+			year, n = getnum(value, true, 4)
+		case stdmonth, stdlongmonth:
+			month, n = matchname(longmonthnames, value, code == stdmonth)
+			month++
+			if month == 0 {
+				n = -1
+			}
+		case stdnummonth, stdzeromonth:
+			month, n = getnum(value, code == stdzeromonth, 2)
+			if n > 0 && (month <= 0 || month > 12) {
+				rangeerr = "month"
+			}
+		case stdweekday, stdlongweekday:
+			// checked for the syntax only
+			wd := 0
+			wd, n = matchname(longdaynames, value, code == stdweekday)
+			if wd < 0 {
+				n = -1
+			}
+		case stdday, stdunderday, stdzeroday:
+			if code == stdunderday && value.len > 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+			day, n = getnum(value, code == stdzeroday, 2)
+		case stdunderyearday, stdzeroyearday:
+			for i := 0; i < 2; i++ {
+				if code == stdunderyearday && value.len > 0 && value[0] == ' ' {
+					value = value[1:]
+				}
+			}
+			yday, n = getnum(value, code == stdzeroyearday, 3)
+		case stdhour:
+			hour, n = getnum(value, false, 2)
+			if hour >= 24 {
+				rangeerr = "hour"
+			}
+		case stdhour12, stdzerohour12:
+			hour, n = getnum(value, code == stdzerohour12, 2)
+			if hour > 12 {
+				rangeerr = "hour"
+			}
+		case stdminute, stdzerominute:
+			min, n = getnum(value, code == stdzerominute, 2)
+			if min >= 60 {
+				rangeerr = "minute"
+			}
+		case stdsecond, stdzerosecond:
+			sec, n = getnum(value, code == stdzerosecond, 2)
+			if n < 0 {
+				break
+			}
+			if sec >= 60 {
+				rangeerr = "second"
+				break
+			}
+			// fractional seconds the layout has not
+			if value.len > n+1 && (value[n] == '.' || value[n] == ',') && isdigit(value, n+1) {
+				_, nstd, _ := nextstd(layout)
+				nstd &= stdmask
+				if nstd == stdfracsecond0 || nstd == stdfracsecond9 {
+					break
+				}
+				i := n + 1
+				for isdigit(value, i) {
+					i++
+				}
+				nsec = parsenano(value, n, i)
+				n = i
+			}
+		case stdPM, stdpm:
+			if hasat(value, 0, "PM") || hasat(value, 0, "pm") {
+				pmset = true
+				n = 2
+			} else if hasat(value, 0, "AM") || hasat(value, 0, "am") {
+				amset = true
+				n = 2
+			} else {
+				n = -1
+			}
+			if n > 0 && (code == stdPM) != (value[0] == 'P' || value[0] == 'A') {
+				n = -1
+			}
+		case stdtz:
+			if hasat(value, 0, "UTC") {
+				z = UTC
+				n = 3
+				break
+			}
+			n = zonenamelen(value)
+			if n == 0 {
+				n = -1
+				break
+			}
+			zonename = value[:n]
+		case stdfracsecond0:
+			// exactly the digits of the layout
+			ndigit := 1 + ((std >> 8) & 0xff)
+			if value.len < ndigit || (value[0] != '.' && value[0] != ',') {
+				n = -1
+				break
+			}
+			for i := 1; i < ndigit; i++ {
+				if !isdigit(value, i) {
+					n = -1
+				}
+			}
+			if n == 0 {
+				nsec = parsenano(value, 0, ndigit)
+				n = ndigit
+			}
+		case stdfracsecond9:
+			// any digits, or none at all
+			if value.len < 2 || (value[0] != '.' && value[0] != ',') || !isdigit(value, 1) {
+				break
+			}
+			i := 1
+			for isdigit(value, i) {
+				i++
+			}
+			nsec = parsenano(value, 0, i)
+			n = i
+		default:
+			// the Z and - zone offsets
+			if code >= stdisotz && code <= stdisocolonsecondtz && hasat(value, 0, "Z") {
+				z = UTC
+				n = 1
+				break
+			}
+			zoneoff, n = parseoffset(value, code)
+		}
+		if rangeerr.len > 0 {
+			return nil, newparseerror(alayout, avalue, stdstr, value, ": "+rangeerr+" out of range")
+		}
+		if n < 0 {
+			err = errbad
+		}
+		if err != nil {
+			return nil, newparseerror(alayout, avalue, stdstr, hold, "")
+		}
+		value = value[n:]
+	}
+	if pmset && hour < 12 {
+		hour += 12
+	} else if amset && hour == 12 {
+		hour = 0
+	}
+
+	// the year day to month and day
+	if yday >= 0 {
+		yleap := 0
+		if isleap(year) {
+			yleap = 1
+		}
+		if yday < 1 || yday > 365+yleap {
+			return nil, newparseerror(alayout, avalue, "", value, ": day-of-year out of range")
+		}
+		m := 1
+		d := yday
+		for d > daysin(Month(m), year) {
+			d -= daysin(Month(m), year)
+			m++
+		}
+		if month >= 0 && month != m {
+			return nil, newparseerror(alayout, avalue, "", value, ": day-of-year does not match month")
+		}
+		if day >= 0 && day != d {
+			return nil, newparseerror(alayout, avalue, "", value, ": day-of-year does not match day")
+		}
+		month = m
+		day = d
+	} else {
+		if month < 0 {
+			month = int(January)
+		}
+		if day < 0 {
+			day = 1
+		}
+	}
+	if day < 1 || day > daysin(Month(month), year) {
+		return nil, newparseerror(alayout, avalue, "", value, ": day out of range")
+	}
+
+	if z != nil {
+		return Date(year, Month(month), day, hour, min, sec, nsec, z), nil
+	}
+	if zoneoff != -1 {
+		t := Date(year, Month(month), day, hour, min, sec, nsec, UTC)
+		t.sec -= int64(zoneoff)
+		// the local zone if it has that offset then
+		lz := local.lookup(t.unixsec())
+		if lz.offset == zoneoff && (zonename.len == 0 || lz.name == zonename) {
+			t.loc = local
+			return t, nil
+		}
+		t.loc = FixedZone(zonename, zoneoff)
+		return t, nil
+	}
+	if zonename.len > 0 {
+		t := Date(year, Month(month), day, hour, min, sec, nsec, UTC)
+		offset, ok := local.lookupname(zonename, t.unixsec())
+		if ok {
+			t.sec -= int64(offset)
+			t.loc = local
+			return t, nil
+		}
+		// unknown zone, GMT+8 has its offset at least
+		offset = 0
+		if zonename.len > 3 && hasat(zonename, 0, "GMT") {
+			h, hn := getnum(zonename[4:], false, 2)
+			if hn > 0 && (zonename[3] == '+' || zonename[3] == '-') {
+				offset = h * 3600
+				if zonename[3] == '-' {
+					offset = -offset
+				}
+			}
+		}
+		t.loc = FixedZone(zonename, offset)
+		return t, nil
+	}
+	return Date(year, Month(month), day, hour, min, sec, nsec, defloc), nil
+}
+
+// nanoseconds of the digits value[from+1:to] after the separator,
+// digits beyond the ninth are dropped
+func parsenano(value string, from int, to int) int {
+	ns := 0
+	scale := 100000000
+	for i := from + 1; i < to && scale > 0; i++ {
+		ns += int(value[i]-'0') * scale
+		scale /= 10
+	}
+	return ns
+}
+
+// the offset seconds of a tz element and its length, -1 if bad
+func parseoffset(value string, code int) (int, int) {
+	if value.len < 3 || (value[0] != '+' && value[0] != '-') {
+		return 0, -1
+	}
+	colon := code == stdisocolontz || code == stdisocolonsecondtz ||
+		code == stdnumcolontz || code == stdnumcolonsecondtz
+	withsec := code == stdisosecondstz || code == stdisocolonsecondtz ||
+		code == stdnumsecondstz || code == stdnumcolonsecondtz
+	short := code == stdisoshorttz || code == stdnumshorttz
+
+	hh, n := getnum(value[1:], true, 2)
+	if n < 0 {
+		return 0, -1
+	}
+	pos := 3
+	mm := 0
+	ss := 0
+	if !short {
+		if colon {
+			if !hasat(value, pos, ":") {
+				return 0, -1
+			}
+			pos++
+		}
+		mm, n = getnum(value[pos:], true, 2)
+		if n < 0 {
+			return 0, -1
+		}
+		pos += 2
+	}
+	if withsec {
+		if colon {
+			if !hasat(value, pos, ":") {
+				return 0, -1
+			}
+			pos++
+		}
+		ss, n = getnum(value[pos:], true, 2)
+		if n < 0 {
+			return 0, -1
+		}
+		pos += 2
+	}
+	off := (hh*60+mm)*60 + ss
+	if value[0] == '-' {
+		off = -off
+	}
+	return off, pos
+}
+
+// ns, us, µs, μs, ms, s, m, h
+func unitof(u string) Duration {
+	switch u {
+	case "ns":
+		return Nanosecond
+	case "us", "µs", "μs":
+		return Microsecond
+	case "ms":
+		return Millisecond
+	case "s":
+		return Second
+	case "m":
+		return Minute
+	case "h":
+		return Hour
+	}
+	return 0
+}
+
+// a signed sequence of decimals with units, like 300ms, -1.5h or 2h45m.
+// units are ns, us (or µs), ms, s, m and h
+func ParseDuration(s string) (Duration, error) {
+	orig := s
+	neg := false
+	i := 0
+	if s.len > 0 && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		i++
+	}
+	if s.len-i == 1 && s[i] == '0' {
+		return 0, nil
+	}
+	if i == s.len {
+		return 0, xerrors.New("time: invalid duration " + quote(orig))
+	}
+	var d uint64
+	for i < s.len {
+		c := s[i]
+		if c != '.' && (c < '0' || c > '9') {
+			return 0, xerrors.New("time: invalid duration " + quote(orig))
+		}
+		// [0-9]*
+		var v uint64
+		start := i
+		for isdigit(s, i) {
+			if v > 0x8000000000000000/10 {
+				return 0, xerrors.New("time: invalid duration " + quote(orig))
+			}
+			v = v*10 + uint64(s[i]-'0')
+			if v > 0x8000000000000000 {
+				return 0, xerrors.New("time: invalid duration " + quote(orig))
+			}
+			i++
+		}
+		pre := i > start
+		// (\.[0-9]*)?
+		var f uint64
+		scale := 1.0
+		post := false
+		if i < s.len && s[i] == '.' {
+			i++
+			start = i
+			overflow := false
+			for isdigit(s, i) {
+				if !overflow {
+					if f > 0x7fffffffffffffff/10 {
+						overflow = true
+					} else {
+						f = f*10 + uint64(s[i]-'0')
+						scale *= 10
+					}
+				}
+				i++
+			}
+			post = i > start
+		}
+		if !pre && !post {
+			return 0, xerrors.New("time: invalid duration " + quote(orig))
+		}
+
+		start = i
+		for i < s.len && s[i] != '.' && (s[i] < '0' || s[i] > '9') {
+			i++
+		}
+		if i == start {
+			return 0, xerrors.New("time: missing unit in duration " + quote(orig))
+		}
+		u := s[start:i]
+		unit := unitof(u)
+		if unit == 0 {
+			return 0, xerrors.New("time: unknown unit " + quote(u) + " in duration " + quote(orig))
+		}
+		if v > 0x8000000000000000/uint64(unit) {
+			return 0, xerrors.New("time: invalid duration " + quote(orig))
+		}
+		v *= uint64(unit)
+		if f > 0 {
+			// float64 is exact enough, the fraction of an hour is < 3.6e12
+			v += uint64(float64(f) * (float64(unit) / scale))
+			if v > 0x8000000000000000 {
+				return 0, xerrors.New("time: invalid duration " + quote(orig))
+			}
+		}
+		d += v
+		if d > 0x8000000000000000 {
+			return 0, xerrors.New("time: invalid duration " + quote(orig))
+		}
+	}
+	if neg {
+		return Duration(0 - d), nil
+	}
+	if d > 0x7fffffffffffffff {
+		return 0, xerrors.New("time: invalid duration " + quote(orig))
+	}
+	return Duration(d), nil
+}
+
+// like 72h3m0.5s, the leading zero units left out. under a second
+// it is in ms, µs or ns like 1.5µs, and 0 is 0s
+func (d Duration) String() string {
+	buf := make([]byte, 32)
+	w := buf.len
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = 0 - u
+	}
+	if u < uint64(Second) {
+		prec := 0
+		w--
+		buf[w] = 's'
+		w--
+		if u == 0 {
+			buf[w] = '0'
+			part := buf[w:]
+			return string(part)
+		} else if u < uint64(Microsecond) {
+			buf[w] = 'n'
+		} else if u < uint64(Millisecond) {
+			// µ is 0xc2 0xb5
+			prec = 3
+			buf[w] = 0xb5
+			w--
+			buf[w] = 0xc2
+		} else {
+			prec = 6
+			buf[w] = 'm'
+		}
+		w, u = fmtfrac(buf, w, u, prec)
+		w = fmtint(buf, w, u)
+	} else {
+		w--
+		buf[w] = 's'
+		w, u = fmtfrac(buf, w, u, 9)
+		w = fmtint(buf, w, u%60)
+		u /= 60
+		if u > 0 {
+			w--
+			buf[w] = 'm'
+			w = fmtint(buf, w, u%60)
+			u /= 60
+			if u > 0 {
+				w--
+				buf[w] = 'h'
+				w = fmtint(buf, w, u)
+			}
+		}
+	}
+	if neg {
+		w--
+		buf[w] = '-'
+	}
+	part := buf[w:]
+	return string(part)
+}
+
+// the prec digits fraction of v before buf[w], trailing zeros and a
+// bare point left out. the new w and v without the fraction
+func fmtfrac(buf []byte, w int, v uint64, prec int) (int, uint64) {
+	printed := false
+	for i := 0; i < prec; i++ {
+		digit := v % 10
+		printed = printed || digit != 0
+		if printed {
+			w--
+			buf[w] = byte(digit) + '0'
+		}
+		v /= 10
+	}
+	if printed {
+		w--
+		buf[w] = '.'
+	}
+	return w, v
+}
+
+// v in decimal before buf[w], the new w
+func fmtint(buf []byte, w int, v uint64) int {
+	if v == 0 {
+		w--
+		buf[w] = '0'
+		return w
+	}
+	for v > 0 {
+		w--
+		buf[w] = byte(v%10) + '0'
+		v /= 10
+	}
+	return w
+}
@@ -4,179 +4,546 @@ package xtime
 #include <time.h>
 #include <sys/time.h>
 #include <unistd.h>
+#include <stdint.h>
+
+static int64_t xtime_clock(int mono, int64_t* nsec) {
+    struct timespec ts;
+    clock_gettime(mono ? CLOCK_MONOTONIC : CLOCK_REALTIME, &ts);
+    *nsec = ts.tv_nsec;
+    return ts.tv_sec;
+}
+
+// hooked, parks the fiber on a netpoller timer
+static int xtime_sleep(int64_t nsec) {
+    struct timespec ts = {nsec / 1000000000, nsec % 1000000000};
+    return nanosleep(&ts, 0);
+}
 */
 import "C"
 
-// import "xgo/xtime"
+// Instants, durations and calendar, like go's time. A Time has the wall
+// clock and, from Now, a monotonic clock reading, which Sub, Since,
+// Before and After use when both sides have one. Durations are nanoseconds.
+
+type Duration int64
+
+const (
+	Nanosecond  Duration = 1
+	Microsecond Duration = 1000
+	Millisecond Duration = 1000000
+	Second      Duration = 1000000000
+	Minute      Duration = 60000000000
+	Hour        Duration = 3600000000000
+)
+
+const (
+	mindur       = -0x7fffffffffffffff - 1
+	maxdur       = 0x7fffffffffffffff
+	unixtoabs    = 62135596800 // seconds from year 1 to 1970
+	secondsofday = 86400
+)
+
+type Time struct {
+	sec  int64     // since January 1, year 1 UTC, the zero Time
+	nsec int       // [0, 1e9)
+	mono int64     // monotonic clock nsec, 0 if none
+	loc  *Location // nil is UTC
+}
+
+type Month int
 
 const (
-	SEC = 1
-	MS  = 1000
-	US  = 1000 * 1000
-	NS  = 1000 * 1000 * 1000
+	January Month = 1 + iota
+	February
+	March
+	April
+	May
+	June
+	July
+	August
+	September
+	October
+	November
+	December
 )
 
-func Sleep(sec int) int {
-	rv := C.sleep(sec)
-	return rv
+var longmonthnames = []string{"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December"}
+
+func (m Month) String() string {
+	if m >= January && m <= December {
+		return longmonthnames[int(m)-1]
+	}
+	n := int(m)
+	return "%!Month(" + n.repr() + ")"
 }
 
-func Sleepms(msec int) int {
-	var ts0 = &C.struct_timespec{}
-	var ts1 = &C.struct_timespec{}
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+	Wednesday
+	Thursday
+	Friday
+	Saturday
+)
+
+var longdaynames = []string{"Sunday", "Monday", "Tuesday", "Wednesday",
+	"Thursday", "Friday", "Saturday"}
+
+func (d Weekday) String() string {
+	if d >= Sunday && d <= Saturday {
+		return longdaynames[int(d)]
+	}
+	n := int(d)
+	return "%!Weekday(" + n.repr() + ")"
+}
 
-	ts0.tv_sec = msec / MS
-	ts0.tv_nsec = (msec % MS) * US
-	rv := C.nanosleep(ts0, ts1)
-	return rv
+// floor of a/b, b > 0
+func floordiv(a int64, b int64) int64 {
+	q := a / b
+	if a%b < 0 {
+		q--
+	}
+	return q
 }
 
-func Unix() int64 {
-	uts := C.time(0)
-	return int64(uts)
+func isleap(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
 }
 
-type Duration int64
+func daysin(m Month, year int) int {
+	if m == February {
+		if isleap(year) {
+			return 29
+		}
+		return 28
+	}
+	if m == April || m == June || m == September || m == November {
+		return 30
+	}
+	return 31
+}
 
-type Time struct {
-	unix int64 // usec, not the same with Go
-	zone int
+// days since 1970-01-01 of a proleptic gregorian date
+func daysfromcivil(y int64, m int, d int) int64 {
+	if m <= 2 {
+		y--
+	}
+	era := floordiv(y, 400)
+	yoe := y - era*400
+	mp := int64(m + 9)
+	if m > 2 {
+		mp = int64(m - 3)
+	}
+	doy := (153*mp+2)/5 + int64(d) - 1
+	doe := yoe*365 + yoe/4 - yoe/100 + doy
+	return era*146097 + doe - 719468
+}
+
+// the date of days since 1970-01-01
+func civilfromdays(days int64) (int, int, int) {
+	z := days + 719468
+	era := floordiv(z, 146097)
+	doe := z - era*146097
+	yoe := (doe - doe/1460 + doe/36524 - doe/146096) / 365
+	y := yoe + era*400
+	doy := doe - (365*yoe + yoe/4 - yoe/100)
+	mp := (5*doy + 2) / 153
+	d := doy - (153*mp+2)/5 + 1
+	m := mp + 3
+	if mp >= 10 {
+		m = mp - 9
+	}
+	if m <= 2 {
+		y++
+	}
+	return int(y), int(m), int(d)
 }
 
 func Now() *Time {
-	var tv = &C.struct_timeval{}
-	rv := C.gettimeofday(tv, 0)
+	var nsec int64
+	var mnsec int64
+	sec := C.xtime_clock(0, &nsec)
+	msec := C.xtime_clock(1, &mnsec)
+	t := &Time{}
+	t.sec = sec + unixtoabs
+	t.nsec = int(nsec)
+	t.mono = msec*1000000000 + mnsec
+	if t.mono == 0 {
+		t.mono = 1
+	}
+	t.loc = Local
+	return t
+}
+
+// the local Time at sec and nsec since the epoch, nsec may be out of [0, 1e9)
+func Unix(sec int64, nsec int64) *Time {
+	if nsec < 0 || nsec >= 1000000000 {
+		n := floordiv(nsec, 1000000000)
+		sec += n
+		nsec -= n * 1000000000
+	}
+	t := &Time{}
+	t.sec = sec + unixtoabs
+	t.nsec = int(nsec)
+	t.loc = Local
+	return t
+}
+
+func UnixMilli(msec int64) *Time {
+	return Unix(floordiv(msec, 1000), (msec-floordiv(msec, 1000)*1000)*1000000)
+}
+
+func UnixMicro(usec int64) *Time {
+	return Unix(floordiv(usec, 1000000), (usec-floordiv(usec, 1000000)*1000000)*1000)
+}
+
+// the Time of the date in loc. out of range values are normalized,
+// October 32 is November 1
+func Date(year int, month Month, day int, hour int, min int, sec int, nsec int, loc *Location) *Time {
+	m := int(month) - 1
+	year += m / 12
+	m %= 12
+	if m < 0 {
+		m += 12
+		year--
+	}
+	secs := int64(sec) + floordiv(int64(nsec), 1000000000)
+	nsec = int(int64(nsec) - floordiv(int64(nsec), 1000000000)*1000000000)
+	days := daysfromcivil(int64(year), m+1, 1) + int64(day-1)
+	unix := days*secondsofday + int64(hour)*3600 + int64(min)*60 + secs
+
+	// the offset at unix as if it was UTC, then again if that crossed
+	// a transition
+	off := loc.lookup(unix).offset
+	off2 := loc.lookup(unix - int64(off)).offset
+	if off2 != off {
+		off = off2
+	}
 	t := &Time{}
-	sec := tv.tv_sec
-	usec := tv.tv_usec
-	newts := sec*US + usec
-	t.unix = newts
-	t.unix = tv.tv_sec*US + tv.tv_usec
-	if tmzone == -1 {
-		tmzone = zoneno()
-	}
-	t.zone = tmzone
+	t.sec = unix - int64(off) + unixtoabs
+	t.nsec = nsec
+	t.loc = loc
 	return t
 }
 
-var tmzone int = -1
+func (t *Time) unixsec() int64 { return t.sec - unixtoabs }
+
+// seconds since the epoch
+func (t *Time) Unix() int64      { return t.unixsec() }
+func (t *Time) UnixMilli() int64 { return t.unixsec()*1000 + int64(t.nsec/1000000) }
+func (t *Time) UnixMicro() int64 { return t.unixsec()*1000000 + int64(t.nsec/1000) }
+
+// undefined beyond year 2262
+func (t *Time) UnixNano() int64 { return t.unixsec()*1000000000 + int64(t.nsec) }
+
+// the nanosecond in the second
+func (t *Time) Nanosecond() int { return t.nsec }
+
+// January 1, year 1 UTC, like &Time{} and nil
+func (t *Time) IsZero() bool {
+	return t == nil || (t.sec == 0 && t.nsec == 0)
+}
+
+func (t *Time) Location() *Location {
+	if t.loc == nil {
+		return UTC
+	}
+	return t.loc
+}
+
+func (t *Time) setloc(loc *Location) *Time {
+	t2 := &Time{}
+	t2.sec = t.sec
+	t2.nsec = t.nsec
+	t2.loc = loc
+	return t2
+}
+
+// the same instant in loc, without monotonic reading
+func (t *Time) In(loc *Location) *Time { return t.setloc(loc) }
+func (t *Time) UTC() *Time             { return t.setloc(UTC) }
+func (t *Time) Local() *Time           { return t.setloc(Local) }
+
+// the zone name and its offset seconds east of UTC
+func (t *Time) Zone() (string, int) {
+	z := t.loc.lookup(t.unixsec())
+	return z.name, z.offset
+}
+
+// seconds since January 1, year 1 of the wall clock in t's zone
+func (t *Time) abs() int64 {
+	return t.sec + int64(t.loc.lookup(t.unixsec()).offset)
+}
+
+func (t *Time) Date() (int, Month, int) {
+	days := floordiv(t.abs()-unixtoabs, secondsofday)
+	y, m, d := civilfromdays(days)
+	return y, Month(m), d
+}
+
+func (t *Time) Year() int {
+	y, _, _ := t.Date()
+	return y
+}
+
+func (t *Time) Month() Month {
+	_, m, _ := t.Date()
+	return m
+}
+
+func (t *Time) Day() int {
+	_, _, d := t.Date()
+	return d
+}
+
+func (t *Time) Clock() (int, int, int) {
+	abs := t.abs()
+	s := int(abs - floordiv(abs, secondsofday)*secondsofday)
+	return s / 3600, (s % 3600) / 60, s % 60
+}
+
+func (t *Time) Hour() int {
+	h, _, _ := t.Clock()
+	return h
+}
+
+func (t *Time) Minute() int {
+	_, m, _ := t.Clock()
+	return m
+}
+
+func (t *Time) Second() int {
+	_, _, s := t.Clock()
+	return s
+}
+
+func (t *Time) Weekday() Weekday {
+	days := floordiv(t.abs()-unixtoabs, secondsofday)
+	wd := (days + 4) % 7 // 1970-01-01 was a Thursday
+	if wd < 0 {
+		wd += 7
+	}
+	return Weekday(wd)
+}
 
-func zoneno() int {
-	rv := C.timezone
-	return rv
+// day of the year, 1 to 366
+func (t *Time) YearDay() int {
+	days := floordiv(t.abs()-unixtoabs, secondsofday)
+	y, _, _ := civilfromdays(days)
+	return int(days-daysfromcivil(int64(y), 1, 1)) + 1
 }
 
-func (t *Time) Unix() int64 {
-	return t.unix
+func (t *Time) Add(d Duration) *Time {
+	dsec := int64(d / Second)
+	nsec := t.nsec + int(d%Second)
+	if nsec >= 1000000000 {
+		dsec++
+		nsec -= 1000000000
+	} else if nsec < 0 {
+		dsec--
+		nsec += 1000000000
+	}
+	t2 := &Time{}
+	t2.sec = t.sec + dsec
+	t2.nsec = nsec
+	t2.loc = t.loc
+	if t.mono != 0 {
+		t2.mono = t.mono + int64(d)
+	}
+	return t2
+}
+
+// the date plus years, months and days, normalized like Date
+func (t *Time) AddDate(years int, months int, days int) *Time {
+	y, m, d := t.Date()
+	hh, mm, ss := t.Clock()
+	return Date(y+years, m+Month(months), d+days, hh, mm, ss, t.nsec, t.Location())
 }
 
-func (t *Time) Iszero() bool {
-	// sure := ifelse(t != nil && t.unix > 0, false, true) // TODO compiler
-	if t != nil && t.unix > 0 {
-		return false
+// t-u, by the monotonic clock if both have a reading.
+// saturates at the min or max Duration
+func (t *Time) Sub(u *Time) Duration {
+	if t.mono != 0 && u.mono != 0 {
+		return Duration(t.mono - u.mono)
 	}
-	return true
+	dsec := t.sec - u.sec
+	if dsec > 9223372035 || dsec < -9223372035 {
+		if dsec > 0 {
+			return Duration(maxdur)
+		}
+		return Duration(mindur)
+	}
+	return Duration(dsec*1000000000 + int64(t.nsec-u.nsec))
 }
 
-func (t *Time) Since(t2 *Time) Duration {
-	duri := t.unix - t2.unix
-	duro := Duration(duri)
-	return duro
+// Now().Sub(t)
+func Since(t *Time) Duration { return Now().Sub(t) }
+
+// t.Sub(Now())
+func Until(t *Time) Duration { return t.Sub(Now()) }
+
+func (t *Time) After(u *Time) bool {
+	if t.mono != 0 && u.mono != 0 {
+		return t.mono > u.mono
+	}
+	return t.sec > u.sec || (t.sec == u.sec && t.nsec > u.nsec)
 }
 
-func Since(t2 *Time) Duration {
-	t := Now()
-	duri := t.unix - t2.unix
-	duro := Duration(duri)
-	return duro
+func (t *Time) Before(u *Time) bool {
+	if t.mono != 0 && u.mono != 0 {
+		return t.mono < u.mono
+	}
+	return t.sec < u.sec || (t.sec == u.sec && t.nsec < u.nsec)
 }
 
-func (dur Duration) String() string {
-	var dur2 int64 = int64(dur)
-	daydur := int64(3600 * 24 * US)
-	hourdur := int64(3600 * US)
-	mindur := int64(60 * US)
-	secdur := int64(US)
+// the same instant, whatever the locations
+func (t *Time) Equal(u *Time) bool {
+	if t.mono != 0 && u.mono != 0 {
+		return t.mono == u.mono
+	}
+	return t.sec == u.sec && t.nsec == u.nsec
+}
 
-	days := dur2 / daydur
-	hours := (dur2 % daydur) / hourdur
-	mins := (dur2 % hourdur) / mindur
-	secs := (dur2 % mindur) / secdur
-	msecs := (dur2 % secdur) / MS
+// t rounded down to a multiple of d since the zero Time, d <= 0 only
+// drops the monotonic reading
+func (t *Time) Truncate(d Duration) *Time {
+	t2 := t.setloc(t.loc)
+	if d <= 0 {
+		return t2
+	}
+	return t2.Add(-t2.mod(d))
+}
 
-	// TODO reduce allocation
-	var str string
-	seenpfx := false
-	if days > 0 {
-		str += days.repr() + "d"
-		seenpfx = true
+// t rounded to the nearest multiple of d since the zero Time, halfway up
+func (t *Time) Round(d Duration) *Time {
+	t2 := t.setloc(t.loc)
+	if d <= 0 {
+		return t2
 	}
-	if hours > 0 || seenpfx {
-		str += hours.repr() + "h"
-		seenpfx = true
+	r := t2.mod(d)
+	if r+r < d {
+		return t2.Add(-r)
 	}
-	if mins > 0 || seenpfx {
-		str += mins.repr() + "m"
-		seenpfx = true
+	return t2.Add(d - r)
+}
+
+// t since the zero Time modulo d
+func (t *Time) mod(d Duration) Duration {
+	if d%Second == 0 {
+		return Duration(t.sec%int64(d/Second))*Second + Duration(t.nsec)
 	}
-	if secs > 0 || seenpfx {
-		str += secs.repr() + "s"
-		seenpfx = true
+	if Second%d == 0 {
+		return Duration(int64(t.nsec) % int64(d))
 	}
-	if msecs > 0 {
-		str += msecs.repr() + "ms"
+	// sec*1e9+nsec mod d, sec*1e9 overflows int64 for most dates
+	r := mulmod(uint64(t.sec), 1000000000, uint64(d))
+	return Duration((r + uint64(t.nsec)) % uint64(d))
+}
+
+// a*b mod m without overflow
+func mulmod(a uint64, b uint64, m uint64) uint64 {
+	var res uint64
+	a %= m
+	for b > 0 {
+		if (b & 1) != 0 {
+			res = (res + a) % m
+		}
+		a = (a + a) % m
+		b >>= 1
 	}
-	return str
+	return res
 }
 
-func (t *Time) Format(format string) string {
-	return ""
+func (d Duration) Nanoseconds() int64  { return int64(d) }
+func (d Duration) Microseconds() int64 { return int64(d) / 1000 }
+func (d Duration) Milliseconds() int64 { return int64(d) / 1000000 }
+
+func (d Duration) Seconds() float64 {
+	sec := d / Second
+	nsec := d % Second
+	return float64(sec) + float64(nsec)/1e9
 }
 
-// yyyy-mm-dd hh:MM:ss.iii
-func (t *Time) Format1(withms bool) string {
-	return ""
+func (d Duration) Minutes() float64 {
+	min := d / Minute
+	nsec := d % Minute
+	return float64(min) + float64(nsec)/(60*1e9)
 }
 
-func (t *Time) Tostr1() string {
-	var ep usize
-	ep = t.unix / US
+func (d Duration) Hours() float64 {
+	hour := d / Hour
+	nsec := d % Hour
+	return float64(hour) + float64(nsec)/(60*60*1e9)
+}
 
-	// var tmo *C.struct_tm // TODO compiler
-	tmo := C.localtime(&ep)
-	buf := malloc3(32)
-	C.sprintf(buf, "%04d-%02d-%02d %02d:%02d:%02d".ptr,
-		tmo.tm_year+1900, tmo.tm_mon, tmo.tm_mday, tmo.tm_hour, tmo.tm_min, tmo.tm_sec)
-	return gostring(buf)
+// d rounded toward zero to a multiple of m
+func (d Duration) Truncate(m Duration) Duration {
+	if m <= 0 {
+		return d
+	}
+	return d - d%m
 }
 
-// with msec
-func (t *Time) Tostr2() string {
-	var ep int64
-	ep = t.unix / US
-	msec := (t.unix % US) / MS
+// d rounded to the nearest multiple of m, halfway away from zero
+func (d Duration) Round(m Duration) Duration {
+	if m <= 0 {
+		return d
+	}
+	r := d % m
+	if d < 0 {
+		r = -r
+		if r+r < m {
+			return d + r
+		}
+		return d - m + r
+	}
+	if r+r < m {
+		return d - r
+	}
+	return d + m - r
+}
 
-	// var tmo *C.struct_tm // TODO compiler
-	tmo := C.localtime(&ep)
-	buf := malloc3(32)
-	C.sprintf(buf, "%04d-%02d-%02d %02d:%02d:%02d.%03d".ptr,
-		tmo.tm_year+1900, tmo.tm_mon, tmo.tm_mday,
-		tmo.tm_hour, tmo.tm_min, tmo.tm_sec, msec)
-	return gostring(buf)
+// pauses the fiber, or the thread outside fibers
+func Sleep(d Duration) {
+	if d <= 0 {
+		return
+	}
+	C.xtime_sleep(int64(d))
 }
 
-func (t *Time) Toiso() string {
-	var ep usize
-	ep = t.unix / US
+func Sleepms(msec int) {
+	Sleep(Duration(msec) * Millisecond)
+}
 
-	return ""
+// yyyy-mm-dd hh:MM:ss[.iii]
+func (t *Time) Format1(withms bool) string {
+	if withms {
+		return t.Format("2006-01-02 15:04:05.000")
+	}
+	return t.Format("2006-01-02 15:04:05")
 }
 
+// yyyy-mm-dd hh:MM:ss
+func (t *Time) Tostr1() string { return t.Format("2006-01-02 15:04:05") }
+
+// with msec
+func (t *Time) Tostr2() string { return t.Format("2006-01-02 15:04:05.000") }
+
+func (t *Time) Toiso() string { return t.Format(RFC3339Nano) }
+
+// nil if s is no RFC3339 time
 func ParseIso(s string) *Time {
-	return nil
+	t, err := Parse(RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return t
 }
 
-//
 type timeritem struct {
 	// btime   *xtime.Time
 	btime   int64
@@ -221,7 +588,7 @@ func init_timerman_proc() {
 
 func timerman_dotask_proc() {
 	for i := 0; ; i++ {
-		Sleep(1)
+		Sleep(Second)
 		timerman_dotask_proc1()
 	}
 }
@@ -231,7 +598,7 @@ func timerman_dotask_proc1() {
 	nowts := C.time(0)
 	tmrman.lock()
 	for _, item := range tmrman.items {
-		if (item.btime + int64(item.timeout)) >= nowts {
+		if (item.btime + int64(item.timeout/Second)) >= nowts {
 			readys = append(readys, item)
 		} else {
 			lefts = append(lefts, item)
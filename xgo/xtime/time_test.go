@@ -0,0 +1,74 @@
+package xtime
+
+func test_format1() {
+	t := Date(2009, November, 10, 23, 4, 5, 123456789, UTC)
+	println(t.Format(RFC3339))     // 2009-11-10T23:04:05Z
+	println(t.Format(RFC3339Nano)) // 2009-11-10T23:04:05.123456789Z
+	println(t.Format(RFC1123))     // Tue, 10 Nov 2009 23:04:05 UTC
+	println(t.Format(Kitchen))     // 11:04PM
+	println(t.Format(StampMilli))  // Nov 10 23:04:05.123
+	println(t.Tostr1())            // 2009-11-10 23:04:05
+	t = Date(2009, 13, 1, 0, 0, 0, 0, FixedZone("X", -3600))
+	println(t.Format(DateTime + " -07:00 MST")) // 2010-01-01 00:00:00 -01:00 X
+	wd := t.Weekday()
+	println(wd.String(), t.YearDay()) // Friday 1
+}
+
+func test_parse1() {
+	t, err := Parse(RFC3339, "2006-01-02T15:04:05.5+07:00")
+	println(err == nil, t.Unix(), t.Nanosecond()) // true 1136189045 500000000
+	_, offset := t.Zone()
+	println(offset) // 25200
+	t, err = Parse(DateOnly, "2024-02-29")
+	println(err == nil, t.UTC().Format(RFC3339)) // true 2024-02-29T00:00:00Z
+	_, err = Parse(DateOnly, "2023-02-29")
+	println(err.Error()) // parsing time "2023-02-29": day out of range
+	_, err = Parse(RFC3339, "2006-01-02 15:04:05")
+	println(err.Error()) // parsing time "2006-01-02 15:04:05" as "2006-01-02T15:04:05Z07:00": cannot parse " 15:04:05" as "T"
+	println(ParseIso("x") == nil)
+}
+
+func test_location1() {
+	loc, err := LoadLocation("Europe/Berlin")
+	if err != nil {
+		println("no tzdata")
+		return
+	}
+	t := Date(2021, July, 1, 12, 0, 0, 0, loc)
+	println(t.Format(RFC1123Z + " MST")) // Thu, 01 Jul 2021 12:00:00 +0200 CEST
+	t = Date(2021, January, 1, 12, 0, 0, 0, loc)
+	println(t.Format("15:04 MST"), t.UTC().Hour()) // 12:00 CET 11
+	t = Date(2050, July, 1, 12, 0, 0, 0, loc)      // after the last transition
+	println(t.Format("15:04 MST"))                 // 12:00 CEST
+	_, err = LoadLocation("Nowhere/Atlantis")
+	println(err != nil)
+}
+
+func test_duration1() {
+	d, err := ParseDuration("1h15m30.918273645s")
+	println(d.String(), err == nil) // 1h15m30.918273645s true
+	d = 1500 * Microsecond
+	d0 := Duration(0)
+	println(d.String(), d0.String()) // 1.5ms 0s
+	d, _ = ParseDuration("-2.5us")
+	println(d.Nanoseconds(), d.String()) // -2500 -2.5µs
+	_, err = ParseDuration("3x")
+	println(err.Error()) // time: unknown unit "x" in duration "3x"
+	d = 90 * Minute
+	println(d.Hours()) // 1.5
+	d = 1500 * Millisecond
+	d = d.Round(Second)
+	println(d.String()) // 2s
+}
+
+func test_mono1() {
+	t0 := Now()
+	Sleep(20 * Millisecond)
+	d := Since(t0)
+	println(d >= 20*Millisecond, d < Second)
+	t1 := t0.Add(Second)
+	println(t1.Sub(t0) == Second, t0.Before(t1), t1.After(t0))
+	s0 := t0.String()
+	s1 := t0.UTC().String()
+	println(s0.index(" m=+") > 0, s1.index(" m=") < 0) // true true
+}
@@ -0,0 +1,578 @@
+package xtime
+
+/*
+#include <fcntl.h>
+#include <stdlib.h>
+#include <unistd.h>
+*/
+import "C"
+import "xgo/xerrors"
+
+// Time zones from the system tzdata, TZif files of /usr/share/zoneinfo.
+// Instants after the last transition of a file follow the POSIX TZ rule
+// in its footer, like "CET-1CEST,M3.5.0,M10.5.0/3".
+
+type zone struct {
+	name   string // like CET
+	offset int    // seconds east of UTC
+	isdst  bool
+}
+
+type zonetrans struct {
+	when  int64 // unix seconds
+	index int   // into zones
+}
+
+type Location struct {
+	name   string
+	zones  []*zone
+	tx     []*zonetrans
+	extend string // TZ rule for after the last transition
+}
+
+var UTC *Location
+var Local *Location
+
+var utczone *zone
+
+func init() {
+	utczone = &zone{}
+	utczone.name = "UTC"
+	UTC = newlocation("UTC")
+	Local = initlocal()
+}
+
+func newlocation(name string) *Location {
+	l := &Location{}
+	l.name = name
+	l.zones = make([]*zone, 0)
+	l.tx = make([]*zonetrans, 0)
+	return l
+}
+
+func (l *Location) String() string {
+	if l == nil {
+		return "UTC"
+	}
+	return l.name
+}
+
+// always name and offset seconds east of UTC
+func FixedZone(name string, offset int) *Location {
+	l := newlocation(name)
+	z := &zone{}
+	z.name = name
+	z.offset = offset
+	l.zones = append(l.zones, z)
+	return l
+}
+
+// TZ, :TZ, or /etc/localtime if TZ is unset. UTC if none loads
+func initlocal() *Location {
+	tz := C.getenv("TZ".ptr)
+	var l *Location
+	if tz == nil {
+		l = loadzonefile("/etc/localtime", "Local")
+	} else {
+		name := gostring(tz)
+		if name.len > 0 && name[0] == ':' {
+			name = name[1:]
+		}
+		if name.len > 0 && name[0] == '/' {
+			l = loadzonefile(name, "Local")
+		} else if name.len > 0 && name != "UTC" {
+			l, _ = loadzone(name)
+			if l != nil {
+				l.name = "Local"
+			}
+		}
+	}
+	if l == nil {
+		l = newlocation("UTC")
+	}
+	return l
+}
+
+// "" and UTC are UTC, Local is Local, others like Europe/Berlin come
+// from $ZONEINFO or the system tzdata
+func LoadLocation(name string) (*Location, error) {
+	if name.len == 0 || name == "UTC" {
+		return UTC, nil
+	}
+	if name == "Local" {
+		return Local, nil
+	}
+	if name[0] == '/' || name.index("..") >= 0 || name.index("\\") >= 0 {
+		return nil, xerrors.New("time: invalid location name")
+	}
+	l, err := loadzone(name)
+	return l, err
+}
+
+func loadzone(name string) (*Location, error) {
+	dirs := make([]string, 0)
+	envdir := C.getenv("ZONEINFO".ptr)
+	if envdir != nil {
+		dirs = append(dirs, gostring(envdir)+"/")
+	}
+	dirs = append(dirs, "/usr/share/zoneinfo/")
+	dirs = append(dirs, "/usr/share/lib/zoneinfo/")
+	dirs = append(dirs, "/usr/lib/locale/TZ/")
+	dirs = append(dirs, "/etc/zoneinfo/")
+	for _, dir := range dirs {
+		l := loadzonefile(dir+name, name)
+		if l != nil {
+			return l, nil
+		}
+	}
+	return nil, xerrors.New("unknown time zone " + name)
+}
+
+// xos imports xtime, so no xos.ReadFile here
+func readfile(filename string) ([]byte, bool) {
+	res := make([]byte, 0)
+	fd := C.open(filename.ptr, C.O_RDONLY|C.O_CLOEXEC)
+	if fd < 0 {
+		return res, false
+	}
+	buf := make([]byte, 4096)
+	for {
+		n := C.read(fd, buf.ptr, buf.len)
+		if n < 0 {
+			C.close(fd)
+			return res, false
+		}
+		if n == 0 {
+			break
+		}
+		part := buf[:n]
+		res = append(res, part...)
+	}
+	C.close(fd)
+	return res, true
+}
+
+// nil if missing or not TZif
+func loadzonefile(filename string, name string) *Location {
+	data, ok := readfile(filename)
+	if !ok {
+		return nil
+	}
+	return parsetzif(data, name)
+}
+
+// big endian reader of a TZif file
+type tzreader struct {
+	data []byte
+	pos  int
+	bad  bool
+}
+
+func (r *tzreader) byte1() int {
+	if r.pos >= r.data.len {
+		r.bad = true
+		return 0
+	}
+	c := int(r.data[r.pos])
+	r.pos++
+	return c
+}
+
+func (r *tzreader) be32() int64 {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		v = (v << 8) | uint32(r.byte1())
+	}
+	return int64(int32(v))
+}
+
+func (r *tzreader) be64() int64 {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = (v << 8) | uint64(r.byte1())
+	}
+	return int64(v)
+}
+
+func (r *tzreader) skip(n int) {
+	r.pos += n
+	if r.pos > r.data.len {
+		r.bad = true
+	}
+}
+
+func parsetzif(data []byte, name string) *Location {
+	r := &tzreader{}
+	r.data = data
+	if data.len < 44 || data[0] != 'T' || data[1] != 'Z' || data[2] != 'i' || data[3] != 'f' {
+		return nil
+	}
+	version := int(data[4])
+	r.pos = 20
+	isutcnt := int(r.be32())
+	isstdcnt := int(r.be32())
+	leapcnt := int(r.be32())
+	timecnt := int(r.be32())
+	typecnt := int(r.be32())
+	charcnt := int(r.be32())
+
+	timesz := 4
+	if version >= '2' {
+		// skip the 32 bit data, the 64 bit header and data follow
+		r.skip(timecnt*5 + typecnt*6 + charcnt + leapcnt*8 + isstdcnt + isutcnt)
+		r.skip(20)
+		isutcnt = int(r.be32())
+		isstdcnt = int(r.be32())
+		leapcnt = int(r.be32())
+		timecnt = int(r.be32())
+		typecnt = int(r.be32())
+		charcnt = int(r.be32())
+		timesz = 8
+	}
+	if r.bad || typecnt == 0 {
+		return nil
+	}
+
+	l := newlocation(name)
+	for i := 0; i < timecnt; i++ {
+		tx := &zonetrans{}
+		if timesz == 8 {
+			tx.when = r.be64()
+		} else {
+			tx.when = r.be32()
+		}
+		l.tx = append(l.tx, tx)
+	}
+	for i := 0; i < timecnt; i++ {
+		l.tx[i].index = r.byte1()
+	}
+	nameidx := make([]int, typecnt)
+	for i := 0; i < typecnt; i++ {
+		z := &zone{}
+		z.offset = int(r.be32())
+		z.isdst = r.byte1() != 0
+		nameidx[i] = r.byte1()
+		l.zones = append(l.zones, z)
+	}
+	chars := r.pos
+	r.skip(charcnt)
+	if r.bad {
+		return nil
+	}
+	for i, z := range l.zones {
+		start := chars + nameidx[i]
+		end := start
+		for end < chars+charcnt && data[end] != 0 {
+			end++
+		}
+		part := data[start:end]
+		z.name = string(part)
+	}
+	for _, tx := range l.tx {
+		if tx.index >= typecnt {
+			return nil
+		}
+	}
+	r.skip(leapcnt*(timesz+4) + isstdcnt + isutcnt)
+
+	// footer \nTZ\n of version 2+
+	if timesz == 8 && !r.bad && r.pos < data.len && data[r.pos] == '\n' {
+		end := r.pos + 1
+		for end < data.len && data[end] != '\n' {
+			end++
+		}
+		part := data[r.pos+1 : end]
+		l.extend = string(part)
+	}
+	return l
+}
+
+// the zone in effect at unix sec
+func (l *Location) lookup(sec int64) *zone {
+	if l == nil || l.zones.len == 0 {
+		return utczone
+	}
+	if l.tx.len == 0 || sec < l.tx[0].when {
+		if l.tx.len == 0 && l.extend.len > 0 {
+			z, ok := tzset(l.extend, sec)
+			if ok {
+				return z
+			}
+		}
+		// the first standard time zone
+		for _, z := range l.zones {
+			if !z.isdst {
+				return z
+			}
+		}
+		return l.zones[0]
+	}
+
+	// the last transition at or before sec
+	lo := 0
+	hi := l.tx.len
+	for hi-lo > 1 {
+		m := lo + (hi-lo)/2
+		if sec < l.tx[m].when {
+			hi = m
+		} else {
+			lo = m
+		}
+	}
+	if lo == l.tx.len-1 && l.extend.len > 0 {
+		z, ok := tzset(l.extend, sec)
+		if ok {
+			return z
+		}
+	}
+	return l.zones[l.tx[lo].index]
+}
+
+// offset seconds of the zone called name around unix sec. a zone in
+// effect then comes first, EST is both standard and summer time in Sydney
+func (l *Location) lookupname(name string, sec int64) (int, bool) {
+	if l == nil {
+		if name == "UTC" {
+			return 0, true
+		}
+		return 0, false
+	}
+	for _, z := range l.zones {
+		if z.name == name {
+			z2 := l.lookup(sec - int64(z.offset))
+			if z2.name == z.name {
+				return z2.offset, true
+			}
+		}
+	}
+	for _, z := range l.zones {
+		if z.name == name {
+			return z.offset, true
+		}
+	}
+	return 0, false
+}
+
+// POSIX TZ rules, std offset [dst [offset] [,start[/time],end[/time]]]
+type tzparser struct {
+	s   string
+	pos int
+	bad bool
+}
+
+func (p *tzparser) more() bool { return !p.bad && p.pos < p.s.len }
+func (p *tzparser) peek() byte { return p.s[p.pos] }
+
+// CET, or <+03> for names with digits
+func (p *tzparser) name() string {
+	if !p.more() {
+		p.bad = true
+		return ""
+	}
+	start := p.pos
+	if p.peek() == '<' {
+		for p.pos < p.s.len && p.s[p.pos] != '>' {
+			p.pos++
+		}
+		if p.pos >= p.s.len {
+			p.bad = true
+			return ""
+		}
+		p.pos++
+		return p.s[start+1 : p.pos-1]
+	}
+	for p.pos < p.s.len {
+		c := p.s[p.pos]
+		if (c >= '0' && c <= '9') || c == ',' || c == '-' || c == '+' {
+			break
+		}
+		p.pos++
+	}
+	if p.pos-start < 3 {
+		p.bad = true
+		return ""
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *tzparser) num(min int, max int) int {
+	if !p.more() || p.peek() < '0' || p.peek() > '9' {
+		p.bad = true
+		return 0
+	}
+	n := 0
+	for p.more() && p.peek() >= '0' && p.peek() <= '9' {
+		n = n*10 + int(p.peek()-'0')
+		p.pos++
+		if n > max {
+			p.bad = true
+			return 0
+		}
+	}
+	if n < min {
+		p.bad = true
+	}
+	return n
+}
+
+// [+-]hh[:mm[:ss]] in seconds
+func (p *tzparser) offset() int {
+	neg := false
+	if p.more() && (p.peek() == '+' || p.peek() == '-') {
+		neg = p.peek() == '-'
+		p.pos++
+	}
+	off := p.num(0, 24*7) * 3600
+	if p.more() && p.peek() == ':' {
+		p.pos++
+		off += p.num(0, 59) * 60
+		if p.more() && p.peek() == ':' {
+			p.pos++
+			off += p.num(0, 59)
+		}
+	}
+	if neg {
+		return -off
+	}
+	return off
+}
+
+type tzrule struct {
+	kind int // J julian day without Feb 29, D zero based day, M month week day
+	day  int
+	week int
+	mon  int
+	time int // seconds after local midnight
+}
+
+func (p *tzparser) rule() *tzrule {
+	r := &tzrule{}
+	if !p.more() {
+		p.bad = true
+		return r
+	}
+	if p.peek() == 'J' {
+		p.pos++
+		r.kind = 'J'
+		r.day = p.num(1, 365)
+	} else if p.peek() == 'M' {
+		p.pos++
+		r.kind = 'M'
+		r.mon = p.num(1, 12)
+		if !p.more() || p.peek() != '.' {
+			p.bad = true
+			return r
+		}
+		p.pos++
+		r.week = p.num(1, 5)
+		if !p.more() || p.peek() != '.' {
+			p.bad = true
+			return r
+		}
+		p.pos++
+		r.day = p.num(0, 6)
+	} else {
+		r.kind = 'D'
+		r.day = p.num(0, 365)
+	}
+	r.time = 2 * 3600
+	if p.more() && p.peek() == '/' {
+		p.pos++
+		r.time = p.offset()
+	}
+	return r
+}
+
+// seconds after the start of year in UTC when r happens, off is the
+// local offset before it
+func tzruletime(year int, r *tzrule, off int) int {
+	s := 0
+	if r.kind == 'J' {
+		s = (r.day - 1) * 86400
+		if isleap(year) && r.day >= 60 {
+			s += 86400
+		}
+	} else if r.kind == 'D' {
+		s = r.day * 86400
+	} else {
+		// the first day of r.mon, then the wanted weekday in week r.week
+		first := int(daysfromcivil(int64(year), r.mon, 1))
+		dow := (first + 4) % 7 // 1970-01-01 was a Thursday
+		if dow < 0 {
+			dow += 7
+		}
+		d := r.day - dow
+		if d < 0 {
+			d += 7
+		}
+		for i := 1; i < r.week; i++ {
+			if d+7 >= daysin(Month(r.mon), year) {
+				break
+			}
+			d += 7
+		}
+		d += first - int(daysfromcivil(int64(year), 1, 1))
+		s = d * 86400
+	}
+	return s + r.time - off
+}
+
+// the zone of TZ rule s at unix sec
+func tzset(s string, sec int64) (*zone, bool) {
+	p := &tzparser{}
+	p.s = s
+	std := &zone{}
+	std.name = p.name()
+	std.offset = -p.offset() // TZ offsets are west of UTC
+	if p.bad {
+		return nil, false
+	}
+	if !p.more() || p.peek() == ',' {
+		return std, true
+	}
+
+	dst := &zone{}
+	dst.isdst = true
+	dst.name = p.name()
+	dst.offset = std.offset + 3600
+	if p.more() && p.peek() != ',' {
+		dst.offset = -p.offset()
+	}
+	if p.bad {
+		return nil, false
+	}
+	if !p.more() {
+		p.s = ",M3.2.0,M11.1.0" // the default of tzcode
+		p.pos = 0
+	}
+	if p.peek() != ',' && p.peek() != ';' {
+		return nil, false
+	}
+	p.pos++
+	startrule := p.rule()
+	if !p.more() || p.peek() != ',' {
+		return nil, false
+	}
+	p.pos++
+	endrule := p.rule()
+	if p.bad || p.pos != p.s.len {
+		return nil, false
+	}
+
+	days := floordiv(sec, 86400)
+	year, _, _ := civilfromdays(days)
+	ysec := sec - daysfromcivil(int64(year), 1, 1)*86400
+	startsec := int64(tzruletime(year, startrule, std.offset))
+	endsec := int64(tzruletime(year, endrule, dst.offset))
+	if endsec < startsec {
+		// southern hemisphere, dst across the new year
+		if ysec >= endsec && ysec < startsec {
+			return std, true
+		}
+		return dst, true
+	}
+	if ysec >= startsec && ysec < endsec {
+		return dst, true
+	}
+	return std, true
+}